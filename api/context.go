@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/futurehomeno/fimpgo"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow/model"
@@ -65,6 +66,30 @@ type ContextExtRecord struct {
 	Rec model.ContextRecord `json:"rec"`
 }
 
+// HistoryRequest is used by history API commands . From and To are RFC3339 time , Period (1h , 7d) is used if From is not set.
+type HistoryRequest struct {
+	FlowId   string `json:"flow_id"`
+	Name     string `json:"name"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Period   string `json:"period"`
+	MaxCount int    `json:"max_count"`
+	MaxAge   int64  `json:"max_age"`
+}
+
+// AtomicUpdateRequest is used by cmd.flow.ctx_atomic_update , Operation is increment , decrement , cas , append , pop , map_set or map_delete
+type AtomicUpdateRequest struct {
+	FlowId    string         `json:"flow_id"`
+	Name      string         `json:"name"`
+	InMemory  bool           `json:"in_memory"`
+	Operation string         `json:"operation"`
+	Value     model.Variable `json:"value"`
+	Expected  model.Variable `json:"expected"`
+	Key       string         `json:"key"`
+	MaxSize   int            `json:"max_size"`
+	PopLast   bool           `json:"pop_last"`
+}
+
 func (ctx *ContextApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 	ctx.msgTransport = msgTransport
 	ctx.msgTransport.Subscribe("pt:j1/mt:cmd/rt:app/rn:tpflow/ad:1")
@@ -121,6 +146,61 @@ func (ctx *ContextApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 					fimp = fimpgo.NewMessage("evt.flow.ctx_delete_report", "tpflow", "string", "ok", nil, nil, newMsg.Payload)
 
 				}
+			case "cmd.flow.ctx_set_history_policy":
+				req, err := ctx.decodeHistoryRequest(newMsg.Payload)
+				if err == nil {
+					err = ctx.ctx.SetHistoryPolicy(req.FlowId, req.Name, model.HistoryPolicy{MaxCount: req.MaxCount, MaxAge: req.MaxAge})
+				}
+				fimp = newOpReport("evt.flow.ctx_history_policy_report", err, newMsg.Payload)
+
+			case "cmd.flow.ctx_get_history":
+				req, err := ctx.decodeHistoryRequest(newMsg.Payload)
+				var from, to time.Time
+				if err == nil {
+					from, to, err = req.getTimeRange()
+				}
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.ctx_history_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				points, err := ctx.ctx.GetHistory(req.FlowId, req.Name, from, to)
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.ctx_history_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				if points == nil {
+					points = []model.HistoryPoint{}
+				}
+				fimp = fimpgo.NewMessage("evt.flow.ctx_history_report", "tpflow", fimpgo.VTypeObject, points, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.ctx_delete_history":
+				req, err := ctx.decodeHistoryRequest(newMsg.Payload)
+				if err == nil {
+					err = ctx.ctx.DeleteHistory(req.FlowId, req.Name)
+				}
+				fimp = newOpReport("evt.flow.ctx_delete_history_report", err, newMsg.Payload)
+
+			case "cmd.flow.ctx_atomic_update":
+				// Reply contains new value of the variable or popped item
+				req := AtomicUpdateRequest{}
+				err := json.Unmarshal(newMsg.Payload.GetRawObjectValue(), &req)
+				if err == nil && req.Name == "" {
+					err = errors.New("variable name is not set")
+				}
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.ctx_atomic_update_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				if req.FlowId == "" || req.FlowId == "-" {
+					req.FlowId = "global"
+				}
+				op := model.AtomicOperation{Type: req.Operation, Value: req.Value, Expected: req.Expected, Key: req.Key, MaxSize: req.MaxSize, PopLast: req.PopLast}
+				result, err := ctx.ctx.ExecuteAtomicOperation(req.Name, req.FlowId, req.InMemory, op)
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.ctx_atomic_update_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				fimp = fimpgo.NewMessage("evt.flow.ctx_atomic_update_report", "tpflow", fimpgo.VTypeObject, result, nil, nil, newMsg.Payload)
 			}
 
 			if fimp != nil {
@@ -133,3 +213,44 @@ func (ctx *ContextApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 
 
 }
+
+func (ctx *ContextApi) decodeHistoryRequest(payload *fimpgo.FimpMessage) (HistoryRequest, error) {
+	req := HistoryRequest{}
+	if err := json.Unmarshal(payload.GetRawObjectValue(), &req); err != nil {
+		log.Error("<ctx> Can't unmarshal history request")
+		return req, err
+	}
+	if req.FlowId == "" || req.FlowId == "-" {
+		req.FlowId = "global"
+	}
+	if req.Name == "" {
+		return req, errors.New("variable name is not set")
+	}
+	return req, nil
+}
+
+func (req *HistoryRequest) getTimeRange() (from time.Time, to time.Time, err error) {
+	if req.From != "" {
+		if from, err = time.Parse(time.RFC3339, req.From); err != nil {
+			return
+		}
+	} else if req.Period != "" {
+		var period time.Duration
+		if period, err = model.ParsePeriod(req.Period); err != nil {
+			return
+		}
+		from = time.Now().Add(-period)
+	}
+	if req.To != "" {
+		to, err = time.Parse(time.RFC3339, req.To)
+	}
+	return
+}
+
+// newOpReport creates report with ok or error text
+func newOpReport(msgType string, err error, request *fimpgo.FimpMessage) *fimpgo.FimpMessage {
+	if err != nil {
+		return fimpgo.NewMessage(msgType, "tpflow", "string", err.Error(), nil, nil, request)
+	}
+	return fimpgo.NewMessage(msgType, "tpflow", "string", "ok", nil, nil, request)
+}
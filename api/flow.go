@@ -7,6 +7,8 @@ import (
 	"github.com/futurehomeno/fimpgo/fimptype"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/connector"
+	connmodel "github.com/thingsplex/tpflow/connector/model"
 	"github.com/thingsplex/tpflow/connector/plugins"
 	"github.com/thingsplex/tpflow/flow"
 	"github.com/thingsplex/tpflow/model"
@@ -16,6 +18,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,6 +28,14 @@ type FlowApi struct {
 	config       *tpflow.Configs
 }
 
+// ConnectorOpReport is a response to connector create , update , delete and test commands
+type ConnectorOpReport struct {
+	ID      string
+	State   string // state reported by connector after the operation
+	Success bool
+	Error   string
+}
+
 func NewFlowApi(flowManager *flow.Manager, config *tpflow.Configs) *FlowApi {
 	ctxApi := FlowApi{flowManager: flowManager, config:config}
 	//ctxApi.RegisterRestApi()
@@ -147,6 +158,9 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 
 	apiCh := make(fimpgo.MessageCh, 10)
 	ctx.msgTransport.RegisterChannel("flow-api",apiCh)
+	connectorEvents := make(chan connector.StateChangeEvent, 20)
+	ctx.flowManager.GetConnectorRegistry().SubscribeToStateChanges("flow-api", connectorEvents)
+	go ctx.publishConnectorStateEvents(connectorEvents)
 	var fimp *fimpgo.FimpMessage
 	go func() {
 		for {
@@ -183,6 +197,39 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 				resp := ctx.flowManager.GetConnectorRegistry().GetAllInstances()
 				fimp = fimpgo.NewMessage("evt.flow.connector_instances_report", "tpflow", "object", resp, nil, nil, newMsg.Payload)
 
+			case "cmd.flow.connector_create", "cmd.flow.connector_update", "cmd.flow.connector_test":
+				reportType := strings.Replace(newMsg.Payload.Type, "cmd.flow.", "evt.flow.", 1) + "_report"
+				inst := connmodel.Instance{}
+				err := json.Unmarshal(newMsg.Payload.GetRawObjectValue(), &inst)
+				if err == nil {
+					switch newMsg.Payload.Type {
+					case "cmd.flow.connector_create":
+						err = ctx.flowManager.CreateConnectorInstance(&inst)
+					case "cmd.flow.connector_update":
+						err = ctx.flowManager.UpdateConnectorInstance(inst)
+					}
+				}
+				resp := ConnectorOpReport{ID: inst.ID}
+				if newMsg.Payload.Type == "cmd.flow.connector_test" && err == nil {
+					resp.State, err = ctx.flowManager.GetConnectorRegistry().TestInstance(inst)
+				} else if connInst := ctx.flowManager.GetConnectorRegistry().GetInstance(inst.ID); connInst != nil && connInst.Connection != nil {
+					resp.State = connInst.Connection.GetState()
+				}
+				resp.Success = err == nil
+				if err != nil {
+					resp.Error = err.Error()
+				}
+				fimp = fimpgo.NewMessage(reportType, "tpflow", "object", resp, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.connector_delete":
+				id, _ := newMsg.Payload.GetStringValue()
+				resp := ConnectorOpReport{ID: id, Success: true}
+				if err := ctx.flowManager.DeleteConnectorInstance(id); err != nil {
+					resp.Success = false
+					resp.Error = err.Error()
+				}
+				fimp = fimpgo.NewMessage("evt.flow.connector_delete_report", "tpflow", "object", resp, nil, nil, newMsg.Payload)
+
 			case "cmd.flow.update_definition":
 				flowMeta := model.FlowMeta{}
 				flowJsonDef := newMsg.Payload.GetRawObjectValue()
@@ -192,8 +239,65 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 					fimp = fimpgo.NewMessage("evt.flow.update_report", "tpflow", "string", err, nil, nil, newMsg.Payload)
 					break
 				}
-				ctx.flowManager.UpdateFlowFromBinJson(flowMeta.Id, flowJsonDef)
-				fimp = fimpgo.NewMessage("evt.flow.update_report", "tpflow", "string", "ok", nil, nil, newMsg.Payload)
+				resp := "ok"
+				if err = ctx.flowManager.UpdateFlowFromBinJson(flowMeta.Id, flowJsonDef); err != nil {
+					resp = err.Error()
+				}
+				fimp = fimpgo.NewMessage("evt.flow.update_report", "tpflow", "string", resp, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.validate":
+				flowMeta := model.FlowMeta{}
+				err := json.Unmarshal(newMsg.Payload.GetRawObjectValue(), &flowMeta)
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.validation_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				report := flow.Validate(flowMeta)
+				fimp = fimpgo.NewMessage("evt.flow.validation_report", "tpflow", "object", report, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.get_revisions":
+				id, _ := newMsg.Payload.GetStringValue()
+				revisions, err := ctx.flowManager.GetFlowRevisions(id)
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.revisions_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				fimp = fimpgo.NewMessage("evt.flow.revisions_report", "tpflow", "object", revisions, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.diff_revisions":
+				val, err := newMsg.Payload.GetStrMapValue()
+				if err != nil {
+					log.Error("<api> Wrong diff_revisions params , error = ", err)
+					break
+				}
+				fromVersion, err1 := strconv.Atoi(val["from"])
+				toVersion, err2 := strconv.Atoi(val["to"])
+				if err1 != nil || err2 != nil {
+					fimp = fimpgo.NewMessage("evt.flow.revisions_diff_report", "tpflow", "string", "wrong version format", nil, nil, newMsg.Payload)
+					break
+				}
+				diff, err := ctx.flowManager.DiffFlowRevisions(val["id"], fromVersion, toVersion)
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.revisions_diff_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				fimp = fimpgo.NewMessage("evt.flow.revisions_diff_report", "tpflow", "object", diff, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.rollback":
+				resp := "ok"
+				val, err := newMsg.Payload.GetStrMapValue()
+				if err != nil {
+					log.Error("<api> Wrong rollback params , error = ", err)
+					break
+				}
+				version, err := strconv.Atoi(val["version"])
+				if err == nil {
+					err = ctx.flowManager.RollbackFlow(val["id"], version)
+				}
+				if err != nil {
+					resp = err.Error()
+				}
+				fimp = fimpgo.NewMessage("evt.flow.rollback_report", "tpflow", "string", resp, nil, nil, newMsg.Payload)
 
 			case "cmd.flow.import":
 				resp := "ok"
@@ -246,6 +350,28 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 				}
 				fimp = fimpgo.NewMessage("evt.flow.ctr_report", "tpflow", "string", resp, nil, nil, newMsg.Payload)
 
+			case "cmd.flow.get_dead_letters":
+				flowId, _ := newMsg.Payload.GetStringValue()
+				resp := ctx.flowManager.GetDeadLetters(flowId)
+				fimp = fimpgo.NewMessage("evt.flow.dead_letters_report", "tpflow", "object", resp, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.replay_dead_letter":
+				resp := "ok"
+				id, err := newMsg.Payload.GetStringValue()
+				if err == nil {
+					err = ctx.flowManager.ReplayDeadLetter(id)
+				}
+				if err != nil {
+					resp = err.Error()
+				}
+				fimp = fimpgo.NewMessage("evt.flow.dead_letter_replay_report", "tpflow", "string", resp, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.delete_dead_letter":
+				// Empty id deletes all messages
+				id, _ := newMsg.Payload.GetStringValue()
+				ctx.flowManager.DeleteDeadLetter(id)
+				fimp = fimpgo.NewMessage("evt.flow.dead_letter_delete_report", "tpflow", "string", "ok", nil, nil, newMsg.Payload)
+
 			case "cmd.flow.delete":
 				resp := "ok"
 				id,err := newMsg.Payload.GetStringValue()
@@ -338,6 +464,59 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 				result := utils.GetLogs(ctx.config.LogFile,&filter,limit)
 				fimp = fimpgo.NewMessage("evt.flow.log_report", "tpflow", "object", result, nil, nil, newMsg.Payload)
 
+			case "cmd.flow.get_trace":
+				val, err := newMsg.Payload.GetStrMapValue()
+				if err != nil {
+					log.Error("<api> Can't get trace , wrong params , error = ", err)
+					break
+				}
+				fl := ctx.flowManager.GetFlowById(val["flowId"])
+				if fl == nil {
+					fimp = fimpgo.NewMessage("evt.flow.trace_report", "tpflow", "string", "unknown flow", nil, nil, newMsg.Payload)
+					break
+				}
+				instanceId, _ := strconv.ParseInt(val["instanceId"], 10, 32)
+				result := fl.GetTraces(int32(instanceId))
+				fimp = fimpgo.NewMessage("evt.flow.trace_report", "tpflow", "object", result, nil, nil, newMsg.Payload)
+
+			case "cmd.flow.trace_ctrl":
+				val, err := newMsg.Payload.GetStrMapValue()
+				if err != nil {
+					log.Error("<api> Wrong trace_ctrl params , error = ", err)
+					break
+				}
+				fl := ctx.flowManager.GetFlowById(val["flowId"])
+				if fl == nil {
+					fimp = fimpgo.NewMessage("evt.flow.trace_ctrl_report", "tpflow", "string", "unknown flow", nil, nil, newMsg.Payload)
+					break
+				}
+				instanceId, _ := strconv.ParseInt(val["instanceId"], 10, 32)
+				switch val["op"] {
+				case "enable":
+					fl.EnableTrace(true)
+				case "disable":
+					fl.EnableTrace(false)
+				case "clear":
+					fl.ClearTraces()
+				case "set_breakpoints":
+					var breakpoints []model.NodeID
+					for _, nodeId := range strings.Split(val["breakpoints"], ",") {
+						if nodeId = strings.TrimSpace(nodeId); nodeId != "" {
+							breakpoints = append(breakpoints, model.NodeID(nodeId))
+						}
+					}
+					fl.SetBreakpoints(breakpoints)
+				case "step":
+					err = fl.StepInstance(int32(instanceId))
+				case "continue":
+					err = fl.ContinueInstance(int32(instanceId))
+				}
+				if err != nil {
+					fimp = fimpgo.NewMessage("evt.flow.trace_ctrl_report", "tpflow", "string", err.Error(), nil, nil, newMsg.Payload)
+					break
+				}
+				fimp = fimpgo.NewMessage("evt.flow.trace_ctrl_report", "tpflow", "object", fl.GetDebuggerState(), nil, nil, newMsg.Payload)
+
 			case "cmd.flow.run_gc":
 				log.Info("Running GC")
 				runtime.GC()
@@ -438,6 +617,17 @@ func (ctx *FlowApi) RegisterMqttApi(msgTransport *fimpgo.MqttTransport) {
 
 }
 
+// publishConnectorStateEvents publishes evt.connector.state_report when connector instance goes up or down
+func (ctx *FlowApi) publishConnectorStateEvents(events chan connector.StateChangeEvent) {
+	addr := fimpgo.Address{MsgType: fimpgo.MsgTypeEvt, ResourceType: fimpgo.ResourceTypeApp, ResourceName: "tpflow", ResourceAddress: "1"}
+	for event := range events {
+		msg := fimpgo.NewMessage("evt.connector.state_report", "tpflow", "object", event, nil, nil, nil)
+		if err := ctx.msgTransport.Publish(&addr, msg); err != nil {
+			log.Error("<api> Can't publish connector state report . Err:", err)
+		}
+	}
+}
+
 type ImportFlowFromUrlRequest struct {
 	Url   string
 	Token string
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/flow"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MetricsApi exposes flow , node and connector statistics over HTTP in Prometheus text format.
+type MetricsApi struct {
+	flowManager *flow.Manager
+	config      *tpflow.Configs
+	server      *http.Server
+}
+
+func NewMetricsApi(flowManager *flow.Manager, config *tpflow.Configs) *MetricsApi {
+	return &MetricsApi{flowManager: flowManager, config: config}
+}
+
+// Start starts HTTP listener on MetricsListenAddress , metrics are served on /metrics path . The method does nothing if
+// the address is not configured.
+func (api *MetricsApi) Start() {
+	if api.config.MetricsListenAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", api.ServeHTTP)
+	api.server = &http.Server{Addr: api.config.MetricsListenAddress, Handler: mux}
+	log.Info("<MetricsApi> Starting metrics endpoint on ", api.config.MetricsListenAddress)
+	go func() {
+		if err := api.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("<MetricsApi> Metrics endpoint failed . Err:", err)
+		}
+	}()
+}
+
+func (api *MetricsApi) Stop() {
+	if api.server != nil {
+		api.server.Close()
+	}
+}
+
+func (api *MetricsApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(api.GenerateMetrics())
+}
+
+// GenerateMetrics returns all metrics in Prometheus text exposition format
+func (api *MetricsApi) GenerateMetrics() []byte {
+	var buf bytes.Buffer
+	flows := api.flowManager.GetFlowMetrics()
+
+	writeHeader(&buf, "tpflow_flow_triggers_total", "counter", "Number of flow instances started by triggers.")
+	for _, fl := range flows {
+		writeSample(&buf, "tpflow_flow_triggers_total", flowLabels(fl), float64(fl.TriggerCounter))
+	}
+	writeHeader(&buf, "tpflow_flow_errors_total", "counter", "Number of node execution errors.")
+	for _, fl := range flows {
+		writeSample(&buf, "tpflow_flow_errors_total", flowLabels(fl), float64(fl.ErrorCounter))
+	}
+	writeHeader(&buf, "tpflow_flow_running_instances", "gauge", "Number of currently running flow instances.")
+	for _, fl := range flows {
+		writeSample(&buf, "tpflow_flow_running_instances", flowLabels(fl), float64(fl.RunningInstances))
+	}
+	writeHeader(&buf, "tpflow_flow_state", "gauge", "Current flow state.")
+	for _, fl := range flows {
+		writeSample(&buf, "tpflow_flow_state", append(flowLabels(fl), "state", fl.State), 1)
+	}
+
+	writeHeader(&buf, "tpflow_node_execution_seconds", "histogram", "Node execution latency.")
+	for _, fl := range flows {
+		for _, node := range fl.Nodes {
+			if node.ExecutionCounter == 0 {
+				continue
+			}
+			labels := append(flowLabels(fl), "node_id", string(node.NodeId), "node_type", node.NodeType)
+			var cumulative uint64
+			for i, counter := range node.BucketCounters {
+				cumulative += counter
+				le := "+Inf"
+				if i < len(flow.NodeLatencyBuckets) {
+					le = strconv.FormatFloat(flow.NodeLatencyBuckets[i], 'g', -1, 64)
+				}
+				writeSample(&buf, "tpflow_node_execution_seconds_bucket", append(labels, "le", le), float64(cumulative))
+			}
+			writeSample(&buf, "tpflow_node_execution_seconds_sum", labels, node.LatencySum)
+			writeSample(&buf, "tpflow_node_execution_seconds_count", labels, float64(node.ExecutionCounter))
+		}
+	}
+
+	writeHeader(&buf, "tpflow_trigger_messages_received_total", "counter", "Number of MQTT messages received by trigger node.")
+	for _, fl := range flows {
+		for _, node := range fl.Nodes {
+			if !node.IsTrigger {
+				continue
+			}
+			labels := append(flowLabels(fl), "node_id", string(node.NodeId), "node_type", node.NodeType)
+			writeSample(&buf, "tpflow_trigger_messages_received_total", labels, float64(node.ReceivedMessages))
+		}
+	}
+
+	writeHeader(&buf, "tpflow_node_retries_total", "counter", "Number of node execution retries done by retry policy.")
+	for _, fl := range flows {
+		for _, node := range fl.Nodes {
+			if node.RetryCounter == 0 {
+				continue
+			}
+			labels := append(flowLabels(fl), "node_id", string(node.NodeId), "node_type", node.NodeType)
+			writeSample(&buf, "tpflow_node_retries_total", labels, float64(node.RetryCounter))
+		}
+	}
+
+	writeHeader(&buf, "tpflow_connector_state", "gauge", "Current state of connector instance.")
+	for _, inst := range api.flowManager.GetConnectorRegistry().GetAllInstances() {
+		writeSample(&buf, "tpflow_connector_state", []string{"id", inst.ID, "name", inst.Name, "plugin", inst.Plugin, "state", inst.State}, 1)
+	}
+	return buf.Bytes()
+}
+
+func flowLabels(fl flow.FlowMetrics) []string {
+	return []string{"flow_id", fl.FlowId, "flow_name", fl.FlowName}
+}
+
+func writeHeader(buf *bytes.Buffer, name string, metricType string, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample writes single sample , labels is a list of name , value pairs
+func writeSample(buf *bytes.Buffer, name string, labels []string, value float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
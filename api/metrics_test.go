@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/flow"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/data/setvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsApi_GenerateMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := tpflow.Configs{ContextStorageDir: filepath.Join(dir, "context.db"), FlowStorageDir: dir, ConnectorStorageDir: dir}
+	man, err := flow.NewManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+	man.AddMetaFlowToRegistry(model.FlowMeta{Id: "metrics", Name: `Metrics "test"`, Nodes: []model.MetaNode{
+		{Id: "1", Type: "set_variable", Config: setvar.SetVariableNodeConfig{Name: "var_1", IsVariableInMemory: true,
+			DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+	}})
+	man.StartFlow("metrics")
+	fl := man.GetFlowById("metrics")
+	for i := 0; i < 2; i++ {
+		fl.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	text := string(NewMetricsApi(man, &config).GenerateMetrics())
+	labels := `flow_id="metrics",flow_name="Metrics \"test\""`
+	expected := []string{
+		"# HELP tpflow_flow_triggers_total Number of flow instances started by triggers.",
+		"# TYPE tpflow_flow_triggers_total counter",
+		"tpflow_flow_triggers_total{" + labels + "} 2",
+		"tpflow_flow_errors_total{" + labels + "} 0",
+		"tpflow_flow_running_instances{" + labels + "} 0",
+		"tpflow_flow_state{" + labels + `,state="RUNNING"} 1`,
+		"# TYPE tpflow_node_execution_seconds histogram",
+		"tpflow_node_execution_seconds_bucket{" + labels + `,node_id="1",node_type="set_variable",le="+Inf"} 2`,
+		"tpflow_node_execution_seconds_count{" + labels + `,node_id="1",node_type="set_variable"} 2`,
+	}
+	lines := strings.Split(text, "\n")
+	for _, line := range expected {
+		found := false
+		for i := range lines {
+			if lines[i] == line {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Line %s not found in :\n%s", line, text)
+		}
+	}
+	// Every line must be a comment or a sample in Prometheus text format
+	sample := regexp.MustCompile(`^[a-z_]+(\{([a-z_]+="([^"\\]|\\.)*",?)+\})? [-+0-9.eInf]+$`)
+	for _, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "# HELP ") && !strings.HasPrefix(line, "# TYPE ") && !sample.MatchString(line) {
+			t.Error("Invalid line : ", line)
+		}
+	}
+	fl.Stop()
+}
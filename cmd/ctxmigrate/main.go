@@ -0,0 +1,51 @@
+// ctxmigrate copies flow context (variables , history , runtime state) between storage backends and encodings.
+// tpflow must be stopped while migration is running.
+//
+//	ctxmigrate -src ./var/flow_storage/context.db -dst ./var/flow_storage/context.sqlite -dst-type sqlite -encoding json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/thingsplex/tpflow/model"
+	"os"
+	"strings"
+)
+
+func main() {
+	var srcType, srcLocation, dstType, dstLocation, encoding string
+	backends := strings.Join(model.StorageBackendTypes(), " , ")
+	flag.StringVar(&srcType, "src-type", model.StorageBolt, "Source storage type : "+backends)
+	flag.StringVar(&srcLocation, "src", "", "Source storage location")
+	flag.StringVar(&dstType, "dst-type", model.StorageBolt, "Destination storage type : "+backends)
+	flag.StringVar(&dstLocation, "dst", "", "Destination storage location")
+	flag.StringVar(&encoding, "encoding", model.EncodingGob, "Encoding of variables in destination storage : gob , json")
+	flag.Parse()
+	if srcLocation == "" || dstLocation == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if srcType == dstType && srcLocation == dstLocation {
+		exit("Source and destination must be different")
+	}
+	src, err := model.OpenStorageBackend(srcType, srcLocation)
+	if err != nil {
+		exit("Can't open source storage : %s", err)
+	}
+	defer src.Close()
+	dst, err := model.OpenStorageBackend(dstType, dstLocation)
+	if err != nil {
+		exit("Can't open destination storage : %s", err)
+	}
+	defer dst.Close()
+	counter, err := model.MigrateStorage(src, dst, encoding)
+	if err != nil {
+		exit("Migration failed after %d items : %s", counter, err)
+	}
+	fmt.Printf("Migrated %d items from %s (%s) to %s (%s) , encoding %s\n", counter, srcLocation, srcType, dstLocation, dstType, encoding)
+}
+
+func exit(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -109,6 +109,8 @@ func main() {
 	ctxApi := fapi.NewContextApi(flowManager.GetGlobalContext())
 	flowApi := fapi.NewFlowApi(flowManager, &configs)
 	regApi := fapi.NewRegistryApi(registry)
+	metricsApi := fapi.NewMetricsApi(flowManager, &configs)
+	metricsApi.Start()
 
 	apiMqttTransport,err := InitApiMqttTransport(configs)
 
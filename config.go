@@ -16,4 +16,11 @@ type Configs struct {
 	LogLevel              string `json:"log_level"`
 	LogFormat             string `json:"log_format"`
 	IsDevMode             bool   `json:"is_dev_mode"`
+	MetricsListenAddress  string `json:"metrics_listen_address"`  // HTTP address of Prometheus metrics endpoint , for instance :9090 . Empty - disabled
+	WebhookListenAddress  string `json:"webhook_listen_address"`  // HTTP address of embedded webhook server , for instance :8085 . Empty - disabled
+	ErrorHandlerFlowId    string `json:"error_handler_flow_id"`   // Default flow invoked on unhandled node errors . Empty - disabled
+	DeadLetterStoreSize   int    `json:"dead_letter_store_size"`  // Max number of failed messages kept in dead-letter store , default - 100
+	ContextSweepInterval  int    `json:"context_sweep_interval"`  // Interval in seconds between removals of expired context variables , default - 10
+	ContextStorageBackend string `json:"context_storage_backend"` // bolt (default) , sqlite or memory . sqlite requires build with sqlite tag
+	ContextEncoding       string `json:"context_encoding"`        // Encoding of stored variables , gob (default) or json
 }
@@ -2,13 +2,17 @@ package connector
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow/connector/model"
 	"github.com/thingsplex/tpflow/connector/plugins"
 	"github.com/thingsplex/tpflow/utils"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // Adapter instance has to be created from Flow manager .
@@ -16,24 +20,29 @@ import (
 
 type Registry struct {
 	instances  []*model.Instance
+	files      map[string]string // instance id -> config file
 	configsDir string
+	supervisor *supervisor
+	mtx        sync.RWMutex
 }
 
 func NewRegistry(configDir string) *Registry {
-	reg := Registry{configsDir: configDir}
+	reg := Registry{configsDir: configDir, files: map[string]string{}, supervisor: newSupervisor()}
 	return &reg
 }
 
 // Adds existing connection as connector instance into the registry
 func (reg *Registry) AddConnection(id string, name string, connType string, conn model.ConnInterface) {
 	inst := model.Instance{ID: id, Name: name, Plugin: connType, Connection: conn}
-	reg.instances = append(reg.instances, &inst)
+	reg.AddInstance(&inst)
 }
 
 // Adds existing instance to registry
 func (reg *Registry) AddInstance(inst *model.Instance) {
+	reg.mtx.Lock()
 	reg.instances = append(reg.instances, inst)
-	log.Info("<ConnRegistry> Instance was added , id = %s , name = %s ", inst.ID, inst.Name)
+	reg.mtx.Unlock()
+	log.Infof("<ConnRegistry> Instance was added , id = %s , name = %s ", inst.ID, inst.Name)
 }
 
 // Creates instance of connector using one of registered plugins
@@ -44,14 +53,142 @@ func (reg *Registry) CreateInstance(id string, name string, plugin string, confi
 			id = utils.GenerateId(15)
 		}
 		connInstance := connPlugin.Constructor(name, config)
-		reg.AddConnection(id, name, plugin, connInstance)
+		reg.AddInstance(&model.Instance{ID: id, Name: name, Plugin: plugin, Connection: connInstance, Config: config})
 		return connInstance
 	}
 	return nil
 }
 
+// CreateAndSaveInstance creates new instance of connector and stores its configuration in connector storage directory .
+// Generated id is set into inst.
+func (reg *Registry) CreateAndSaveInstance(inst *model.Instance) error {
+	if plugins.GetPlugin(inst.Plugin) == nil {
+		return fmt.Errorf("unknown connector plugin %s", inst.Plugin)
+	}
+	if inst.ID == "" {
+		inst.ID = utils.GenerateId(15)
+	} else if reg.GetInstance(inst.ID) != nil {
+		return fmt.Errorf("connector instance %s already exists", inst.ID)
+	}
+	reg.CreateInstance(inst.ID, inst.Name, inst.Plugin, inst.Config)
+	return reg.SaveInstanceToDisk(inst.ID)
+}
+
+// UpdateInstance stops running connection , re-initializes it with new configuration and stores configuration on disk .
+// Configuration is saved even if connection can't be initialized , init error is returned.
+func (reg *Registry) UpdateInstance(id string, name string, config interface{}) error {
+	inst := reg.GetInstance(id)
+	if inst == nil {
+		return fmt.Errorf("connector instance %s doesn't exist", id)
+	}
+	if plugins.GetPlugin(inst.Plugin) == nil {
+		return fmt.Errorf("connector instance %s can't be modified", id)
+	}
+	log.Infof("<ConnRegistry> Updating instance , id = %s , name = %s ", id, name)
+	inst.Connection.Stop()
+	if err := inst.Connection.LoadConfig(config); err != nil {
+		return err
+	}
+	reg.mtx.Lock()
+	inst.Name = name
+	inst.Config = config
+	reg.mtx.Unlock()
+	initErr := inst.Connection.Init()
+	if err := reg.SaveInstanceToDisk(id); err != nil {
+		return err
+	}
+	return initErr
+}
+
+// DeleteInstance stops connection , removes instance from registry and deletes its configuration file
+func (reg *Registry) DeleteInstance(id string) error {
+	inst := reg.GetInstance(id)
+	if inst == nil {
+		return fmt.Errorf("connector instance %s doesn't exist", id)
+	}
+	if plugins.GetPlugin(inst.Plugin) == nil {
+		return fmt.Errorf("connector instance %s can't be deleted", id)
+	}
+	inst.Connection.Stop()
+	reg.mtx.Lock()
+	for i := range reg.instances {
+		if reg.instances[i].ID == id {
+			reg.instances = append(reg.instances[:i], reg.instances[i+1:]...)
+			break
+		}
+	}
+	fileName := reg.getInstanceFileName(id)
+	delete(reg.files, id)
+	reg.mtx.Unlock()
+	reg.supervisor.forget(id)
+	log.Infof("<ConnRegistry> Instance was deleted , id = %s ", id)
+	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// TestInstance checks configuration from inst and returns state of the probe connection .
+// Plugins with Tester are probed without touching running instances . Other plugins are constructed with a temporary name ,
+// which opens a real connection (or listener) for the duration of the test.
+// If configuration is not set , state of existing instance with the same id is returned.
+func (reg *Registry) TestInstance(inst model.Instance) (string, error) {
+	if inst.Config == nil {
+		existing := reg.GetInstance(inst.ID)
+		if existing == nil {
+			return "", fmt.Errorf("connector instance %s doesn't exist", inst.ID)
+		}
+		return existing.Connection.GetState(), nil
+	}
+	connPlugin := plugins.GetPlugin(inst.Plugin)
+	if connPlugin == nil {
+		return "", fmt.Errorf("unknown connector plugin %s", inst.Plugin)
+	}
+	if connPlugin.Tester != nil {
+		return connPlugin.Tester(inst.Config)
+	}
+	conn := connPlugin.Constructor("test_"+inst.Name, inst.Config)
+	state := conn.GetState()
+	conn.Stop()
+	return state, nil
+}
+
+// SaveInstanceToDisk stores instance configuration in connector storage directory
+func (reg *Registry) SaveInstanceToDisk(id string) error {
+	inst := reg.GetInstance(id)
+	if inst == nil {
+		return fmt.Errorf("connector instance %s doesn't exist", id)
+	}
+	if reg.configsDir == "" {
+		return errors.New("connector storage directory is not set")
+	}
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+	data, err := json.MarshalIndent(inst, "", "  ")
+	if err != nil {
+		return err
+	}
+	fileName := reg.getInstanceFileName(id)
+	if err = ioutil.WriteFile(fileName, data, 0644); err != nil {
+		log.Error("<ConnRegistry> Can't save connector config file . Err:", err)
+		return err
+	}
+	reg.files[id] = fileName
+	return nil
+}
+
+// getInstanceFileName returns file instance was loaded from or default file name
+func (reg *Registry) getInstanceFileName(id string) string {
+	if fileName, ok := reg.files[id]; ok {
+		return fileName
+	}
+	return filepath.Join(reg.configsDir, id+".json")
+}
+
 // Returns pointer to existing instance of connector
 func (reg *Registry) GetInstance(id string) *model.Instance {
+	reg.mtx.RLock()
+	defer reg.mtx.RUnlock()
 	for i := range reg.instances {
 		if reg.instances[i].ID == id {
 			return reg.instances[i]
@@ -62,9 +199,12 @@ func (reg *Registry) GetInstance(id string) *model.Instance {
 
 // Returns pointer to existing instance of connector
 func (reg *Registry) GetAllInstances() []model.InstanceView {
+	reg.mtx.RLock()
+	defer reg.mtx.RUnlock()
 	var instList []model.InstanceView
 	for i := range reg.instances {
-		inst := model.InstanceView{ID: reg.instances[i].ID, Name: reg.instances[i].Name, Plugin: reg.instances[i].Plugin, State: reg.instances[i].Connection.GetState(), Config: reg.instances[i].Config}
+		inst := model.InstanceView{ID: reg.instances[i].ID, Name: reg.instances[i].Name, Plugin: reg.instances[i].Plugin, State: reg.instances[i].Connection.GetState(), Config: reg.instances[i].Config,
+			ReconnectAttempts: reg.GetReconnectAttempts(reg.instances[i].ID)}
 		instList = append(instList, inst)
 	}
 	return instList
@@ -94,7 +234,11 @@ func (reg *Registry) LoadInstancesFromDisk() error {
 				continue
 			}
 
-			reg.CreateInstance(inst.ID, inst.Name, inst.Plugin, inst.Config)
+			if reg.CreateInstance(inst.ID, inst.Name, inst.Plugin, inst.Config) != nil {
+				reg.mtx.Lock()
+				reg.files[inst.ID] = fileName
+				reg.mtx.Unlock()
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,127 @@
+package connector
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/connector/model"
+	"github.com/thingsplex/tpflow/connector/plugins"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testConnConfig struct {
+	Address string
+}
+
+type testConn struct {
+	config    testConnConfig
+	state     string
+	initCalls int
+	stopCalls int
+}
+
+func (conn *testConn) LoadConfig(config interface{}) error {
+	return mapstructure.Decode(config, &conn.config)
+}
+
+func (conn *testConn) Init() error {
+	conn.initCalls++
+	if conn.config.Address == "" {
+		conn.state = "INIT_FAILED"
+	} else {
+		conn.state = "RUNNING"
+	}
+	return nil
+}
+
+func (conn *testConn) Stop() {
+	conn.stopCalls++
+	conn.state = "STOPPED"
+}
+
+func (conn *testConn) GetConnection() interface{} {
+	return conn
+}
+
+func (conn *testConn) GetState() string {
+	return conn.state
+}
+
+func init() {
+	plugins.RegisterPlugin("test", model.Plugin{Constructor: func(name string, config interface{}) model.ConnInterface {
+		conn := testConn{}
+		conn.LoadConfig(config)
+		conn.Init()
+		return &conn
+	}, Config: testConnConfig{}})
+	plugins.RegisterPlugin("test_probe", model.Plugin{Constructor: func(name string, config interface{}) model.ConnInterface {
+		panic("constructor must not be used if plugin has tester")
+	}, Tester: func(config interface{}) (string, error) {
+		return "RUNNING", nil
+	}, Config: testConnConfig{}})
+}
+
+func TestRegistry_InstanceLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "connectors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reg := NewRegistry(dir)
+
+	inst := model.Instance{Name: "test-1", Plugin: "test", Config: map[string]interface{}{"Address": "localhost"}}
+	if err := reg.CreateAndSaveInstance(&inst); err != nil {
+		t.Fatal("Create failed . Err:", err)
+	}
+	if inst.ID == "" {
+		t.Fatal("Id is not generated")
+	}
+	if err := reg.CreateAndSaveInstance(&inst); err == nil {
+		t.Error("Duplicate id must be rejected")
+	}
+	if err := reg.CreateAndSaveInstance(&model.Instance{Plugin: "unknown"}); err == nil {
+		t.Error("Unknown plugin must be rejected")
+	}
+
+	// Registry loaded from disk must contain the instance
+	reg2 := NewRegistry(dir)
+	reg2.LoadInstancesFromDisk()
+	if loaded := reg2.GetInstance(inst.ID); loaded == nil || loaded.Name != "test-1" || loaded.Connection.GetState() != "RUNNING" {
+		t.Fatal("Instance wasn't persisted")
+	}
+
+	conn := reg.GetInstance(inst.ID).Connection.(*testConn)
+	if err := reg.UpdateInstance(inst.ID, "test-2", map[string]interface{}{"Address": ""}); err != nil {
+		t.Fatal("Update failed . Err:", err)
+	}
+	if conn.stopCalls != 1 || conn.initCalls != 2 || conn.GetState() != "INIT_FAILED" {
+		t.Errorf("Connection wasn't re-initialized . stop = %d , init = %d , state = %s", conn.stopCalls, conn.initCalls, conn.GetState())
+	}
+	if reg.GetInstance(inst.ID).Name != "test-2" {
+		t.Error("Name wasn't updated")
+	}
+
+	state, err := reg.TestInstance(model.Instance{Plugin: "test", Config: map[string]interface{}{"Address": "remote"}})
+	if err != nil || state != "RUNNING" {
+		t.Errorf("Unexpected test result , state = %s , err = %v", state, err)
+	}
+	state, err = reg.TestInstance(model.Instance{Plugin: "test_probe", Config: map[string]interface{}{"Address": "remote"}})
+	if err != nil || state != "RUNNING" {
+		t.Errorf("Plugin tester wasn't used , state = %s , err = %v", state, err)
+	}
+	state, _ = reg.TestInstance(model.Instance{ID: inst.ID})
+	if state != "INIT_FAILED" {
+		t.Error("Test must report state of existing instance , state = ", state)
+	}
+
+	if err := reg.DeleteInstance(inst.ID); err != nil {
+		t.Fatal("Delete failed . Err:", err)
+	}
+	if reg.GetInstance(inst.ID) != nil {
+		t.Error("Instance wasn't removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, inst.ID+".json")); !os.IsNotExist(err) {
+		t.Error("Config file wasn't deleted")
+	}
+}
@@ -9,15 +9,17 @@ type Instance struct {
 }
 
 type InstanceView struct {
-	ID     string
-	Name   string // name of the instance
-	Plugin string // name of connector
-	State  string
-	Config interface{}
+	ID                string
+	Name              string // name of the instance
+	Plugin            string // name of connector
+	State             string
+	Config            interface{}
+	ReconnectAttempts int // number of failed reconnect attempts since the instance went down
 }
 
 type Plugin struct {
 	Constructor Constructor `json:"-"`
+	Tester      Tester      `json:"-"` // optional , used by connector test instead of Constructor
 	Config      interface{}
 }
 
@@ -29,6 +31,14 @@ type ConnInterface interface {
 	GetState() string
 }
 
+// HealthChecker is implemented by connectors which can detect lost connection . CheckHealth updates connector state.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
 // plugin registry
 
 type Constructor func(name string, config interface{}) ConnInterface
+
+// Tester verifies configuration without affecting running instances of the plugin and returns state of probe connection.
+type Tester func(config interface{}) (string, error)
@@ -1,10 +1,14 @@
 package fimpmqtt
 
 import (
+	"errors"
+	"fmt"
 	"github.com/futurehomeno/fimpgo"
 	"github.com/thingsplex/tpflow/connector/model"
 	"github.com/labstack/gommon/log"
 	"github.com/mitchellh/mapstructure"
+	"sync"
+	"time"
 )
 
 type Connector struct {
@@ -13,6 +17,7 @@ type Connector struct {
 	config       ConnectorConfig
 	msgStreams   map[string]MsgPipeline
 	msgTransport *fimpgo.MqttTransport
+	mtx          sync.RWMutex // guards state , health check runs in supervisor goroutine
 }
 
 type ConnectorConfig struct {
@@ -41,12 +46,25 @@ func NewConnectorInstance(name string, config interface{}) model.ConnInterface {
 	return &con
 }
 
+// TestConfig connects to broker with probe client id , connection with the id of running connector would be dropped by broker.
+func TestConfig(config interface{}) (string, error) {
+	con := Connector{name: "probe"}
+	if err := con.LoadConfig(config); err != nil {
+		return "", err
+	}
+	con.config.MqttClientIdPrefix = fmt.Sprintf("%sprobe_%d_", con.config.MqttClientIdPrefix, time.Now().UnixNano())
+	con.Init()
+	state := con.GetState()
+	con.Stop()
+	return state, nil
+}
+
 func (conn *Connector) LoadConfig(config interface{}) error {
 	return mapstructure.Decode(config, &conn.config)
 }
 
 func (conn *Connector) Init() error {
-	conn.state = "INIT_FAILED"
+	conn.setState("INIT_FAILED")
 	log.Info("<FimpConn> Initializing fimp MQTT client.")
 	clientId := conn.config.MqttClientIdPrefix + "flow_manager"
 	conn.msgTransport = fimpgo.NewMqttTransport(conn.config.MqttServerURI, clientId, conn.config.MqttUsername, conn.config.MqttPassword, true, 1, 1)
@@ -56,23 +74,45 @@ func (conn *Connector) Init() error {
 	if err != nil {
 		log.Error("<FimpConn> Error connecting to broker : ", err)
 	} else {
-		conn.state = "RUNNING"
+		conn.setState("RUNNING")
 	}
 	return err
 	//conn.msgTransport.SetMessageHandler(conn.onMqttMessage)
 }
 
 func (conn *Connector) Stop() {
-	conn.state = "STOPPED"
+	conn.setState("STOPPED")
 	conn.msgTransport.Stop()
 
 }
 
+// CheckHealth verifies broker connection . Transport reconnects and restores subscriptions by itself.
+func (conn *Connector) CheckHealth() error {
+	state := conn.GetState()
+	if conn.msgTransport == nil || (state != "RUNNING" && state != "CONNECTION_LOST") {
+		return nil
+	}
+	if !conn.msgTransport.Client().IsConnectionOpen() {
+		conn.setState("CONNECTION_LOST")
+		return errors.New("connection to broker is lost")
+	}
+	conn.setState("RUNNING")
+	return nil
+}
+
 // Returns
 func (conn *Connector) GetConnection() interface{} {
 	return conn.msgTransport
 }
 
 func (conn *Connector) GetState() string {
+	conn.mtx.RLock()
+	defer conn.mtx.RUnlock()
 	return conn.state
 }
+
+func (conn *Connector) setState(state string) {
+	conn.mtx.Lock()
+	conn.state = state
+	conn.mtx.Unlock()
+}
@@ -2,6 +2,8 @@ package influxdb
 
 import (
 	"fmt"
+	"sync"
+	"time"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow/connector/model"
 	influx "github.com/influxdata/influxdb/client/v2"
@@ -13,6 +15,7 @@ type Connector struct {
 	influxC influx.Client
 	state   string
 	config  ConnectorConfig
+	mtx     sync.RWMutex // guards state , health check runs in supervisor goroutine
 }
 
 type ConnectorConfig struct {
@@ -37,7 +40,7 @@ func (conn *Connector) LoadConfig(config interface{}) error {
 
 func (conn *Connector) Init() error {
 	var err error
-	conn.state = "INIT_FAILED"
+	conn.setState("INIT_FAILED")
 	log.Info("<InfluxdbConn> Initializing influx client.")
 	conn.influxC, err = influx.NewHTTPClient(influx.HTTPConfig{
 		Addr:     conn.config.Address, //"http://localhost:8086",
@@ -52,7 +55,7 @@ func (conn *Connector) Init() error {
 	log.Info("<InfluxdbConn> Setting up database")
 	q := influx.NewQuery(fmt.Sprintf("CREATE DATABASE %s", conn.config.Db), "", "")
 	if response, err := conn.influxC.Query(q); err == nil && response.Error() == nil {
-		log.Infof("<InfluxdbConn> Database %s was created with status :%s", conn.config.Db, response.Results)
+		log.Infof("<InfluxdbConn> Database %s was created with status :%v", conn.config.Db, response.Results)
 	} else {
 		log.Error("<InfluxdbConn> Database init failed . Error:", err)
 		return err
@@ -61,25 +64,56 @@ func (conn *Connector) Init() error {
 	log.Info("<InfluxdbConn>  Setting up retention policies")
 	q = influx.NewQuery(fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1", conn.config.RetentionPolicyName, conn.config.Db, conn.config.RetentionDuration), conn.config.Db, "")
 	if response, err := conn.influxC.Query(q); err == nil && response.Error() == nil {
-		log.Infof("<InfluxdbConn> Retention policy %s was created with status :%s", conn.config.RetentionPolicyName, response.Results)
+		log.Infof("<InfluxdbConn> Retention policy %s was created with status :%v", conn.config.RetentionPolicyName, response.Results)
 	} else {
 		log.Errorf("<InfluxdbConn> Configuration of retention policy %s failed with status : %s ", conn.config.RetentionPolicyName, response.Error())
 	}
-	conn.state = "RUNNING"
+	conn.setState("RUNNING")
 	return err
 
 }
 
 func (conn *Connector) Stop() {
-	conn.state = "STOPPED"
+	conn.setState("STOPPED")
 	conn.influxC.Close()
 
 }
 
+// CheckHealth pings the server . Http client doesn't keep connection , so the state is restored as soon as ping succeeds.
+func (conn *Connector) CheckHealth() error {
+	state := conn.GetState()
+	if conn.influxC == nil || (state != "RUNNING" && state != "CONNECTION_LOST") {
+		return nil
+	}
+	if _, _, err := conn.influxC.Ping(5 * time.Second); err != nil {
+		conn.setState("CONNECTION_LOST")
+		return err
+	}
+	conn.setState("RUNNING")
+	return nil
+}
+
 func (conn *Connector) GetConnection() interface{} {
 	return conn.influxC
 }
 
 func (conn *Connector) GetState() string {
+	conn.mtx.RLock()
+	defer conn.mtx.RUnlock()
 	return conn.state
 }
+
+func (conn *Connector) setState(state string) {
+	conn.mtx.Lock()
+	conn.state = state
+	conn.mtx.Unlock()
+}
+
+// GetDbName returns database configured in the connector , is used by nodes as default database.
+func (conn *Connector) GetDbName() string {
+	return conn.config.Db
+}
+
+func (conn *Connector) GetRetentionPolicyName() string {
+	return conn.config.RetentionPolicyName
+}
@@ -0,0 +1,243 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/connector/model"
+	"sync"
+	"time"
+)
+
+// Connector is generic MQTT client for devices which don't use FIMP envelopes (Zigbee2MQTT , Tasmota , ESPHome , etc).
+// Nodes get the connector itself from GetConnection and use Subscribe , Unsubscribe and Publish methods.
+type Connector struct {
+	name          string
+	state         string
+	config        ConnectorConfig
+	client        mqtt.Client
+	subscriptions map[string]subscription // subscriber id -> subscription
+	mtx           sync.RWMutex            // guards state , client and subscriptions , state is updated from client callbacks
+}
+
+type ConnectorConfig struct {
+	MqttServerURI string // tcp://localhost:1883
+	MqttUsername  string
+	MqttPassword  string
+	MqttClientId  string // default - tpflow_<connector name>
+	CleanSession  bool
+}
+
+// Message is raw MQTT message delivered to subscribers
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+type subscription struct {
+	topicFilter string
+	qos         byte
+	ch          chan Message
+}
+
+const operationTimeout = 5 * time.Second
+
+func NewConnectorInstance(name string, config interface{}) model.ConnInterface {
+	con := Connector{name: name, subscriptions: map[string]subscription{}}
+	con.LoadConfig(config)
+	con.Init()
+	return &con
+}
+
+// TestConfig connects to broker with probe client id and clean session . Broker drops existing session of the same client id ,
+// therefore running connector must never be tested with its own id.
+func TestConfig(config interface{}) (string, error) {
+	con := Connector{name: "probe", subscriptions: map[string]subscription{}}
+	if err := con.LoadConfig(config); err != nil {
+		return "", err
+	}
+	clientId := con.config.MqttClientId
+	if clientId == "" {
+		clientId = "tpflow"
+	}
+	con.config.MqttClientId = fmt.Sprintf("%s_probe_%d", clientId, time.Now().UnixNano())
+	con.config.CleanSession = true
+	con.Init()
+	state := con.GetState()
+	con.Stop()
+	return state, nil
+}
+
+func (conn *Connector) LoadConfig(config interface{}) error {
+	return mapstructure.Decode(config, &conn.config)
+}
+
+func (conn *Connector) Init() error {
+	conn.setState("INIT_FAILED")
+	log.Info("<MqttConn> Initializing MQTT client.")
+	clientId := conn.config.MqttClientId
+	if clientId == "" {
+		clientId = "tpflow_" + conn.name
+	}
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(conn.config.MqttServerURI)
+	opts.SetClientID(clientId)
+	opts.SetUsername(conn.config.MqttUsername)
+	opts.SetPassword(conn.config.MqttPassword)
+	opts.SetCleanSession(conn.config.CleanSession)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Error("<MqttConn> Connection lost . Err:", err)
+		conn.setState("CONNECTION_LOST")
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Info("<MqttConn> Connected to broker ", conn.config.MqttServerURI)
+		conn.setState("RUNNING")
+		conn.resubscribe()
+	})
+	client := mqtt.NewClient(opts)
+	conn.mtx.Lock()
+	conn.client = client
+	conn.mtx.Unlock()
+	token := client.Connect()
+	if !token.WaitTimeout(operationTimeout) {
+		log.Error("<MqttConn> Connection timeout")
+		return errors.New("connection timeout")
+	}
+	if err := token.Error(); err != nil {
+		log.Error("<MqttConn> Error connecting to broker : ", err)
+		return err
+	}
+	return nil
+}
+
+func (conn *Connector) Stop() {
+	conn.setState("STOPPED")
+	if client := conn.getClient(); client != nil {
+		client.Disconnect(250)
+	}
+}
+
+// Returns connector itself , client is wrapped to keep subscriptions across reconnects
+func (conn *Connector) GetConnection() interface{} {
+	return conn
+}
+
+func (conn *Connector) GetState() string {
+	conn.mtx.RLock()
+	defer conn.mtx.RUnlock()
+	return conn.state
+}
+
+func (conn *Connector) setState(state string) {
+	conn.mtx.Lock()
+	conn.state = state
+	conn.mtx.Unlock()
+}
+
+func (conn *Connector) getClient() mqtt.Client {
+	conn.mtx.RLock()
+	defer conn.mtx.RUnlock()
+	return conn.client
+}
+
+// Subscribe registers subscriber channel for topic filter . Subscription is restored after reconnect.
+// Messages are dropped if subscriber channel is full.
+func (conn *Connector) Subscribe(subscriberId string, topicFilter string, qos byte, ch chan Message) error {
+	conn.mtx.Lock()
+	conn.subscriptions[subscriberId] = subscription{topicFilter: topicFilter, qos: qos, ch: ch}
+	client := conn.client
+	conn.mtx.Unlock()
+	if client == nil || !client.IsConnected() {
+		log.Info("<MqttConn> Client is not connected , subscription will be created after connect . Topic = ", topicFilter)
+		return nil
+	}
+	return conn.subscribeTopic(topicFilter, qos)
+}
+
+// Unsubscribe removes subscriber , topic is unsubscribed if no other subscriber uses it
+func (conn *Connector) Unsubscribe(subscriberId string) {
+	conn.mtx.Lock()
+	sub, ok := conn.subscriptions[subscriberId]
+	if !ok {
+		conn.mtx.Unlock()
+		return
+	}
+	delete(conn.subscriptions, subscriberId)
+	isTopicUsed := false
+	for _, s := range conn.subscriptions {
+		if s.topicFilter == sub.topicFilter {
+			isTopicUsed = true
+			break
+		}
+	}
+	client := conn.client
+	conn.mtx.Unlock()
+	if !isTopicUsed && client != nil && client.IsConnected() {
+		client.Unsubscribe(sub.topicFilter).WaitTimeout(operationTimeout)
+	}
+}
+
+func (conn *Connector) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	client := conn.getClient()
+	if client == nil || !client.IsConnected() {
+		return errors.New("mqtt client is not connected")
+	}
+	token := client.Publish(topic, qos, retain, payload)
+	if !token.WaitTimeout(operationTimeout) {
+		return errors.New("publish timeout")
+	}
+	return token.Error()
+}
+
+func (conn *Connector) subscribeTopic(topicFilter string, qos byte) error {
+	client := conn.getClient()
+	if client == nil {
+		return errors.New("mqtt client is not initialized")
+	}
+	token := client.Subscribe(topicFilter, qos, conn.messageHandler(topicFilter))
+	if !token.WaitTimeout(operationTimeout) {
+		return fmt.Errorf("subscribe timeout , topic %s", topicFilter)
+	}
+	return token.Error()
+}
+
+func (conn *Connector) resubscribe() {
+	conn.mtx.RLock()
+	topics := map[string]byte{}
+	for _, sub := range conn.subscriptions {
+		if qos, ok := topics[sub.topicFilter]; !ok || sub.qos > qos {
+			topics[sub.topicFilter] = sub.qos
+		}
+	}
+	conn.mtx.RUnlock()
+	for topic, qos := range topics {
+		// Handler is invoked from client goroutine , subscription is done asynchronously to avoid deadlock
+		go func(topic string, qos byte) {
+			if err := conn.subscribeTopic(topic, qos); err != nil {
+				log.Error("<MqttConn> Can't subscribe . Err:", err)
+			}
+		}(topic, qos)
+	}
+}
+
+// messageHandler delivers messages to all subscribers of topic filter
+func (conn *Connector) messageHandler(topicFilter string) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		conn.mtx.RLock()
+		defer conn.mtx.RUnlock()
+		for id, sub := range conn.subscriptions {
+			if sub.topicFilter != topicFilter {
+				continue
+			}
+			select {
+			case sub.ch <- Message{Topic: msg.Topic(), Payload: msg.Payload(), Retained: msg.Retained()}:
+			default:
+				log.Warnf("<MqttConn> Subscriber %s channel is full , message from %s is dropped", id, msg.Topic())
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+)
+
+type testMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m *testMessage) Duplicate() bool   { return false }
+func (m *testMessage) Qos() byte         { return 0 }
+func (m *testMessage) Retained() bool    { return false }
+func (m *testMessage) Topic() string     { return m.topic }
+func (m *testMessage) MessageID() uint16 { return 0 }
+func (m *testMessage) Payload() []byte   { return m.payload }
+func (m *testMessage) Ack()              {}
+
+func newTestConnector() *Connector {
+	return &Connector{name: "test", subscriptions: map[string]subscription{}}
+}
+
+func TestConnector_Subscriptions(t *testing.T) {
+	conn := newTestConnector()
+	ch1 := make(chan Message, 1)
+	ch2 := make(chan Message, 1)
+	// Client isn't connected , subscriptions are kept until connect
+	if err := conn.Subscribe("node1", "zigbee2mqtt/+", 0, ch1); err != nil {
+		t.Fatal(err)
+	}
+	conn.Subscribe("node2", "zigbee2mqtt/+", 0, ch2)
+	conn.Subscribe("node3", "tasmota/#", 0, make(chan Message, 1))
+
+	handler := conn.messageHandler("zigbee2mqtt/+")
+	handler(nil, &testMessage{topic: "zigbee2mqtt/sensor", payload: []byte("1")})
+	for _, ch := range []chan Message{ch1, ch2} {
+		select {
+		case msg := <-ch:
+			if msg.Topic != "zigbee2mqtt/sensor" || string(msg.Payload) != "1" {
+				t.Error("Wrong message ", msg)
+			}
+		default:
+			t.Error("Message wasn't delivered to subscriber")
+		}
+	}
+	// Full channel doesn't block delivery to other subscribers
+	ch1 <- Message{}
+	handler(nil, &testMessage{topic: "zigbee2mqtt/sensor", payload: []byte("2")})
+	if msg := <-ch2; string(msg.Payload) != "2" {
+		t.Error("Message wasn't delivered to second subscriber")
+	}
+
+	conn.Unsubscribe("node1")
+	<-ch1
+	handler(nil, &testMessage{topic: "zigbee2mqtt/sensor", payload: []byte("3")})
+	if len(ch1) != 0 || len(ch2) != 1 {
+		t.Error("Message was delivered to removed subscriber")
+	}
+}
+
+func TestConnector_State(t *testing.T) {
+	conn := newTestConnector()
+	var wg sync.WaitGroup
+	// State is updated from client callbacks while supervisor reads it , go test -race must not report races
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conn.setState("RUNNING")
+		}()
+		go func() {
+			defer wg.Done()
+			conn.GetState()
+		}()
+	}
+	wg.Wait()
+	conn.Stop()
+	if conn.GetState() != "STOPPED" {
+		t.Error("Wrong state ", conn.GetState())
+	}
+}
+
+func TestConnector_InitWhilePublishing(t *testing.T) {
+	conn := newTestConnector()
+	// Nothing listens on the port , connect fails fast
+	conn.config.MqttServerURI = "tcp://127.0.0.1:1"
+	var wg sync.WaitGroup
+	// Client is replaced by Init while nodes publish and subscribe , go test -race must not report races
+	for i := 0; i < 3; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conn.Init()
+		}()
+		go func() {
+			defer wg.Done()
+			conn.Publish("tasmota/cmnd/power", []byte("ON"), 0, false)
+			conn.Subscribe("node1", "tasmota/#", 0, make(chan Message, 1))
+		}()
+	}
+	wg.Wait()
+	if err := conn.Publish("tasmota/cmnd/power", []byte("ON"), 0, false); err == nil {
+		t.Error("Publish must fail if client isn't connected")
+	}
+	conn.Stop()
+}
@@ -4,11 +4,15 @@ import (
 	"github.com/thingsplex/tpflow/connector/model"
 	"github.com/thingsplex/tpflow/connector/plugins/fimpmqtt"
 	"github.com/thingsplex/tpflow/connector/plugins/influxdb"
+	"github.com/thingsplex/tpflow/connector/plugins/mqtt"
+	"github.com/thingsplex/tpflow/connector/plugins/webhook"
 )
 
 var pluginRegistry = map[string]model.Plugin{
 	"influxdb": {Constructor: influxdb.NewConnectorInstance, Config: influxdb.ConnectorConfig{}},
-	"fimpmqtt": {Constructor: fimpmqtt.NewConnectorInstance, Config: fimpmqtt.ConnectorConfig{}},
+	"fimpmqtt": {Constructor: fimpmqtt.NewConnectorInstance, Tester: fimpmqtt.TestConfig, Config: fimpmqtt.ConnectorConfig{}},
+	"mqtt":     {Constructor: mqtt.NewConnectorInstance, Tester: mqtt.TestConfig, Config: mqtt.ConnectorConfig{}},
+	"webhook":  {Constructor: webhook.NewConnectorInstance, Tester: webhook.TestConfig, Config: webhook.ConnectorConfig{}},
 }
 
 func GetPlugin(name string) *model.Plugin {
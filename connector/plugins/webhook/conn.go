@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/connector/model"
+	"github.com/thingsplex/tpflow/utils"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Connector is embedded HTTP server . Webhook trigger nodes register paths , requests are delivered to nodes over channels
+// and can be held open until the flow responds using Respond method.
+type Connector struct {
+	name     string
+	state    string
+	config   ConnectorConfig
+	server   *http.Server
+	handlers map[string]Handler  // path -> handler
+	pending  map[string]*Request // request id -> request waiting for response
+	mtx      sync.RWMutex // guards state , handlers and pending requests
+}
+
+type ConnectorConfig struct {
+	ListenAddress string // :8085
+	MaxBodySize   int64  // Max request body size in bytes , default - 1MB
+}
+
+// Handler is path registration of webhook trigger node
+type Handler struct {
+	Path            string
+	Methods         []string // Allowed methods , empty - any method
+	Token           string   // Secret token , request must have it in Authorization: Bearer header , X-Webhook-Token header or token query parameter
+	WaitForResponse bool     // true - request is held open until Respond is called or ResponseTimeout expires
+	ResponseTimeout time.Duration
+	Ch              chan *Request
+}
+
+// Request is incoming HTTP request delivered to trigger node
+type Request struct {
+	ID              string
+	Method          string
+	Path            string
+	Headers         map[string]string
+	Query           map[string]string
+	Body            []byte
+	RemoteAddr      string
+	WaitForResponse bool
+	responseCh      chan Response
+}
+
+// Response is sent back to waiting HTTP client
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       []byte
+}
+
+const defaultMaxBodySize = 1024 * 1024
+
+func NewConnectorInstance(name string, config interface{}) model.ConnInterface {
+	con := Connector{name: name, handlers: map[string]Handler{}, pending: map[string]*Request{}}
+	con.LoadConfig(config)
+	con.Init()
+	return &con
+}
+
+// TestConfig only validates configuration . Probe server isn't started , running instance of the connector would hold the
+// same address and the probe would always fail.
+func TestConfig(config interface{}) (string, error) {
+	con := Connector{name: "probe"}
+	if err := con.LoadConfig(config); err != nil {
+		return "INIT_FAILED", err
+	}
+	_, port, err := net.SplitHostPort(con.config.ListenAddress)
+	if err != nil {
+		return "INIT_FAILED", fmt.Errorf("invalid listen address %s : %s", con.config.ListenAddress, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return "INIT_FAILED", fmt.Errorf("invalid port %s", port)
+	}
+	if con.config.MaxBodySize < 0 {
+		return "INIT_FAILED", errors.New("max body size can't be negative")
+	}
+	return "CONFIGURED", nil
+}
+
+func (conn *Connector) LoadConfig(config interface{}) error {
+	return mapstructure.Decode(config, &conn.config)
+}
+
+func (conn *Connector) Init() error {
+	conn.setState("INIT_FAILED")
+	if conn.config.MaxBodySize == 0 {
+		conn.config.MaxBodySize = defaultMaxBodySize
+	}
+	log.Info("<WebhookConn> Starting HTTP server on ", conn.config.ListenAddress)
+	listener, err := net.Listen("tcp", conn.config.ListenAddress)
+	if err != nil {
+		log.Error("<WebhookConn> Can't start HTTP server . Err:", err)
+		return err
+	}
+	conn.server = &http.Server{Handler: conn}
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("<WebhookConn> HTTP server failed . Err:", err)
+			conn.setState("CONNECTION_LOST")
+		}
+	}(conn.server)
+	conn.setState("RUNNING")
+	return nil
+}
+
+func (conn *Connector) Stop() {
+	conn.setState("STOPPED")
+	if conn.server != nil {
+		conn.server.Close()
+	}
+}
+
+// Returns connector itself , nodes use RegisterHandler and Respond methods
+func (conn *Connector) GetConnection() interface{} {
+	return conn
+}
+
+func (conn *Connector) GetState() string {
+	conn.mtx.RLock()
+	defer conn.mtx.RUnlock()
+	return conn.state
+}
+
+func (conn *Connector) setState(state string) {
+	conn.mtx.Lock()
+	conn.state = state
+	conn.mtx.Unlock()
+}
+
+// RegisterHandler registers path of webhook trigger node . Only one node can be registered for the path.
+func (conn *Connector) RegisterHandler(handler Handler) error {
+	if !strings.HasPrefix(handler.Path, "/") {
+		handler.Path = "/" + handler.Path
+	}
+	conn.mtx.Lock()
+	defer conn.mtx.Unlock()
+	if _, ok := conn.handlers[handler.Path]; ok {
+		return fmt.Errorf("path %s is already registered", handler.Path)
+	}
+	conn.handlers[handler.Path] = handler
+	return nil
+}
+
+func (conn *Connector) UnregisterHandler(path string) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	conn.mtx.Lock()
+	delete(conn.handlers, path)
+	conn.mtx.Unlock()
+}
+
+// Respond sends response to HTTP client which is waiting for it
+func (conn *Connector) Respond(requestId string, response Response) error {
+	conn.mtx.Lock()
+	req, ok := conn.pending[requestId]
+	delete(conn.pending, requestId)
+	conn.mtx.Unlock()
+	if !ok {
+		return errors.New("request doesn't exist or has already timed out")
+	}
+	req.responseCh <- response
+	return nil
+}
+
+func (conn *Connector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn.mtx.RLock()
+	handler, ok := conn.handlers[r.URL.Path]
+	conn.mtx.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !isMethodAllowed(handler.Methods, r.Method) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if handler.Token != "" && !isTokenValid(handler.Token, r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, conn.config.MaxBodySize))
+	if err != nil {
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	query := flattenValues(r.URL.Query())
+	headers := flattenValues(r.Header)
+	if handler.Token != "" {
+		// Secret must not leak into flow
+		delete(query, "token")
+		delete(headers, "Authorization")
+		delete(headers, "X-Webhook-Token")
+	}
+	req := &Request{
+		ID:              utils.GenerateId(15),
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Headers:         headers,
+		Query:           query,
+		Body:            body,
+		RemoteAddr:      r.RemoteAddr,
+		WaitForResponse: handler.WaitForResponse,
+		responseCh:      make(chan Response, 1),
+	}
+	if handler.WaitForResponse {
+		conn.mtx.Lock()
+		conn.pending[req.ID] = req
+		conn.mtx.Unlock()
+	}
+	select {
+	case handler.Ch <- req:
+	default:
+		conn.removePending(req.ID)
+		log.Warnf("<WebhookConn> Trigger node is busy , request to %s is rejected", req.Path)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	if !handler.WaitForResponse {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	select {
+	case resp := <-req.responseCh:
+		for k, v := range resp.Headers {
+			w.Header().Set(k, v)
+		}
+		if resp.StatusCode == 0 {
+			resp.StatusCode = http.StatusOK
+		}
+		w.WriteHeader(resp.StatusCode)
+		w.Write(resp.Body)
+	case <-time.After(handler.ResponseTimeout):
+		conn.removePending(req.ID)
+		http.Error(w, "flow didn't respond", http.StatusGatewayTimeout)
+	}
+}
+
+func (conn *Connector) removePending(requestId string) {
+	conn.mtx.Lock()
+	delete(conn.pending, requestId)
+	conn.mtx.Unlock()
+}
+
+func isMethodAllowed(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTokenValid checks token from Authorization: Bearer header , X-Webhook-Token header or token query parameter
+func isTokenValid(token string, r *http.Request) bool {
+	received := r.Header.Get("X-Webhook-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		received = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if received == "" {
+		received = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(received)) == 1
+}
+
+// flattenValues keeps only the first value of every key
+func flattenValues(values map[string][]string) map[string]string {
+	result := map[string]string{}
+	for k, v := range values {
+		if len(v) > 0 {
+			result[k] = v[0]
+		}
+	}
+	return result
+}
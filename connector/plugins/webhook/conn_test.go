@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestConnector() *Connector {
+	return &Connector{handlers: map[string]Handler{}, pending: map[string]*Request{}, config: ConnectorConfig{MaxBodySize: defaultMaxBodySize}}
+}
+
+func TestConnector_TokenAndMethod(t *testing.T) {
+	conn := newTestConnector()
+	ch := make(chan *Request, 1)
+	if err := conn.RegisterHandler(Handler{Path: "doorbell", Methods: []string{"POST"}, Token: "secret", Ch: ch}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.RegisterHandler(Handler{Path: "/doorbell", Ch: ch}); err == nil {
+		t.Error("Duplicate path must be rejected")
+	}
+
+	cases := []struct {
+		method, url, auth string
+		status            int
+	}{
+		{"POST", "/unknown", "", http.StatusNotFound},
+		{"GET", "/doorbell?token=secret", "", http.StatusMethodNotAllowed},
+		{"POST", "/doorbell", "", http.StatusUnauthorized},
+		{"POST", "/doorbell", "Bearer wrong", http.StatusUnauthorized},
+		{"POST", "/doorbell?token=secret&floor=1", "", http.StatusAccepted},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.url, strings.NewReader(`{"ring":true}`))
+		if c.auth != "" {
+			r.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		conn.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("%s %s , expected status %d , got %d", c.method, c.url, c.status, w.Code)
+		}
+	}
+	req := <-ch
+	if req.Method != "POST" || req.Query["floor"] != "1" || string(req.Body) != `{"ring":true}` {
+		t.Errorf("Unexpected request %+v", req)
+	}
+	if _, ok := req.Query["token"]; ok {
+		t.Error("Token must be removed from query")
+	}
+}
+
+func TestConnector_WaitForResponse(t *testing.T) {
+	conn := newTestConnector()
+	ch := make(chan *Request, 1)
+	conn.RegisterHandler(Handler{Path: "/status", WaitForResponse: true, ResponseTimeout: time.Second, Ch: ch})
+	go func() {
+		req := <-ch
+		conn.Respond(req.ID, Response{StatusCode: 201, Headers: map[string]string{"Content-Type": "text/plain"}, Body: []byte("ok")})
+	}()
+	w := httptest.NewRecorder()
+	conn.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != 201 || w.Body.String() != "ok" || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	conn.UnregisterHandler("/status")
+	conn.RegisterHandler(Handler{Path: "/status", WaitForResponse: true, ResponseTimeout: 10 * time.Millisecond, Ch: ch})
+	w = httptest.NewRecorder()
+	conn.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Error("Expected timeout , got ", w.Code)
+	}
+	req := <-ch
+	if err := conn.Respond(req.ID, Response{}); err == nil {
+		t.Error("Response to timed out request must fail")
+	}
+}
+
+func TestConfig_DoesNotBind(t *testing.T) {
+	// Address is held by running instance
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if state, err := TestConfig(map[string]interface{}{"ListenAddress": listener.Addr().String()}); err != nil || state != "CONFIGURED" {
+		t.Error("Valid configuration was rejected ", state, err)
+	}
+	if _, err := TestConfig(map[string]interface{}{"ListenAddress": "localhost"}); err == nil {
+		t.Error("Address without port must be rejected")
+	}
+}
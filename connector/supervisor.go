@@ -0,0 +1,246 @@
+package connector
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/connector/model"
+	"github.com/thingsplex/tpflow/connector/plugins"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	MinReconnectBackoff        = 5 * time.Second
+	MaxReconnectBackoff        = 5 * time.Minute
+)
+
+// StateChangeEvent is sent to subscribers when connector instance goes up or down
+type StateChangeEvent struct {
+	ID                string
+	Name              string
+	Plugin            string
+	State             string
+	PreviousState     string
+	ReconnectAttempts int
+	Reinitialized     bool // connection was re-created by supervisor , nodes have to load new connection
+}
+
+// instanceHealth - supervision state of single connector instance
+type instanceHealth struct {
+	lastState     string
+	attempts      int
+	nextAttemptAt time.Time
+	reconnecting  bool
+	reinitialized bool
+}
+
+// supervisor periodically checks state of all connector instances , re-initializes instances which are down using
+// exponential backoff and notifies subscribers about state changes.
+type supervisor struct {
+	checkInterval time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	health        map[string]*instanceHealth
+	subscribers   map[string]chan StateChangeEvent
+	stopCh        chan bool
+	isRunning     bool
+	mtx           sync.Mutex
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{
+		checkInterval: DefaultHealthCheckInterval,
+		minBackoff:    MinReconnectBackoff,
+		maxBackoff:    MaxReconnectBackoff,
+		health:        map[string]*instanceHealth{},
+		subscribers:   map[string]chan StateChangeEvent{},
+	}
+}
+
+// StartSupervisor starts connector health supervision . Zero interval - default interval is used.
+func (reg *Registry) StartSupervisor(checkInterval time.Duration) {
+	sup := reg.supervisor
+	sup.mtx.Lock()
+	defer sup.mtx.Unlock()
+	if sup.isRunning {
+		return
+	}
+	if checkInterval > 0 {
+		sup.checkInterval = checkInterval
+	}
+	sup.stopCh = make(chan bool)
+	sup.isRunning = true
+	log.Infof("<ConnRegistry> Starting connector supervisor , check interval = %s", sup.checkInterval)
+	go func(stopCh chan bool, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reg.CheckInstances()
+			case <-stopCh:
+				return
+			}
+		}
+	}(sup.stopCh, sup.checkInterval)
+}
+
+func (reg *Registry) StopSupervisor() {
+	sup := reg.supervisor
+	sup.mtx.Lock()
+	defer sup.mtx.Unlock()
+	if !sup.isRunning {
+		return
+	}
+	close(sup.stopCh)
+	sup.isRunning = false
+}
+
+// SetReconnectBackoff sets initial and max delay between reconnect attempts
+func (reg *Registry) SetReconnectBackoff(min, max time.Duration) {
+	reg.supervisor.mtx.Lock()
+	reg.supervisor.minBackoff = min
+	reg.supervisor.maxBackoff = max
+	reg.supervisor.mtx.Unlock()
+}
+
+// SubscribeToStateChanges registers channel for connector state change events . Events are dropped if channel is full.
+func (reg *Registry) SubscribeToStateChanges(subscriberId string, ch chan StateChangeEvent) {
+	reg.supervisor.mtx.Lock()
+	reg.supervisor.subscribers[subscriberId] = ch
+	reg.supervisor.mtx.Unlock()
+}
+
+func (reg *Registry) UnsubscribeFromStateChanges(subscriberId string) {
+	reg.supervisor.mtx.Lock()
+	delete(reg.supervisor.subscribers, subscriberId)
+	reg.supervisor.mtx.Unlock()
+}
+
+// GetReconnectAttempts returns number of failed reconnect attempts since instance went down
+func (reg *Registry) GetReconnectAttempts(id string) int {
+	reg.supervisor.mtx.Lock()
+	defer reg.supervisor.mtx.Unlock()
+	if h, ok := reg.supervisor.health[id]; ok {
+		return h.attempts
+	}
+	return 0
+}
+
+// CheckInstances runs single supervision cycle . Is invoked by supervisor periodically.
+func (reg *Registry) CheckInstances() {
+	reg.mtx.RLock()
+	instances := make([]*model.Instance, len(reg.instances))
+	copy(instances, reg.instances)
+	reg.mtx.RUnlock()
+
+	sup := reg.supervisor
+	for _, inst := range instances {
+		// Connections which are not created by plugins (thing registry) can't be re-initialized
+		if inst.Connection == nil || plugins.GetPlugin(inst.Plugin) == nil {
+			continue
+		}
+		sup.mtx.Lock()
+		h, ok := sup.health[inst.ID]
+		if !ok {
+			h = &instanceHealth{}
+			sup.health[inst.ID] = h
+		}
+		isReconnecting := h.reconnecting
+		sup.mtx.Unlock()
+		if isReconnecting {
+			continue
+		}
+		if checker, ok := inst.Connection.(model.HealthChecker); ok {
+			if err := checker.CheckHealth(); err != nil {
+				log.Debugf("<ConnRegistry> Health check of instance %s failed . Err: %s", inst.ID, err)
+			}
+		}
+		reg.superviseInstance(inst, h)
+	}
+}
+
+func (reg *Registry) superviseInstance(inst *model.Instance, h *instanceHealth) {
+	sup := reg.supervisor
+	state := inst.Connection.GetState()
+	sup.mtx.Lock()
+	defer sup.mtx.Unlock()
+	if h.lastState != "" && h.lastState != state {
+		event := StateChangeEvent{ID: inst.ID, Name: inst.Name, Plugin: inst.Plugin, State: state, PreviousState: h.lastState,
+			ReconnectAttempts: h.attempts, Reinitialized: h.reinitialized && state == "RUNNING"}
+		log.Infof("<ConnRegistry> Instance %s changed state %s -> %s", inst.ID, h.lastState, state)
+		sup.notify(event)
+	}
+	h.lastState = state
+	switch state {
+	case "RUNNING":
+		h.attempts = 0
+		h.reinitialized = false
+		h.nextAttemptAt = time.Time{}
+		return
+	case "STOPPED":
+		// Instance was stopped explicitly
+		return
+	}
+	now := time.Now()
+	if h.nextAttemptAt.IsZero() {
+		// Connection is given a chance to recover by itself before it is re-created
+		h.nextAttemptAt = now.Add(sup.backoff(0))
+		return
+	}
+	if now.Before(h.nextAttemptAt) {
+		return
+	}
+	h.reconnecting = true
+	go reg.reconnect(inst, h)
+}
+
+// reconnect re-initializes connection , may block for long time , that's why it runs in its own goroutine
+func (reg *Registry) reconnect(inst *model.Instance, h *instanceHealth) {
+	sup := reg.supervisor
+	log.Infof("<ConnRegistry> Reconnecting instance %s , attempt %d", inst.ID, h.attempts+1)
+	inst.Connection.Stop()
+	err := inst.Connection.Init()
+	sup.mtx.Lock()
+	defer sup.mtx.Unlock()
+	h.reconnecting = false
+	h.reinitialized = true
+	if err == nil && inst.Connection.GetState() == "RUNNING" {
+		log.Infof("<ConnRegistry> Instance %s reconnected", inst.ID)
+		return
+	}
+	h.attempts++
+	h.nextAttemptAt = time.Now().Add(sup.backoff(h.attempts))
+	log.Warnf("<ConnRegistry> Instance %s reconnect failed , next attempt after %s . Err: %v", inst.ID, sup.backoff(h.attempts), err)
+	// State was STOPPED during re-init , it must not be mistaken for explicit stop
+	h.lastState = inst.Connection.GetState()
+}
+
+// backoff returns delay before next reconnect attempt , delay is doubled after every failed attempt
+func (sup *supervisor) backoff(attempts int) time.Duration {
+	delay := sup.minBackoff
+	for i := 0; i < attempts && delay < sup.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > sup.maxBackoff {
+		delay = sup.maxBackoff
+	}
+	return delay
+}
+
+func (sup *supervisor) notify(event StateChangeEvent) {
+	for id, ch := range sup.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Warnf("<ConnRegistry> Subscriber %s channel is full , state event is dropped", id)
+		}
+	}
+}
+
+// forget removes supervision state of deleted instance
+func (sup *supervisor) forget(id string) {
+	sup.mtx.Lock()
+	delete(sup.health, id)
+	sup.mtx.Unlock()
+}
@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSupervisor_Backoff(t *testing.T) {
+	sup := newSupervisor()
+	sup.minBackoff = time.Second
+	sup.maxBackoff = 10 * time.Second
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for attempts, delay := range expected {
+		if sup.backoff(attempts) != delay {
+			t.Errorf("Attempt %d , expected delay %s , got %s", attempts, delay, sup.backoff(attempts))
+		}
+	}
+}
+
+func TestSupervisor_Reconnect(t *testing.T) {
+	reg := NewRegistry("")
+	reg.SetReconnectBackoff(time.Millisecond, 10*time.Millisecond)
+	// Empty address - init fails
+	reg.CreateInstance("test-1", "test-1", "test", map[string]interface{}{"Address": ""})
+	events := make(chan StateChangeEvent, 10)
+	reg.SubscribeToStateChanges("test", events)
+
+	reg.CheckInstances()
+	time.Sleep(5 * time.Millisecond)
+	// First attempt fails
+	reg.CheckInstances()
+	time.Sleep(5 * time.Millisecond)
+	if reg.GetReconnectAttempts("test-1") != 1 {
+		t.Fatal("Reconnect attempt wasn't made , attempts = ", reg.GetReconnectAttempts("test-1"))
+	}
+	reg.GetInstance("test-1").Connection.LoadConfig(map[string]interface{}{"Address": "localhost"})
+	deadline := time.Now().Add(time.Second)
+	var event StateChangeEvent
+	for event.State == "" && time.Now().Before(deadline) {
+		reg.CheckInstances()
+		select {
+		case event = <-events:
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	if event.ID != "test-1" || event.State != "RUNNING" || event.PreviousState != "INIT_FAILED" || !event.Reinitialized {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+	if reg.GetReconnectAttempts("test-1") != 0 {
+		t.Error("Attempts must be reset")
+	}
+
+	// Explicitly stopped instance must not be reconnected
+	conn := reg.GetInstance("test-1").Connection.(*testConn)
+	conn.Stop()
+	initCalls := conn.initCalls
+	for i := 0; i < 5; i++ {
+		reg.CheckInstances()
+		time.Sleep(2 * time.Millisecond)
+	}
+	if conn.initCalls != initCalls {
+		t.Error("Stopped instance was re-initialized")
+	}
+	if event := <-events; event.State != "STOPPED" {
+		t.Error("Stop event wasn't sent")
+	}
+}
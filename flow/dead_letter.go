@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/utils"
+	"sync"
+)
+
+const DefaultDeadLetterStoreSize = 100
+
+// DeadLetter is failed message kept for inspection and replay
+type DeadLetter struct {
+	ID string
+	FlowError
+	ReplayCounter int // number of times the message was replayed before it failed again
+}
+
+// DeadLetterStore keeps the last failed messages , the oldest message is dropped when the store is full.
+type DeadLetterStore struct {
+	letters []DeadLetter
+	maxSize int
+	mtx     sync.RWMutex
+}
+
+func NewDeadLetterStore(maxSize int) *DeadLetterStore {
+	if maxSize <= 0 {
+		maxSize = DefaultDeadLetterStoreSize
+	}
+	return &DeadLetterStore{maxSize: maxSize}
+}
+
+// Add stores failed message and returns its id
+func (st *DeadLetterStore) Add(flowError FlowError, replayCounter int) string {
+	letter := DeadLetter{ID: utils.GenerateId(15), FlowError: flowError, ReplayCounter: replayCounter}
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if len(st.letters) >= st.maxSize {
+		st.letters = append(st.letters[:0], st.letters[len(st.letters)-st.maxSize+1:]...)
+	}
+	st.letters = append(st.letters, letter)
+	return letter.ID
+}
+
+// GetAll returns stored messages , flowId filters messages by flow , empty - messages of all flows
+func (st *DeadLetterStore) GetAll(flowId string) []DeadLetter {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	result := []DeadLetter{}
+	for i := range st.letters {
+		if flowId == "" || st.letters[i].FlowId == flowId {
+			result = append(result, st.letters[i])
+		}
+	}
+	return result
+}
+
+func (st *DeadLetterStore) Get(id string) (DeadLetter, bool) {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	for i := range st.letters {
+		if st.letters[i].ID == id {
+			return st.letters[i], true
+		}
+	}
+	return DeadLetter{}, false
+}
+
+// Delete removes message by id , empty id - all messages are removed
+func (st *DeadLetterStore) Delete(id string) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if id == "" {
+		st.letters = nil
+		return
+	}
+	for i := range st.letters {
+		if st.letters[i].ID == id {
+			st.letters = append(st.letters[:i], st.letters[i+1:]...)
+			return
+		}
+	}
+}
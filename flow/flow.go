@@ -1,6 +1,7 @@
 package flow
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow/connector"
@@ -8,7 +9,9 @@ import (
 	"github.com/thingsplex/tpflow/node"
 	"github.com/thingsplex/tpflow/utils"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,6 +27,7 @@ type Flow struct {
 	instances         map[int32]*Instance
 	TriggerCounter    int64
 	ErrorCounter      int64
+	RetryCounter      int64 // number of node execution retries
 	StartedAt         time.Time
 	WaitingSince      time.Time
 	LastExecutionTime time.Duration
@@ -32,13 +36,26 @@ type Flow struct {
 	instanceCounter   int
 	mtx               sync.Mutex
 	rateLimiter       int // Is used by loop detector . Max alowed number of loop execution in 10 seconds
+	tracer            *tracer
+	nodeLatency       map[model.NodeID]*nodeLatency // node execution latency histograms
+	nodeRetries       map[model.NodeID]uint64       // number of retries per node
+	errorReporter     ErrorReporter
+	metricsMtx        sync.Mutex
+	stopSignal        chan struct{} // closed by Stop , wakes up all instances which wait for retry
 }
 
 type Instance struct {
-	ID                int32
-	CurrentNodeId     model.NodeID
-	StartNodeId       model.NodeID
-	StartedAt         time.Time
+	ID            int32
+	StartNodeId   model.NodeID
+	StartedAt     time.Time
+	branchCounter int32          // number of branches started by the instance , including main branch
+	branches      sync.WaitGroup // parallel branches started by fork nodes
+	trace         *model.InstanceTrace // nil if trace mode was disabled when instance was started
+	isCanceled    int32                // set by sub-flow caller on timeout
+	done          chan struct{}        // closed on cancel , is passed to nodes with the message
+	forkCounter   int64                // id of the last fork execution
+	forks         map[int64]int        // fork id -> number of branches which are neither ended nor merged by join node
+	forksMtx      sync.Mutex
 }
 
 func NewFlow(metaFlow model.FlowMeta, globalContext *model.Context) *Flow {
@@ -57,6 +74,8 @@ func NewFlow(metaFlow model.FlowMeta, globalContext *model.Context) *Flow {
 	flow.initFromMetaFlow(&metaFlow)
 	flow.instanceCounter = 0
 	flow.mtx = sync.Mutex{}
+	flow.stopSignal = make(chan struct{})
+	flow.tracer = newTracer()
 
 	return &flow
 }
@@ -123,6 +142,10 @@ func (fl *Flow) LoadAndConfigureAllNodes() {
 			fl.getLog().Infof(" Reusing existing node ")
 		}
 
+		if _, ok := newNode.(model.TimerOwner); ok {
+			// Timer node starts new instance on expiry
+			newNode.SetFlowRunner(fl.startOwnedInstance)
+		}
 		fl.getLog().Debug(" Running Init() function of the node")
 		newNode.Init()
 		fl.getLog().Debug(" Done")
@@ -182,12 +205,19 @@ func (fl *Flow) GetFlowStats() *model.FlowStatsReport {
 		}
 	}
 	stats.NumberOfNodes = len(fl.nodes)
-	stats.NumberOfActiveSubflows = fl.instanceCounter
+	stats.NumberOfActiveSubflows = fl.getInstanceCounter()
 	stats.NumberOfTriggers = numberOfTrigger
 	stats.NumberOfActiveTriggers = numberOfActiveTriggers
 	stats.StartedAt = fl.StartedAt
 	stats.WaitingSince = fl.WaitingSince
 	stats.LastExecutionTime = int64(fl.LastExecutionTime / time.Millisecond)
+	stats.ConnectorsDown = fl.getConnectorsDown()
+	stats.RetryCounter = atomic.LoadInt64(&fl.RetryCounter)
+	for i := range fl.nodes {
+		if timerOwner, ok := fl.nodes[i].(model.TimerOwner); ok {
+			stats.PendingTimers = append(stats.PendingTimers, timerOwner.GetPendingTimers()...)
+		}
+	}
 	return &stats
 }
 
@@ -233,24 +263,54 @@ func (fl *Flow) IsNodeValid(node *model.MetaNode) bool {
 	//}
 	return true
 }
-// T
+// StartFlowInstance starts new flow instance in its own goroutine , the instance can be skipped by ParallelExecution policy.
 func (fl *Flow) StartFlowInstance(reactorEvent model.ReactorEvent) {
+	fl.TryStartFlowInstance(reactorEvent)
+}
+
+// TryStartFlowInstance starts new flow instance in its own goroutine . Returns false if the instance was skipped by
+// ParallelExecution policy.
+func (fl *Flow) TryStartFlowInstance(reactorEvent model.ReactorEvent) bool {
+	if !fl.admitInstance() {
+		return false
+	}
+	go fl.run(reactorEvent)
+	return true
+}
+
+// startOwnedInstance starts instance on behalf of node which owns timer . Unlike trigger event , expired timer isn't repeated
+// by the source , therefore skipped instance is reported as error and the message can be replayed from dead-letter store.
+func (fl *Flow) startOwnedInstance(reactorEvent model.ReactorEvent) {
+	if fl.TryStartFlowInstance(reactorEvent) {
+		return
+	}
+	err := fmt.Errorf("instance started by node %s was skipped , another instance of keep_first flow is running", reactorEvent.SrcNodeId)
+	fl.getLog().Warn(err)
+	fl.reportError(reactorEvent.TransitionNodeId, err, reactorEvent.Msg, false)
+}
+
+// admitInstance applies ParallelExecution policy and counts new instance . Returns false if the instance must be skipped.
+func (fl *Flow) admitInstance() bool {
 	switch fl.FlowMeta.ParallelExecution {
 	case model.ParallelExecutionKeepFirst:
 		// in this case we keep only first started instance , all subsequent will be skipped
+		fl.mtx.Lock()
+		defer fl.mtx.Unlock()
 		if fl.instanceCounter > 0 {
 			fl.getLog().Debug("One instance is already running . Skipping this one  ")
-			return
+			return false
 		}
+		fl.instanceCounter++
+		return true
 	case model.ParallelExecutionKeepLast:
 		// in this case we keep only new instance but cancel all previous ones
-		if fl.instanceCounter > 0 {
+		if fl.getInstanceCounter() > 0 {
 			fl.getLog().Debug("One instance is already running . Terminating all previous instances")
 			fl.TerminateRunningInstances()
 		}
 	case model.ParallelExecutionParallel:
 		// start new instance in parallel with already running one
-		if fl.instanceCounter > 0 {
+		if fl.getInstanceCounter() > 0 {
 			fl.getLog().Debug("One instance is already running . Executing new instance in parallel")
 		}
 	default:
@@ -259,54 +319,87 @@ func (fl *Flow) StartFlowInstance(reactorEvent model.ReactorEvent) {
 	fl.mtx.Lock()
 	fl.instanceCounter++
 	fl.mtx.Unlock()
-	go fl.run(reactorEvent)
+	return true
+}
+
+// isRunning returns false while the flow is stopping or running instances are being terminated
+func (fl *Flow) isRunning() bool {
+	fl.mtx.Lock()
+	defer fl.mtx.Unlock()
+	return fl.opContext.IsFlowRunning
+}
+
+func (fl *Flow) setRunning(isRunning bool) {
+	fl.mtx.Lock()
+	fl.opContext.IsFlowRunning = isRunning
+	fl.mtx.Unlock()
+}
+
+func (fl *Flow) getInstanceCounter() int {
+	fl.mtx.Lock()
+	defer fl.mtx.Unlock()
+	return fl.instanceCounter
 }
 
 // Terminating all running instance except 1 caller instance
 func (fl *Flow) TerminateRunningInstances() {
 	// aborting all run loops
-	fl.opContext.IsFlowRunning = false
+	fl.setRunning(false)
+	fl.resumePausedInstances(0, false)
 	for ic:=0;ic<1000;ic++{
-		for i := 0; i < fl.instanceCounter; i++ {
+		for i := 0; i < fl.getInstanceCounter(); i++ {
 			// sending signal to every instance wait node
 			select {
 			case fl.opContext.NodeControlSignalChannel <- model.SIGNAL_TERMINATE_WAITING:
 			case <-time.After(10 * time.Millisecond):
 			}
 		}
-		if fl.instanceCounter < 1 {
+		if fl.getInstanceCounter() < 1 {
 			break
 		}
 		time.Sleep(50 * time.Millisecond)
-		fl.getLog().Debugf("Terminating instances , total = %d , ic = %d",fl.instanceCounter,ic)
+		fl.getLog().Debugf("Terminating instances , total = %d , ic = %d",fl.getInstanceCounter(),ic)
 	}
-	fl.opContext.IsFlowRunning = true
+	fl.setRunning(true)
 	fl.getLog().Debugf("-- All instances were terminated --")
 }
 
-// Invoked by trigger node in it's own goroutine
-func (fl *Flow) run(reactorEvent model.ReactorEvent) {
-	var transitionNodeId model.NodeID
-	flowId := utils.GenerateRandomNumber()
-	instance := Instance{ID:flowId,CurrentNodeId:reactorEvent.SrcNodeId,StartNodeId:reactorEvent.SrcNodeId,StartedAt:time.Now()}
+// Invoked by trigger node in it's own goroutine . Returns message and error of the last node executed by main branch.
+func (fl *Flow) run(reactorEvent model.ReactorEvent) (outMsg model.Message, err error) {
+	return fl.runInstance(newInstance(reactorEvent.SrcNodeId), reactorEvent)
+}
+
+func newInstance(startNodeId model.NodeID) *Instance {
+	return &Instance{ID: utils.GenerateRandomNumber(), StartNodeId: startNodeId, StartedAt: time.Now(), branchCounter: 1, done: make(chan struct{})}
+}
+
+// cancel stops the instance before execution of next node and wakes up nodes which are waiting within the instance
+func (instance *Instance) cancel() {
+	if atomic.CompareAndSwapInt32(&instance.isCanceled, 0, 1) {
+		close(instance.done)
+	}
+}
+
+func (instance *Instance) isActive() bool {
+	return atomic.LoadInt32(&instance.isCanceled) == 0
+}
+
+// runInstance executes the instance , instance counter must be incremented by the caller.
+func (fl *Flow) runInstance(instance *Instance, reactorEvent model.ReactorEvent) (outMsg model.Message, err error) {
+	outMsg = reactorEvent.Msg
 	defer func() {
 		fl.mtx.Lock()
 		fl.instanceCounter--
 		//delete(fl.instances,flowId)
 		fl.mtx.Unlock()
-		if r := recover(); r != nil {
-			fl.getLog().Error(" Flow process CRASHED with error : ", r)
-			fl.getLog().Errorf(" Crashed while processing message from Current Node = %v Next Node = %v ", instance.CurrentNodeId, transitionNodeId)
-			transitionNodeId = ""
-		}
 		fl.LastExecutionTime = time.Since(fl.StartedAt)
-		fl.getLog().Debugf(" ------Flow %s completed , num of instances = %d ----------- ", fl.Name,fl.instanceCounter)
+		fl.getLog().Debugf(" ------Flow %s completed , num of instances = %d ----------- ", fl.Name, fl.getInstanceCounter())
 	}()
-	if !fl.opContext.IsFlowRunning {
+	if !fl.isRunning() {
 		fl.getLog().Debug("Flow is not running.Exiting runner.")
-		return
+		return outMsg, errors.New("flow is not running")
 	}
-	fl.getLog().Debugf(" ------Flow %s started , num of instances = %d ----------- ", fl.Name,fl.instanceCounter)
+	fl.getLog().Debugf(" ------Flow %s started , num of instances = %d ----------- ", fl.Name, fl.getInstanceCounter())
 	// ------------------------------------
 	//fl.instances[flowId] = &instance
 	// -------------------------------------
@@ -316,21 +409,56 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 		fl.getLog().Error(" TriggerNode failed with error :", reactorEvent.Err)
 		//fl.currentNodeIds[0] = ""
 	}
-	fl.TriggerCounter++
-	currentMsg := reactorEvent.Msg
-	transitionNodeId = reactorEvent.TransitionNodeId
-	fl.getLog().Debug(" Next node id = ", transitionNodeId)
+	atomic.AddInt64(&fl.TriggerCounter, 1)
+	fl.getLog().Debug(" Next node id = ", reactorEvent.TransitionNodeId)
 	//fl.getLog().Debug(" Current nodes = ",fl.currentNodeIds)
-	if !fl.IsNodeIdValid(instance.StartNodeId, transitionNodeId) {
-		fl.getLog().Errorf(" Unknown transition node %s from first node.Switching back to first node", transitionNodeId)
-		return
+	if !fl.IsNodeIdValid(instance.StartNodeId, reactorEvent.TransitionNodeId) {
+		fl.getLog().Errorf(" Unknown transition node %s from first node.Switching back to first node", reactorEvent.TransitionNodeId)
+		return outMsg, errors.New("unknown transition node")
 	}
+	fl.traceStartInstance(instance)
+	outMsg, err = fl.runBranch(instance, reactorEvent.Msg, reactorEvent.TransitionNodeId, nil)
+	// Instance is completed only after all parallel branches started by fork nodes are completed
+	instance.branches.Wait()
+	fl.releaseInstance(instance)
+	fl.traceCompleteInstance(instance)
+	return outMsg, err
+}
+
+// runBranch executes nodes starting from transitionNodeId until the branch reaches node without transition.
+// Main branch and every parallel branch started by fork node are executed by own runBranch call , current node is
+// tracked per branch and is passed to tracer , checkpoints and debugger explicitly.
+// Returns the last message of the branch and error of the last executed node.
+func (fl *Flow) runBranch(instance *Instance, currentMsg model.Message, transitionNodeId model.NodeID, groups []model.BranchGroup) (outMsg model.Message, lastErr error) {
+	var currentNodeId model.NodeID
+	var isMerged bool
+	defer func() {
+		if isMerged {
+			fl.leaveFork(instance, groups)
+		} else {
+			fl.endBranch(instance, groups)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			fl.getLog().Error(" Flow process CRASHED with error : ", r)
+			fl.getLog().Errorf(" Crashed while processing message from Current Node = %v Next Node = %v ", currentNodeId, transitionNodeId)
+			transitionNodeId = ""
+			lastErr = fmt.Errorf("flow crashed in node %s : %v", currentNodeId, r)
+			fl.reportError(currentNodeId, lastErr, currentMsg, true)
+		}
+		outMsg = currentMsg
+	}()
 	var nodeOutboundStream chan model.ReactorEvent
 	var loopDetectorCounter int
+	currentMsg.Done = instance.done
 	for {
-		if !fl.opContext.IsFlowRunning {
+		if !fl.isRunning() {
 			break
 		}
+		if !instance.isActive() {
+			return currentMsg, errors.New("instance is canceled")
+		}
 		if time.Now().Sub(fl.StartedAt) < time.Second*5 {
 			if loopDetectorCounter > fl.rateLimiter {
 				fl.getLog().Error("Loop detected. Flow is stopped ")
@@ -343,13 +471,23 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 		}
 
 		for i := range fl.nodes {
-			if !fl.opContext.IsFlowRunning {
+			if !fl.isRunning() {
 				break
 			}
 			if fl.nodes[i].GetMetaNode().Id == transitionNodeId {
 				var err error
 				var nextNodes []model.NodeID
-				instance.CurrentNodeId = fl.nodes[i].GetMetaNode().Id
+				currentNodeId = fl.nodes[i].GetMetaNode().Id
+				if !fl.debugWait(instance, currentNodeId) {
+					return currentMsg, errors.New("instance is terminated by debugger")
+				}
+				traceStartedAt := time.Now()
+				traceInputMsg := currentMsg
+				traceVarsBefore := fl.traceSnapshot(instance)
+				if traceVarsBefore != nil {
+					traceInputMsg = currentMsg.Clone()
+				}
+				isCheckpointed := fl.saveCheckpoint(instance, fl.nodes[i], currentMsg, time.Time{})
 				if fl.nodes[i].IsMsgReactorNode() {
 					// lazy channel init
 					if nodeOutboundStream == nil {
@@ -364,20 +502,40 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 					select {
 					case reactorEvent := <-nodeOutboundStream:
 						fl.getLog().Debug(" New event from reactor node.")
+						reactorEvent.Msg.KeepInstanceScope(&currentMsg)
 						currentMsg = reactorEvent.Msg
 						transitionNodeId = reactorEvent.TransitionNodeId
 						err = reactorEvent.Err
 					case signal := <-fl.opContext.TriggerControlSignalChannel:
 						fl.getLog().Debug("Control signal ")
 						if signal == model.SIGNAL_STOP {
-							return
+							return currentMsg, errors.New("flow is stopped")
 						}
+					case <-instance.done:
+						return currentMsg, errors.New("instance is canceled")
 					}
 
 				} else {
+					if joiner, ok := fl.nodes[i].(model.BranchJoiner); ok {
+						group := model.BranchGroup{InstanceId: instance.ID, Size: 1}
+						if len(groups) > 0 {
+							group = groups[len(groups)-1]
+						}
+						nextNodes, err = joiner.JoinBranch(group, &currentMsg)
+						if len(nextNodes) == 0 {
+							isMerged = true
+						} else if len(groups) > 0 {
+							// Holding branch continues as the branch which executed the fork
+							instance.completeFork(group.ForkId)
+							groups = groups[:len(groups)-1]
+						}
+					} else {
+						nextNodes, err = fl.executeNode(fl.nodes[i], &currentMsg)
+					}
 
-					nextNodes, err = fl.nodes[i].OnInput(&currentMsg)
-
+					if len(nextNodes) > 1 {
+						groups = fl.forkBranches(instance, currentNodeId, currentMsg, nextNodes[1:], groups)
+					}
 					if len(nextNodes) > 0 {
 						transitionNodeId = nextNodes[0]
 					} else {
@@ -385,12 +543,22 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 					}
 				}
 
+				if isCheckpointed {
+					fl.deleteCheckpoint(instance, currentNodeId)
+				}
+				fl.recordNodeLatency(fl.nodes[i], time.Since(traceStartedAt))
+				fl.traceNode(instance, fl.nodes[i], traceInputMsg, traceVarsBefore, traceStartedAt, transitionNodeId, err)
+				lastErr = err
 				if err != nil {
-					fl.ErrorCounter++
+					atomic.AddInt64(&fl.ErrorCounter, 1)
 					fl.getLog().Errorf(" Node executed with error . Doing error transition to %s. Error : %s", transitionNodeId, err)
+					if transitionNodeId == "" {
+						// Node doesn't have error transition
+						fl.reportError(currentNodeId, err, traceInputMsg, false)
+					}
 				}
 
-				if !fl.IsNodeIdValid(instance.CurrentNodeId, transitionNodeId) {
+				if !fl.IsNodeIdValid(currentNodeId, transitionNodeId) {
 					fl.getLog().Errorf(" Unknown transition node %s.Switching back to first node", transitionNodeId)
 					transitionNodeId = ""
 				}
@@ -398,8 +566,7 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 
 			} else if transitionNodeId == "" {
 				// Flow is finished . Returning to first step.
-				instance.CurrentNodeId = ""
-				return
+				return currentMsg, lastErr
 			}
 		}
 		loopDetectorCounter++
@@ -407,7 +574,154 @@ func (fl *Flow) run(reactorEvent model.ReactorEvent) {
 	}
 	//fl.opContext.State = "STOPPED"
 	fl.getLog().Infof(" Runner for flow %s stopped.", fl.Name)
+	return currentMsg, errors.New("flow is stopped")
+}
+
+// forkBranches starts parallel branches of the instance . Every branch gets own copy of the message.
+// Returns branch groups of the calling branch with new group of the fork on top.
+func (fl *Flow) forkBranches(instance *Instance, srcNodeId model.NodeID, msg model.Message, branchNodeIds []model.NodeID, groups []model.BranchGroup) []model.BranchGroup {
+	var validNodeIds []model.NodeID
+	for _, nodeId := range branchNodeIds {
+		if nodeId == "" || !fl.IsNodeIdValid(srcNodeId, nodeId) {
+			fl.getLog().Errorf(" Unknown parallel transition node %s.Branch is skipped", nodeId)
+			continue
+		}
+		validNodeIds = append(validNodeIds, nodeId)
+	}
+	if len(validNodeIds) == 0 {
+		return groups
+	}
+	group := instance.startFork(len(validNodeIds) + 1)
+	// Every branch gets own copy of the stack , so branches can't modify each other's groups
+	branchGroups := append(append(make([]model.BranchGroup, 0, len(groups)+1), groups...), group)
+	for _, nodeId := range validNodeIds {
+		fl.getLog().Debug(" Starting parallel branch from node ", nodeId)
+		atomic.AddInt32(&instance.branchCounter, 1)
+		instance.branches.Add(1)
+		go func(branchMsg model.Message, branchNodeId model.NodeID) {
+			defer instance.branches.Done()
+			fl.runBranch(instance, branchMsg, branchNodeId, append([]model.BranchGroup{}, branchGroups...))
+		}(msg.Clone(), nodeId)
+	}
+	return branchGroups
+}
+
+// startFork registers new fork execution with size branches
+func (instance *Instance) startFork(size int) model.BranchGroup {
+	forkId := atomic.AddInt64(&instance.forkCounter, 1)
+	instance.forksMtx.Lock()
+	if instance.forks == nil {
+		instance.forks = map[int64]int{}
+	}
+	instance.forks[forkId] = size
+	instance.forksMtx.Unlock()
+	return model.BranchGroup{InstanceId: instance.ID, ForkId: forkId, Size: size}
+}
 
+// completeFork is invoked when holding branch continues after join node , branches of the fork aren't tracked anymore
+func (instance *Instance) completeFork(forkId int64) {
+	instance.forksMtx.Lock()
+	delete(instance.forks, forkId)
+	instance.forksMtx.Unlock()
+}
+
+// removeForkBranch returns true if the last branch of the fork is gone and none of them continued after join node
+func (instance *Instance) removeForkBranch(forkId int64) bool {
+	instance.forksMtx.Lock()
+	defer instance.forksMtx.Unlock()
+	live, ok := instance.forks[forkId]
+	if !ok {
+		return false
+	}
+	if live > 1 {
+		instance.forks[forkId] = live - 1
+		return false
+	}
+	delete(instance.forks, forkId)
+	return true
+}
+
+// endBranch notifies join nodes that the branch ended without reaching join node . If all branches of the fork ended ,
+// the branch which executed the fork is treated as ended too.
+func (fl *Flow) endBranch(instance *Instance, groups []model.BranchGroup) {
+	for i := len(groups) - 1; i >= 0; i-- {
+		for j := range fl.nodes {
+			if joiner, ok := fl.nodes[j].(model.BranchJoiner); ok {
+				joiner.BranchEnded(groups[i])
+			}
+		}
+		if !instance.removeForkBranch(groups[i].ForkId) {
+			return
+		}
+	}
+}
+
+// leaveFork removes branch merged by join node from the fork
+func (fl *Flow) leaveFork(instance *Instance, groups []model.BranchGroup) {
+	if len(groups) > 0 && instance.removeForkBranch(groups[len(groups)-1].ForkId) {
+		fl.endBranch(instance, groups[:len(groups)-1])
+	}
+}
+
+// releaseInstance notifies join nodes that all branches of the instance are completed.
+func (fl *Flow) releaseInstance(instance *Instance) {
+	for i := range fl.nodes {
+		if joiner, ok := fl.nodes[i].(model.BranchJoiner); ok {
+			joiner.ReleaseInstance(instance.ID)
+		}
+	}
+}
+
+// Invoke runs flow instance synchronously starting from subflow_trigger node . Input variables are passed to the instance
+// as instance variables of the message , so concurrent calls don't see each other's arguments . Returns message of the last
+// node executed by main branch and instance variables set by the flow.
+func (fl *Flow) Invoke(msg model.Message, vars map[string]model.Variable, timeout time.Duration) (model.Message, map[string]model.Variable, error) {
+	if fl.GetFlowState() != "RUNNING" {
+		return msg, nil, errors.New("flow is not running")
+	}
+	for _, flowId := range msg.CallChain {
+		if flowId == fl.Id {
+			return msg, nil, fmt.Errorf("recursive sub-flow call %s -> %s", strings.Join(msg.CallChain, " -> "), fl.Id)
+		}
+	}
+	var startNode *model.MetaNode
+	for i := range fl.nodes {
+		if fl.nodes[i].GetMetaNode().Type == "subflow_trigger" {
+			startNode = fl.nodes[i].GetMetaNode()
+			break
+		}
+	}
+	if startNode == nil {
+		return msg, nil, errors.New("flow doesn't have subflow_trigger node")
+	}
+	inMsg := msg.Clone()
+	inMsg.Vars = make(map[string]model.Variable, len(vars))
+	for name, v := range vars {
+		inMsg.Vars[name] = v
+	}
+	if !fl.admitInstance() {
+		return msg, nil, errors.New("flow instance is already running")
+	}
+	type instanceResult struct {
+		msg model.Message
+		err error
+	}
+	resultCh := make(chan instanceResult, 1)
+	instance := newInstance(startNode.Id)
+	go func() {
+		outMsg, err := fl.runInstance(instance, model.ReactorEvent{Msg: inMsg, TransitionNodeId: startNode.SuccessTransition, SrcNodeId: startNode.Id})
+		resultCh <- instanceResult{msg: outMsg, err: err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result := <-resultCh:
+		return result.msg, result.msg.Vars, result.err
+	case <-timer.C:
+		// Waiting nodes are woken up and the instance is stopped before next node , instance counter is decremented when it exits
+		instance.cancel()
+		return msg, nil, errors.New("subflow execution timeout")
+	}
 }
 
 // Starts Flow loop in its own goroutine and sets isFlowRunning flag to true
@@ -418,8 +732,15 @@ func (fl *Flow) Start() error {
 		return nil
 	}
 	fl.getLog().Info(" Starting flow : ", fl.Name)
+	fl.mtx.Lock()
+	select {
+	case <-fl.stopSignal:
+		fl.stopSignal = make(chan struct{})
+	default:
+	}
+	fl.mtx.Unlock()
 	fl.opContext.State = "STARTING"
-	fl.opContext.IsFlowRunning = true
+	fl.setRunning(true)
 	fl.LoadAndConfigureAllNodes()
 	if fl.opContext.State == "CONFIGURED" {
 		// Init all nodes
@@ -427,7 +748,7 @@ func (fl *Flow) Start() error {
 		//	fl.nodes[i].Init()
 		//}
 		fl.opContext.State = "RUNNING"
-		fl.opContext.IsFlowRunning = true
+		fl.setRunning(true)
 		fl.getLog().Infof(" Flow %s is running", fl.Name)
 	} else {
 		fl.opContext.State = "NOT_CONFIGURED"
@@ -444,8 +765,9 @@ func (fl *Flow) Stop() error {
 		return nil
 	}
 	fl.getLog().Info(" Stopping flow  ", fl.Name)
-	fl.opContext.IsFlowRunning = false
+	fl.setRunning(false)
 	fl.opContext.State = "STOPPING"
+	fl.signalStop()
 	var breakLoop = false
 	for {
 		// Sending STOP signal to all active triggers
@@ -500,10 +822,12 @@ func (fl *Flow) Stop() error {
 		}
 	}
 
+	// Paused instances must not block the flow from stopping
+	fl.resumePausedInstances(0, false)
 	// Wait until all subflows are stopped
 
 	for {
-		if fl.instanceCounter == 0 {
+		if fl.getInstanceCounter() == 0 {
 			break
 		} else {
 			fl.getLog().Debug(" Some subflows are still running . Waiting.....")
@@ -548,3 +872,7 @@ func (fl *Flow) IsNodeCurrentNode(nodeId model.NodeID) bool {
 func (fl *Flow) SetConnectorRegistry(resources *connector.Registry) {
 	fl.connectorRegistry = resources
 }
+
+func (fl *Flow) SetSubflowInvoker(invoker model.SubflowInvoker) {
+	fl.opContext.SubflowInvoker = invoker
+}
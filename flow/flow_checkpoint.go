@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"sync/atomic"
+	"time"
+)
+
+func (fl *Flow) isCheckpointingEnabled() bool {
+	policy := fl.FlowMeta.InstanceRecoveryPolicy
+	return policy == model.InstanceRecoveryResume || policy == model.InstanceRecoverySkipExpired
+}
+
+// saveCheckpoint stores instance state before waiting node is executed . Returns true if checkpoint was created.
+func (fl *Flow) saveCheckpoint(instance *Instance, node model.Node, msg model.Message, waitUntil time.Time) bool {
+	if !fl.isCheckpointingEnabled() {
+		return false
+	}
+	waitingNode, ok := node.(model.WaitingNode)
+	if !ok {
+		return false
+	}
+	if waitUntil.IsZero() {
+		if waitTime := waitingNode.GetWaitTime(); waitTime > 0 {
+			waitUntil = time.Now().Add(waitTime)
+		}
+	}
+	cp := model.NewInstanceCheckpoint(fl.Id, instance.ID, node.GetMetaNode().Id, msg, waitUntil)
+	if err := fl.globalContext.SaveCheckpoint(&cp); err != nil {
+		fl.getLog().Error(" Can't save instance checkpoint . Err:", err)
+		return false
+	}
+	return true
+}
+
+func (fl *Flow) deleteCheckpoint(instance *Instance, nodeId model.NodeID) {
+	if err := fl.globalContext.DeleteCheckpoint(fl.Id, instance.ID, nodeId); err != nil {
+		fl.getLog().Error(" Can't delete instance checkpoint . Err:", err)
+	}
+}
+
+// ResumeInstances restores instances from checkpoints according to flow InstanceRecoveryPolicy . Is invoked after flow is started.
+// Every checkpoint is resumed as separate instance , so parallel branches of the same instance are not joined after restart.
+func (fl *Flow) ResumeInstances() {
+	checkpoints := fl.globalContext.GetCheckpoints(fl.Id)
+	if len(checkpoints) == 0 {
+		return
+	}
+	fl.globalContext.DeleteCheckpoints(fl.Id)
+	if !fl.isCheckpointingEnabled() || fl.GetFlowState() != "RUNNING" {
+		fl.getLog().Infof(" %d checkpoints dropped , instance recovery is disabled", len(checkpoints))
+		return
+	}
+	for i := range checkpoints {
+		cp := checkpoints[i]
+		node := fl.GetNodeById(cp.NodeId)
+		if node == nil {
+			fl.getLog().Errorf(" Checkpoint node %s doesn't exist . Instance %d is dropped", cp.NodeId, cp.InstanceId)
+			continue
+		}
+		if _, ok := node.(model.WaitingNode); !ok {
+			continue
+		}
+		isExpired := !cp.WaitUntil.IsZero() && time.Now().After(cp.WaitUntil)
+		if isExpired && fl.FlowMeta.InstanceRecoveryPolicy == model.InstanceRecoverySkipExpired {
+			fl.getLog().Infof(" Instance %d expired while tpflow wasn't running . Instance is dropped", cp.InstanceId)
+			continue
+		}
+		for _, rec := range cp.Variables {
+			fl.globalContext.PutRecord(&rec, fl.Id, true)
+		}
+		fl.mtx.Lock()
+		fl.instanceCounter++
+		fl.mtx.Unlock()
+		go fl.resumeInstance(cp, node)
+	}
+}
+
+func (fl *Flow) resumeInstance(cp model.InstanceCheckpoint, node model.Node) {
+	instance := Instance{ID: cp.InstanceId, StartNodeId: cp.NodeId, StartedAt: time.Now(), branchCounter: 1, done: make(chan struct{})}
+	defer func() {
+		fl.mtx.Lock()
+		fl.instanceCounter--
+		fl.mtx.Unlock()
+	}()
+	fl.getLog().Infof(" Resuming instance %d from node %s", cp.InstanceId, cp.NodeId)
+	msg := cp.GetMessage()
+	// Wait node keeps waiting after resume , the instance must survive another restart
+	isCheckpointed := fl.saveCheckpoint(&instance, node, msg, cp.WaitUntil)
+	nextNodes, err := node.(model.WaitingNode).ResumeWait(&msg, cp.WaitUntil)
+	if isCheckpointed {
+		fl.deleteCheckpoint(&instance, cp.NodeId)
+	}
+	if err != nil {
+		fl.getLog().Error(" Instance resume failed . Err:", err)
+		atomic.AddInt64(&fl.ErrorCounter, 1)
+		return
+	}
+	if len(nextNodes) == 0 || nextNodes[0] == "" {
+		return
+	}
+	fl.traceStartInstance(&instance)
+	fl.runBranch(&instance, msg, nextNodes[0], nil)
+	instance.branches.Wait()
+	fl.releaseInstance(&instance)
+	fl.traceCompleteInstance(&instance)
+}
@@ -0,0 +1,83 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"strings"
+)
+
+// DefaultConnectorId - connector used by fimp nodes if ConnectorID is not set in node config
+const DefaultConnectorId = "fimpmqtt"
+
+// Node types which use default connector if connector isn't set explicitly
+var defaultConnectorNodeTypes = map[string]bool{"trigger": true, "vinc_trigger": true, "receive": true, "action": true}
+
+// Node types which reference connector instance but don't hold its client . The flow doesn't depend on such connectors ,
+// it must not be restarted when connector is re-created and must keep running while connector is down.
+var connectorObserverNodeTypes = map[string]bool{"connector_state": true}
+
+// IsConnectorUsed returns true if at least one node of the flow is holding client of connector instance
+func (fl *Flow) IsConnectorUsed(connectorId string) bool {
+	for _, id := range fl.GetUsedConnectors() {
+		if id == connectorId {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUsedConnectors returns ids of connector instances nodes of the flow are holding clients of
+func (fl *Flow) GetUsedConnectors() []string {
+	var result []string
+	used := map[string]bool{}
+	for _, metaNode := range fl.FlowMeta.Nodes {
+		if connectorObserverNodeTypes[metaNode.Type] {
+			continue
+		}
+		nodeConnectorId := getNodeConnectorId(metaNode)
+		if nodeConnectorId == "" && defaultConnectorNodeTypes[metaNode.Type] {
+			nodeConnectorId = DefaultConnectorId
+		}
+		if nodeConnectorId != "" && !used[nodeConnectorId] {
+			used[nodeConnectorId] = true
+			result = append(result, nodeConnectorId)
+		}
+	}
+	return result
+}
+
+// getConnectorsDown returns connectors used by the flow which are missing or not running
+func (fl *Flow) getConnectorsDown() []string {
+	var result []string
+	if fl.connectorRegistry == nil {
+		return result
+	}
+	for _, id := range fl.GetUsedConnectors() {
+		inst := fl.connectorRegistry.GetInstance(id)
+		if inst == nil || inst.Connection == nil || inst.Connection.GetState() != "RUNNING" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Restart stops the flow , drops all loaded nodes and starts the flow again , so nodes re-resolve their connections.
+func (fl *Flow) Restart() error {
+	fl.Stop()
+	fl.nodes = nil
+	return fl.Start()
+}
+
+// getNodeConnectorId extracts connector id from node config , nodes use both ConnectorID and ConnectorId field names
+func getNodeConnectorId(metaNode model.MetaNode) string {
+	config, ok := metaNode.Config.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for key, value := range config {
+		if strings.EqualFold(key, "ConnectorId") {
+			id, _ := value.(string)
+			return id
+		}
+	}
+	return ""
+}
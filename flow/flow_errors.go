@@ -0,0 +1,39 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"time"
+)
+
+// FlowError describes node error which wasn't handled by error transition of the node , or node panic.
+type FlowError struct {
+	FlowId    string
+	FlowName  string
+	NodeId    model.NodeID
+	NodeLabel string
+	NodeType  string
+	Error     string
+	IsPanic   bool
+	Message   model.Message // message which caused the error
+	CreatedAt time.Time
+}
+
+// ErrorReporter is invoked by flow on every unhandled node error
+type ErrorReporter func(flowError FlowError)
+
+func (fl *Flow) SetErrorReporter(reporter ErrorReporter) {
+	fl.errorReporter = reporter
+}
+
+// reportError sends unhandled error to error reporter configured by manager
+func (fl *Flow) reportError(nodeId model.NodeID, err error, msg model.Message, isPanic bool) {
+	if fl.errorReporter == nil || err == nil {
+		return
+	}
+	flowError := FlowError{FlowId: fl.Id, FlowName: fl.Name, NodeId: nodeId, Error: err.Error(), IsPanic: isPanic, Message: msg.Clone(), CreatedAt: time.Now()}
+	if node := fl.GetNodeById(nodeId); node != nil {
+		flowError.NodeLabel = node.GetMetaNode().Label
+		flowError.NodeType = node.GetMetaNode().Type
+	}
+	fl.errorReporter(flowError)
+}
@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"sync/atomic"
+	"time"
+)
+
+// NodeLatencyBuckets - upper bounds (in seconds) of node execution latency histogram buckets
+var NodeLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NodeMetrics - execution statistics of a single node . Execution time of reactor (trigger , receive) nodes is not
+// measured because most of the time they are waiting for messages.
+type NodeMetrics struct {
+	NodeId           model.NodeID
+	NodeType         string
+	NodeLabel        string
+	IsTrigger        bool
+	BucketCounters   []uint64 // number of executions per NodeLatencyBuckets bucket , not cumulative , the last item is +Inf bucket
+	LatencySum       float64  // total execution time in seconds
+	ExecutionCounter uint64
+	ReceivedMessages int64  // number of messages received by trigger node
+	RetryCounter     uint64 // number of execution retries done by retry policy
+}
+
+// FlowMetrics - flow statistics exported by metrics endpoint
+type FlowMetrics struct {
+	FlowId           string
+	FlowName         string
+	State            string
+	TriggerCounter   int64
+	ErrorCounter     int64
+	RetryCounter     int64
+	RunningInstances int
+	Nodes            []NodeMetrics
+}
+
+type nodeLatency struct {
+	bucketCounters []uint64
+	sum            float64
+	counter        uint64
+}
+
+func (fl *Flow) recordNodeLatency(node model.Node, duration time.Duration) {
+	if node.IsMsgReactorNode() {
+		return
+	}
+	seconds := duration.Seconds()
+	fl.metricsMtx.Lock()
+	defer fl.metricsMtx.Unlock()
+	if fl.nodeLatency == nil {
+		fl.nodeLatency = map[model.NodeID]*nodeLatency{}
+	}
+	latency, ok := fl.nodeLatency[node.GetMetaNode().Id]
+	if !ok {
+		latency = &nodeLatency{bucketCounters: make([]uint64, len(NodeLatencyBuckets)+1)}
+		fl.nodeLatency[node.GetMetaNode().Id] = latency
+	}
+	bucket := len(NodeLatencyBuckets)
+	for i := range NodeLatencyBuckets {
+		if seconds <= NodeLatencyBuckets[i] {
+			bucket = i
+			break
+		}
+	}
+	latency.bucketCounters[bucket]++
+	latency.sum += seconds
+	latency.counter++
+}
+
+// GetMetrics returns snapshot of flow and node statistics
+func (fl *Flow) GetMetrics() FlowMetrics {
+	fl.mtx.Lock()
+	metrics := FlowMetrics{
+		FlowId:           fl.Id,
+		FlowName:         fl.Name,
+		State:            fl.opContext.State,
+		TriggerCounter:   atomic.LoadInt64(&fl.TriggerCounter),
+		ErrorCounter:     atomic.LoadInt64(&fl.ErrorCounter),
+		RetryCounter:     atomic.LoadInt64(&fl.RetryCounter),
+		RunningInstances: fl.instanceCounter,
+	}
+	fl.mtx.Unlock()
+
+	fl.metricsMtx.Lock()
+	defer fl.metricsMtx.Unlock()
+	for i := range fl.nodes {
+		meta := fl.nodes[i].GetMetaNode()
+		nodeMetrics := NodeMetrics{NodeId: meta.Id, NodeType: meta.Type, NodeLabel: meta.Label, IsTrigger: fl.nodes[i].IsStartNode(),
+			BucketCounters: make([]uint64, len(NodeLatencyBuckets)+1)}
+		if latency, ok := fl.nodeLatency[meta.Id]; ok {
+			copy(nodeMetrics.BucketCounters, latency.bucketCounters)
+			nodeMetrics.LatencySum = latency.sum
+			nodeMetrics.ExecutionCounter = latency.counter
+		}
+		nodeMetrics.RetryCounter = fl.nodeRetries[meta.Id]
+		if counter, ok := fl.nodes[i].(model.ReceivedMsgCounter); ok {
+			nodeMetrics.ReceivedMessages = counter.GetReceivedMsgCounter()
+		}
+		metrics.Nodes = append(metrics.Nodes, nodeMetrics)
+	}
+	return metrics
+}
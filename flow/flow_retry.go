@@ -0,0 +1,78 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"sync/atomic"
+	"time"
+)
+
+// executeNode invokes node and retries failed execution according to node retry policy . Every attempt gets copy of
+// the original input message . Retries are cancelled if the flow is stopped , the instance is canceled or waiting nodes are terminated.
+func (fl *Flow) executeNode(node model.Node, msg *model.Message) ([]model.NodeID, error) {
+	policy := node.GetMetaNode().RetryPolicy
+	if policy == nil || policy.MaxAttempts < 2 {
+		return node.OnInput(msg)
+	}
+	inputMsg := msg.Clone()
+	nextNodes, err := node.OnInput(msg)
+	for attempt := 1; policy.ShouldRetry(err, attempt); attempt++ {
+		delay := policy.GetDelay(attempt)
+		fl.getLog().Infof(" Node %s failed , attempt %d of %d . Retrying after %s . Error : %s", node.GetMetaNode().Label, attempt, policy.MaxAttempts, delay, err)
+		if !fl.waitForRetry(delay, msg.Done) {
+			fl.getLog().Info(" Retry is cancelled")
+			return nil, err
+		}
+		fl.recordNodeRetry(node)
+		*msg = inputMsg.Clone()
+		nextNodes, err = node.OnInput(msg)
+	}
+	return nextNodes, err
+}
+
+// waitForRetry returns false if the flow was stopped , the instance was canceled or waiting nodes were terminated during the delay.
+// Stop signal is a closed channel , so every instance which waits for retry is woken up.
+func (fl *Flow) waitForRetry(delay time.Duration, done <-chan struct{}) bool {
+	if !fl.isRunning() {
+		return false
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return fl.isRunning()
+	case <-fl.getStopSignal():
+		return false
+	case <-done:
+		return false
+	case signal := <-fl.opContext.NodeControlSignalChannel:
+		fl.getLog().Debug(" Control signal during retry delay : ", signal)
+		return false
+	}
+}
+
+func (fl *Flow) getStopSignal() <-chan struct{} {
+	fl.mtx.Lock()
+	defer fl.mtx.Unlock()
+	return fl.stopSignal
+}
+
+// signalStop closes stop signal channel , channel is recreated by Start
+func (fl *Flow) signalStop() {
+	fl.mtx.Lock()
+	defer fl.mtx.Unlock()
+	select {
+	case <-fl.stopSignal:
+	default:
+		close(fl.stopSignal)
+	}
+}
+
+func (fl *Flow) recordNodeRetry(node model.Node) {
+	atomic.AddInt64(&fl.RetryCounter, 1)
+	fl.metricsMtx.Lock()
+	defer fl.metricsMtx.Unlock()
+	if fl.nodeRetries == nil {
+		fl.nodeRetries = map[model.NodeID]uint64{}
+	}
+	fl.nodeRetries[node.GetMetaNode().Id]++
+}
@@ -0,0 +1,147 @@
+package flow
+
+import (
+	"errors"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// flakyNode fails until number of failures is reached , modifies input message to check that retries get original message
+type flakyNode struct {
+	base.BaseNode
+	failures int
+	calls    int
+	inputs   []interface{}
+}
+
+func newFlakyNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, failures int) *flakyNode {
+	node := flakyNode{failures: failures}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *flakyNode) LoadNodeConfig() error                                { return nil }
+func (node *flakyNode) WaitForEvent(responseChannel chan model.ReactorEvent) {}
+
+func (node *flakyNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	node.calls++
+	node.inputs = append(node.inputs, msg.Payload.Value)
+	msg.Payload.Value = "modified"
+	if node.calls <= node.failures {
+		return []model.NodeID{node.Meta().ErrorTransition}, errors.New("connection timeout")
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+func TestFlow_RetryPolicy(t *testing.T) {
+	ctx, err := model.NewContextDB("TestRetryFlow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("TestRetryFlow.db")
+	defer ctx.Close()
+	fl := NewFlow(model.FlowMeta{Id: "TestRetryFlow"}, ctx)
+	fl.opContext.IsFlowRunning = true
+
+	policy := &model.RetryPolicy{MaxAttempts: 3, Backoff: model.RetryBackoffExponential, Delay: 1}
+	node := newFlakyNode(&fl.opContext, model.MetaNode{Id: "1", SuccessTransition: "2", ErrorTransition: "3", RetryPolicy: policy}, 2)
+	msg := model.Message{}
+	msg.Payload.Value = "original"
+	nextNodes, err := fl.executeNode(node, &msg)
+	if err != nil || len(nextNodes) != 1 || nextNodes[0] != "2" || node.calls != 3 {
+		t.Fatalf("Node must succeed on the 3rd attempt . calls = %d , err = %v", node.calls, err)
+	}
+	for _, input := range node.inputs {
+		if input != "original" {
+			t.Error("Retry must get original message , got ", input)
+		}
+	}
+	if fl.GetMetrics().RetryCounter != 2 || fl.nodeRetries["1"] != 2 {
+		t.Error("Wrong retry counters")
+	}
+
+	// Error which doesn't match RetryOn isn't retried
+	policy = &model.RetryPolicy{MaxAttempts: 3, RetryOn: []string{"503"}}
+	node = newFlakyNode(&fl.opContext, model.MetaNode{Id: "4", ErrorTransition: "3", RetryPolicy: policy}, 2)
+	if _, err = fl.executeNode(node, &msg); err == nil || node.calls != 1 {
+		t.Error("Error must not be retried , calls = ", node.calls)
+	}
+
+	// Retry is cancelled by terminate signal
+	policy = &model.RetryPolicy{MaxAttempts: 5, Delay: 5000}
+	node = newFlakyNode(&fl.opContext, model.MetaNode{Id: "5", ErrorTransition: "3", RetryPolicy: policy}, 5)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fl.opContext.NodeControlSignalChannel <- model.SIGNAL_TERMINATE_WAITING
+	}()
+	startedAt := time.Now()
+	nextNodes, err = fl.executeNode(node, &msg)
+	if err == nil || len(nextNodes) != 0 || node.calls != 1 || time.Since(startedAt) > time.Second {
+		t.Error("Retry wasn't cancelled , calls = ", node.calls)
+	}
+
+	// Retry is cancelled by cancellation of the instance
+	done := make(chan struct{})
+	node = newFlakyNode(&fl.opContext, model.MetaNode{Id: "6", ErrorTransition: "3", RetryPolicy: policy}, 5)
+	time.AfterFunc(50*time.Millisecond, func() { close(done) })
+	startedAt = time.Now()
+	if _, err = fl.executeNode(node, &model.Message{Done: done}); err == nil || node.calls != 1 || time.Since(startedAt) > time.Second {
+		t.Error("Retry wasn't cancelled by instance cancel , calls = ", node.calls)
+	}
+}
+
+func TestFlow_RetryCancelledByStop(t *testing.T) {
+	fl := NewFlow(model.FlowMeta{Id: "TestRetryStopFlow"}, model.NewInMemoryContext())
+	fl.opContext.IsFlowRunning = true
+	policy := &model.RetryPolicy{MaxAttempts: 5, Delay: 5000}
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		node := newFlakyNode(&fl.opContext, model.MetaNode{Id: model.NodeID(strconv.Itoa(i)), ErrorTransition: "3", RetryPolicy: policy}, 5)
+		go func() {
+			_, err := fl.executeNode(node, &model.Message{})
+			results <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	// Every waiting instance must be woken up , not only the one which gets control signal
+	fl.signalStop()
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-results:
+			if err == nil {
+				t.Error("Error of the last attempt expected")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Retry wasn't cancelled by stop")
+		}
+	}
+}
+
+func TestRetryPolicy_GetDelay(t *testing.T) {
+	policy := model.RetryPolicy{MaxAttempts: 10, Backoff: model.RetryBackoffExponential, Delay: 100, MaxDelay: 500}
+	expected := []time.Duration{100, 200, 400, 500, 500}
+	for i, delay := range expected {
+		if policy.GetDelay(i+1) != delay*time.Millisecond {
+			t.Errorf("Attempt %d , expected %s , got %s", i+1, delay*time.Millisecond, policy.GetDelay(i+1))
+		}
+	}
+	policy.Backoff = model.RetryBackoffFixed
+	if policy.GetDelay(5) != 100*time.Millisecond {
+		t.Error("Fixed delay must not grow")
+	}
+	// Delay without max delay must not overflow
+	policy = model.RetryPolicy{MaxAttempts: model.MaxRetryAttempts, Backoff: model.RetryBackoffExponential, Delay: 1000}
+	if delay := policy.GetDelay(model.MaxRetryAttempts); delay != model.DefaultRetryMaxDelay {
+		t.Error("Delay must be limited by default max delay , got ", delay)
+	}
+	policy.MaxAttempts = model.MaxRetryAttempts + 1
+	if len(policy.Validate()) != 1 {
+		t.Error("Too many attempts must be reported")
+	}
+}
@@ -7,13 +7,18 @@ import (
 	"github.com/thingsplex/tpflow/model"
 	actfimp "github.com/thingsplex/tpflow/node/action/fimp"
 	"github.com/thingsplex/tpflow/node/action/rest"
+	"github.com/thingsplex/tpflow/node/control/fork"
 	"github.com/thingsplex/tpflow/node/control/ifn"
+	"github.com/thingsplex/tpflow/node/control/join"
 	"github.com/thingsplex/tpflow/node/control/loop"
+	"github.com/thingsplex/tpflow/node/control/subflow"
+	"github.com/thingsplex/tpflow/node/control/timer"
 	"github.com/thingsplex/tpflow/node/data/setvar"
 	"github.com/thingsplex/tpflow/node/data/transform"
 	trigfimp "github.com/thingsplex/tpflow/node/trigger/fimp"
 	trigtime "github.com/thingsplex/tpflow/node/trigger/time"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -771,3 +776,508 @@ func TestTimeTriggerFlow(t *testing.T) {
 	os.Remove("TestTimeTriggerFlow.db")
 
 }
+
+func TestFlow_ForkJoin(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx, err := model.NewContextDB("TestForkJoinFlow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowMeta := model.FlowMeta{Id: "TestForkJoinFlow"}
+
+	node := model.MetaNode{Id: "1", Label: "Fork", Type: "fork", SuccessTransition: "2",
+		Config: fork.NodeConfig{Transitions: []model.NodeID{"3", "4"}}}
+	flowMeta.Nodes = append(flowMeta.Nodes, node)
+	for _, id := range []model.NodeID{"2", "3", "4"} {
+		node = model.MetaNode{Id: id, Label: "Set variable", Type: "set_variable", SuccessTransition: "5",
+			Config: setvar.SetVariableNodeConfig{Name: "branch_" + string(id), IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}}
+		flowMeta.Nodes = append(flowMeta.Nodes, node)
+	}
+	node = model.MetaNode{Id: "5", Label: "Join", Type: "join", SuccessTransition: "6", Config: join.NodeConfig{Timeout: 5}}
+	flowMeta.Nodes = append(flowMeta.Nodes, node)
+	// loop node counts how many branches passed through the join
+	node = model.MetaNode{Id: "6", Label: "Counter", Type: "loop", Config: loop.NodeConfig{StartValue: 0, EndValue: 100}}
+	flowMeta.Nodes = append(flowMeta.Nodes, node)
+
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(time.Second * 1)
+
+	for _, name := range []string{"branch_2", "branch_3", "branch_4"} {
+		if _, err := ctx.GetVariable(name, flowMeta.Id); err != nil {
+			t.Error("Branch wasn't executed , variable ", name)
+		}
+	}
+	counter, err := ctx.GetVariable("loop_counter", flowMeta.Id)
+	if err != nil {
+		t.Error("Join node didn't continue the flow")
+	} else if counter.Value.(int64) != 1 {
+		t.Error("Join node continued the flow more than once , counter = ", counter.Value)
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestForkJoinFlow.db")
+}
+
+func TestFlow_SequentialForkJoin(t *testing.T) {
+	ctx, err := model.NewContextDB("TestSequentialForkJoin.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowMeta := model.FlowMeta{Id: "TestSequentialForkJoin"}
+	// Two fork/join pairs in sequence , both joins are executed by the same instance
+	for _, pair := range [][]model.NodeID{{"1", "2", "3", "4", "5"}, {"5", "6", "7", "8", "9"}} {
+		flowMeta.Nodes = append(flowMeta.Nodes, model.MetaNode{Id: pair[0], Label: "Fork", Type: "fork", SuccessTransition: pair[1],
+			Config: fork.NodeConfig{Transitions: []model.NodeID{pair[2]}}})
+		for _, id := range pair[1:3] {
+			flowMeta.Nodes = append(flowMeta.Nodes, model.MetaNode{Id: id, Label: "Set variable", Type: "set_variable", SuccessTransition: pair[3],
+				Config: setvar.SetVariableNodeConfig{Name: "branch_" + string(id), IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}})
+		}
+		flowMeta.Nodes = append(flowMeta.Nodes, model.MetaNode{Id: pair[3], Label: "Join", Type: "join", SuccessTransition: pair[4]})
+	}
+	flowMeta.Nodes = append(flowMeta.Nodes, model.MetaNode{Id: "9", Label: "Counter", Type: "loop", Config: loop.NodeConfig{StartValue: 0, EndValue: 100}})
+
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(500 * time.Millisecond)
+
+	counter, err := ctx.GetVariable("loop_counter", flowMeta.Id)
+	if err != nil || counter.Value.(int64) != 1 {
+		t.Error("The second join must continue the flow exactly once ", counter.Value, err)
+	}
+	if flow.getInstanceCounter() != 0 {
+		t.Error("Instance wasn't completed")
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestSequentialForkJoin.db")
+}
+
+func TestFlow_LoopThroughJoin(t *testing.T) {
+	ctx, err := model.NewContextDB("TestLoopThroughJoin.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowMeta := model.FlowMeta{Id: "TestLoopThroughJoin", Nodes: []model.MetaNode{
+		{Id: "1", Label: "Fork", Type: "fork", SuccessTransition: "2", Config: fork.NodeConfig{Transitions: []model.NodeID{"3"}}},
+		{Id: "2", Label: "Branch 1", Type: "set_variable", SuccessTransition: "4",
+			Config: setvar.SetVariableNodeConfig{Name: "branch_2", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+		{Id: "3", Label: "Branch 2", Type: "set_variable", SuccessTransition: "4",
+			Config: setvar.SetVariableNodeConfig{Name: "branch_3", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+		{Id: "4", Label: "Join", Type: "join", SuccessTransition: "5"},
+		// Loop goes back to the fork 3 times and continues to node 6 at the end
+		{Id: "5", Label: "Loop", Type: "loop", SuccessTransition: "1", ErrorTransition: "6", Config: loop.NodeConfig{StartValue: 0, EndValue: 3}},
+		{Id: "6", Label: "Finished", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "finished", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "yes", ValueType: "string"}}},
+	}}
+
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(500 * time.Millisecond)
+
+	if v, err := ctx.GetVariable("finished", flowMeta.Id); err != nil || v.Value != "yes" {
+		t.Error("Instance didn't pass the join on every iteration")
+	}
+	if flow.getInstanceCounter() != 0 {
+		t.Error("Instance wasn't completed")
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestLoopThroughJoin.db")
+}
+
+func TestFlow_JoinBranchEnded(t *testing.T) {
+	ctx, err := model.NewContextDB("TestJoinBranchEnded.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Branch 3 ends without reaching the join , join without timeout must not wait for it forever
+	flowMeta := model.FlowMeta{Id: "TestJoinBranchEnded", Nodes: []model.MetaNode{
+		{Id: "1", Label: "Fork", Type: "fork", SuccessTransition: "2", Config: fork.NodeConfig{Transitions: []model.NodeID{"3"}}},
+		{Id: "2", Label: "Join", Type: "join", SuccessTransition: "4", TimeoutTransition: "5"},
+		{Id: "3", Label: "Dead end", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "branch_3", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+		{Id: "4", Label: "Joined", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "result", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "joined", ValueType: "string"}}},
+		{Id: "5", Label: "Partial", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "result", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "partial", ValueType: "string"}}},
+	}}
+
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(500 * time.Millisecond)
+
+	if v, err := ctx.GetVariable("result", flowMeta.Id); err != nil || v.Value != "partial" {
+		t.Error("Join must continue via timeout transition ", v.Value, err)
+	}
+	if flow.getInstanceCounter() != 0 {
+		t.Error("Instance wasn't completed")
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestJoinBranchEnded.db")
+}
+
+func TestFlow_TimerExpirySkippedByKeepFirst(t *testing.T) {
+	ctx := model.NewInMemoryContext()
+	flowMeta := model.FlowMeta{Id: "TestTimerKeepFirst", ParallelExecution: model.ParallelExecutionKeepFirst, Nodes: []model.MetaNode{
+		{Id: "1", Label: "Timer", Type: "timer", SuccessTransition: "2", Config: timer.NodeConfig{Operation: timer.OpStart, Duration: 1, ExpiryTransition: "3"}},
+		{Id: "2", Label: "Wait", Type: "wait", Config: float64(1500)},
+		{Id: "3", Label: "Expired", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "expired", IsVariableInMemory: true, DefaultValue: model.Variable{Value: true, ValueType: "bool"}}},
+	}}
+	flow := NewFlow(flowMeta, ctx)
+	errs := make(chan FlowError, 1)
+	flow.SetErrorReporter(func(flowError FlowError) {
+		errs <- flowError
+	})
+	flow.Start()
+	// The instance is still waiting when the timer expires
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	select {
+	case flowError := <-errs:
+		if flowError.NodeId != "3" {
+			t.Error("Skipped expiry must be reported for expiry transition node , got ", flowError.NodeId)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Skipped expiry wasn't reported")
+	}
+	flow.Stop()
+}
+
+func TestFlow_Subflow(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx, err := model.NewContextDB("TestSubflow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subMeta := model.FlowMeta{Id: "TestSubflowCallee"}
+	node := model.MetaNode{Id: "1", Label: "Entry", Type: "subflow_trigger", SuccessTransition: "2"}
+	subMeta.Nodes = append(subMeta.Nodes, node)
+	node = model.MetaNode{Id: "2", Label: "Set output var", Type: "set_variable", SuccessTransition: "3",
+		Config: setvar.SetVariableNodeConfig{Name: "out", UpdateInstance: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}}
+	subMeta.Nodes = append(subMeta.Nodes, node)
+	node = model.MetaNode{Id: "3", Label: "Set output msg", Type: "set_variable",
+		Config: setvar.SetVariableNodeConfig{UpdateInputMsg: true, DefaultValue: model.Variable{Value: "processed", ValueType: "string"}}}
+	subMeta.Nodes = append(subMeta.Nodes, node)
+	subFlow := NewFlow(subMeta, ctx)
+	subFlow.Start()
+
+	callerMeta := model.FlowMeta{Id: "TestSubflowCaller"}
+	node = model.MetaNode{Id: "1", Label: "Call", Type: "subflow", SuccessTransition: "2",
+		Config: subflow.NodeConfig{
+			FlowId:         subMeta.Id,
+			InputVariables: []subflow.InputVariable{{Name: "in", Value: model.Variable{Value: "hello", ValueType: "string"}}},
+			OutputVariables: []subflow.OutputVariable{{Name: "in", TargetVariableName: "echo", IsTargetInMemory: true},
+				{Name: "out", IsTargetInMemory: true}},
+			UpdateInputMsg: true,
+		}}
+	callerMeta.Nodes = append(callerMeta.Nodes, node)
+	node = model.MetaNode{Id: "2", Label: "Save result", Type: "set_variable",
+		Config: setvar.SetVariableNodeConfig{Name: "result", IsVariableInMemory: true}}
+	callerMeta.Nodes = append(callerMeta.Nodes, node)
+	callerFlow := NewFlow(callerMeta, ctx)
+	callerFlow.SetSubflowInvoker(func(flowId string, msg model.Message, vars map[string]model.Variable, timeout time.Duration) (model.Message, map[string]model.Variable, error) {
+		return subFlow.Invoke(msg, vars, timeout)
+	})
+	callerFlow.Start()
+	callerFlow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(time.Second * 1)
+
+	if v, err := ctx.GetVariable("echo", callerMeta.Id); err != nil || v.Value != "hello" {
+		t.Error("Input variable wasn't returned by sub-flow", err)
+	}
+	if v, err := ctx.GetVariable("out", callerMeta.Id); err != nil || v.Value != "done" {
+		t.Error("Output variable wasn't returned by sub-flow", err)
+	}
+	if v, err := ctx.GetVariable("result", callerMeta.Id); err != nil || v.Value != "processed" {
+		t.Error("Output message wasn't returned by sub-flow", err)
+	}
+	if len(ctx.GetRecords(subMeta.Id)) != 0 {
+		t.Error("Arguments must not be stored as sub-flow variables")
+	}
+	callerFlow.Stop()
+	subFlow.Stop()
+	ctx.Close()
+	os.Remove("TestSubflow.db")
+}
+
+func TestFlow_SubflowConcurrentCalls(t *testing.T) {
+	ctx := model.NewInMemoryContext()
+	subMeta := model.FlowMeta{Id: "TestSubflowConcurrent", Nodes: []model.MetaNode{
+		{Id: "1", Label: "Entry", Type: "subflow_trigger", SuccessTransition: "2"},
+		{Id: "2", Label: "Wait", Type: "wait", Config: float64(200)},
+	}}
+	subFlow := NewFlow(subMeta, ctx)
+	subFlow.Start()
+	results := make(chan bool, 2)
+	for _, arg := range []string{"a", "b"} {
+		go func(arg string) {
+			_, vars, err := subFlow.Invoke(model.Message{}, map[string]model.Variable{"in": {ValueType: "string", Value: arg}}, time.Second)
+			results <- err == nil && vars["in"].Value == arg
+		}(arg)
+	}
+	for i := 0; i < 2; i++ {
+		if !<-results {
+			t.Error("Concurrent call got wrong arguments")
+		}
+	}
+	// Instance which exceeds the timeout is canceled
+	if _, _, err := subFlow.Invoke(model.Message{}, nil, 50*time.Millisecond); err == nil {
+		t.Error("Timeout error expected")
+	}
+	time.Sleep(300 * time.Millisecond)
+	if counter := subFlow.getInstanceCounter(); counter != 0 {
+		t.Error("Instance counter wasn't reconciled ", counter)
+	}
+	subFlow.Stop()
+}
+
+// offlineFimpConn provides fimp transport which isn't connected to broker , receive node can subscribe but never gets messages
+type offlineFimpConn struct {
+	transport *fimpgo.MqttTransport
+}
+
+func (conn *offlineFimpConn) LoadConfig(config interface{}) error { return nil }
+func (conn *offlineFimpConn) Init() error                         { return nil }
+func (conn *offlineFimpConn) Stop()                               {}
+func (conn *offlineFimpConn) GetConnection() interface{}          { return conn.transport }
+func (conn *offlineFimpConn) GetState() string                    { return "RUNNING" }
+
+func TestFlow_SubflowTimeoutWakesReceive(t *testing.T) {
+	ctx := model.NewInMemoryContext()
+	conReg := connector.NewRegistry("")
+	conReg.AddConnection("fimpmqtt", "fimpmqtt", "fimpmqtt", &offlineFimpConn{transport: fimpgo.NewMqttTransport("tcp://localhost:1", "flow_test", "", "", true, 1, 1)})
+	subMeta := model.FlowMeta{Id: "TestSubflowReceive", ParallelExecution: model.ParallelExecutionKeepFirst, Nodes: []model.MetaNode{
+		{Id: "1", Label: "Entry", Type: "subflow_trigger", SuccessTransition: "2"},
+		{Id: "2", Label: "Receive", Type: "receive", Address: "pt:j1/mt:evt/rt:dev/rn:test/ad:1/sv:out_bin_switch/ad:300_0",
+			Service: "out_bin_switch", ServiceInterface: "evt.binary.report", Config: trigfimp.ReceiveConfig{Timeout: 0}},
+	}}
+	subFlow := NewFlow(subMeta, ctx)
+	subFlow.SetConnectorRegistry(conReg)
+	subFlow.Start()
+	for i := 0; i < 2; i++ {
+		// The second call is admitted only if the first instance was stopped
+		if _, _, err := subFlow.Invoke(model.Message{}, nil, 100*time.Millisecond); err == nil || err.Error() != "subflow execution timeout" {
+			t.Fatal("Timeout error expected , got ", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if counter := subFlow.getInstanceCounter(); counter != 0 {
+			t.Fatal("Instance blocked in receive node wasn't stopped , instances = ", counter)
+		}
+	}
+	subFlow.Stop()
+}
+
+func TestFlow_SubflowRecursion(t *testing.T) {
+	ctx := model.NewInMemoryContext()
+	flows := map[string]*Flow{}
+	invoker := func(flowId string, msg model.Message, vars map[string]model.Variable, timeout time.Duration) (model.Message, map[string]model.Variable, error) {
+		return flows[flowId].Invoke(msg, vars, timeout)
+	}
+	for _, ids := range [][2]string{{"TestRecursionA", "TestRecursionB"}, {"TestRecursionB", "TestRecursionA"}} {
+		meta := model.FlowMeta{Id: ids[0], Nodes: []model.MetaNode{
+			{Id: "1", Label: "Entry", Type: "subflow_trigger", SuccessTransition: "2"},
+			{Id: "2", Label: "Call", Type: "subflow", Config: subflow.NodeConfig{FlowId: ids[1], Timeout: 5}},
+		}}
+		flows[ids[0]] = NewFlow(meta, ctx)
+		flows[ids[0]].SetSubflowInvoker(invoker)
+		flows[ids[0]].Start()
+	}
+	startedAt := time.Now()
+	_, _, err := flows["TestRecursionA"].Invoke(model.Message{}, nil, 5*time.Second)
+	if err == nil || time.Since(startedAt) > time.Second {
+		t.Error("Indirect recursion must be rejected without waiting for timeout ", err)
+	}
+	for _, fl := range flows {
+		fl.Stop()
+	}
+}
+
+func TestFlow_Trace(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx, err := model.NewContextDB("TestTraceFlow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowMeta := model.FlowMeta{Id: "TestTraceFlow"}
+	for i, id := range []model.NodeID{"1", "2", "3"} {
+		var next model.NodeID
+		if i < 2 {
+			next = model.NodeID(strconv.Itoa(i + 2))
+		}
+		node := model.MetaNode{Id: id, Label: "Set variable", Type: "set_variable", SuccessTransition: next,
+			Config: setvar.SetVariableNodeConfig{Name: "var_" + string(id), IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}}
+		flowMeta.Nodes = append(flowMeta.Nodes, node)
+	}
+
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.EnableTrace(true)
+	flow.SetBreakpoints([]model.NodeID{"2"})
+	flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(time.Millisecond * 300)
+
+	state := flow.GetDebuggerState()
+	if len(state.PausedInstances) != 1 || state.PausedInstances[0].NodeId != "2" {
+		t.Fatal("Instance is not paused at breakpoint , state = ", state)
+	}
+	if _, err := ctx.GetVariable("var_2", flowMeta.Id); err == nil {
+		t.Error("Breakpoint node was executed before step")
+	}
+	instanceId := state.PausedInstances[0].InstanceId
+	if err := flow.StepInstance(instanceId); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 300)
+	state = flow.GetDebuggerState()
+	if len(state.PausedInstances) != 1 || state.PausedInstances[0].NodeId != "3" {
+		t.Fatal("Instance is not paused after step , state = ", state)
+	}
+	if err := flow.ContinueInstance(instanceId); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 300)
+
+	traces := flow.GetTraces(instanceId)
+	if len(traces) != 1 || !traces[0].IsCompleted {
+		t.Fatal("Trace is not completed , traces = ", traces)
+	}
+	steps := traces[0].Steps
+	if len(steps) != 3 {
+		t.Fatal("Wrong number of steps = ", len(steps))
+	}
+	if steps[1].NodeId != "2" || steps[1].Transition != "3" {
+		t.Error("Wrong step record ", steps[1])
+	}
+	if len(steps[1].ChangedVariables) != 1 || steps[1].ChangedVariables[0].Name != "var_2" || steps[1].ChangedVariables[0].OldValue != nil {
+		t.Error("Variable change wasn't recorded ", steps[1].ChangedVariables)
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestTraceFlow.db")
+}
+
+func TestFlow_InstanceRecovery(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx, err := model.NewContextDB("TestInstanceRecoveryFlow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flowMeta := model.FlowMeta{Id: "TestInstanceRecoveryFlow", InstanceRecoveryPolicy: model.InstanceRecoveryResume}
+	flowMeta.Nodes = []model.MetaNode{
+		{Id: "1", Label: "Trigger", Type: "subflow_trigger", SuccessTransition: "2"},
+		{Id: "2", Label: "Wait", Type: "wait", SuccessTransition: "3", Config: float64(500)},
+		{Id: "3", Label: "Set variable", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "resumed", DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+	}
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.StartFlowInstance(model.ReactorEvent{SrcNodeId: "1", TransitionNodeId: "2"})
+	time.Sleep(time.Millisecond * 200)
+	if cps := ctx.GetCheckpoints(flowMeta.Id); len(cps) != 1 || cps[0].NodeId != "2" || cps[0].WaitUntil.IsZero() {
+		t.Fatal("Checkpoint wasn't created , checkpoints = ", cps)
+	}
+	time.Sleep(time.Millisecond * 500)
+	if cps := ctx.GetCheckpoints(flowMeta.Id); len(cps) != 0 {
+		t.Fatal("Checkpoint wasn't deleted after wait , checkpoints = ", cps)
+	}
+	flow.Stop()
+
+	// Simulating restart while instance was waiting
+	msg := model.Message{Payload: *fimpgo.NewIntMessage("evt.sensor.report", "sensor_temp", 21, nil, nil, nil)}
+	cp := model.NewInstanceCheckpoint(flowMeta.Id, 100, "2", msg, time.Now().Add(time.Millisecond*300))
+	ctx.SaveCheckpoint(&cp)
+	cp = model.NewInstanceCheckpoint(flowMeta.Id, 101, "2", msg, time.Now().Add(-time.Minute))
+	ctx.SaveCheckpoint(&cp)
+	flowMeta.InstanceRecoveryPolicy = model.InstanceRecoverySkipExpired
+	ctx.DeleteRecord("resumed", flowMeta.Id, false)
+	flow = NewFlow(flowMeta, ctx)
+	flow.Start()
+	flow.EnableTrace(true)
+	flow.ResumeInstances()
+	time.Sleep(time.Millisecond * 100)
+	if _, err := ctx.GetVariable("resumed", flowMeta.Id); err == nil {
+		t.Error("Instance continued before remaining wait time expired")
+	}
+	time.Sleep(time.Millisecond * 500)
+	traces := flow.GetTraces(0)
+	if len(traces) != 1 || traces[0].InstanceId != 100 {
+		t.Fatal("Expected only instance 100 to be resumed , traces = ", traces)
+	}
+	if value, _ := traces[0].Steps[0].InputMsg.Payload.GetIntValue(); value != 21 {
+		t.Error("Message wasn't restored from checkpoint")
+	}
+	if len(ctx.GetCheckpoints(flowMeta.Id)) != 0 {
+		t.Error("Checkpoints weren't cleaned up")
+	}
+	flow.Stop()
+	ctx.Close()
+	os.Remove("TestInstanceRecoveryFlow.db")
+}
+
+func TestFlow_Metrics(t *testing.T) {
+	ctx, err := model.NewContextDB("TestMetricsFlow.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("TestMetricsFlow.db")
+	flowMeta := model.FlowMeta{Id: "TestMetricsFlow", Nodes: []model.MetaNode{
+		{Id: "1", Label: "Set variable", Type: "set_variable", SuccessTransition: "2",
+			Config: setvar.SetVariableNodeConfig{Name: "var_1", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+		{Id: "2", Label: "Set variable", Type: "set_variable",
+			Config: setvar.SetVariableNodeConfig{Name: "var_2", IsVariableInMemory: true, DefaultValue: model.Variable{Value: "done", ValueType: "string"}}},
+	}}
+	flow := NewFlow(flowMeta, ctx)
+	flow.Start()
+	for i := 0; i < 3; i++ {
+		flow.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+		// metrics are read while instances are running
+		flow.GetMetrics()
+	}
+	time.Sleep(time.Millisecond * 300)
+
+	metrics := flow.GetMetrics()
+	if metrics.FlowId != flowMeta.Id || len(metrics.Nodes) != 2 || metrics.RunningInstances != 0 || metrics.TriggerCounter != 3 {
+		t.Fatal("Wrong flow metrics ", metrics)
+	}
+	for _, node := range metrics.Nodes {
+		var total uint64
+		for _, counter := range node.BucketCounters {
+			total += counter
+		}
+		if node.ExecutionCounter != 3 || total != 3 || len(node.BucketCounters) != len(NodeLatencyBuckets)+1 {
+			t.Error("Wrong node metrics ", node)
+		}
+	}
+	flow.Stop()
+	ctx.Close()
+}
+
+func TestFlow_IsConnectorUsed(t *testing.T) {
+	flowMeta := model.FlowMeta{Id: "conn-test", Nodes: []model.MetaNode{
+		{Id: "1", Type: "trigger", Config: map[string]interface{}{"Service": "out_bin_switch"}},
+		{Id: "2", Type: "influx_write", Config: map[string]interface{}{"ConnectorId": "influx-1"}},
+		{Id: "3", Type: "mqtt_publish", Config: map[string]interface{}{"ConnectorID": "mqtt-1"}},
+		{Id: "4", Type: "connector_state", Config: map[string]interface{}{"ConnectorID": "mqtt-2"}},
+	}}
+	ctx, err := model.NewContextDB("TestConnectorUsed.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("TestConnectorUsed.db")
+	defer ctx.Close()
+	fl := NewFlow(flowMeta, ctx)
+	for _, id := range []string{"fimpmqtt", "influx-1", "mqtt-1"} {
+		if !fl.IsConnectorUsed(id) {
+			t.Error("Connector must be used : ", id)
+		}
+	}
+	if fl.IsConnectorUsed("mqtt-2") {
+		t.Error("Connector mqtt-2 is only observed by connector_state node , the flow doesn't depend on it")
+	}
+}
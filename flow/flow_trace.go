@@ -0,0 +1,249 @@
+package flow
+
+import (
+	"errors"
+	"github.com/thingsplex/tpflow/model"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxTraces = 20  // Number of last instance traces kept in memory
+	maxTraceSteps    = 500 // Max number of steps recorded per instance , protects memory in case of loops
+)
+
+// tracer keeps execution traces of last flow instances and state of step debugger.
+// Tracing is disabled by default and doesn't add any overhead to the runner while disabled.
+type tracer struct {
+	mtx         sync.Mutex
+	isEnabled   bool
+	maxTraces   int
+	traces      []*model.InstanceTrace
+	breakpoints map[model.NodeID]bool
+	stepping    map[int32]bool // instances which must be paused before next node
+	paused      []*pausedInstance
+}
+
+type pausedInstance struct {
+	view   model.PausedInstance
+	resume chan bool // true - continue execution , false - terminate branch
+}
+
+func newTracer() *tracer {
+	return &tracer{maxTraces: defaultMaxTraces, breakpoints: map[model.NodeID]bool{}, stepping: map[int32]bool{}}
+}
+
+// EnableTrace turns trace mode on or off . All paused instances are resumed when trace is turned off.
+func (fl *Flow) EnableTrace(enable bool) {
+	fl.tracer.mtx.Lock()
+	fl.tracer.isEnabled = enable
+	fl.tracer.mtx.Unlock()
+	if !enable {
+		fl.resumePausedInstances(0, true)
+	}
+	fl.getLog().Infof(" Trace mode enabled = %t", enable)
+}
+
+func (fl *Flow) IsTraceEnabled() bool {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	return fl.tracer.isEnabled
+}
+
+// GetTraces returns copy of recorded traces , instanceId = 0 returns traces of all recorded instances
+func (fl *Flow) GetTraces(instanceId int32) []model.InstanceTrace {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	result := []model.InstanceTrace{}
+	for _, trace := range fl.tracer.traces {
+		if instanceId != 0 && trace.InstanceId != instanceId {
+			continue
+		}
+		traceCopy := *trace
+		traceCopy.Steps = append([]model.NodeTraceRecord{}, trace.Steps...)
+		result = append(result, traceCopy)
+	}
+	return result
+}
+
+func (fl *Flow) ClearTraces() {
+	fl.tracer.mtx.Lock()
+	fl.tracer.traces = nil
+	fl.tracer.mtx.Unlock()
+}
+
+// SetBreakpoints replaces current set of breakpoints. Instance is paused before breakpoint node is executed.
+func (fl *Flow) SetBreakpoints(nodeIds []model.NodeID) {
+	fl.tracer.mtx.Lock()
+	fl.tracer.breakpoints = map[model.NodeID]bool{}
+	for _, nodeId := range nodeIds {
+		fl.tracer.breakpoints[nodeId] = true
+	}
+	fl.tracer.mtx.Unlock()
+}
+
+// StepInstance executes one node of paused instance and pauses the instance again before next node.
+func (fl *Flow) StepInstance(instanceId int32) error {
+	fl.tracer.mtx.Lock()
+	fl.tracer.stepping[instanceId] = true
+	fl.tracer.mtx.Unlock()
+	if fl.resumePausedInstances(instanceId, true) == 0 {
+		return errors.New("instance is not paused")
+	}
+	return nil
+}
+
+// ContinueInstance resumes paused instance , the instance runs until next breakpoint.
+func (fl *Flow) ContinueInstance(instanceId int32) error {
+	fl.tracer.mtx.Lock()
+	delete(fl.tracer.stepping, instanceId)
+	fl.tracer.mtx.Unlock()
+	if fl.resumePausedInstances(instanceId, true) == 0 {
+		return errors.New("instance is not paused")
+	}
+	return nil
+}
+
+func (fl *Flow) GetDebuggerState() model.DebuggerState {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	state := model.DebuggerState{IsTraceEnabled: fl.tracer.isEnabled, Breakpoints: []model.NodeID{}, PausedInstances: []model.PausedInstance{}}
+	for nodeId := range fl.tracer.breakpoints {
+		state.Breakpoints = append(state.Breakpoints, nodeId)
+	}
+	for _, p := range fl.tracer.paused {
+		state.PausedInstances = append(state.PausedInstances, p.view)
+	}
+	return state
+}
+
+// resumePausedInstances resumes (or terminates) paused branches of the instance , instanceId = 0 - all instances.
+// Returns number of resumed branches.
+func (fl *Flow) resumePausedInstances(instanceId int32, isContinue bool) int {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	var counter int
+	var stillPaused []*pausedInstance
+	for _, p := range fl.tracer.paused {
+		if instanceId == 0 || p.view.InstanceId == instanceId {
+			p.resume <- isContinue
+			counter++
+		} else {
+			stillPaused = append(stillPaused, p)
+		}
+	}
+	fl.tracer.paused = stillPaused
+	if !isContinue || instanceId == 0 {
+		fl.tracer.stepping = map[int32]bool{}
+	}
+	return counter
+}
+
+// traceStartInstance creates new trace for the instance if trace mode is enabled
+func (fl *Flow) traceStartInstance(instance *Instance) {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	if !fl.tracer.isEnabled {
+		return
+	}
+	instance.trace = &model.InstanceTrace{InstanceId: instance.ID, FlowId: fl.Id, StartedAt: instance.StartedAt, Steps: []model.NodeTraceRecord{}}
+	fl.tracer.traces = append(fl.tracer.traces, instance.trace)
+	if len(fl.tracer.traces) > fl.tracer.maxTraces {
+		fl.tracer.traces = fl.tracer.traces[len(fl.tracer.traces)-fl.tracer.maxTraces:]
+	}
+}
+
+func (fl *Flow) traceCompleteInstance(instance *Instance) {
+	fl.tracer.mtx.Lock()
+	defer fl.tracer.mtx.Unlock()
+	delete(fl.tracer.stepping, instance.ID)
+	if instance.trace == nil {
+		return
+	}
+	instance.trace.CompletedAt = time.Now()
+	instance.trace.IsCompleted = true
+}
+
+// debugWait blocks the branch if the node is breakpoint or the instance is executed step by step.
+// Returns false if the branch must be terminated.
+func (fl *Flow) debugWait(instance *Instance, nodeId model.NodeID) bool {
+	fl.tracer.mtx.Lock()
+	if !fl.tracer.isEnabled || !(fl.tracer.breakpoints[nodeId] || fl.tracer.stepping[instance.ID]) {
+		fl.tracer.mtx.Unlock()
+		return true
+	}
+	p := &pausedInstance{view: model.PausedInstance{InstanceId: instance.ID, NodeId: nodeId, PausedAt: time.Now()}, resume: make(chan bool, 1)}
+	fl.tracer.paused = append(fl.tracer.paused, p)
+	fl.tracer.mtx.Unlock()
+	fl.getLog().Infof(" Instance %d paused before node %s", instance.ID, nodeId)
+	isContinue := <-p.resume
+	fl.getLog().Debugf(" Instance %d resumed , continue = %t", instance.ID, isContinue)
+	return isContinue
+}
+
+// traceSnapshot returns current flow and global variables . Returns nil if the instance is not traced.
+func (fl *Flow) traceSnapshot(instance *Instance) map[string]model.ContextRecord {
+	if instance.trace == nil {
+		return nil
+	}
+	snapshot := map[string]model.ContextRecord{}
+	for _, flowId := range []string{fl.Id, "global"} {
+		for _, rec := range fl.globalContext.GetRecords(flowId) {
+			snapshot[flowId+"/"+rec.Name] = rec
+		}
+	}
+	return snapshot
+}
+
+func (fl *Flow) traceNode(instance *Instance, node model.Node, inputMsg model.Message, before map[string]model.ContextRecord, startedAt time.Time, transition model.NodeID, err error) {
+	if instance.trace == nil {
+		return
+	}
+	meta := node.GetMetaNode()
+	step := model.NodeTraceRecord{
+		NodeId:           meta.Id,
+		NodeLabel:        meta.Label,
+		NodeType:         meta.Type,
+		StartedAt:        startedAt,
+		Duration:         int64(time.Since(startedAt) / time.Microsecond),
+		InputMsg:         inputMsg,
+		ChangedVariables: fl.diffSnapshots(before, fl.traceSnapshot(instance)),
+		Transition:       transition,
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	fl.tracer.mtx.Lock()
+	if len(instance.trace.Steps) < maxTraceSteps {
+		instance.trace.Steps = append(instance.trace.Steps, step)
+	}
+	fl.tracer.mtx.Unlock()
+}
+
+func (fl *Flow) diffSnapshots(before, after map[string]model.ContextRecord) []model.VariableChange {
+	var changes []model.VariableChange
+	flowIdOf := func(rec model.ContextRecord, key string) string {
+		return key[:len(key)-len(rec.Name)-1]
+	}
+	for key, newRec := range after {
+		oldRec, ok := before[key]
+		if ok && oldRec.UpdatedAt.Equal(newRec.UpdatedAt) && reflect.DeepEqual(oldRec.Variable, newRec.Variable) {
+			continue
+		}
+		newVar := newRec.Variable
+		change := model.VariableChange{FlowId: flowIdOf(newRec, key), Name: newRec.Name, NewValue: &newVar}
+		if ok {
+			oldVar := oldRec.Variable
+			change.OldValue = &oldVar
+		}
+		changes = append(changes, change)
+	}
+	for key, oldRec := range before {
+		if _, ok := after[key]; !ok {
+			oldVar := oldRec.Variable
+			changes = append(changes, model.VariableChange{FlowId: flowIdOf(oldRec, key), Name: oldRec.Name, OldValue: &oldVar})
+		}
+	}
+	return changes
+}
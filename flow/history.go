@@ -0,0 +1,229 @@
+package flow
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/model"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxFlowRevisions = 50 // Number of archived revisions kept per flow
+
+type FlowRevision struct {
+	Version       int
+	UpdatedAt     time.Time
+	Author        string
+	NumberOfNodes int
+	IsCurrent     bool
+}
+
+type NodeDiff struct {
+	NodeId model.NodeID
+	Change string   // added , removed , modified
+	Fields []string // fields modified between revisions
+	Old    *model.MetaNode
+	New    *model.MetaNode
+}
+
+type FlowRevisionDiff struct {
+	FlowId      string
+	FromVersion int
+	ToVersion   int
+	FlowFields  []string // flow level fields modified between revisions
+	Nodes       []NodeDiff
+}
+
+func (mg *Manager) getFlowHistoryDir(id string) string {
+	return filepath.Join(mg.config.FlowStorageDir, "history", id)
+}
+
+// archiveFlowRevision copies current flow definition from storage into flow history.
+func (mg *Manager) archiveFlowRevision(id string) error {
+	data, err := ioutil.ReadFile(mg.GetFlowFileNameById(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	flowMeta := model.FlowMeta{}
+	if err = json.Unmarshal(data, &flowMeta); err != nil {
+		return err
+	}
+	historyDir := mg.getFlowHistoryDir(id)
+	if err = os.MkdirAll(historyDir, 0755); err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(historyDir, strconv.Itoa(flowMeta.Version)+".json"), data, 0644)
+	if err != nil {
+		return err
+	}
+	log.Debugf("<FlMan> Flow %s revision %d archived", id, flowMeta.Version)
+	versions := mg.getArchivedVersions(id)
+	for len(versions) > maxFlowRevisions {
+		os.Remove(filepath.Join(historyDir, strconv.Itoa(versions[0])+".json"))
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// getArchivedVersions returns sorted versions of all archived revisions
+func (mg *Manager) getArchivedVersions(id string) []int {
+	var versions []int
+	files, err := ioutil.ReadDir(mg.getFlowHistoryDir(id))
+	if err != nil {
+		return versions
+	}
+	for _, file := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".json"))
+		if err == nil && strings.HasSuffix(file.Name(), ".json") {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// GetFlowRevisions returns all archived revisions of the flow and current revision , sorted by version.
+func (mg *Manager) GetFlowRevisions(id string) ([]FlowRevision, error) {
+	flow := mg.GetFlowById(id)
+	if flow == nil {
+		return nil, fmt.Errorf("flow %s not found", id)
+	}
+	var result []FlowRevision
+	for _, version := range mg.getArchivedVersions(id) {
+		flowMeta, err := mg.GetFlowRevision(id, version)
+		if err != nil {
+			log.Errorf("<FlMan> Can't load revision %d of flow %s . Err:%s", version, id, err)
+			continue
+		}
+		if version == flow.FlowMeta.Version {
+			continue
+		}
+		result = append(result, FlowRevision{Version: version, UpdatedAt: flowMeta.UpdatedAt, Author: flowMeta.Author, NumberOfNodes: len(flowMeta.Nodes)})
+	}
+	result = append(result, FlowRevision{Version: flow.FlowMeta.Version, UpdatedAt: flow.FlowMeta.UpdatedAt,
+		Author: flow.FlowMeta.Author, NumberOfNodes: len(flow.FlowMeta.Nodes), IsCurrent: true})
+	return result, nil
+}
+
+// GetFlowRevision returns flow definition of requested version , current definition is returned if version matches current version.
+func (mg *Manager) GetFlowRevision(id string, version int) (model.FlowMeta, error) {
+	flowMeta := model.FlowMeta{}
+	if flow := mg.GetFlowById(id); flow != nil && flow.FlowMeta.Version == version {
+		return *flow.FlowMeta, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(mg.getFlowHistoryDir(id), strconv.Itoa(version)+".json"))
+	if err != nil {
+		return flowMeta, fmt.Errorf("revision %d of flow %s not found", version, id)
+	}
+	err = json.Unmarshal(data, &flowMeta)
+	return flowMeta, err
+}
+
+// DiffFlowRevisions compares two revisions of the flow node by node.
+func (mg *Manager) DiffFlowRevisions(id string, fromVersion, toVersion int) (*FlowRevisionDiff, error) {
+	from, err := mg.GetFlowRevision(id, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := mg.GetFlowRevision(id, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	diff := FlowRevisionDiff{FlowId: id, FromVersion: fromVersion, ToVersion: toVersion, FlowFields: []string{}, Nodes: []NodeDiff{}}
+	for _, field := range []string{"Name", "Group", "Description", "Settings", "ParallelExecution"} {
+		if !isJsonEqual(reflect.ValueOf(from).FieldByName(field).Interface(), reflect.ValueOf(to).FieldByName(field).Interface()) {
+			diff.FlowFields = append(diff.FlowFields, field)
+		}
+	}
+	fromNodes := map[model.NodeID]*model.MetaNode{}
+	for i := range from.Nodes {
+		fromNodes[from.Nodes[i].Id] = &from.Nodes[i]
+	}
+	toNodes := map[model.NodeID]bool{}
+	for i := range to.Nodes {
+		newNode := &to.Nodes[i]
+		toNodes[newNode.Id] = true
+		oldNode, ok := fromNodes[newNode.Id]
+		if !ok {
+			diff.Nodes = append(diff.Nodes, NodeDiff{NodeId: newNode.Id, Change: "added", New: newNode})
+			continue
+		}
+		var fields []string
+		oldValue, newValue := reflect.ValueOf(*oldNode), reflect.ValueOf(*newNode)
+		for f := 0; f < oldValue.NumField(); f++ {
+			name := oldValue.Type().Field(f).Name
+			if name == "Ui" {
+				// Node position in editor is not a functional change
+				continue
+			}
+			if !isJsonEqual(oldValue.Field(f).Interface(), newValue.Field(f).Interface()) {
+				fields = append(fields, name)
+			}
+		}
+		if len(fields) > 0 {
+			diff.Nodes = append(diff.Nodes, NodeDiff{NodeId: newNode.Id, Change: "modified", Fields: fields, Old: oldNode, New: newNode})
+		}
+	}
+	for i := range from.Nodes {
+		if !toNodes[from.Nodes[i].Id] {
+			diff.Nodes = append(diff.Nodes, NodeDiff{NodeId: from.Nodes[i].Id, Change: "removed", Old: &from.Nodes[i]})
+		}
+	}
+	return &diff, nil
+}
+
+// RollbackFlow replaces current flow definition with archived revision . Rollback is saved as new version ,
+// so current definition is archived and can be restored later . Flow is restarted if it was running.
+func (mg *Manager) RollbackFlow(id string, version int) error {
+	flow := mg.GetFlowById(id)
+	if flow == nil {
+		return fmt.Errorf("flow %s not found", id)
+	}
+	if flow.FlowMeta.IsDefault {
+		return fmt.Errorf("default flows are constant")
+	}
+	flowMeta, err := mg.GetFlowRevision(id, version)
+	if err != nil {
+		return err
+	}
+	wasRunning := flow.GetFlowState() == "RUNNING"
+	if err = mg.archiveFlowRevision(id); err != nil {
+		log.Error("<FlMan> Can't archive current flow revision . Err:", err)
+		return err
+	}
+	flowMeta.Version = flow.FlowMeta.Version + 1
+	flowMeta.UpdatedAt = time.Now()
+	flowMeta.IsDisabled = !wasRunning
+	mg.StopFlow(id)
+	mg.DeleteFlowFromRegistry(id, false)
+	if err = mg.AddMetaFlowToRegistry(flowMeta); err != nil {
+		return err
+	}
+	if err = mg.SaveFlowToStorage(id); err != nil {
+		return err
+	}
+	if wasRunning {
+		mg.StartFlow(id)
+	}
+	log.Infof("<FlMan> Flow %s rolled back to revision %d , new version = %d", id, version, flowMeta.Version)
+	return nil
+}
+
+func isJsonEqual(a, b interface{}) bool {
+	aJson, errA := json.Marshal(a)
+	bJson, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(aJson) == string(bJson)
+}
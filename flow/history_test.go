@@ -0,0 +1,76 @@
+package flow
+
+import (
+	"encoding/json"
+	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/data/setvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager_FlowHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := tpflow.Configs{FlowStorageDir: dir, ConnectorStorageDir: dir, ContextStorageDir: filepath.Join(dir, "context.db")}
+	man, err := NewManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+
+	flowMeta := model.FlowMeta{Id: "TestHistoryFlow", Name: "History", IsDisabled: true}
+	flowMeta.Nodes = []model.MetaNode{
+		{Id: "1", Type: "subflow_trigger", SuccessTransition: "2"},
+		{Id: "2", Type: "set_variable", Label: "first", Config: setvar.SetVariableNodeConfig{Name: "var1"}},
+	}
+	update := func(meta model.FlowMeta) {
+		data, _ := json.Marshal(meta)
+		if err := man.UpdateFlowFromBinJson(meta.Id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update(flowMeta)
+	flowMeta.Nodes[1].Label = "second"
+	flowMeta.Nodes = append(flowMeta.Nodes, model.MetaNode{Id: "3", Type: "set_variable", Config: setvar.SetVariableNodeConfig{Name: "var3"}})
+	flowMeta.Nodes[1].SuccessTransition = "3"
+	update(flowMeta)
+
+	revisions, err := man.GetFlowRevisions(flowMeta.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 1 || revisions[1].Version != 2 || !revisions[1].IsCurrent {
+		t.Fatal("Wrong revisions ", revisions)
+	}
+
+	diff, err := man.DiffFlowRevisions(flowMeta.Id, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Nodes) != 2 {
+		t.Fatal("Wrong number of node changes ", diff.Nodes)
+	}
+	if diff.Nodes[0].NodeId != "2" || diff.Nodes[0].Change != "modified" || len(diff.Nodes[0].Fields) != 2 {
+		t.Error("Wrong node change ", diff.Nodes[0])
+	}
+	if diff.Nodes[1].NodeId != "3" || diff.Nodes[1].Change != "added" {
+		t.Error("Wrong node change ", diff.Nodes[1])
+	}
+
+	if err = man.RollbackFlow(flowMeta.Id, 1); err != nil {
+		t.Fatal(err)
+	}
+	current := man.GetFlowById(flowMeta.Id).FlowMeta
+	if current.Version != 3 || len(current.Nodes) != 2 || current.Nodes[1].Label != "first" {
+		t.Error("Rollback failed , current definition = ", current)
+	}
+	if _, err = man.GetFlowRevision(flowMeta.Id, 2); err != nil {
+		t.Error("Version 2 wasn't archived by rollback")
+	}
+}
@@ -3,14 +3,20 @@ package flow
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow"
 	"github.com/thingsplex/tpflow/connector"
+	connmodel "github.com/thingsplex/tpflow/connector/model"
+	"github.com/thingsplex/tpflow/connector/plugins/webhook"
 	"github.com/thingsplex/tpflow/model"
 	"github.com/thingsplex/tpflow/node/trigger/fimp"
+	trigwebhook "github.com/thingsplex/tpflow/node/trigger/webhook"
 	"github.com/thingsplex/tpflow/utils"
 	fgoutils "github.com/futurehomeno/fimpgo/utils"
 	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -22,11 +28,14 @@ import (
 )
 
 type Manager struct {
-	flowRegistry      []*Flow
-	msgStreams        map[string]model.MsgPipeline
-	globalContext     *model.Context
-	config            tpflow.Configs
-	connectorRegistry connector.Registry
+	flowRegistry              []*Flow
+	msgStreams                map[string]model.MsgPipeline
+	globalContext             *model.Context
+	config                    tpflow.Configs
+	connectorRegistry         *connector.Registry
+	deadLetters               *DeadLetterStore
+	defaultErrorHandlerFlowId string
+	registryMtx               sync.RWMutex // guards flowRegistry , registry is read by api and connector events while flows are added or removed
 }
 
 type FlowListItem struct {
@@ -51,14 +60,24 @@ func NewManager(config tpflow.Configs) (*Manager, error) {
 	man := Manager{config: config}
 	man.msgStreams = make(map[string]model.MsgPipeline)
 	man.flowRegistry = make([]*Flow, 0)
-	man.globalContext, err = model.NewContextDB(config.ContextStorageDir)
+	man.globalContext, err = model.NewContextWithStorage(config.ContextStorageBackend, config.ContextStorageDir, config.ContextEncoding)
 	if err !=nil {
 		log.Error("Can't initialize context DB")
 		return nil,err
 	}
 	man.globalContext.RegisterFlow("global")
-	man.connectorRegistry = *connector.NewRegistry(config.ConnectorStorageDir)
+	man.globalContext.StartExpirySweeper(time.Duration(config.ContextSweepInterval) * time.Second)
+	man.deadLetters = NewDeadLetterStore(config.DeadLetterStoreSize)
+	man.defaultErrorHandlerFlowId = config.ErrorHandlerFlowId
+	man.connectorRegistry = connector.NewRegistry(config.ConnectorStorageDir)
 	man.connectorRegistry.LoadInstancesFromDisk()
+	if config.WebhookListenAddress != "" && man.connectorRegistry.GetInstance(trigwebhook.DefaultConnectorID) == nil {
+		man.connectorRegistry.CreateInstance(trigwebhook.DefaultConnectorID, "webhook", "webhook", webhook.ConnectorConfig{ListenAddress: config.WebhookListenAddress})
+	}
+	connectorEvents := make(chan connector.StateChangeEvent, 20)
+	man.connectorRegistry.SubscribeToStateChanges("flow-manager", connectorEvents)
+	go man.onConnectorStateChange(connectorEvents)
+	man.connectorRegistry.StartSupervisor(0)
 	return &man, err
 }
 
@@ -111,6 +130,9 @@ func (mg *Manager) LoadAllFlowsFromStorage() error {
 				}
 				if !flow.FlowMeta.IsDisabled {
 					mg.StartFlow(flowId)
+					flow.ResumeInstances()
+				} else {
+					mg.globalContext.DeleteCheckpoints(flowId)
 				}
 			}
 		}
@@ -149,11 +171,24 @@ func (mg *Manager) AddMetaFlowToRegistry(flowMeta model.FlowMeta) error {
 	flow := NewFlow(flowMeta, mg.globalContext)
 	flow.SetStoragePath(mg.config.FlowStorageDir)
 	flow.SetExternalLibsDir(mg.config.ExternalLibsDir)
-	flow.SetConnectorRegistry(&mg.connectorRegistry)
+	flow.SetConnectorRegistry(mg.connectorRegistry)
+	flow.SetSubflowInvoker(mg.InvokeFlow)
+	flow.SetErrorReporter(mg.onFlowError)
+	mg.registryMtx.Lock()
 	mg.flowRegistry = append(mg.flowRegistry, flow)
+	mg.registryMtx.Unlock()
 	return nil
 }
 
+// InvokeFlow executes flow synchronously . Is used by subflow node.
+func (mg *Manager) InvokeFlow(flowId string, msg model.Message, vars map[string]model.Variable, timeout time.Duration) (model.Message, map[string]model.Variable, error) {
+	flow := mg.GetFlowById(flowId)
+	if flow == nil {
+		return msg, nil, fmt.Errorf("flow %s doesn't exist", flowId)
+	}
+	return flow.Invoke(msg, vars, timeout)
+}
+
 func (mg *Manager) UpdateFlowFromBinJson(id string, flowJsonDef []byte) error {
 	flowMeta := model.FlowMeta{}
 	err := json.Unmarshal(flowJsonDef, &flowMeta)
@@ -165,6 +200,23 @@ func (mg *Manager) UpdateFlowFromBinJson(id string, flowJsonDef []byte) error {
 		log.Error("<FlMan> Default flows are constant.Operation skipped.")
 		return err
 	}
+	report := Validate(flowMeta)
+	if !report.IsValid {
+		for _, vErr := range report.Errors {
+			log.Errorf("<FlMan> Validation %s . Node = %s , field = %s : %s", vErr.Severity, vErr.NodeId, vErr.Field, vErr.Message)
+		}
+		return fmt.Errorf("flow definition is not valid , %d problems found", len(report.Errors))
+	}
+	if currentFlow := mg.GetFlowById(id); currentFlow != nil {
+		// Previous definition is archived , so it can be restored later
+		if err = mg.archiveFlowRevision(id); err != nil {
+			log.Error("<FlMan> Can't archive previous flow revision . Err:", err)
+			return err
+		}
+		flowMeta.Version = currentFlow.FlowMeta.Version + 1
+	} else if flowMeta.Version == 0 {
+		flowMeta.Version = 1
+	}
 	mg.StopFlow(id)
 	mg.DeleteFlowFromRegistry(id, false)
 	flowMeta.UpdatedAt = time.Now()
@@ -276,22 +328,30 @@ func (mg *Manager) SaveFlowToStorage(id string) error {
 	return nil
 }
 
+// getFlows returns snapshot of flow registry
+func (mg *Manager) getFlows() []*Flow {
+	mg.registryMtx.RLock()
+	defer mg.registryMtx.RUnlock()
+	return append([]*Flow{}, mg.flowRegistry...)
+}
+
 func (mg *Manager) GetFlowById(id string) *Flow {
-	for i := range mg.flowRegistry {
-		if mg.flowRegistry[i].Id == id {
-			return mg.flowRegistry[i]
+	for _, flow := range mg.getFlows() {
+		if flow.Id == id {
+			return flow
 		}
 	}
 	return nil
 }
 
 func (mg *Manager) GetFlowBySettings(settings map[string]model.Setting) *Flow {
-	for i := range mg.flowRegistry {
+	flows := mg.getFlows()
+	for i := range flows {
 		fullMatch := true
-		log.Debug("Flow ",mg.flowRegistry[i].Name)
+		log.Debug("Flow ",flows[i].Name)
 		for si := range settings {
-			if mg.flowRegistry[i].FlowMeta != nil {
-				flSet := mg.flowRegistry[i].FlowMeta.Settings[si]
+			if flows[i].FlowMeta != nil {
+				flSet := flows[i].FlowMeta.Settings[si]
 				sSet := settings[si]
 				log.Debugf( "key = %s, flSet = %s , sSet = %s",si,flSet.String(),sSet.String())
 				if flSet.String() != sSet.String() {
@@ -302,26 +362,27 @@ func (mg *Manager) GetFlowBySettings(settings map[string]model.Setting) *Flow {
 			}
 		}
 		if fullMatch {
-			return mg.flowRegistry[i]
+			return flows[i]
 		}
 	}
 	return nil
 }
 
 func (mg *Manager) GetFlowList() []FlowListItem {
-	response := make([]FlowListItem, len(mg.flowRegistry))
+	flows := mg.getFlows()
+	response := make([]FlowListItem, len(flows))
 	var c int
-	for i := range mg.flowRegistry {
+	for i := range flows {
 		response[c] = FlowListItem{
-			Id:             mg.flowRegistry[i].Id,
-			Name:           mg.flowRegistry[i].Name,
-			Group:          mg.flowRegistry[i].FlowMeta.Group,
-			Description:    mg.flowRegistry[i].Description,
-			TriggerCounter: mg.flowRegistry[i].TriggerCounter,
-			ErrorCounter:   mg.flowRegistry[i].ErrorCounter,
-			State:          mg.flowRegistry[i].opContext.State,
-			Stats:          mg.flowRegistry[i].GetFlowStats(),
-			IsDisabled:     mg.flowRegistry[i].FlowMeta.IsDisabled,
+			Id:             flows[i].Id,
+			Name:           flows[i].Name,
+			Group:          flows[i].FlowMeta.Group,
+			Description:    flows[i].Description,
+			TriggerCounter: atomic.LoadInt64(&flows[i].TriggerCounter),
+			ErrorCounter:   atomic.LoadInt64(&flows[i].ErrorCounter),
+			State:          flows[i].opContext.State,
+			Stats:          flows[i].GetFlowStats(),
+			IsDisabled:     flows[i].FlowMeta.IsDisabled,
 		}
 
 		c++
@@ -376,6 +437,8 @@ func (mg *Manager) StopFlow(id string) {
 		return
 	}
 	flow.Stop()
+	// Instances terminated by explicit stop must not be resumed
+	mg.globalContext.DeleteCheckpoints(id)
 	if flow.FlowMeta.IsDefault {
 		log.Infof("Flow with Id = %s was stopped but NOT disabled", id)
 		return
@@ -386,17 +449,19 @@ func (mg *Manager) StopFlow(id string) {
 }
 
 func (mg *Manager) DeleteFlowFromRegistry(id string, cleanRegistry bool) {
-
+	var deleted *Flow
+	mg.registryMtx.Lock()
 	for i := range mg.flowRegistry {
 		if mg.flowRegistry[i].Id == id {
-			if cleanRegistry {
-				mg.flowRegistry[i].CleanupBeforeDelete()
-			}
-
+			deleted = mg.flowRegistry[i]
 			mg.flowRegistry = append(mg.flowRegistry[:i], mg.flowRegistry[i+1:]...)
 			break
 		}
 	}
+	mg.registryMtx.Unlock()
+	if deleted != nil && cleanRegistry {
+		deleted.CleanupBeforeDelete()
+	}
 }
 
 func (mg *Manager) DeleteFlowFromStorage(id string) {
@@ -410,11 +475,69 @@ func (mg *Manager) DeleteFlowFromStorage(id string) {
 	}
 	mg.StopFlow(id)
 	mg.DeleteFlowFromRegistry(id, true)
+	mg.globalContext.DeleteNodeStates(id)
 	os.Remove(mg.GetFlowFileNameById(id))
+	os.RemoveAll(mg.getFlowHistoryDir(id))
 }
 
 func (mg *Manager) GetConnectorRegistry() *connector.Registry {
-	return &mg.connectorRegistry
+	return mg.connectorRegistry
+}
+
+// CreateConnectorInstance creates new connector instance and stores it on disk . Generated id is set into inst.
+func (mg *Manager) CreateConnectorInstance(inst *connmodel.Instance) error {
+	if err := mg.connectorRegistry.CreateAndSaveInstance(inst); err != nil {
+		log.Error("<FlMan> Can't create connector instance . Err:", err)
+		return err
+	}
+	// Flows might have been started before the connector was created
+	mg.RestartFlowsUsingConnector(inst.ID)
+	return nil
+}
+
+// UpdateConnectorInstance re-initializes connector instance with new configuration and restarts flows which are using it
+func (mg *Manager) UpdateConnectorInstance(inst connmodel.Instance) error {
+	err := mg.connectorRegistry.UpdateInstance(inst.ID, inst.Name, inst.Config)
+	if err != nil {
+		log.Error("<FlMan> Connector instance update failed . Err:", err)
+		if mg.connectorRegistry.GetInstance(inst.ID) == nil {
+			return err
+		}
+	}
+	mg.RestartFlowsUsingConnector(inst.ID)
+	return err
+}
+
+// DeleteConnectorInstance stops and deletes connector instance . Flows which are using it are restarted and end up in CONFIG_ERROR state.
+func (mg *Manager) DeleteConnectorInstance(id string) error {
+	if err := mg.connectorRegistry.DeleteInstance(id); err != nil {
+		log.Error("<FlMan> Can't delete connector instance . Err:", err)
+		return err
+	}
+	mg.RestartFlowsUsingConnector(id)
+	return nil
+}
+
+// onConnectorStateChange restarts flows after supervisor re-created connection , nodes are still holding the old one
+func (mg *Manager) onConnectorStateChange(events chan connector.StateChangeEvent) {
+	for event := range events {
+		if event.Reinitialized {
+			mg.RestartFlowsUsingConnector(event.ID)
+		}
+	}
+}
+
+// RestartFlowsUsingConnector restarts running flows which have nodes holding client of connector instance . Flows which only observe connector state are not restarted.
+func (mg *Manager) RestartFlowsUsingConnector(connectorId string) {
+	for _, flow := range mg.getFlows() {
+		if flow.FlowMeta.IsDisabled || !flow.IsConnectorUsed(connectorId) {
+			continue
+		}
+		log.Infof("<FlMan> Restarting flow %s , connector %s was changed", flow.Id, connectorId)
+		if err := flow.Restart(); err != nil {
+			log.Errorf("<FlMan> Flow %s can't be restarted . Err: %s", flow.Id, err)
+		}
+	}
 }
 
 func (mg *Manager) BackupAll() error{
@@ -435,6 +558,17 @@ func (mg *Manager) FactoryReset() error{
 			os.Remove(filepath.Join(mg.config.FlowStorageDir,file.Name()))
 		}
 	}
+	os.RemoveAll(filepath.Join(mg.config.FlowStorageDir, "history"))
 	mg.globalContext.FactoryReset()
 	return nil
-}
\ No newline at end of file
+}
+
+// GetFlowMetrics returns statistics of all flows from registry
+func (mg *Manager) GetFlowMetrics() []FlowMetrics {
+	flows := mg.getFlows()
+	result := make([]FlowMetrics, 0, len(flows))
+	for i := range flows {
+		result = append(result, flows[i].GetMetrics())
+	}
+	return result
+}
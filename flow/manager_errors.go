@@ -0,0 +1,113 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ReplayCounterHeader - message header with number of times the message was replayed from dead-letter store
+	ReplayCounterHeader = "dead_letter_replay_counter"
+	errorHandlerTimeout = 30 * time.Second
+)
+
+// SetDefaultErrorHandler sets flow which is invoked on unhandled errors of flows without own error handler
+func (mg *Manager) SetDefaultErrorHandler(flowId string) {
+	mg.defaultErrorHandlerFlowId = flowId
+}
+
+// onFlowError stores failed message in dead-letter store and invokes error handler flow . Error handler flow must have
+// subflow_trigger node , error details are passed as error_flow_id , error_node_id , error_text and error_dead_letter_id
+// instance variables , so concurrent errors don't overwrite each other's details.
+func (mg *Manager) onFlowError(flowError FlowError) {
+	replayCounter, _ := strconv.Atoi(flowError.Message.Header[ReplayCounterHeader])
+	deadLetterId := mg.deadLetters.Add(flowError, replayCounter)
+
+	handlerFlowId := mg.defaultErrorHandlerFlowId
+	if fl := mg.GetFlowById(flowError.FlowId); fl != nil && fl.FlowMeta.ErrorHandlerFlowId != "" {
+		handlerFlowId = fl.FlowMeta.ErrorHandlerFlowId
+	}
+	if handlerFlowId == "" {
+		return
+	}
+	// Error handler is invoked as sub-flow , call chain contains the failed flow and handlers which reported errors before it ,
+	// so failing handlers can't invoke each other forever (A -> B -> A) and handler can't handle own errors.
+	callChain := append(append([]string{}, flowError.Message.CallChain...), flowError.FlowId)
+	for _, flowId := range callChain {
+		if flowId == handlerFlowId {
+			log.Warnf("<FlMan> Error handler flow %s is skipped , error handlers form a cycle %s", handlerFlowId, strings.Join(callChain, " -> "))
+			return
+		}
+	}
+	report := map[string]interface{}{
+		"flow_id":        flowError.FlowId,
+		"flow_name":      flowError.FlowName,
+		"node_id":        flowError.NodeId,
+		"node_label":     flowError.NodeLabel,
+		"node_type":      flowError.NodeType,
+		"error":          flowError.Error,
+		"is_panic":       flowError.IsPanic,
+		"dead_letter_id": deadLetterId,
+		"message":        flowError.Message.Payload,
+		"topic":          flowError.Message.AddressStr,
+	}
+	props := fimpgo.Props{"flow_id": flowError.FlowId, "node_id": string(flowError.NodeId)}
+	msg := model.Message{Payload: *fimpgo.NewMessage("evt.flow.error_report", "tpflow", "object", report, props, nil, nil), CallChain: callChain}
+	vars := map[string]model.Variable{
+		"error_flow_id":        {ValueType: "string", Value: flowError.FlowId},
+		"error_node_id":        {ValueType: "string", Value: string(flowError.NodeId)},
+		"error_text":           {ValueType: "string", Value: flowError.Error},
+		"error_dead_letter_id": {ValueType: "string", Value: deadLetterId},
+	}
+	go func() {
+		if _, _, err := mg.InvokeFlow(handlerFlowId, msg, vars, errorHandlerTimeout); err != nil {
+			log.Errorf("<FlMan> Error handler flow %s failed . Err: %s", handlerFlowId, err)
+		}
+	}()
+}
+
+// GetDeadLetters returns failed messages , flowId filters messages by flow , empty - messages of all flows
+func (mg *Manager) GetDeadLetters(flowId string) []DeadLetter {
+	return mg.deadLetters.GetAll(flowId)
+}
+
+// DeleteDeadLetter removes failed message , empty id - all messages are removed
+func (mg *Manager) DeleteDeadLetter(id string) {
+	mg.deadLetters.Delete(id)
+}
+
+// ReplayDeadLetter starts new flow instance from the failed node with the failed message . The message is removed from
+// the store only after the instance is started and is added back as new dead letter if it fails again.
+func (mg *Manager) ReplayDeadLetter(id string) error {
+	letter, ok := mg.deadLetters.Get(id)
+	if !ok {
+		return fmt.Errorf("dead letter %s doesn't exist", id)
+	}
+	fl := mg.GetFlowById(letter.FlowId)
+	if fl == nil {
+		return fmt.Errorf("flow %s doesn't exist", letter.FlowId)
+	}
+	if fl.GetFlowState() != "RUNNING" {
+		return errors.New("flow is not running")
+	}
+	if fl.GetNodeById(letter.NodeId) == nil {
+		return fmt.Errorf("node %s doesn't exist", letter.NodeId)
+	}
+	msg := letter.Message.Clone()
+	if msg.Header == nil {
+		msg.Header = map[string]string{}
+	}
+	msg.Header[ReplayCounterHeader] = strconv.Itoa(letter.ReplayCounter + 1)
+	log.Infof("<FlMan> Replaying dead letter %s , flow = %s , node = %s", id, letter.FlowId, letter.NodeId)
+	if !fl.TryStartFlowInstance(model.ReactorEvent{Msg: msg, TransitionNodeId: letter.NodeId}) {
+		return errors.New("instance wasn't started , another instance of keep_first flow is running")
+	}
+	mg.deadLetters.Delete(id)
+	return nil
+}
@@ -0,0 +1,145 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/control/ifn"
+	"github.com/thingsplex/tpflow/node/control/subflow"
+	"github.com/thingsplex/tpflow/node/data/setvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManager_ErrorHandlerAndDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	man, err := NewManager(tpflow.Configs{ContextStorageDir: filepath.Join(dir, "context.db"), FlowStorageDir: dir, DeadLetterStoreSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+	man.SetDefaultErrorHandler("ErrorHandler")
+
+	handlerMeta := model.FlowMeta{Id: "ErrorHandler", Nodes: []model.MetaNode{
+		{Id: "1", Type: "subflow_trigger", SuccessTransition: "2"},
+		{Id: "2", Type: "if", Config: ifn.IFExpressions{Mode: ifn.ModeCalc, CalcExpression: "error_node_id == '1' && error_flow_id == 'Failing'", TrueTransition: "3"}},
+		{Id: "3", Type: "set_variable", Config: setvar.SetVariableNodeConfig{Name: "handled", IsVariableInMemory: true,
+			DefaultValue: model.Variable{Value: "yes", ValueType: "string"}}},
+	}}
+	failingMeta := model.FlowMeta{Id: "Failing", Nodes: []model.MetaNode{
+		{Id: "1", Label: "Call missing flow", Type: "subflow", Config: subflow.NodeConfig{FlowId: "missing"}},
+	}}
+	man.AddMetaFlowToRegistry(handlerMeta)
+	man.AddMetaFlowToRegistry(failingMeta)
+	man.StartFlow("ErrorHandler")
+	man.StartFlow("Failing")
+	failing := man.GetFlowById("Failing")
+
+	msg := model.Message{AddressStr: "test/topic"}
+	failing.StartFlowInstance(model.ReactorEvent{Msg: msg, TransitionNodeId: "1"})
+	time.Sleep(300 * time.Millisecond)
+
+	letters := man.GetDeadLetters("Failing")
+	if len(letters) != 1 || letters[0].NodeId != "1" || letters[0].NodeType != "subflow" || letters[0].Message.AddressStr != "test/topic" {
+		t.Fatalf("Wrong dead letters %+v", letters)
+	}
+	if v, err := man.GetGlobalContext().GetVariable("handled", "ErrorHandler"); err != nil || v.Value != "yes" {
+		t.Error("Error handler flow wasn't executed or error details weren't passed")
+	}
+
+	if err := man.ReplayDeadLetter(letters[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	letters = man.GetDeadLetters("")
+	if len(letters) != 1 || letters[0].ReplayCounter != 1 {
+		t.Fatalf("Replayed message must fail again , letters = %+v", letters)
+	}
+
+	// The oldest message is dropped when the store is full
+	for i := 0; i < 3; i++ {
+		failing.StartFlowInstance(model.ReactorEvent{Msg: msg, TransitionNodeId: "1"})
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(man.GetDeadLetters("")) != 2 {
+		t.Error("Store size limit is not respected")
+	}
+	man.DeleteDeadLetter("")
+	if len(man.GetDeadLetters("")) != 0 {
+		t.Error("Store wasn't cleared")
+	}
+	failing.Stop()
+	man.GetFlowById("ErrorHandler").Stop()
+}
+
+func TestManager_ReplayDeadLetterSkipped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	man, err := NewManager(tpflow.Configs{ContextStorageDir: filepath.Join(dir, "context.db"), FlowStorageDir: dir, DeadLetterStoreSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+	busyMeta := model.FlowMeta{Id: "Busy", ParallelExecution: model.ParallelExecutionKeepFirst, Nodes: []model.MetaNode{
+		{Id: "1", Label: "Wait", Type: "wait", Config: float64(500)},
+	}}
+	man.AddMetaFlowToRegistry(busyMeta)
+	man.StartFlow("Busy")
+	busy := man.GetFlowById("Busy")
+	id := man.deadLetters.Add(FlowError{FlowId: "Busy", NodeId: "1", Error: "failed"}, 0)
+
+	busy.StartFlowInstance(model.ReactorEvent{TransitionNodeId: "1"})
+	time.Sleep(50 * time.Millisecond)
+	if err := man.ReplayDeadLetter(id); err == nil {
+		t.Error("Replay must fail while keep_first instance is running")
+	}
+	if _, ok := man.deadLetters.Get(id); !ok {
+		t.Fatal("Dead letter must be kept if the instance wasn't started")
+	}
+	time.Sleep(600 * time.Millisecond)
+	if err := man.ReplayDeadLetter(id); err != nil {
+		t.Error(err)
+	}
+	if _, ok := man.deadLetters.Get(id); ok {
+		t.Error("Dead letter must be deleted after the instance was started")
+	}
+	busy.Stop()
+}
+
+func TestManager_ErrorHandlerCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	man, err := NewManager(tpflow.Configs{ContextStorageDir: filepath.Join(dir, "context.db"), FlowStorageDir: dir, DeadLetterStoreSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+	// Failing flows are error handlers of each other
+	for _, ids := range [][2]string{{"HandlerA", "HandlerB"}, {"HandlerB", "HandlerA"}} {
+		man.AddMetaFlowToRegistry(model.FlowMeta{Id: ids[0], ErrorHandlerFlowId: ids[1], Nodes: []model.MetaNode{
+			{Id: "1", Type: "subflow_trigger", SuccessTransition: "2"},
+			{Id: "2", Label: "Call missing flow", Type: "subflow", Config: subflow.NodeConfig{FlowId: "missing"}},
+		}})
+		man.StartFlow(ids[0])
+	}
+	man.GetFlowById("HandlerA").StartFlowInstance(model.ReactorEvent{TransitionNodeId: "2"})
+	time.Sleep(500 * time.Millisecond)
+
+	if letters := man.GetDeadLetters(""); len(letters) != 2 || letters[0].FlowId == letters[1].FlowId {
+		t.Error("Each flow must fail once , number of dead letters = ", len(letters))
+	}
+	man.GetFlowById("HandlerA").Stop()
+	man.GetFlowById("HandlerB").Stop()
+}
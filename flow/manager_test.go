@@ -5,7 +5,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/futurehomeno/fimpgo"
 	"github.com/thingsplex/tpflow"
+	"github.com/thingsplex/tpflow/model"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -121,3 +125,37 @@ func TestManager_GetFlowList(t *testing.T) {
 	}
 
 }
+
+func TestManager_GetFlowMetricsWhileRegistryChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tpflow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	man, err := NewManager(tpflow.Configs{ContextStorageDir: filepath.Join(dir, "context.db"), FlowStorageDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer man.GetGlobalContext().Close()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			id := "MetricsFlow" + strconv.Itoa(i%5)
+			man.AddMetaFlowToRegistry(model.FlowMeta{Id: id})
+			man.DeleteFlowFromRegistry(id, false)
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			if len(man.GetFlowMetrics()) != 0 {
+				t.Error("All flows must be removed from registry")
+			}
+			return
+		default:
+			man.GetFlowMetrics()
+			man.GetFlowList()
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package flow
+
+import (
+	"fmt"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node"
+	"sort"
+)
+
+// Validate checks flow definition without starting it and reports every problem found together with node id and field.
+// Nodes are instantiated with empty context , only nodes implementing model.ConfigValidator check own configuration.
+func Validate(meta model.FlowMeta) model.FlowValidationReport {
+	report := model.FlowValidationReport{FlowId: meta.Id, Errors: []model.ValidationError{}}
+	addError := func(nodeId model.NodeID, field string, severity string, format string, args ...interface{}) {
+		report.Errors = append(report.Errors, model.ValidationError{NodeId: nodeId, Field: field, Message: fmt.Sprintf(format, args...), Severity: severity})
+	}
+	opContext := model.FlowOperationalContext{FlowId: meta.Id, FlowMeta: &meta}
+
+	switch meta.InstanceRecoveryPolicy {
+	case "", model.InstanceRecoveryNone, model.InstanceRecoveryResume, model.InstanceRecoverySkipExpired:
+	default:
+		addError("", "InstanceRecoveryPolicy", model.ValidationSeverityError, "unknown instance recovery policy %s", meta.InstanceRecoveryPolicy)
+	}
+
+	nodeIds := map[model.NodeID]bool{}
+	for _, metaNode := range meta.Nodes {
+		if metaNode.Id == "" {
+			addError("", "Id", model.ValidationSeverityError, "node %s has empty id", metaNode.Label)
+		} else if nodeIds[metaNode.Id] {
+			addError(metaNode.Id, "Id", model.ValidationSeverityError, "duplicate node id")
+		}
+		nodeIds[metaNode.Id] = true
+		if metaNode.RetryPolicy != nil {
+			for _, vErr := range metaNode.RetryPolicy.Validate() {
+				vErr.NodeId = metaNode.Id
+				report.Errors = append(report.Errors, vErr)
+			}
+		}
+	}
+
+	graph := map[model.NodeID][]model.NodeID{}
+	var startNodes []model.NodeID
+	for _, metaNode := range meta.Nodes {
+		transitions := map[string]model.NodeID{
+			"SuccessTransition": metaNode.SuccessTransition,
+			"ErrorTransition":   metaNode.ErrorTransition,
+			"TimeoutTransition": metaNode.TimeoutTransition,
+		}
+		constructor, ok := node.Registry[metaNode.Type]
+		if ok {
+			newNode := constructor(&opContext, metaNode, nil)
+			if validator, ok := newNode.(model.ConfigValidator); ok {
+				for _, vErr := range validator.ValidateConfig() {
+					vErr.NodeId = metaNode.Id
+					report.Errors = append(report.Errors, vErr)
+				}
+			}
+			if provider, ok := newNode.(model.ConfigTransitionProvider); ok {
+				for field, nodeId := range provider.GetConfigTransitions() {
+					transitions[field] = nodeId
+				}
+			}
+			if newNode.IsStartNode() {
+				startNodes = append(startNodes, metaNode.Id)
+			}
+		} else {
+			addError(metaNode.Id, "Type", model.ValidationSeverityError, "unknown node type %s", metaNode.Type)
+		}
+
+		fields := make([]string, 0, len(transitions))
+		for field := range transitions {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			nodeId := transitions[field]
+			if nodeId == "" {
+				continue
+			}
+			if nodeId == metaNode.Id {
+				addError(metaNode.Id, field, model.ValidationSeverityError, "transition to the node itself")
+			} else if !nodeIds[nodeId] {
+				addError(metaNode.Id, field, model.ValidationSeverityError, "transition to unknown node %s", nodeId)
+			} else {
+				graph[metaNode.Id] = append(graph[metaNode.Id], nodeId)
+			}
+		}
+	}
+
+	if len(startNodes) == 0 {
+		addError("", "Nodes", model.ValidationSeverityError, "flow has no trigger node")
+	} else {
+		reachable := map[model.NodeID]bool{}
+		queue := append([]model.NodeID{}, startNodes...)
+		for len(queue) > 0 {
+			nodeId := queue[0]
+			queue = queue[1:]
+			if reachable[nodeId] {
+				continue
+			}
+			reachable[nodeId] = true
+			queue = append(queue, graph[nodeId]...)
+		}
+		for _, metaNode := range meta.Nodes {
+			if metaNode.Id != "" && !reachable[metaNode.Id] {
+				addError(metaNode.Id, "", model.ValidationSeverityWarning, "node is not reachable from any trigger")
+			}
+		}
+	}
+
+	report.IsValid = true
+	for i := range report.Errors {
+		if report.Errors[i].Severity == model.ValidationSeverityError {
+			report.IsValid = false
+			break
+		}
+	}
+	return report
+}
@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/control/ifn"
+	"github.com/thingsplex/tpflow/node/data/transform"
+	"github.com/thingsplex/tpflow/node/trigger/time"
+	"testing"
+)
+
+func findValidationError(report model.FlowValidationReport, nodeId model.NodeID, field string) *model.ValidationError {
+	for i := range report.Errors {
+		if report.Errors[i].NodeId == nodeId && report.Errors[i].Field == field {
+			return &report.Errors[i]
+		}
+	}
+	return nil
+}
+
+func TestValidate_ValidFlow(t *testing.T) {
+	flowMeta := model.FlowMeta{Id: "TestValidateFlow"}
+	flowMeta.Nodes = []model.MetaNode{
+		{Id: "1", Type: "time_trigger", SuccessTransition: "2",
+			Config: time.NodeConfig{Expressions: []time.TimeExpression{{Expression: "*/5 * * * *"}}}},
+		{Id: "2", Type: "if", Config: ifn.IFExpressions{TrueTransition: "3",
+			Expression: []ifn.IFExpression{{RightVariable: model.Variable{ValueType: "int", Value: 1}, Operand: "eq"}}}},
+		{Id: "3", Type: "transform", Config: transform.NodeConfig{TransformType: "calc", Expression: "input + 1"}},
+	}
+	report := Validate(flowMeta)
+	if !report.IsValid || len(report.Errors) != 0 {
+		t.Error("Valid flow reported as invalid , errors = ", report.Errors)
+	}
+}
+
+func TestValidate_InvalidFlow(t *testing.T) {
+	flowMeta := model.FlowMeta{Id: "TestValidateFlow"}
+	flowMeta.Nodes = []model.MetaNode{
+		{Id: "1", Type: "time_trigger", SuccessTransition: "2", ErrorTransition: "10",
+			Config: time.NodeConfig{Expressions: []time.TimeExpression{{Expression: "not a cron"}}}},
+		{Id: "2", Type: "if", Config: ifn.IFExpressions{FalseTransition: "11",
+			Expression: []ifn.IFExpression{{Operand: "eq"}}}},
+		{Id: "3", Type: "transform", Config: transform.NodeConfig{TransformType: "calc", Expression: "input +* ("}},
+		{Id: "4", Type: "transform", Config: transform.NodeConfig{TransformType: "template", Template: "{{ .Value "}},
+		{Id: "5", Type: "set_variable", Config: map[string]interface{}{"Name": []int{1}}},
+		{Id: "6", Type: "unknown_node"},
+	}
+	report := Validate(flowMeta)
+	if report.IsValid {
+		t.Fatal("Invalid flow reported as valid")
+	}
+	expected := []struct {
+		nodeId   model.NodeID
+		field    string
+		severity string
+	}{
+		{"1", "Config.Expressions[0]", model.ValidationSeverityError},
+		{"1", "ErrorTransition", model.ValidationSeverityError},
+		{"2", "Config.FalseTransition", model.ValidationSeverityError},
+		{"3", "Config.Expression", model.ValidationSeverityError},
+		{"3", "", model.ValidationSeverityWarning},
+		{"4", "Config.Template", model.ValidationSeverityError},
+		{"5", "Config", model.ValidationSeverityError},
+		{"6", "Type", model.ValidationSeverityError},
+	}
+	for _, exp := range expected {
+		vErr := findValidationError(report, exp.nodeId, exp.field)
+		if vErr == nil {
+			t.Errorf("Missing validation error for node %s , field %s", exp.nodeId, exp.field)
+		} else if vErr.Severity != exp.severity {
+			t.Errorf("Wrong severity for node %s , field %s : %s", exp.nodeId, exp.field, vErr.Severity)
+		}
+	}
+}
+
+func TestValidate_MissingTrigger(t *testing.T) {
+	flowMeta := model.FlowMeta{Id: "TestValidateFlow", Nodes: []model.MetaNode{{Id: "1", Type: "wait", Config: float64(100)}}}
+	report := Validate(flowMeta)
+	if report.IsValid || findValidationError(report, "", "Nodes") == nil {
+		t.Error("Missing trigger wasn't reported , errors = ", report.Errors)
+	}
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	InstanceRecoveryNone        = "none"         // instances are not checkpointed , default
+	InstanceRecoveryResume      = "resume"       // all instances are resumed , expired waits continue immediately
+	InstanceRecoverySkipExpired = "skip_expired" // instances which wait time expired while tpflow wasn't running are dropped
+)
+
+// InstanceCheckpoint is snapshot of flow instance waiting in long running node (wait , receive) .
+type InstanceCheckpoint struct {
+	FlowId     string
+	InstanceId int32
+	NodeId     NodeID
+	AddressStr string
+	Address    fimpgo.Address
+	Payload    []byte // fimp message serialized by fimpgo , keeps value types
+	RawPayload []byte
+	Header     map[string]string
+	Variables  []ContextRecord     // in-memory variables of the flow
+	Vars       map[string]Variable // instance variables
+	CallChain  []string
+	WaitUntil  time.Time // zero if the node has no time limit
+	CreatedAt  time.Time
+}
+
+func NewInstanceCheckpoint(flowId string, instanceId int32, nodeId NodeID, msg Message, waitUntil time.Time) InstanceCheckpoint {
+	cp := InstanceCheckpoint{FlowId: flowId, InstanceId: instanceId, NodeId: nodeId, AddressStr: msg.AddressStr, Address: msg.Address,
+		RawPayload: msg.RawPayload, Header: msg.Header, Vars: msg.Vars, CallChain: msg.CallChain, WaitUntil: waitUntil, CreatedAt: time.Now()}
+	if msg.Payload.Type != "" {
+		cp.Payload, _ = msg.Payload.SerializeToJson()
+	}
+	return cp
+}
+
+// GetMessage restores message from the checkpoint
+func (cp *InstanceCheckpoint) GetMessage() Message {
+	msg := Message{AddressStr: cp.AddressStr, Address: cp.Address, RawPayload: cp.RawPayload, Header: cp.Header, Vars: cp.Vars, CallChain: cp.CallChain}
+	if len(cp.Payload) > 0 {
+		payload, err := fimpgo.NewMessageFromBytes(cp.Payload)
+		if err == nil {
+			msg.Payload = *payload
+		} else {
+			log.Error("<ctx> Can't restore checkpoint message . Err:", err)
+		}
+	}
+	return msg
+}
+
+func checkpointKey(flowId string, instanceId int32, nodeId NodeID) string {
+	return fmt.Sprintf("checkpoint/%s/%d/%s", flowId, instanceId, nodeId)
+}
+
+func (ctx *Context) SaveCheckpoint(cp *InstanceCheckpoint) error {
+	if records, err := ctx.inMemoryStore.GetRecordsForFlow(cp.FlowId); err == nil {
+		cp.Variables = records
+	}
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(cp); err != nil {
+		return err
+	}
+	return ctx.PutRuntimeState(checkpointKey(cp.FlowId, cp.InstanceId, cp.NodeId), buf.Bytes())
+}
+
+// GetCheckpoints returns all checkpoints of the flow
+func (ctx *Context) GetCheckpoints(flowId string) []InstanceCheckpoint {
+	var result []InstanceCheckpoint
+	for key, data := range ctx.GetRuntimeStates(fmt.Sprintf("checkpoint/%s/", flowId)) {
+		cp := InstanceCheckpoint{}
+		if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&cp); err != nil {
+			log.Errorf("<ctx> Can't decode checkpoint %s . Err:%s", key, err)
+			continue
+		}
+		result = append(result, cp)
+	}
+	return result
+}
+
+func (ctx *Context) DeleteCheckpoint(flowId string, instanceId int32, nodeId NodeID) error {
+	return ctx.DeleteRuntimeStates(checkpointKey(flowId, instanceId, nodeId))
+}
+
+// DeleteCheckpoints deletes all checkpoints of the flow
+func (ctx *Context) DeleteCheckpoints(flowId string) error {
+	return ctx.DeleteRuntimeStates(fmt.Sprintf("checkpoint/%s/", flowId))
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Comparison operands supported by CompareVariables
+const (
+	OperandEq       = "eq"
+	OperandNe       = "ne"
+	OperandGt       = "gt"
+	OperandGte      = "gte"
+	OperandLt       = "lt"
+	OperandLte      = "lte"
+	OperandContains = "contains"
+	OperandIn       = "in"
+	OperandRegex    = "regex"
+	OperandBetween  = "between"
+)
+
+var regexCache sync.Map
+
+// IsCompareOperandSupported returns true if operand can be evaluated by CompareVariables
+func IsCompareOperandSupported(operand string) bool {
+	switch operand {
+	case OperandEq, OperandNe, OperandGt, OperandGte, OperandLt, OperandLte, OperandContains, OperandIn, OperandRegex, OperandBetween:
+		return true
+	}
+	return false
+}
+
+// CompareVariables evaluates comparison between left and right variables :
+// eq , ne - numbers are compared as numbers , other types must have the same type ;
+// gt , gte , lt , lte - both variables must be numbers ;
+// contains - left string contains right string or left array contains right value ;
+// in - left value is one of items of right array ;
+// regex - left value converted to string matches regular expression from right variable ;
+// between - right <= left <= rightMax , both bounds are inclusive.
+func CompareVariables(operand string, left Variable, right Variable, rightMax Variable) (bool, error) {
+	switch operand {
+	case OperandEq, OperandNe:
+		var isEqual bool
+		if left.IsNumber() && right.IsNumber() {
+			leftNum, rightNum, err := toNumbers(left, right)
+			if err != nil {
+				return false, err
+			}
+			isEqual = leftNum == rightNum
+		} else if left.ValueType != right.ValueType {
+			return false, fmt.Errorf("right and left of expression have different types")
+		} else {
+			isEqual = reflect.DeepEqual(left.Value, right.Value)
+		}
+		if operand == OperandNe {
+			return !isEqual, nil
+		}
+		return isEqual, nil
+	case OperandGt, OperandGte, OperandLt, OperandLte:
+		leftNum, rightNum, err := toNumbers(left, right)
+		if err != nil {
+			return false, err
+		}
+		switch operand {
+		case OperandGt:
+			return leftNum > rightNum, nil
+		case OperandGte:
+			return leftNum >= rightNum, nil
+		case OperandLt:
+			return leftNum < rightNum, nil
+		}
+		return leftNum <= rightNum, nil
+	case OperandBetween:
+		leftNum, minNum, err := toNumbers(left, right)
+		if err != nil {
+			return false, err
+		}
+		_, maxNum, err := toNumbers(left, rightMax)
+		if err != nil {
+			return false, err
+		}
+		return leftNum >= minNum && leftNum <= maxNum, nil
+	case OperandContains:
+		if str, ok := left.Value.(string); ok {
+			return strings.Contains(str, fmt.Sprint(right.Value)), nil
+		}
+		return listContains(left.Value, right.Value)
+	case OperandIn:
+		return listContains(right.Value, left.Value)
+	case OperandRegex:
+		pattern, ok := right.Value.(string)
+		if !ok {
+			return false, fmt.Errorf("regular expression must be a string")
+		}
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(left.Value)), nil
+	}
+	return false, fmt.Errorf("unsupported operand %s", operand)
+}
+
+func toNumbers(left Variable, right Variable) (float64, float64, error) {
+	if !left.IsNumber() || !right.IsNumber() {
+		return 0, 0, fmt.Errorf("incompatible value types %s and %s , numeric types expected", left.ValueType, right.ValueType)
+	}
+	leftNum, err := left.ToNumber()
+	if err != nil {
+		return 0, 0, err
+	}
+	rightNum, err := right.ToNumber()
+	return leftNum, rightNum, err
+}
+
+// listContains checks if list (any slice type) has item , numbers are compared as numbers
+func listContains(list interface{}, item interface{}) (bool, error) {
+	listVal := reflect.ValueOf(list)
+	if listVal.Kind() != reflect.Slice && listVal.Kind() != reflect.Array {
+		return false, fmt.Errorf("array value expected")
+	}
+	itemVar := Variable{Value: item}
+	itemNum, itemNumErr := itemVar.ToNumber()
+	for i := 0; i < listVal.Len(); i++ {
+		listItem := Variable{Value: listVal.Index(i).Interface()}
+		if itemNumErr == nil {
+			if num, err := listItem.ToNumber(); err == nil && num == itemNum {
+				return true, nil
+			}
+		}
+		if reflect.DeepEqual(listItem.Value, item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
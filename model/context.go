@@ -1,14 +1,12 @@
 package model
 
 import (
-	"bytes"
-	"encoding/gob"
 	log "github.com/sirupsen/logrus"
 	"os"
 
-	"github.com/boltdb/bolt"
 	"github.com/pkg/errors"
 	"math"
+	"sync"
 	"time"
 )
 
@@ -120,71 +118,110 @@ type ContextRecord struct {
 	UpdatedAt   time.Time
 	Variable    Variable
 	InMemory    bool
+	ExpiresAt   time.Time // zero time - variable never expires
 }
 
+const runtimeStateBucket = "_runtime_state"
+
 type Context struct {
 	storageLocation string
-	db              *bolt.DB
+	db              StorageBackend
+	codec           recordCodec
 	inMemoryStore   ContextInMemoryStore
+	subscribers     map[string]chan ContextChangeEvent // variable change subscribers
+	subMtx          sync.RWMutex
+	historyPolicies map[string]HistoryPolicy   // flowId/name -> policy
+	historyCounts   map[historyCountKey]int    // number of values in history bucket , is loaded on the first write
+	historyWrites   map[historyCountKey]uint64 // sequence number of the last history write , count is cached only by the last write
+	historyWriteSeq uint64
+	memHistory      StorageBackend // history of in-memory variables
+	historyMtx      sync.RWMutex
+	expiringVars    map[expiringVarKey]expiringVar // variables with expiry time
+	expiryMtx       sync.Mutex
+	inMemoryMtx     sync.Mutex // serializes read-modify-write of in-memory records
+	sweeperStopCh   chan bool
 }
 
+// NewContextDB opens context stored in bolt DB file with gob encoded variables
 func NewContextDB(storageLocation string) (*Context, error) {
-	var err error
-	gob.Register([]interface{}{})
-	gob.Register([]string{})
-	gob.Register([]int64{})
-	gob.Register([]float64{})
-	gob.Register([]bool{})
-	gob.Register(map[string]interface{}{})
-	gob.Register(map[string]string{})
-	gob.Register(map[string]int64{})
-	gob.Register(map[string]float64{})
-	gob.Register(map[string]bool{})
-
-	ctx := Context{storageLocation: storageLocation}
-	//ctx.inMemoryStore = make(map[string][]ContextRecord)
-	ctx.db, err = bolt.Open(storageLocation, 0600, nil)
+	return NewContextWithStorage(StorageBolt, storageLocation, EncodingGob)
+}
+
+// NewContextWithStorage opens context stored in backend of given type (bolt , memory , sqlite) . Encoding (gob , json) is used for new writes ,
+// variables stored with other encoding are still readable.
+func NewContextWithStorage(backendType string, storageLocation string, encoding string) (*Context, error) {
+	storage, err := OpenStorageBackend(backendType, storageLocation)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	ctx, err := NewContext(storage, encoding)
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	ctx.storageLocation = storageLocation
+	return ctx, nil
+}
+
+// NewContext creates context on top of opened storage backend
+func NewContext(storage StorageBackend, encoding string) (*Context, error) {
+	codec, err := newRecordCodec(encoding)
+	if err != nil {
+		return nil, err
+	}
+	ctx := Context{db: storage, codec: codec, memHistory: NewMemoryStorage(), historyCounts: map[historyCountKey]int{},
+		historyWrites: map[historyCountKey]uint64{}}
 	ctx.RegisterFlow("global")
-	//ctx.DeleteRecord("weather.temp", "global", false)
+	ctx.RegisterFlow(runtimeStateBucket)
+	ctx.RegisterFlow(historyPolicyBucket)
+	ctx.loadHistoryPolicies()
+	ctx.loadExpiryIndex()
 	return &ctx, nil
 }
+
+// NewInMemoryContext creates context which doesn't persist anything , is used by tests
+func NewInMemoryContext() *Context {
+	ctx, _ := NewContext(NewMemoryStorage(), EncodingGob)
+	return ctx
+}
+
 func (ctx *Context) Close() {
+	ctx.StopExpirySweeper()
 	ctx.db.Close()
 }
 
 func (ctx *Context) FactoryReset() {
 	ctx.Close()
-	os.Remove(ctx.storageLocation)
+	if ctx.storageLocation != "" {
+		os.Remove(ctx.storageLocation)
+	}
 }
 
 func (ctx *Context) RegisterFlow(flowId string) error {
-	ctx.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(flowId))
-		if err != nil {
-			log.Errorf("<ctx> Can't create bucket %s . Error: %s", flowId, err)
-			return err
-		}
-		return nil
+	err := ctx.db.Update(func(tx StorageTx) error {
+		return tx.CreateBucket(flowId)
 	})
+	if err != nil {
+		log.Errorf("<ctx> Can't create bucket %s . Error: %s", flowId, err)
+		return err
+	}
 	log.Infof("<ctx> Flow %s is registered in store.", flowId)
 	return nil
 }
 
 func (ctx *Context) UnregisterFlow(flowId string) error {
-	ctx.db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket([]byte(flowId))
-		if err != nil {
-			log.Errorf("<ctx> Can't delete bucket %s . Error: %s", flowId, err)
-			return err
-		}
-		return nil
+	err := ctx.db.Update(func(tx StorageTx) error {
+		return tx.DeleteBucket(flowId)
 	})
+	if err != nil {
+		log.Errorf("<ctx> Can't delete bucket %s . Error: %s", flowId, err)
+	}
 	ctx.inMemoryStore.DeleteFlow(flowId)
-	log.Info("<ctx> Flow %s is deleted .", flowId)
+	if err := ctx.deleteFlowHistory(flowId); err != nil {
+		log.Errorf("<ctx> Can't delete history of flow %s . Error: %s", flowId, err)
+	}
+	log.Infof("<ctx> Flow %s is deleted .", flowId)
 	return nil
 }
 
@@ -199,32 +236,84 @@ func (ctx *Context) PutRecord(rec *ContextRecord, flowId string, inMemory bool)
 		log.Info("<ctx> Incompatible type , varname = ", rec.Name)
 		return errors.New("Incompatible type")
 	}
+	// Old value is needed only for change notifications
+	isNotifying := ctx.hasSubscribers()
+	var oldRec *ContextRecord
 	if inMemory {
+		ctx.inMemoryMtx.Lock()
+		if isNotifying {
+			oldRec = ctx.inMemoryStore.Get(flowId, rec.Name)
+		}
 		ctx.inMemoryStore.Store(*rec, flowId)
+		ctx.inMemoryMtx.Unlock()
 	} else {
-		err := ctx.db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(flowId))
+		var historyUpdate *historyCountUpdate
+		err := ctx.db.Update(func(tx StorageTx) error {
+			if isNotifying {
+				if oldData, _ := tx.Get(flowId, []byte(rec.Name)); oldData != nil {
+					oldRec, _ = ctx.decodeRecord(oldData)
+				}
+			}
 			data, err := ctx.encodeRecord(rec)
 			if err != nil {
 				return err
 			}
-			err = b.Put([]byte(rec.Name), data)
+			if err = tx.Put(flowId, []byte(rec.Name), data); err != nil {
+				return err
+			}
+			historyUpdate, err = ctx.writeHistory(tx, flowId, rec, false)
 			return err
 		})
-		return err
+		if err != nil {
+			return err
+		}
+		ctx.cacheHistoryCount(historyUpdate)
 	}
+	ctx.onRecordUpdated(flowId, rec, oldRec, inMemory, isNotifying)
 	return nil
 }
 
-func (ctx *Context) DeleteRecord(name string, flowId string, inMemory bool) error {
+// onRecordUpdated updates expiry index and history of in-memory variable and notifies subscribers .
+// History of disk variable is written by the transaction which stores the value.
+func (ctx *Context) onRecordUpdated(flowId string, rec *ContextRecord, oldRec *ContextRecord, inMemory bool, isNotifying bool) {
+	ctx.updateExpiryIndex(flowId, rec.Name, rec.ExpiresAt, inMemory)
 	if inMemory {
+		if err := ctx.appendMemoryHistory(flowId, rec); err != nil {
+			log.Errorf("<ctx> Can't store history of variable %s . Err:%s", rec.Name, err)
+		}
+	}
+	if isNotifying {
+		newValue := rec.Variable
+		event := ContextChangeEvent{FlowId: flowId, Name: rec.Name, NewValue: &newValue, InMemory: inMemory, UpdatedAt: rec.UpdatedAt}
+		if oldRec != nil {
+			event.OldValue = &oldRec.Variable
+		}
+		ctx.notifyChange(event)
+	}
+}
 
+func (ctx *Context) DeleteRecord(name string, flowId string, inMemory bool) error {
+	ctx.updateExpiryIndex(flowId, name, time.Time{}, inMemory)
+	if inMemory {
+		ctx.inMemoryMtx.Lock()
+		oldRec := ctx.inMemoryStore.Get(flowId, name)
+		ctx.inMemoryStore.Delete(flowId, name)
+		ctx.inMemoryMtx.Unlock()
+		if oldRec != nil && ctx.hasSubscribers() {
+			ctx.notifyChange(ContextChangeEvent{FlowId: flowId, Name: name, OldValue: &oldRec.Variable, InMemory: true, UpdatedAt: time.Now()})
+		}
 	} else {
 		log.Infof("<ctx> Deleting variable %s from flow %s", name, flowId)
-		err := ctx.db.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte(flowId))
-			return b.Delete([]byte(name))
+		var oldRec *ContextRecord
+		err := ctx.db.Update(func(tx StorageTx) error {
+			if oldData, _ := tx.Get(flowId, []byte(name)); oldData != nil {
+				oldRec, _ = ctx.decodeRecord(oldData)
+			}
+			return tx.Delete(flowId, []byte(name))
 		})
+		if err == nil && oldRec != nil && ctx.hasSubscribers() {
+			ctx.notifyChange(ContextChangeEvent{FlowId: flowId, Name: name, OldValue: &oldRec.Variable, UpdatedAt: time.Now()})
+		}
 		return err
 	}
 	return nil
@@ -251,28 +340,32 @@ func (ctx *Context) GetVariableType(name string, flowId string) (string, error)
 
 func (ctx *Context) GetRecord(name string, flowId string) (*ContextRecord, error) {
 	// check memmory first
+	// Expired variables are invisible even if sweeper hasn't deleted them yet
 	rec := ctx.inMemoryStore.Get(flowId, name)
-	if rec != nil {
+	if rec != nil && !rec.IsExpired(time.Now()) {
 		rec.InMemory = true
 		return rec, nil
 	}
 
 	var ctxRec *ContextRecord
 	var err error
-	ctx.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(flowId))
-		if b == nil {
+	ctx.db.View(func(tx StorageTx) error {
+		var data []byte
+		data, err = tx.Get(flowId, []byte(name))
+		if err == ErrBucketNotFound {
 			err = errors.New("Flow doesn't exist")
+		} else if err != nil {
 			return nil
-		}
-		data := b.Get([]byte(name))
-		if data == nil {
+		} else if data == nil {
 			err = errors.New("Not Found")
 		} else {
 			ctxRec, err = ctx.decodeRecord(data)
 		}
 		return nil
 	})
+	if err == nil && ctxRec.IsExpired(time.Now()) {
+		err = errors.New("Not Found")
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -281,27 +374,21 @@ func (ctx *Context) GetRecord(name string, flowId string) (*ContextRecord, error
 
 func (ctx *Context) GetRecords(flowId string) []ContextRecord {
 	result := []ContextRecord{}
+	now := time.Now()
 	log.Info("<ctx> GEtting records")
-	ctx.db.View(func(tx *bolt.Tx) error {
-		// Assume bucket exists and has keys
-		b := tx.Bucket([]byte(flowId))
-		if b == nil {
-
-			return nil
-		}
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
+	ctx.db.View(func(tx StorageTx) error {
+		// Missing bucket means that flow doesn't have variables
+		return tx.Scan(flowId, nil, nil, false, func(k, v []byte) (bool, error) {
 			rec, err := ctx.decodeRecord(v)
 			if err == nil {
-				result = append(result, *rec)
+				if !rec.IsExpired(now) {
+					result = append(result, *rec)
+				}
 			} else {
 				log.Errorf("Can't decode record = %s , %s", k, err)
 			}
-
-		}
-
-		return nil
+			return true, nil
+		})
 	})
 	//log.Info("<ctx> DONE ,",len(result))
 	//log.Info("<ctx> DONE ,",result)
@@ -309,37 +396,64 @@ func (ctx *Context) GetRecords(flowId string) []ContextRecord {
 	memResult, err := ctx.inMemoryStore.GetRecordsForFlow(flowId)
 	if err == nil {
 		for i := range memResult {
-			memResult[i].InMemory = true
+			if !memResult[i].IsExpired(now) {
+				memResult[i].InMemory = true
+				result = append(result, memResult[i])
+			}
 		}
-		result = append(result, memResult...)
 	} else {
 		log.Error("Can't get records from memory store , err :", err)
 	}
 	return result
 }
 
+// PutRuntimeState stores internal state of flows and nodes (instance checkpoints , etc) . The state isn't visible as context variable.
+func (ctx *Context) PutRuntimeState(key string, data []byte) error {
+	return ctx.db.Update(func(tx StorageTx) error {
+		return tx.Put(runtimeStateBucket, []byte(key), data)
+	})
+}
+
+// GetRuntimeStates returns all runtime states which keys start with keyPrefix
+func (ctx *Context) GetRuntimeStates(keyPrefix string) map[string][]byte {
+	result := map[string][]byte{}
+	ctx.db.View(func(tx StorageTx) error {
+		from, to := prefixRange(keyPrefix)
+		return tx.Scan(runtimeStateBucket, from, to, false, func(k, v []byte) (bool, error) {
+			result[string(k)] = append([]byte{}, v...)
+			return true, nil
+		})
+	})
+	return result
+}
+
+// DeleteRuntimeStates deletes all runtime states which keys start with keyPrefix
+func (ctx *Context) DeleteRuntimeStates(keyPrefix string) error {
+	return ctx.db.Update(func(tx StorageTx) error {
+		var keys [][]byte
+		from, to := prefixRange(keyPrefix)
+		err := tx.Scan(runtimeStateBucket, from, to, false, func(k, v []byte) (bool, error) {
+			keys = append(keys, append([]byte{}, k...))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete(runtimeStateBucket, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (ctx *Context) encodeRecord(rec *ContextRecord) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	enc := gob.NewEncoder(buf)
-	err := enc.Encode(rec)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return ctx.codec.encodeRecord(rec)
 }
 
 func (ctx *Context) decodeRecord(data []byte) (*ContextRecord, error) {
-	ctxRec := ContextRecord{}
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(&ctxRec)
-	//log.Infof("Decoding variable %s",ctxRec.Name)
-	//if ctxRec.Name == "weather.temp"{
-	//	return nil,errors.New("WrongType")
-	//
-	//}
-
-	return &ctxRec, err
+	return ctx.codec.decodeRecord(data)
 }
 
 //func (ctx *Context) GetRecord(name string) (*ContextRecord,error) {
@@ -0,0 +1,402 @@
+package model
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Atomic operation types
+const (
+	AtomicIncrement = "increment"
+	AtomicDecrement = "decrement"
+	AtomicCas       = "cas"
+	AtomicAppend    = "append"
+	AtomicPop       = "pop"
+	AtomicMapSet    = "map_set"
+	AtomicMapDelete = "map_delete"
+)
+
+var (
+	ErrCompareFailed = errors.New("current value doesn't match expected value")
+	ErrListEmpty     = errors.New("list is empty")
+)
+
+// listTypes maps list value type to type of its items and empty list
+var listTypes = map[string]struct {
+	itemType string
+	empty    interface{}
+}{
+	"str_array":   {"string", []string{}},
+	"int_array":   {"int", []int64{}},
+	"float_array": {"float", []float64{}},
+	"bool_array":  {"bool", []bool{}},
+	"object":      {"", []interface{}{}},
+}
+
+// mapTypes maps map value type to type of its items and empty map
+var mapTypes = map[string]struct {
+	itemType string
+	empty    interface{}
+}{
+	"str_map":   {"string", map[string]string{}},
+	"int_map":   {"int", map[string]int64{}},
+	"float_map": {"float", map[string]float64{}},
+	"bool_map":  {"bool", map[string]bool{}},
+	"object":    {"", map[string]interface{}{}},
+}
+
+// AtomicOperation describes read-modify-write operation executed on single variable without interference from other writers
+type AtomicOperation struct {
+	Type     string   // increment , decrement , cas , append , pop , map_set , map_delete
+	Value    Variable // increment/decrement step (1 if not set) , new value (cas) , list item (append) or map item (map_set)
+	Expected Variable // cas - expected current value , empty ValueType - variable must not exist
+	Key      string   // map key
+	MaxSize  int      // append - max list size , oldest items are removed , 0 - unlimited
+	PopLast  bool     // pop - remove last item (stack) instead of first one (queue)
+}
+
+// ExecuteAtomicOperation executes operation on the variable . Returns new value of the variable or removed item in case of pop.
+func (ctx *Context) ExecuteAtomicOperation(name string, flowId string, inMemory bool, op AtomicOperation) (Variable, error) {
+	switch op.Type {
+	case AtomicIncrement, AtomicDecrement:
+		step := Variable{ValueType: "int", Value: int64(1)}
+		if op.Value.ValueType != "" {
+			step = op.Value
+		}
+		return ctx.incrementVariable(name, flowId, inMemory, step, op.Type == AtomicDecrement)
+	case AtomicCas:
+		return op.Value, ctx.CompareAndSwapVariable(name, flowId, inMemory, op.Expected, op.Value)
+	case AtomicAppend:
+		return ctx.AppendToList(name, flowId, inMemory, op.Value, op.MaxSize)
+	case AtomicPop:
+		return ctx.PopFromList(name, flowId, inMemory, op.PopLast)
+	case AtomicMapSet:
+		return ctx.SetMapValue(name, flowId, inMemory, op.Key, op.Value)
+	case AtomicMapDelete:
+		return ctx.DeleteMapKey(name, flowId, inMemory, op.Key)
+	}
+	return Variable{}, errors.New("unknown operation " + op.Type)
+}
+
+// IncrementVariable adds step to numeric variable , variable which doesn't exist is created with value 0 . Returns new value.
+func (ctx *Context) IncrementVariable(name string, flowId string, inMemory bool, step float64) (Variable, error) {
+	stepVar := Variable{ValueType: "float", Value: step}
+	if step == math.Trunc(step) && math.Abs(step) < math.MaxInt64 {
+		stepVar = Variable{ValueType: "int", Value: int64(step)}
+	}
+	return ctx.incrementVariable(name, flowId, inMemory, stepVar, false)
+}
+
+// incrementVariable adds (or subtracts if isDecrement is true) step to numeric variable .
+// Int variable incremented by integer step is calculated in int64 , so big values don't lose precision.
+func (ctx *Context) incrementVariable(name string, flowId string, inMemory bool, step Variable, isDecrement bool) (Variable, error) {
+	floatStep, err := step.ToNumber()
+	if err != nil || !step.IsNumber() {
+		return Variable{}, errors.New("step is not a number")
+	}
+	intStep, isIntStep := step.toInt64()
+	if !isIntStep && floatStep == math.Trunc(floatStep) && math.Abs(floatStep) < math.MaxInt64 {
+		intStep, isIntStep = int64(floatStep), true
+	}
+	if isDecrement {
+		floatStep, intStep = -floatStep, -intStep
+	}
+	var result Variable
+	err = ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if !exists {
+			rec.Variable = Variable{ValueType: "float", Value: float64(0)}
+			if isIntStep {
+				rec.Variable = Variable{ValueType: "int", Value: int64(0)}
+			}
+		}
+		current, err := rec.Variable.ToNumber()
+		if err != nil || !rec.Variable.IsNumber() {
+			return errors.New("variable is not a number")
+		}
+		if rec.Variable.ValueType == "int" {
+			if !isIntStep {
+				return errors.New("int variable can't be incremented by fractional step")
+			}
+			intCurrent, ok := rec.Variable.toInt64()
+			if !ok {
+				intCurrent = int64(current)
+			}
+			rec.Variable.Value = intCurrent + intStep
+		} else {
+			rec.Variable.Value = current + floatStep
+		}
+		result = rec.Variable
+		return nil
+	})
+	return result, err
+}
+
+// CompareAndSwapVariable sets variable to newValue only if its current value is equal to expected .
+// Expected with empty type means that the variable must not exist . Returns ErrCompareFailed if values don't match.
+func (ctx *Context) CompareAndSwapVariable(name string, flowId string, inMemory bool, expected Variable, newValue Variable) error {
+	return ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if expected.ValueType == "" {
+			if exists {
+				return ErrCompareFailed
+			}
+		} else {
+			if !exists {
+				return ErrCompareFailed
+			}
+			if isEqual, err := CompareVariables(OperandEq, rec.Variable, expected, Variable{}); err != nil || !isEqual {
+				return ErrCompareFailed
+			}
+		}
+		rec.Variable = newValue
+		return nil
+	})
+}
+
+// AppendToList appends item to the end of list variable . List is created if the variable doesn't exist.
+// If maxSize > 0 , the oldest items are removed to keep list size within the limit . Returns new value.
+func (ctx *Context) AppendToList(name string, flowId string, inMemory bool, item Variable, maxSize int) (Variable, error) {
+	var result Variable
+	err := ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if !exists {
+			rec.Variable = Variable{ValueType: "object", Value: []interface{}{}}
+			for listType, def := range listTypes {
+				if def.itemType != "" && def.itemType == item.ValueType {
+					rec.Variable = Variable{ValueType: listType, Value: def.empty}
+				}
+			}
+		}
+		list, err := copyList(rec.Variable)
+		if err != nil {
+			return err
+		}
+		itemValue, err := convertItem(item, listTypes[rec.Variable.ValueType].itemType, list.Type().Elem())
+		if err != nil {
+			return err
+		}
+		list = reflect.Append(list, itemValue)
+		if maxSize > 0 && list.Len() > maxSize {
+			list = list.Slice(list.Len()-maxSize, list.Len())
+		}
+		rec.Variable.Value = list.Interface()
+		result = rec.Variable
+		return nil
+	})
+	return result, err
+}
+
+// PopFromList removes first (or last if popLast is true) item from list variable and returns the item
+func (ctx *Context) PopFromList(name string, flowId string, inMemory bool, popLast bool) (Variable, error) {
+	var result Variable
+	err := ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if !exists {
+			return errors.New("Not Found")
+		}
+		list, err := copyList(rec.Variable)
+		if err != nil {
+			return err
+		}
+		if list.Len() == 0 {
+			return ErrListEmpty
+		}
+		if popLast {
+			last := list.Len() - 1
+			result.Value = list.Index(last).Interface()
+			list = list.Slice(0, last)
+		} else {
+			result.Value = list.Index(0).Interface()
+			list = list.Slice(1, list.Len())
+		}
+		result.ValueType = listTypes[rec.Variable.ValueType].itemType
+		if result.ValueType == "" {
+			result.ValueType = "object"
+		}
+		rec.Variable.Value = list.Interface()
+		return nil
+	})
+	return result, err
+}
+
+// SetMapValue sets key of map variable . Map is created if the variable doesn't exist . Returns new value.
+func (ctx *Context) SetMapValue(name string, flowId string, inMemory bool, key string, item Variable) (Variable, error) {
+	var result Variable
+	err := ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if !exists {
+			rec.Variable = Variable{ValueType: "object", Value: map[string]interface{}{}}
+			for mapType, def := range mapTypes {
+				if def.itemType != "" && def.itemType == item.ValueType {
+					rec.Variable = Variable{ValueType: mapType, Value: def.empty}
+				}
+			}
+		}
+		m, err := copyMap(rec.Variable)
+		if err != nil {
+			return err
+		}
+		itemValue, err := convertItem(item, mapTypes[rec.Variable.ValueType].itemType, m.Type().Elem())
+		if err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(key), itemValue)
+		rec.Variable.Value = m.Interface()
+		result = rec.Variable
+		return nil
+	})
+	return result, err
+}
+
+// DeleteMapKey removes key from map variable . Returns new value.
+func (ctx *Context) DeleteMapKey(name string, flowId string, inMemory bool, key string) (Variable, error) {
+	var result Variable
+	err := ctx.updateRecord(name, flowId, inMemory, func(rec *ContextRecord, exists bool) error {
+		if !exists {
+			return errors.New("Not Found")
+		}
+		m, err := copyMap(rec.Variable)
+		if err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(key), reflect.Value{})
+		rec.Variable.Value = m.Interface()
+		result = rec.Variable
+		return nil
+	})
+	return result, err
+}
+
+// updateRecord reads , modifies and writes the record within single bolt transaction or under lock for in-memory records.
+// Expired record is treated as not existing one . The record isn't saved if update returns error.
+func (ctx *Context) updateRecord(name string, flowId string, inMemory bool, update func(rec *ContextRecord, exists bool) error) error {
+	now := time.Now()
+	isNotifying := ctx.hasSubscribers()
+	var rec, oldRec *ContextRecord
+	modify := func() error {
+		rec = &ContextRecord{Name: name}
+		if oldRec != nil && !oldRec.IsExpired(now) {
+			copyRec := *oldRec
+			rec = &copyRec
+		} else {
+			oldRec = nil
+		}
+		if err := update(rec, oldRec != nil); err != nil {
+			return err
+		}
+		rec.UpdatedAt = now
+		if !rec.Variable.isTypeValid() {
+			return errors.New("Incompatible type")
+		}
+		return nil
+	}
+	if inMemory {
+		ctx.inMemoryMtx.Lock()
+		oldRec = ctx.inMemoryStore.Get(flowId, name)
+		err := modify()
+		if err == nil {
+			ctx.inMemoryStore.Store(*rec, flowId)
+		}
+		ctx.inMemoryMtx.Unlock()
+		if err != nil {
+			return err
+		}
+	} else {
+		var historyUpdate *historyCountUpdate
+		err := ctx.db.Update(func(tx StorageTx) error {
+			data, err := tx.Get(flowId, []byte(name))
+			if err == ErrBucketNotFound {
+				return errors.New("Flow doesn't exist")
+			} else if err != nil {
+				return err
+			}
+			if data != nil {
+				if oldRec, err = ctx.decodeRecord(data); err != nil {
+					return err
+				}
+			}
+			if err := modify(); err != nil {
+				return err
+			}
+			if data, err = ctx.encodeRecord(rec); err != nil {
+				return err
+			}
+			if err = tx.Put(flowId, []byte(name), data); err != nil {
+				return err
+			}
+			historyUpdate, err = ctx.writeHistory(tx, flowId, rec, false)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		ctx.cacheHistoryCount(historyUpdate)
+	}
+	ctx.onRecordUpdated(flowId, rec, oldRec, inMemory, isNotifying)
+	return nil
+}
+
+// toInt64 returns value of variable which holds go integer , without conversion through float64
+func (vrbl *Variable) toInt64() (int64, bool) {
+	switch v := vrbl.Value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// copyList returns copy of list variable , so the old value isn't modified
+func copyList(vrbl Variable) (reflect.Value, error) {
+	list := reflect.ValueOf(vrbl.Value)
+	if list.Kind() != reflect.Slice {
+		return list, errors.New("variable is not a list")
+	}
+	result := reflect.MakeSlice(list.Type(), list.Len(), list.Len())
+	reflect.Copy(result, list)
+	return result, nil
+}
+
+// copyMap returns copy of map variable , so the old value isn't modified
+func copyMap(vrbl Variable) (reflect.Value, error) {
+	m := reflect.ValueOf(vrbl.Value)
+	if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+		return m, errors.New("variable is not a map")
+	}
+	result := reflect.MakeMapWithSize(m.Type(), m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		result.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return result, nil
+}
+
+// convertItem converts list or map item into value of the type of container elements
+func convertItem(item Variable, itemType string, elemType reflect.Type) (reflect.Value, error) {
+	if itemType != "" && item.ValueType != itemType {
+		return reflect.Value{}, errors.New("item type " + item.ValueType + " doesn't match type " + itemType)
+	}
+	value := item.Value
+	if item.IsNumber() {
+		number, err := item.ToNumber()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value = number
+		if item.ValueType == "int" {
+			value = int64(number)
+		}
+	}
+	if value == nil {
+		return reflect.Zero(elemType), nil
+	}
+	result := reflect.ValueOf(value)
+	if result.Type().AssignableTo(elemType) {
+		return result, nil
+	}
+	if result.Type().ConvertibleTo(elemType) {
+		return result.Convert(elemType), nil
+	}
+	return reflect.Value{}, errors.New("item can't be converted to " + elemType.String())
+}
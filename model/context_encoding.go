@@ -0,0 +1,242 @@
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Encodings of stored variables
+const (
+	EncodingGob  = "gob"
+	EncodingJson = "json"
+)
+
+func init() {
+	gob.Register([]interface{}{})
+	gob.Register([]string{})
+	gob.Register([]int64{})
+	gob.Register([]float64{})
+	gob.Register([]bool{})
+	gob.Register(map[string]interface{}{})
+	gob.Register(map[string]string{})
+	gob.Register(map[string]int64{})
+	gob.Register(map[string]float64{})
+	gob.Register(map[string]bool{})
+}
+
+// recordCodec encodes context records and history values . gob keeps Go types , json is readable by other tools.
+type recordCodec struct {
+	encoding string
+}
+
+func newRecordCodec(encoding string) (recordCodec, error) {
+	switch encoding {
+	case "":
+		return recordCodec{encoding: EncodingGob}, nil
+	case EncodingGob, EncodingJson:
+		return recordCodec{encoding: encoding}, nil
+	}
+	return recordCodec{}, fmt.Errorf("unknown encoding %s", encoding)
+}
+
+func (cd recordCodec) encode(value interface{}) ([]byte, error) {
+	if cd.encoding == EncodingJson {
+		return json.Marshal(value)
+	}
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode detects encoding of stored data , so records written before encoding was changed can still be read.
+// Returns true if data was JSON encoded.
+func (cd recordCodec) decode(data []byte, target interface{}) (bool, error) {
+	decodeJson := func() error {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		return dec.Decode(target)
+	}
+	decodeGob := func() error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(target)
+	}
+	if isJsonData(data) {
+		if err := decodeJson(); err == nil {
+			return true, nil
+		}
+		return false, decodeGob()
+	}
+	if err := decodeGob(); err == nil {
+		return false, nil
+	}
+	return true, decodeJson()
+}
+
+func (cd recordCodec) encodeRecord(rec *ContextRecord) ([]byte, error) {
+	return cd.encode(rec)
+}
+
+func (cd recordCodec) decodeRecord(data []byte) (*ContextRecord, error) {
+	rec := ContextRecord{}
+	isJson, err := cd.decode(data, &rec)
+	if err == nil && isJson {
+		rec.Variable.normalizeJsonValue()
+	}
+	return &rec, err
+}
+
+func (cd recordCodec) decodeVariable(data []byte) (Variable, error) {
+	vrbl := Variable{}
+	isJson, err := cd.decode(data, &vrbl)
+	if err == nil && isJson {
+		vrbl.normalizeJsonValue()
+	}
+	return vrbl, err
+}
+
+// isJsonData returns true if data looks like JSON object , gob data starting with '{' is handled by decode fallback.
+func isJsonData(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// normalizeJsonValue restores Go types of value decoded from JSON , where all numbers are json.Number and lists are []interface{}.
+// Value which doesn't match its type is kept as generic object.
+func (vrbl *Variable) normalizeJsonValue() {
+	var result interface{}
+	var err error
+	switch vrbl.ValueType {
+	case "int", "float":
+		if n, ok := vrbl.Value.(json.Number); ok {
+			result, err = jsonNumber(n, vrbl.ValueType == "int")
+		}
+	case "str_array", "int_array", "float_array", "bool_array":
+		if list, ok := vrbl.Value.([]interface{}); ok {
+			result, err = normalizeList(list, vrbl.ValueType)
+		}
+	case "str_map", "int_map", "float_map", "bool_map":
+		if m, ok := vrbl.Value.(map[string]interface{}); ok {
+			result, err = normalizeMap(m, vrbl.ValueType)
+		}
+	}
+	if result == nil || err != nil {
+		result = normalizeObject(vrbl.Value)
+	}
+	vrbl.Value = result
+}
+
+func jsonNumber(n json.Number, isInt bool) (interface{}, error) {
+	if isInt {
+		if v, err := n.Int64(); err == nil {
+			return v, nil
+		}
+		v, err := n.Float64()
+		return int64(v), err
+	}
+	return n.Float64()
+}
+
+// normalizeItem converts JSON value into Go type of list or map item
+func normalizeItem(value interface{}, containerType string) (interface{}, error) {
+	switch containerType {
+	case "int_array", "int_map":
+		if n, ok := value.(json.Number); ok {
+			return jsonNumber(n, true)
+		}
+	case "float_array", "float_map":
+		if n, ok := value.(json.Number); ok {
+			return jsonNumber(n, false)
+		}
+	case "str_array", "str_map":
+		if _, ok := value.(string); ok {
+			return value, nil
+		}
+	case "bool_array", "bool_map":
+		if _, ok := value.(bool); ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected item %v in %s", value, containerType)
+}
+
+func normalizeList(list []interface{}, listType string) (interface{}, error) {
+	var result interface{}
+	switch listType {
+	case "str_array":
+		result = make([]string, 0, len(list))
+	case "int_array":
+		result = make([]int64, 0, len(list))
+	case "float_array":
+		result = make([]float64, 0, len(list))
+	case "bool_array":
+		result = make([]bool, 0, len(list))
+	}
+	for _, item := range list {
+		value, err := normalizeItem(item, listType)
+		if err != nil {
+			return list, err
+		}
+		switch r := result.(type) {
+		case []string:
+			result = append(r, value.(string))
+		case []int64:
+			result = append(r, value.(int64))
+		case []float64:
+			result = append(r, value.(float64))
+		case []bool:
+			result = append(r, value.(bool))
+		}
+	}
+	return result, nil
+}
+
+func normalizeMap(m map[string]interface{}, mapType string) (interface{}, error) {
+	var result interface{}
+	switch mapType {
+	case "str_map":
+		result = make(map[string]string, len(m))
+	case "int_map":
+		result = make(map[string]int64, len(m))
+	case "float_map":
+		result = make(map[string]float64, len(m))
+	case "bool_map":
+		result = make(map[string]bool, len(m))
+	}
+	for key, item := range m {
+		value, err := normalizeItem(item, mapType)
+		if err != nil {
+			return m, err
+		}
+		switch r := result.(type) {
+		case map[string]string:
+			r[key] = value.(string)
+		case map[string]int64:
+			r[key] = value.(int64)
+		case map[string]float64:
+			r[key] = value.(float64)
+		case map[string]bool:
+			r[key] = value.(bool)
+		}
+	}
+	return result, nil
+}
+
+// normalizeObject converts json.Number inside objects into float64 , the same way as json.Unmarshal does without UseNumber
+func normalizeObject(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeObject(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = normalizeObject(v[key])
+		}
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// ContextChangeEvent is emitted when context variable is set or deleted . It's emitted on every write , even if value wasn't changed.
+type ContextChangeEvent struct {
+	FlowId    string // flow id or global
+	Name      string
+	OldValue  *Variable // nil if variable didn't exist
+	NewValue  *Variable // nil if variable was deleted
+	InMemory  bool
+	IsExpired bool // variable was deleted by expiry sweeper
+	UpdatedAt time.Time
+}
+
+// IsValueChanged returns true if variable was created , deleted or its value is different from old value
+func (event *ContextChangeEvent) IsValueChanged() bool {
+	if event.OldValue == nil || event.NewValue == nil {
+		return event.OldValue != event.NewValue
+	}
+	isEqual, err := CompareVariables(OperandEq, *event.NewValue, *event.OldValue, Variable{})
+	return err != nil || !isEqual
+}
+
+// SubscribeToChanges registers channel for variable change events . Events are dropped if channel is full.
+func (ctx *Context) SubscribeToChanges(subscriberId string, ch chan ContextChangeEvent) {
+	ctx.subMtx.Lock()
+	if ctx.subscribers == nil {
+		ctx.subscribers = map[string]chan ContextChangeEvent{}
+	}
+	ctx.subscribers[subscriberId] = ch
+	ctx.subMtx.Unlock()
+}
+
+func (ctx *Context) UnsubscribeFromChanges(subscriberId string) {
+	ctx.subMtx.Lock()
+	delete(ctx.subscribers, subscriberId)
+	ctx.subMtx.Unlock()
+}
+
+func (ctx *Context) hasSubscribers() bool {
+	ctx.subMtx.RLock()
+	defer ctx.subMtx.RUnlock()
+	return len(ctx.subscribers) > 0
+}
+
+func (ctx *Context) notifyChange(event ContextChangeEvent) {
+	ctx.subMtx.RLock()
+	defer ctx.subMtx.RUnlock()
+	for id, ch := range ctx.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Warnf("<ctx> Subscriber %s channel is full , change event of %s is dropped", id, event.Name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const DefaultExpirySweepInterval = 10 * time.Second
+
+// expiringVarKey identifies variable in expiry index
+type expiringVarKey struct {
+	flowId string
+	name   string
+}
+
+type expiringVar struct {
+	expiresAt time.Time
+	inMemory  bool
+}
+
+// IsExpired returns true if the record has expiry time and the time has passed
+func (rec *ContextRecord) IsExpired(now time.Time) bool {
+	return !rec.ExpiresAt.IsZero() && !now.Before(rec.ExpiresAt)
+}
+
+// GetExpiryTime converts ttl in seconds or absolute time in RFC3339 format into expiry time . TTL has priority.
+// Zero time is returned if neither is set , the variable never expires.
+func GetExpiryTime(ttl int, expiresAt string) (time.Time, error) {
+	if ttl > 0 {
+		return time.Now().Add(time.Duration(ttl) * time.Second), nil
+	}
+	if expiresAt != "" {
+		return time.Parse(time.RFC3339, expiresAt)
+	}
+	return time.Time{}, nil
+}
+
+// SetVariableWithExpiry sets variable which is automatically deleted by expiry sweeper at expiresAt . Zero time - never expires.
+func (ctx *Context) SetVariableWithExpiry(name string, valueType string, value interface{}, description string, flowId string, inMemory bool, expiresAt time.Time) error {
+	rec := ContextRecord{Name: name, UpdatedAt: time.Now(), Description: description, Variable: Variable{ValueType: valueType, Value: value}, ExpiresAt: expiresAt}
+	return ctx.PutRecord(&rec, flowId, inMemory)
+}
+
+// updateExpiryIndex adds variable with expiry time into index or removes it if the variable doesn't expire anymore
+func (ctx *Context) updateExpiryIndex(flowId string, name string, expiresAt time.Time, inMemory bool) {
+	ctx.expiryMtx.Lock()
+	defer ctx.expiryMtx.Unlock()
+	if ctx.expiringVars == nil {
+		ctx.expiringVars = map[expiringVarKey]expiringVar{}
+	}
+	key := expiringVarKey{flowId: flowId, name: name}
+	if expiresAt.IsZero() {
+		delete(ctx.expiringVars, key)
+		return
+	}
+	ctx.expiringVars[key] = expiringVar{expiresAt: expiresAt, inMemory: inMemory}
+}
+
+// loadExpiryIndex scans stored variables , so variables set before restart expire as well
+func (ctx *Context) loadExpiryIndex() {
+	ctx.db.View(func(tx StorageTx) error {
+		buckets, err := tx.Buckets()
+		if err != nil {
+			return err
+		}
+		for _, bucket := range buckets {
+			if strings.HasPrefix(bucket, "_") {
+				// Internal buckets (runtime state , history) don't contain variables
+				continue
+			}
+			tx.Scan(bucket, nil, nil, false, func(k, v []byte) (bool, error) {
+				if rec, err := ctx.decodeRecord(v); err == nil && !rec.ExpiresAt.IsZero() {
+					ctx.updateExpiryIndex(bucket, rec.Name, rec.ExpiresAt, false)
+				}
+				return true, nil
+			})
+		}
+		return nil
+	})
+}
+
+// StartExpirySweeper starts background deletion of expired variables . Zero interval - default interval is used.
+func (ctx *Context) StartExpirySweeper(interval time.Duration) {
+	ctx.expiryMtx.Lock()
+	defer ctx.expiryMtx.Unlock()
+	if ctx.sweeperStopCh != nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultExpirySweepInterval
+	}
+	ctx.sweeperStopCh = make(chan bool)
+	log.Infof("<ctx> Starting variable expiry sweeper , interval = %s", interval)
+	go func(stopCh chan bool) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx.SweepExpired()
+			case <-stopCh:
+				return
+			}
+		}
+	}(ctx.sweeperStopCh)
+}
+
+func (ctx *Context) StopExpirySweeper() {
+	ctx.expiryMtx.Lock()
+	defer ctx.expiryMtx.Unlock()
+	if ctx.sweeperStopCh == nil {
+		return
+	}
+	close(ctx.sweeperStopCh)
+	ctx.sweeperStopCh = nil
+}
+
+// SweepExpired deletes expired variables and emits change events with IsExpired flag . Returns number of deleted variables.
+func (ctx *Context) SweepExpired() int {
+	now := time.Now()
+	var expired []expiringVarKey
+	ctx.expiryMtx.Lock()
+	for key, v := range ctx.expiringVars {
+		if !now.Before(v.expiresAt) {
+			expired = append(expired, key)
+		}
+	}
+	ctx.expiryMtx.Unlock()
+
+	var counter int
+	for _, key := range expired {
+		ctx.expiryMtx.Lock()
+		v, ok := ctx.expiringVars[key]
+		// Variable could be updated with new expiry time in meantime
+		if !ok || now.Before(v.expiresAt) {
+			ctx.expiryMtx.Unlock()
+			continue
+		}
+		delete(ctx.expiringVars, key)
+		ctx.expiryMtx.Unlock()
+
+		oldRec, err := ctx.deleteExpiredRecord(key, v.inMemory, now)
+		if err != nil {
+			log.Errorf("<ctx> Can't delete expired variable %s . Err:%s", key.name, err)
+			continue
+		}
+		if oldRec == nil {
+			continue
+		}
+		counter++
+		log.Debugf("<ctx> Variable %s in flow %s expired", key.name, key.flowId)
+		ctx.notifyChange(ContextChangeEvent{FlowId: key.flowId, Name: key.name, OldValue: &oldRec.Variable, InMemory: v.inMemory, IsExpired: true, UpdatedAt: now})
+	}
+	return counter
+}
+
+// deleteExpiredRecord deletes the record if it's still expired , returns deleted record
+func (ctx *Context) deleteExpiredRecord(key expiringVarKey, inMemory bool, now time.Time) (*ContextRecord, error) {
+	if inMemory {
+		ctx.inMemoryMtx.Lock()
+		defer ctx.inMemoryMtx.Unlock()
+		rec := ctx.inMemoryStore.Get(key.flowId, key.name)
+		if rec == nil || !rec.IsExpired(now) {
+			return nil, nil
+		}
+		ctx.inMemoryStore.Delete(key.flowId, key.name)
+		return rec, nil
+	}
+	var oldRec *ContextRecord
+	err := ctx.db.Update(func(tx StorageTx) error {
+		data, err := tx.Get(key.flowId, []byte(key.name))
+		if err == ErrBucketNotFound {
+			return nil
+		} else if err != nil || data == nil {
+			return err
+		}
+		rec, err := ctx.decodeRecord(data)
+		if err != nil || !rec.IsExpired(now) {
+			return err
+		}
+		oldRec = rec
+		return tx.Delete(key.flowId, []byte(key.name))
+	})
+	return oldRec, err
+}
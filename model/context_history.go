@@ -0,0 +1,494 @@
+package model
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyBucketPrefix = "_history/" // history of each variable is stored in separate bucket
+	historyPolicyBucket = "_history_policy"
+)
+
+// HistoryPolicy enables history of context variable . History of disk variables is written in the same transaction as the value ,
+// history of in-memory variables is kept in memory and is lost on restart like the variable itself.
+// At least one retention bound must be set.
+type HistoryPolicy struct {
+	MaxCount int   `json:"max_count"` // Max number of stored values , 0 - not limited by count
+	MaxAge   int64 `json:"max_age"`   // Max age of stored values in seconds , 0 - not limited by age
+}
+
+// historyCountKey identifies history bucket in disk or in-memory storage
+type historyCountKey struct {
+	bucket   string
+	inMemory bool
+}
+
+// historyCountUpdate is number of values in history bucket after write , it's cached after the transaction is committed
+type historyCountUpdate struct {
+	key   historyCountKey
+	count int
+	seq   uint64
+}
+
+// HistoryPoint is single value of variable history
+type HistoryPoint struct {
+	Time     time.Time `json:"time"`
+	Variable Variable  `json:"variable"`
+}
+
+func historyKey(flowId string, name string) []byte {
+	return []byte(flowId + "/" + name)
+}
+
+func historyBucket(flowId string, name string) string {
+	return historyBucketPrefix + flowId + "/" + name
+}
+
+func timeToHistoryKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func historyKeyToTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+// loadHistoryPolicies loads policies into memory cache , so variable writes don't need extra DB read
+func (ctx *Context) loadHistoryPolicies() {
+	ctx.historyMtx.Lock()
+	defer ctx.historyMtx.Unlock()
+	ctx.historyPolicies = map[string]HistoryPolicy{}
+	ctx.db.View(func(tx StorageTx) error {
+		return tx.Scan(historyPolicyBucket, nil, nil, false, func(k, v []byte) (bool, error) {
+			policy := HistoryPolicy{}
+			if err := json.Unmarshal(v, &policy); err == nil {
+				ctx.historyPolicies[string(k)] = policy
+			}
+			return true, nil
+		})
+	})
+}
+
+// SetHistoryPolicy enables history of the variable or updates retention of existing history
+func (ctx *Context) SetHistoryPolicy(flowId string, name string, policy HistoryPolicy) error {
+	if policy.MaxCount < 0 || policy.MaxAge < 0 {
+		return errors.New("retention can't be negative")
+	}
+	if policy.MaxCount == 0 && policy.MaxAge == 0 {
+		return errors.New("history must be limited by count or age")
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	err = ctx.db.Update(func(tx StorageTx) error {
+		if err := tx.CreateBucket(historyBucket(flowId, name)); err != nil {
+			return err
+		}
+		return tx.Put(historyPolicyBucket, historyKey(flowId, name), data)
+	})
+	if err != nil {
+		return err
+	}
+	ctx.historyMtx.Lock()
+	ctx.historyPolicies[string(historyKey(flowId, name))] = policy
+	ctx.historyMtx.Unlock()
+	log.Infof("<ctx> History of variable %s in flow %s is enabled", name, flowId)
+	return nil
+}
+
+// GetHistoryPolicy returns history policy of the variable , false if history is disabled
+func (ctx *Context) GetHistoryPolicy(flowId string, name string) (HistoryPolicy, bool) {
+	ctx.historyMtx.RLock()
+	defer ctx.historyMtx.RUnlock()
+	policy, ok := ctx.historyPolicies[string(historyKey(flowId, name))]
+	return policy, ok
+}
+
+// DeleteHistory disables history of the variable and deletes all stored values
+func (ctx *Context) DeleteHistory(flowId string, name string) error {
+	key := historyKey(flowId, name)
+	bucket := historyBucket(flowId, name)
+	ctx.historyMtx.Lock()
+	delete(ctx.historyPolicies, string(key))
+	for _, countKey := range []historyCountKey{{bucket: bucket}, {bucket: bucket, inMemory: true}} {
+		delete(ctx.historyCounts, countKey)
+		delete(ctx.historyWrites, countKey)
+	}
+	ctx.historyMtx.Unlock()
+	ctx.memHistory.Update(func(tx StorageTx) error {
+		return tx.DeleteBucket(bucket)
+	})
+	return ctx.db.Update(func(tx StorageTx) error {
+		if err := tx.Delete(historyPolicyBucket, key); err != nil {
+			return err
+		}
+		err := tx.DeleteBucket(bucket)
+		if err == ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// appendMemoryHistory stores new value of in-memory variable if the variable has history enabled
+func (ctx *Context) appendMemoryHistory(flowId string, rec *ContextRecord) error {
+	if _, ok := ctx.GetHistoryPolicy(flowId, rec.Name); !ok {
+		return nil
+	}
+	var historyUpdate *historyCountUpdate
+	err := ctx.memHistory.Update(func(tx StorageTx) error {
+		var err error
+		historyUpdate, err = ctx.writeHistory(tx, flowId, rec, true)
+		return err
+	})
+	if err == nil {
+		ctx.cacheHistoryCount(historyUpdate)
+	}
+	return err
+}
+
+// deleteFlowHistory disables history of all variables of the flow and deletes stored values
+func (ctx *Context) deleteFlowHistory(flowId string) error {
+	keyPrefix := string(historyKey(flowId, ""))
+	bucketPrefix := historyBucket(flowId, "")
+	ctx.historyMtx.Lock()
+	for key := range ctx.historyPolicies {
+		if strings.HasPrefix(key, keyPrefix) {
+			delete(ctx.historyPolicies, key)
+		}
+	}
+	for countKey := range ctx.historyCounts {
+		if strings.HasPrefix(countKey.bucket, bucketPrefix) {
+			delete(ctx.historyCounts, countKey)
+		}
+	}
+	for countKey := range ctx.historyWrites {
+		if strings.HasPrefix(countKey.bucket, bucketPrefix) {
+			delete(ctx.historyWrites, countKey)
+		}
+	}
+	ctx.historyMtx.Unlock()
+	deleteBuckets := func(tx StorageTx) error {
+		buckets, err := tx.Buckets()
+		if err != nil {
+			return err
+		}
+		for _, bucket := range buckets {
+			if strings.HasPrefix(bucket, bucketPrefix) {
+				if err := tx.DeleteBucket(bucket); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := ctx.memHistory.Update(deleteBuckets); err != nil {
+		return err
+	}
+	return ctx.db.Update(func(tx StorageTx) error {
+		if err := deleteBuckets(tx); err != nil {
+			return err
+		}
+		// Keys are collected first , buckets can't be modified during scan
+		var keys [][]byte
+		err := tx.Scan(historyPolicyBucket, []byte(keyPrefix), nil, false, func(k, v []byte) (bool, error) {
+			if !strings.HasPrefix(string(k), keyPrefix) {
+				return false, nil
+			}
+			keys = append(keys, append([]byte{}, k...))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete(historyPolicyBucket, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeHistory stores new value within transaction tx if the variable has history enabled and applies retention .
+// Number of stored values is cached , so retention by count doesn't scan whole history on every write .
+// Returned count must be cached by cacheHistoryCount only after the transaction is committed.
+func (ctx *Context) writeHistory(tx StorageTx, flowId string, rec *ContextRecord, inMemory bool) (*historyCountUpdate, error) {
+	policy, ok := ctx.GetHistoryPolicy(flowId, rec.Name)
+	if !ok {
+		return nil, nil
+	}
+	data, err := ctx.codec.encode(rec.Variable)
+	if err != nil {
+		return nil, err
+	}
+	updatedAt := rec.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	bucket := historyBucket(flowId, rec.Name)
+	countKey := historyCountKey{bucket: bucket, inMemory: inMemory}
+	ctx.historyMtx.Lock()
+	defer ctx.historyMtx.Unlock()
+	count, isCounted := ctx.historyCounts[countKey]
+	// Cached count is dropped until the transaction is committed , it's recounted by the next write if the transaction fails
+	delete(ctx.historyCounts, countKey)
+	ctx.historyWriteSeq++
+	seq := ctx.historyWriteSeq
+	ctx.historyWrites[countKey] = seq
+	if err := tx.CreateBucket(bucket); err != nil {
+		return nil, err
+	}
+	key := timeToHistoryKey(updatedAt)
+	if !isCounted {
+		count = 0
+		tx.Scan(bucket, nil, nil, false, func(k, v []byte) (bool, error) {
+			count++
+			return true, nil
+		})
+	}
+	if existing, _ := tx.Get(bucket, key); existing == nil {
+		count++
+	}
+	if err := tx.Put(bucket, key, data); err != nil {
+		return nil, err
+	}
+	// Oldest values are removed first , scan stops at the first value which is kept . Keys are collected first ,
+	// buckets can't be modified during scan.
+	var expired [][]byte
+	var oldestKey []byte
+	if policy.MaxAge > 0 {
+		oldestKey = timeToHistoryKey(time.Now().Add(-time.Duration(policy.MaxAge) * time.Second))
+	}
+	tx.Scan(bucket, nil, nil, false, func(k, v []byte) (bool, error) {
+		isExpired := oldestKey != nil && string(k) < string(oldestKey)
+		isExtra := policy.MaxCount > 0 && count-len(expired) > policy.MaxCount
+		if !isExpired && !isExtra {
+			return false, nil
+		}
+		expired = append(expired, append([]byte{}, k...))
+		return true, nil
+	})
+	for _, k := range expired {
+		if err := tx.Delete(bucket, k); err != nil {
+			return nil, err
+		}
+	}
+	return &historyCountUpdate{key: countKey, count: count - len(expired), seq: seq}, nil
+}
+
+// cacheHistoryCount caches number of values stored by committed history write . Count isn't cached if the history
+// was written again or deleted in the meantime.
+func (ctx *Context) cacheHistoryCount(update *historyCountUpdate) {
+	if update == nil {
+		return
+	}
+	ctx.historyMtx.Lock()
+	if ctx.historyWrites[update.key] == update.seq {
+		ctx.historyCounts[update.key] = update.count
+		delete(ctx.historyWrites, update.key)
+	}
+	ctx.historyMtx.Unlock()
+}
+
+// GetHistory returns values of the variable stored within time range , zero time means open range
+func (ctx *Context) GetHistory(flowId string, name string, from time.Time, to time.Time) ([]HistoryPoint, error) {
+	result, err := ctx.getHistory(ctx.db, flowId, name, from, to)
+	if err != nil {
+		return result, err
+	}
+	memResult, err := ctx.getHistory(ctx.memHistory, flowId, name, from, to)
+	if len(memResult) == 0 {
+		return result, err
+	}
+	// Variable could be stored both on disk and in memory
+	result = append(result, memResult...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result, err
+}
+
+func (ctx *Context) getHistory(storage StorageBackend, flowId string, name string, from time.Time, to time.Time) ([]HistoryPoint, error) {
+	var result []HistoryPoint
+	var fromKey, toKey []byte
+	if !from.IsZero() {
+		fromKey = timeToHistoryKey(from)
+	}
+	if !to.IsZero() {
+		// Range end is inclusive
+		toKey = timeToHistoryKey(to.Add(time.Nanosecond))
+	}
+	err := storage.View(func(tx StorageTx) error {
+		err := tx.Scan(historyBucket(flowId, name), fromKey, toKey, false, func(k, v []byte) (bool, error) {
+			point := HistoryPoint{Time: historyKeyToTime(k)}
+			var err error
+			point.Variable, err = ctx.codec.decodeVariable(v)
+			result = append(result, point)
+			return err == nil, err
+		})
+		if err == ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+	return result, err
+}
+
+// GetValueAt returns value the variable had at time t , that is the last value stored before or at t
+func (ctx *Context) GetValueAt(flowId string, name string, t time.Time) (Variable, error) {
+	var result Variable
+	var resultTime time.Time
+	var found bool
+	for _, storage := range []StorageBackend{ctx.db, ctx.memHistory} {
+		err := storage.View(func(tx StorageTx) error {
+			// Last value stored before or at t
+			err := tx.Scan(historyBucket(flowId, name), nil, timeToHistoryKey(t.Add(time.Nanosecond)), true, func(k, v []byte) (bool, error) {
+				if found && !historyKeyToTime(k).After(resultTime) {
+					return false, nil
+				}
+				vari, err := ctx.codec.decodeVariable(v)
+				if err == nil {
+					found = true
+					result, resultTime = vari, historyKeyToTime(k)
+				}
+				return false, err
+			})
+			if err == ErrBucketNotFound {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	if !found {
+		return result, errors.New("no history value at the time")
+	}
+	return result, nil
+}
+
+// HistoryFunction is function available in templates and calc expressions
+type HistoryFunction func(args ...interface{}) (interface{}, error)
+
+// HistoryFunctions returns functions which read variable history :
+// history(name , period) - list of values stored within period , for instance history("temp" , "1h") ;
+// avg_over , min_over , max_over , count_over (name , period) - aggregated values within period ;
+// value_at(name , period) - value the variable had the period ago .
+// Period is Go duration (30m , 1h) or number of days (1d) . Variable of the flow is used if it has history enabled , otherwise global one.
+func (ctx *Context) HistoryFunctions(flowId string) map[string]HistoryFunction {
+	aggregate := func(fn string) HistoryFunction {
+		return func(args ...interface{}) (interface{}, error) {
+			points, err := ctx.getHistoryForPeriod(flowId, args)
+			if err != nil {
+				return nil, err
+			}
+			if fn == "count" {
+				return float64(len(points)), nil
+			}
+			var result float64
+			var count int
+			for _, p := range points {
+				value, err := p.Variable.ToNumber()
+				if err != nil {
+					continue
+				}
+				switch {
+				case count == 0:
+					result = value
+				case fn == "min":
+					result = math.Min(result, value)
+				case fn == "max":
+					result = math.Max(result, value)
+				default:
+					result += value
+				}
+				count++
+			}
+			if count == 0 {
+				return nil, errors.New("no numeric values within the period")
+			}
+			if fn == "avg" {
+				result = result / float64(count)
+			}
+			return result, nil
+		}
+	}
+	return map[string]HistoryFunction{
+		"history": func(args ...interface{}) (interface{}, error) {
+			points, err := ctx.getHistoryForPeriod(flowId, args)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]interface{}, len(points))
+			for i := range points {
+				result[i] = points[i].Variable.Value
+			}
+			return result, nil
+		},
+		"avg_over":   aggregate("avg"),
+		"min_over":   aggregate("min"),
+		"max_over":   aggregate("max"),
+		"count_over": aggregate("count"),
+		"value_at": func(args ...interface{}) (interface{}, error) {
+			name, period, err := parseHistoryArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			vari, err := ctx.GetValueAt(ctx.getHistoryScope(flowId, name), name, time.Now().Add(-period))
+			return vari.Value, err
+		},
+	}
+}
+
+func (ctx *Context) getHistoryForPeriod(flowId string, args []interface{}) ([]HistoryPoint, error) {
+	name, period, err := parseHistoryArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.GetHistory(ctx.getHistoryScope(flowId, name), name, time.Now().Add(-period), time.Time{})
+}
+
+func (ctx *Context) getHistoryScope(flowId string, name string) string {
+	if _, ok := ctx.GetHistoryPolicy(flowId, name); ok {
+		return flowId
+	}
+	return "global"
+}
+
+func parseHistoryArgs(args []interface{}) (string, time.Duration, error) {
+	if len(args) != 2 {
+		return "", 0, errors.New("function requires variable name and period")
+	}
+	name, ok1 := args[0].(string)
+	period, ok2 := args[1].(string)
+	if !ok1 || !ok2 {
+		return "", 0, errors.New("variable name and period must be strings")
+	}
+	duration, err := ParsePeriod(period)
+	return name, duration, err
+}
+
+// ParsePeriod parses Go duration , additionally supports days , for instance 7d
+func ParsePeriod(period string) (time.Duration, error) {
+	if strings.HasSuffix(period, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %s", period)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(period)
+}
@@ -5,24 +5,21 @@ import (
 	"sync"
 )
 
+// ContextInMemoryStore keeps in-memory variables , flowId -> *sync.Map of variable name -> ContextRecord
 type ContextInMemoryStore struct {
 	store sync.Map
 }
 
 func (ctx *ContextInMemoryStore) Store(rec ContextRecord, flowId string) {
-	inMemoryRecI, ok := ctx.store.Load(flowId)
-	var inMemoryRec sync.Map
-	if ok {
-		inMemoryRec = inMemoryRecI.(sync.Map)
-	}
-	inMemoryRec.Store(rec.Name, rec)
-	ctx.store.Store(flowId, inMemoryRec)
+	// Flow map is shared by pointer , concurrent writers of the same flow don't overwrite each other
+	flowI, _ := ctx.store.LoadOrStore(flowId, &sync.Map{})
+	flowI.(*sync.Map).Store(rec.Name, rec)
 }
 
 func (ctx *ContextInMemoryStore) Get(flowId string, varName string) *ContextRecord {
 	flowI, ok := ctx.store.Load(flowId)
 	if ok {
-		flowS, ok := flowI.(sync.Map)
+		flowS, ok := flowI.(*sync.Map)
 		if !ok {
 			return nil
 		}
@@ -38,6 +35,16 @@ func (ctx *ContextInMemoryStore) Get(flowId string, varName string) *ContextReco
 	return nil
 }
 
+func (ctx *ContextInMemoryStore) Delete(flowId string, varName string) {
+	flowI, ok := ctx.store.Load(flowId)
+	if !ok {
+		return
+	}
+	if flowS, ok := flowI.(*sync.Map); ok {
+		flowS.Delete(varName)
+	}
+}
+
 func (ctx *ContextInMemoryStore) DeleteFlow(flowId string) {
 	ctx.store.Delete(flowId)
 }
@@ -46,7 +53,7 @@ func (ctx *ContextInMemoryStore) GetRecordsForFlow(flowId string) ([]ContextReco
 	var result []ContextRecord
 	flowI, ok := ctx.store.Load(flowId)
 	if ok {
-		flowS, ok := flowI.(sync.Map)
+		flowS, ok := flowI.(*sync.Map)
 		if !ok {
 			return result, errors.New("Wrong type")
 		}
@@ -1,6 +1,13 @@
 package model
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestContext_SetVariable(t *testing.T) {
 	ctx, err := NewContextDB("context_test_1.db")
@@ -60,3 +67,330 @@ func TestContext_GetRecords(t *testing.T) {
 	ctx.Close()
 
 }
+
+func TestContext_ChangeNotifications(t *testing.T) {
+	ctx, err := NewContextDB("context_test_3.db")
+	if err != nil {
+		t.Fatal("Fail to create context ", err)
+	}
+	defer os.Remove("context_test_3.db")
+	defer ctx.Close()
+	events := make(chan ContextChangeEvent, 10)
+	ctx.SubscribeToChanges("test", events)
+	ctx.SetVariable("house_mode", "string", "home", "", "global", false)
+	ctx.SetVariable("house_mode", "string", "away", "", "global", false)
+	ctx.SetVariable("counter", "int", int64(1), "", "global", true)
+	ctx.SetVariable("counter", "int", int64(1), "", "global", true)
+	ctx.DeleteRecord("house_mode", "global", false)
+	ctx.UnsubscribeFromChanges("test")
+	ctx.SetVariable("house_mode", "string", "home", "", "global", false)
+
+	if len(events) != 5 {
+		t.Fatal("Wrong number of events ", len(events))
+	}
+	event := <-events
+	if event.OldValue != nil || event.NewValue.Value != "home" || !event.IsValueChanged() {
+		t.Error("Wrong create event ", event)
+	}
+	event = <-events
+	if event.OldValue.Value != "home" || event.NewValue.Value != "away" || event.InMemory {
+		t.Error("Wrong update event ", event)
+	}
+	<-events
+	event = <-events
+	if !event.InMemory || event.OldValue == nil || event.IsValueChanged() {
+		t.Error("Wrong in-memory update event ", event)
+	}
+	event = <-events
+	if event.NewValue != nil || event.OldValue.Value != "away" || !event.IsValueChanged() {
+		t.Error("Wrong delete event ", event)
+	}
+}
+
+func TestContext_History(t *testing.T) {
+	ctx, err := NewContextDB("context_test_4.db")
+	if err != nil {
+		t.Fatal("Fail to create context ", err)
+	}
+	defer os.Remove("context_test_4.db")
+	defer ctx.Close()
+	ctx.SetHistoryPolicy("global", "temp", HistoryPolicy{MaxCount: 3})
+	start := time.Now().Add(-time.Hour)
+	for i, value := range []float64{18, 20, 22, 24} {
+		rec := ContextRecord{Name: "temp", UpdatedAt: start.Add(time.Duration(i) * 10 * time.Minute), Variable: Variable{ValueType: "float", Value: value}}
+		ctx.PutRecord(&rec, "global", false)
+	}
+	ctx.SetVariable("mode", "string", "home", "", "global", false)
+
+	points, err := ctx.GetHistory("global", "temp", time.Time{}, time.Time{})
+	if err != nil || len(points) != 3 || points[0].Variable.Value != 20.0 {
+		t.Fatal("Retention by count doesn't work ", points, err)
+	}
+	if points, _ = ctx.GetHistory("global", "mode", time.Time{}, time.Time{}); len(points) != 0 {
+		t.Error("Variable without policy must not have history")
+	}
+	value, err := ctx.GetValueAt("global", "temp", start.Add(25*time.Minute))
+	if err != nil || value.Value != 22.0 {
+		t.Error("Wrong value_at result ", value, err)
+	}
+
+	functions := ctx.HistoryFunctions("flow1")
+	avg, err := functions["avg_over"]("temp", "45m")
+	if err != nil || avg != 23.0 {
+		t.Error("Wrong avg_over result ", avg, err)
+	}
+	count, _ := functions["count_over"]("temp", "1d")
+	if count != 3.0 {
+		t.Error("Wrong count_over result ", count)
+	}
+	if _, err = functions["history"]("temp"); err == nil {
+		t.Error("Missing period must fail")
+	}
+
+	// Policy must be restored after restart
+	ctx.Close()
+	ctx, _ = NewContextDB("context_test_4.db")
+	if policy, ok := ctx.GetHistoryPolicy("global", "temp"); !ok || policy.MaxCount != 3 {
+		t.Error("Policy wasn't restored")
+	}
+	ctx.DeleteHistory("global", "temp")
+	if points, _ = ctx.GetHistory("global", "temp", time.Time{}, time.Time{}); len(points) != 0 {
+		t.Error("History wasn't deleted")
+	}
+}
+
+func TestContext_HistoryRetention(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx, err := NewContext(storage, EncodingGob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+	if err := ctx.SetHistoryPolicy("global", "temp", HistoryPolicy{}); err == nil {
+		t.Error("Policy without retention bound must be rejected")
+	}
+	ctx.SetHistoryPolicy("global", "temp", HistoryPolicy{MaxCount: 5, MaxAge: 3600})
+	ctx.SetHistoryPolicy("global", "mode", HistoryPolicy{MaxCount: 2})
+	start := time.Now().Add(-2 * time.Hour)
+	for i := 0; i < 20; i++ {
+		rec := ContextRecord{Name: "temp", UpdatedAt: start.Add(time.Duration(i) * 10 * time.Minute), Variable: Variable{ValueType: "float", Value: float64(i)}}
+		ctx.PutRecord(&rec, "global", false)
+	}
+	points, _ := ctx.GetHistory("global", "temp", time.Time{}, time.Time{})
+	if len(points) != 5 || points[0].Variable.Value != 15.0 {
+		t.Error("Retention by count doesn't work ", points)
+	}
+
+	// History of in-memory variable isn't written into storage
+	for _, mode := range []string{"home", "away", "sleep"} {
+		ctx.SetVariable("mode", "string", mode, "", "global", true)
+	}
+	storage.View(func(tx StorageTx) error {
+		return tx.Scan(historyBucket("global", "mode"), nil, nil, false, func(k, v []byte) (bool, error) {
+			t.Error("In-memory history must not be stored")
+			return false, nil
+		})
+	})
+	points, _ = ctx.GetHistory("global", "mode", time.Time{}, time.Time{})
+	if len(points) != 2 || points[1].Variable.Value != "sleep" {
+		t.Error("Wrong in-memory history ", points)
+	}
+	if value, err := ctx.GetValueAt("global", "mode", time.Now()); err != nil || value.Value != "sleep" {
+		t.Error("Wrong value_at result ", value, err)
+	}
+}
+
+func TestContext_UnregisterFlowHistory(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx, err := NewContext(storage, EncodingGob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+	for _, flowId := range []string{"flow1", "flow10"} {
+		ctx.RegisterFlow(flowId)
+		ctx.SetHistoryPolicy(flowId, "temp", HistoryPolicy{MaxCount: 5})
+		ctx.SetHistoryPolicy(flowId, "mode", HistoryPolicy{MaxCount: 5})
+		ctx.SetVariable("temp", "float", 21.5, "", flowId, false)
+		ctx.SetVariable("mode", "string", "home", "", flowId, true)
+	}
+
+	// Count isn't cached if the transaction is rolled back
+	rec := ContextRecord{Name: "temp", Variable: Variable{ValueType: "float", Value: 22.0}}
+	storage.Update(func(tx StorageTx) error {
+		ctx.writeHistory(tx, "flow1", &rec, false)
+		return errors.New("rollback")
+	})
+	if _, ok := ctx.historyCounts[historyCountKey{bucket: historyBucket("flow1", "temp")}]; ok {
+		t.Error("Count of rolled back write must not be cached")
+	}
+
+	ctx.UnregisterFlow("flow1")
+	if _, ok := ctx.GetHistoryPolicy("flow1", "temp"); ok {
+		t.Error("Cached policy wasn't deleted")
+	}
+	for _, name := range []string{"temp", "mode"} {
+		if points, _ := ctx.GetHistory("flow1", name, time.Time{}, time.Time{}); len(points) != 0 {
+			t.Error("History wasn't deleted ", name)
+		}
+		if points, _ := ctx.GetHistory("flow10", name, time.Time{}, time.Time{}); len(points) != 1 {
+			t.Error("History of other flow must be kept ", name)
+		}
+	}
+	for countKey := range ctx.historyCounts {
+		if strings.HasPrefix(countKey.bucket, historyBucket("flow1", "")) {
+			t.Error("Cached count wasn't deleted ", countKey)
+		}
+	}
+	ctx.loadHistoryPolicies()
+	if _, ok := ctx.GetHistoryPolicy("flow1", "mode"); ok {
+		t.Error("Stored policy wasn't deleted")
+	}
+	if _, ok := ctx.GetHistoryPolicy("flow10", "mode"); !ok {
+		t.Error("Policy of other flow must be kept")
+	}
+}
+
+func TestContext_Expiry(t *testing.T) {
+	ctx, err := NewContextDB("context_test_5.db")
+	if err != nil {
+		t.Fatal("Fail to create context ", err)
+	}
+	defer os.Remove("context_test_5.db")
+	events := make(chan ContextChangeEvent, 10)
+	expiresAt := time.Now().Add(100 * time.Millisecond)
+	ctx.SetVariableWithExpiry("presence", "string", "home", "", "global", false, expiresAt)
+	ctx.SetVariableWithExpiry("motion", "bool", true, "", "global", true, expiresAt)
+	ctx.SetVariableWithExpiry("house_mode", "string", "away", "", "global", false, time.Now().Add(time.Hour))
+	// Expiry is removed when variable is overwritten without expiry time
+	ctx.SetVariableWithExpiry("counter", "int", int64(1), "", "global", false, expiresAt)
+	ctx.SetVariable("counter", "int", int64(2), "", "global", false)
+
+	if rec, err := ctx.GetRecord("presence", "global"); err != nil || !rec.ExpiresAt.Equal(expiresAt) {
+		t.Fatal("Wrong record before expiry ", rec, err)
+	}
+	ctx.SubscribeToChanges("test", events)
+	time.Sleep(150 * time.Millisecond)
+	// Expired variables are hidden even before sweeper deletes them
+	if _, err := ctx.GetVariable("presence", "global"); err == nil {
+		t.Error("Expired variable is returned")
+	}
+	if len(ctx.GetRecords("global")) != 2 {
+		t.Error("Wrong number of records ", ctx.GetRecords("global"))
+	}
+	if deleted := ctx.SweepExpired(); deleted != 2 {
+		t.Fatal("Wrong number of deleted variables ", deleted)
+	}
+	if len(events) != 2 {
+		t.Fatal("Wrong number of events ", len(events))
+	}
+	event := <-events
+	if !event.IsExpired || event.NewValue != nil || event.OldValue == nil {
+		t.Error("Wrong expiry event ", event)
+	}
+	if _, err := ctx.GetVariable("counter", "global"); err != nil {
+		t.Error("Variable without expiry was deleted")
+	}
+	ctx.Close()
+
+	// Expiry index is restored from DB
+	ctx, _ = NewContextDB("context_test_5.db")
+	ctx.SetVariableWithExpiry("house_mode", "string", "away", "", "global", false, time.Now().Add(50*time.Millisecond))
+	ctx.Close()
+	ctx, _ = NewContextDB("context_test_5.db")
+	defer ctx.Close()
+	ctx.StartExpirySweeper(20 * time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	if _, err := ctx.GetRecord("house_mode", "global"); err == nil {
+		t.Error("Variable wasn't deleted by sweeper")
+	}
+	records := ctx.GetRecords("global")
+	if len(records) != 1 || records[0].Name != "counter" {
+		t.Error("Wrong records after sweep ", records)
+	}
+}
+
+func TestContext_AtomicOperations(t *testing.T) {
+	ctx, err := NewContextDB("context_test_6.db")
+	if err != nil {
+		t.Fatal("Fail to create context ", err)
+	}
+	defer os.Remove("context_test_6.db")
+	defer ctx.Close()
+
+	// Parallel increments must not lose updates
+	for _, inMemory := range []bool{false, true} {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if _, err := ctx.IncrementVariable("counter", "global", inMemory, 1); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		rec, err := ctx.GetRecord("counter", "global")
+		if err != nil || rec.Variable.Value != int64(200) || rec.Variable.ValueType != "int" {
+			t.Error("Wrong counter value ", rec, err)
+		}
+		ctx.DeleteRecord("counter", "global", inMemory)
+	}
+	if result, err := ctx.ExecuteAtomicOperation("temp", "global", false, AtomicOperation{Type: AtomicDecrement, Value: Variable{ValueType: "float", Value: 0.5}}); err != nil || result.Value != -0.5 {
+		t.Error("Wrong decrement result ", result, err)
+	}
+	// Int arithmetic must not lose precision above 2^53
+	big := int64(1)<<53 + 1
+	ctx.SetVariable("big", "int", big, "", "global", false)
+	if result, err := ctx.ExecuteAtomicOperation("big", "global", false, AtomicOperation{Type: AtomicIncrement, Value: Variable{ValueType: "int", Value: int64(2)}}); err != nil || result.Value != big+2 {
+		t.Error("Wrong increment of big int ", result, err)
+	}
+	if result, err := ctx.ExecuteAtomicOperation("big", "global", false, AtomicOperation{Type: AtomicDecrement}); err != nil || result.Value != big+1 {
+		t.Error("Wrong decrement of big int ", result, err)
+	}
+
+	// Compare-and-swap
+	if err = ctx.CompareAndSwapVariable("lock", "global", false, Variable{}, Variable{ValueType: "string", Value: "flow1"}); err != nil {
+		t.Error("Lock must be acquired ", err)
+	}
+	if err = ctx.CompareAndSwapVariable("lock", "global", false, Variable{}, Variable{ValueType: "string", Value: "flow2"}); err != ErrCompareFailed {
+		t.Error("Lock must not be acquired twice ", err)
+	}
+	if err = ctx.CompareAndSwapVariable("lock", "global", false, Variable{ValueType: "string", Value: "flow1"}, Variable{ValueType: "string", Value: "free"}); err != nil {
+		t.Error("Lock must be released ", err)
+	}
+
+	// Lists
+	for _, item := range []string{"a", "b", "c"} {
+		ctx.AppendToList("queue", "global", true, Variable{ValueType: "string", Value: item}, 2)
+	}
+	if vari, _ := ctx.GetVariable("queue", "global"); vari.ValueType != "str_array" || len(vari.Value.([]string)) != 2 {
+		t.Error("Wrong list ", vari)
+	}
+	if item, err := ctx.PopFromList("queue", "global", true, false); err != nil || item.Value != "b" || item.ValueType != "string" {
+		t.Error("Wrong popped item ", item, err)
+	}
+	if item, err := ctx.PopFromList("queue", "global", true, true); err != nil || item.Value != "c" {
+		t.Error("Wrong popped item ", item, err)
+	}
+	if _, err := ctx.PopFromList("queue", "global", true, false); err != ErrListEmpty {
+		t.Error("List must be empty ", err)
+	}
+	if _, err := ctx.AppendToList("queue", "global", true, Variable{ValueType: "int", Value: 1}, 0); err == nil {
+		t.Error("Item of wrong type was appended")
+	}
+
+	// Maps
+	ctx.SetMapValue("temps", "global", false, "kitchen", Variable{ValueType: "float", Value: 21.5})
+	ctx.SetMapValue("temps", "global", false, "bedroom", Variable{ValueType: "float", Value: 19.0})
+	result, err := ctx.DeleteMapKey("temps", "global", false, "kitchen")
+	if m, ok := result.Value.(map[string]float64); err != nil || !ok || len(m) != 1 || m["bedroom"] != 19.0 || result.ValueType != "float_map" {
+		t.Error("Wrong map ", result, err)
+	}
+	if vari, _ := ctx.GetVariable("temps", "global"); len(vari.Value.(map[string]float64)) != 1 {
+		t.Error("Map wasn't saved ", vari)
+	}
+}
@@ -9,13 +9,65 @@ type MsgPipeline chan Message
 
 type FlowRunner func(ReactorEvent)
 
+// SubflowInvoker executes flow synchronously and returns output message and instance variables set by the flow
+type SubflowInvoker func(flowId string, msg Message, vars map[string]Variable, timeout time.Duration) (Message, map[string]Variable, error)
+
 type Message struct {
 	AddressStr string
 	Address    fimpgo.Address
 	Payload    fimpgo.FimpMessage
 	RawPayload []byte
 	Header     map[string]string
-	CancelOp   bool // if true , listening end should close all operations
+	CancelOp   bool                // if true , listening end should close all operations
+	Vars       map[string]Variable // instance variables , are visible only within flow instance . Are used as sub-flow arguments and results
+	CallChain  []string            // ids of flows which invoked the instance as sub-flow , is used to detect recursive calls
+	Done       <-chan struct{}     // closed when the instance is canceled , blocking nodes stop waiting
+}
+
+// Clone returns copy of the message which can be modified independently , for instance by parallel branches of the flow.
+func (msg *Message) Clone() Message {
+	clone := *msg
+	if msg.Header != nil {
+		clone.Header = make(map[string]string, len(msg.Header))
+		for k, v := range msg.Header {
+			clone.Header[k] = v
+		}
+	}
+	if msg.Payload.Properties != nil {
+		clone.Payload.Properties = make(fimpgo.Props, len(msg.Payload.Properties))
+		for k, v := range msg.Payload.Properties {
+			clone.Payload.Properties[k] = v
+		}
+	}
+	if msg.Payload.Tags != nil {
+		clone.Payload.Tags = append(fimpgo.Tags{}, msg.Payload.Tags...)
+	}
+	if msg.Vars != nil {
+		clone.Vars = make(map[string]Variable, len(msg.Vars))
+		for k, v := range msg.Vars {
+			clone.Vars[k] = v
+		}
+	}
+	if msg.CallChain != nil {
+		clone.CallChain = append([]string{}, msg.CallChain...)
+	}
+	return clone
+}
+
+// KeepInstanceScope copies instance variables , call chain and cancel channel from src , is used when node replaces message of the instance
+// with a new one , for instance with message received from message bus.
+func (msg *Message) KeepInstanceScope(src *Message) {
+	msg.Vars = src.Vars
+	msg.CallChain = src.CallChain
+	msg.Done = src.Done
+}
+
+// SetVar sets instance variable
+func (msg *Message) SetVar(name string, value Variable) {
+	if msg.Vars == nil {
+		msg.Vars = map[string]Variable{}
+	}
+	msg.Vars[name] = value
 }
 
 type ReactorEvent struct {
@@ -40,20 +92,22 @@ func (s *Setting) String() string {
 }
 
 type FlowMeta struct {
-	Id                string // Instance id . Is different for every instance
-	ClassId           string // Class id , all instances share the same ClassId
-	Author            string
-	Version           int
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
-	Name              string
-	Group             string
-	Description       string
-	Nodes             []MetaNode
-	Settings          map[string]Setting
-	IsDisabled        bool
-	IsDefault         bool   // default flows are read only and can't be deleted
-	ParallelExecution string // keep_first , keep_last , parallel
+	Id                     string // Instance id . Is different for every instance
+	ClassId                string // Class id , all instances share the same ClassId
+	Author                 string
+	Version                int
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Name                   string
+	Group                  string
+	Description            string
+	Nodes                  []MetaNode
+	Settings               map[string]Setting
+	IsDisabled             bool
+	IsDefault              bool   // default flows are read only and can't be deleted
+	ParallelExecution      string // keep_first , keep_last , parallel
+	InstanceRecoveryPolicy string // none , resume , skip_expired . Defines how waiting instances are restored after restart
+	ErrorHandlerFlowId     string // Flow invoked on unhandled node errors , empty - system wide default handler is used
 }
 
 const (
@@ -74,6 +128,7 @@ type FlowOperationalContext struct {
 	NodeIsReady                 chan bool // Flow should notify message router when next node is ready to process new message .
 	StoragePath                 string
 	ExtLibsDir                  string
+	SubflowInvoker              SubflowInvoker // is used by subflow node to call other flows
 }
 
 type FlowStatsReport struct {
@@ -87,4 +142,7 @@ type FlowStatsReport struct {
 	StartedAt              time.Time
 	WaitingSince           time.Time
 	LastExecutionTime      int64
+	ConnectorsDown         []string       // connectors used by the flow which are not running
+	RetryCounter           int64          // number of node execution retries
+	PendingTimers          []PendingTimer // running timers of timer nodes
 }
@@ -2,6 +2,7 @@ package model
 
 import (
 	"github.com/thingsplex/tpflow/connector"
+	"time"
 )
 
 type NodeID string
@@ -18,6 +19,7 @@ type MetaNode struct {
 	ServiceInterface  string
 	Config            interface{}
 	Ui                interface{}
+	RetryPolicy       *RetryPolicy // nil - failed execution is not retried
 }
 
 type Node interface {
@@ -44,3 +46,63 @@ type Node interface {
 	//GetConfigs() interface{}
 	//SetConfigs(configs interface{})
 }
+
+// BranchGroup identifies branches started by single execution of fork node . Every execution of fork node gets new ForkId ,
+// so sequential forks and loops through fork node create new groups . Branch which isn't started by fork has ForkId 0 and Size 1.
+type BranchGroup struct {
+	InstanceId int32
+	ForkId     int64
+	Size       int // number of branches started by the fork , including branch which executed the fork
+}
+
+// BranchJoiner is implemented by nodes which merge parallel branches of the same flow instance (join node).
+// Flow runner invokes JoinBranch instead of OnInput . Branch is terminated if method returns no transitions.
+type BranchJoiner interface {
+	// JoinBranch is invoked when branch of the group reaches the node
+	JoinBranch(group BranchGroup, msg *Message) ([]NodeID, error)
+	// BranchEnded is invoked when branch of the group ends without reaching any join node
+	BranchEnded(group BranchGroup)
+	// ReleaseInstance is invoked when all branches of the instance are completed
+	ReleaseInstance(instanceId int32)
+}
+
+// ConfigValidator is implemented by nodes which can check own configuration . The method must not have side effects
+// outside of the node (no connections , files or context access) , it's invoked on nodes which are never started.
+type ConfigValidator interface {
+	ValidateConfig() []ValidationError
+}
+
+// ConfigTransitionProvider is implemented by nodes which define transitions in node configuration (if , fork , etc).
+// Returns config field name -> transition node id . Invoked after ValidateConfig.
+type ConfigTransitionProvider interface {
+	GetConfigTransitions() map[string]NodeID
+}
+
+// WaitingNode is implemented by nodes which can hold flow instance for long time (wait , receive).
+// Flow runner checkpoints the instance before such node is executed , so the instance can be resumed after restart.
+type WaitingNode interface {
+	// GetWaitTime returns max time the node holds the instance , 0 - no time limit
+	GetWaitTime() time.Duration
+	// ResumeWait is invoked instead of OnInput when the instance is restored from checkpoint . waitUntil is zero if
+	// the node has no time limit and is in the past if wait time expired while the instance wasn't running.
+	// Returns next transitions the same way as OnInput , node may return own id to be executed again.
+	ResumeWait(msg *Message, waitUntil time.Time) ([]NodeID, error)
+}
+
+// ReceivedMsgCounter is implemented by trigger nodes which count messages received from message bus.
+type ReceivedMsgCounter interface {
+	GetReceivedMsgCounter() int64
+}
+
+// TimerOwner is implemented by nodes which own flow level timers (timer node , msg filter , aggregate) . Timers aren't bound to instances ,
+// on expiry the node starts new flow instance using flow runner.
+type TimerOwner interface {
+	// GetPendingTimers returns timers which are running
+	GetPendingTimers() []PendingTimer
+}
+
+type PendingTimer struct {
+	NodeId    NodeID
+	NodeLabel string
+	ExpiresAt time.Time
+}
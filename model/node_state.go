@@ -0,0 +1,45 @@
+package model
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// Node state is internal state of stateful node (aggregation window , etc.) which should survive restarts.
+
+// Key ends with separator , so it can be used as prefix without matching other nodes
+func nodeStateKey(flowId string, nodeId NodeID) string {
+	return fmt.Sprintf("node/%s/%s/", flowId, nodeId)
+}
+
+// SaveNodeState gob-encodes the state and stores it on disk
+func (ctx *Context) SaveNodeState(flowId string, nodeId NodeID, state interface{}) error {
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(state); err != nil {
+		return err
+	}
+	return ctx.PutRuntimeState(nodeStateKey(flowId, nodeId), buf.Bytes())
+}
+
+// LoadNodeState decodes stored state into state , returns false if the node doesn't have stored state
+func (ctx *Context) LoadNodeState(flowId string, nodeId NodeID, state interface{}) (bool, error) {
+	key := nodeStateKey(flowId, nodeId)
+	data, ok := ctx.GetRuntimeStates(key)[key]
+	if !ok {
+		return false, nil
+	}
+	if err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(state); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (ctx *Context) DeleteNodeState(flowId string, nodeId NodeID) error {
+	return ctx.DeleteRuntimeStates(nodeStateKey(flowId, nodeId))
+}
+
+// DeleteNodeStates deletes states of all nodes of the flow
+func (ctx *Context) DeleteNodeStates(flowId string) error {
+	return ctx.DeleteRuntimeStates(fmt.Sprintf("node/%s/", flowId))
+}
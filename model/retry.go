@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	RetryBackoffFixed       = "fixed"
+	RetryBackoffExponential = "exponential"
+	// DefaultRetryMaxDelay limits exponential backoff if MaxDelay isn't set
+	DefaultRetryMaxDelay = time.Hour
+	MaxRetryAttempts     = 100
+)
+
+// RetryPolicy defines how failed node execution is retried by flow runner . Retries are done before error transition is taken.
+type RetryPolicy struct {
+	MaxAttempts int      // Total number of attempts including the first one , 0 or 1 - no retries
+	Backoff     string   // fixed (default) , exponential
+	Delay       int      // Delay before the first retry in milliseconds
+	MaxDelay    int      // Max delay of exponential backoff in milliseconds , 0 - DefaultRetryMaxDelay
+	RetryOn     []string // Only errors containing one of the strings are retried , empty - all errors
+}
+
+// ShouldRetry returns true if the error should be retried after attempt (starting from 1)
+func (p *RetryPolicy) ShouldRetry(err error, attempt int) bool {
+	if p == nil || err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, s := range p.RetryOn {
+		if strings.Contains(err.Error(), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDelay returns delay before retry which follows attempt (starting from 1)
+func (p *RetryPolicy) GetDelay(attempt int) time.Duration {
+	delay := time.Duration(p.Delay) * time.Millisecond
+	if p.Backoff != RetryBackoffExponential {
+		return delay
+	}
+	maxDelay := time.Duration(p.MaxDelay) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	// Delay is capped before doubling , so it can't overflow regardless of number of attempts
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+func (p *RetryPolicy) Validate() []ValidationError {
+	var result []ValidationError
+	addError := func(field string, format string, args ...interface{}) {
+		result = append(result, ValidationError{Field: "RetryPolicy." + field, Message: fmt.Sprintf(format, args...), Severity: ValidationSeverityError})
+	}
+	if p.MaxAttempts < 0 {
+		addError("MaxAttempts", "number of attempts can't be negative")
+	}
+	if p.MaxAttempts > MaxRetryAttempts {
+		addError("MaxAttempts", "number of attempts can't be greater than %d", MaxRetryAttempts)
+	}
+	switch p.Backoff {
+	case "", RetryBackoffFixed, RetryBackoffExponential:
+	default:
+		addError("Backoff", "unknown backoff %s", p.Backoff)
+	}
+	if p.Delay < 0 {
+		addError("Delay", "delay can't be negative")
+	}
+	if p.MaxDelay < 0 {
+		addError("MaxDelay", "delay can't be negative")
+	}
+	if p.MaxDelay > 0 && p.Delay > p.MaxDelay {
+		addError("Delay", "delay can't be greater than max delay")
+	}
+	if p.MaxDelay == 0 && time.Duration(p.Delay)*time.Millisecond > DefaultRetryMaxDelay {
+		addError("Delay", "delay can't be greater than %s", DefaultRetryMaxDelay)
+	}
+	return result
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Storage backend types
+const (
+	StorageBolt   = "bolt"
+	StorageMemory = "memory"
+	StorageSqlite = "sqlite"
+)
+
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// StorageTx gives access to key-value buckets within transaction . Keys are ordered as byte strings.
+type StorageTx interface {
+	CreateBucket(bucket string) error // does nothing if bucket exists
+	DeleteBucket(bucket string) error // returns ErrBucketNotFound if bucket doesn't exist
+	Buckets() ([]string, error)
+	// Get returns nil if key doesn't exist . Returned value can be used after transaction is closed.
+	Get(bucket string, key []byte) ([]byte, error)
+	Put(bucket string, key []byte, value []byte) error
+	Delete(bucket string, key []byte) error
+	// Scan calls fn for keys within [from , to) range in ascending or descending (reverse) order , nil from or to means open range.
+	// Iteration stops if fn returns false or error . fn must not modify the bucket.
+	Scan(bucket string, from []byte, to []byte, reverse bool, fn func(key []byte, value []byte) (bool, error)) error
+}
+
+// StorageBackend stores context variables , history and runtime state of flows and nodes.
+// Update must be atomic , changes made by fn are discarded if fn returns error.
+type StorageBackend interface {
+	View(fn func(tx StorageTx) error) error
+	Update(fn func(tx StorageTx) error) error
+	Close() error
+}
+
+// StorageFactory opens storage at location , location meaning depends on backend (file path , DSN)
+type StorageFactory func(location string) (StorageBackend, error)
+
+var (
+	storageFactories   = map[string]StorageFactory{}
+	storageFactoriesMu sync.RWMutex
+)
+
+// RegisterStorageBackend makes backend available for OpenStorageBackend
+func RegisterStorageBackend(backendType string, factory StorageFactory) {
+	storageFactoriesMu.Lock()
+	storageFactories[backendType] = factory
+	storageFactoriesMu.Unlock()
+}
+
+// StorageBackendTypes returns types of all registered backends
+func StorageBackendTypes() []string {
+	storageFactoriesMu.RLock()
+	defer storageFactoriesMu.RUnlock()
+	var result []string
+	for backendType := range storageFactories {
+		result = append(result, backendType)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// OpenStorageBackend opens storage of given type , bolt is used if type is empty
+func OpenStorageBackend(backendType string, location string) (StorageBackend, error) {
+	if backendType == "" {
+		backendType = StorageBolt
+	}
+	storageFactoriesMu.RLock()
+	factory, ok := storageFactories[backendType]
+	storageFactoriesMu.RUnlock()
+	if !ok {
+		if backendType == StorageSqlite {
+			return nil, errors.New("sqlite storage isn't available , the application must be built with sqlite tag")
+		}
+		return nil, fmt.Errorf("unknown storage backend %s", backendType)
+	}
+	return factory(location)
+}
+
+// prefixRange returns key range [from , to) which contains all keys starting with prefix
+func prefixRange(prefix string) ([]byte, []byte) {
+	from := []byte(prefix)
+	to := append([]byte{}, from...)
+	for i := len(to) - 1; i >= 0; i-- {
+		if to[i] < 0xff {
+			to[i]++
+			return from, to[:i+1]
+		}
+	}
+	// Prefix consists of 0xff bytes only , range is open
+	return from, nil
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"bytes"
+	"github.com/boltdb/bolt"
+)
+
+func init() {
+	RegisterStorageBackend(StorageBolt, func(location string) (StorageBackend, error) {
+		st, err := NewBoltStorage(location)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	})
+}
+
+// BoltStorage keeps every bucket as top level bolt bucket
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltStorage(location string) (*BoltStorage, error) {
+	db, err := bolt.Open(location, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+func (st *BoltStorage) View(fn func(tx StorageTx) error) error {
+	return st.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (st *BoltStorage) Update(fn func(tx StorageTx) error) error {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (st *BoltStorage) Close() error {
+	return st.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (btx *boltTx) bucket(name string) (*bolt.Bucket, error) {
+	b := btx.tx.Bucket([]byte(name))
+	if b == nil {
+		return nil, ErrBucketNotFound
+	}
+	return b, nil
+}
+
+func (btx *boltTx) CreateBucket(bucket string) error {
+	_, err := btx.tx.CreateBucketIfNotExists([]byte(bucket))
+	return err
+}
+
+func (btx *boltTx) DeleteBucket(bucket string) error {
+	err := btx.tx.DeleteBucket([]byte(bucket))
+	if err == bolt.ErrBucketNotFound {
+		return ErrBucketNotFound
+	}
+	return err
+}
+
+func (btx *boltTx) Buckets() ([]string, error) {
+	var result []string
+	err := btx.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		result = append(result, string(name))
+		return nil
+	})
+	return result, err
+}
+
+func (btx *boltTx) Get(bucket string, key []byte) ([]byte, error) {
+	b, err := btx.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	// bolt value is valid only within transaction
+	if v := b.Get(key); v != nil {
+		return append([]byte{}, v...), nil
+	}
+	return nil, nil
+}
+
+func (btx *boltTx) Put(bucket string, key []byte, value []byte) error {
+	b, err := btx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+func (btx *boltTx) Delete(bucket string, key []byte) error {
+	b, err := btx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return b.Delete(key)
+}
+
+func (btx *boltTx) Scan(bucket string, from []byte, to []byte, reverse bool, fn func(key []byte, value []byte) (bool, error)) error {
+	b, err := btx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	c := b.Cursor()
+	var k, v []byte
+	if reverse {
+		if to == nil {
+			k, v = c.Last()
+		} else if k, v = c.Seek(to); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	} else if from == nil {
+		k, v = c.First()
+	} else {
+		k, v = c.Seek(from)
+	}
+	for k != nil {
+		if reverse && from != nil && bytes.Compare(k, from) < 0 {
+			return nil
+		}
+		if !reverse && to != nil && bytes.Compare(k, to) >= 0 {
+			return nil
+		}
+		if next, err := fn(k, v); err != nil || !next {
+			return err
+		}
+		if reverse {
+			k, v = c.Prev()
+		} else {
+			k, v = c.Next()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+func init() {
+	RegisterStorageBackend(StorageMemory, func(location string) (StorageBackend, error) {
+		return NewMemoryStorage(), nil
+	})
+}
+
+// MemoryStorage keeps all data in memory , it's used by tests and instances which don't need persistence.
+// Update transactions are serialized and rolled back on error.
+type MemoryStorage struct {
+	buckets map[string]map[string][]byte
+	mtx     sync.RWMutex
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{buckets: map[string]map[string][]byte{}}
+}
+
+func (st *MemoryStorage) View(fn func(tx StorageTx) error) error {
+	st.mtx.RLock()
+	defer st.mtx.RUnlock()
+	return fn(&memoryTx{st: st, isReadOnly: true})
+}
+
+func (st *MemoryStorage) Update(fn func(tx StorageTx) error) error {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	tx := &memoryTx{st: st}
+	err := fn(tx)
+	if err != nil {
+		tx.rollback()
+	}
+	return err
+}
+
+func (st *MemoryStorage) Close() error {
+	return nil
+}
+
+type memoryTx struct {
+	st         *MemoryStorage
+	isReadOnly bool
+	undo       []func()
+}
+
+var errReadOnlyTx = errors.New("transaction is read-only")
+
+func (mtx *memoryTx) rollback() {
+	for i := len(mtx.undo) - 1; i >= 0; i-- {
+		mtx.undo[i]()
+	}
+}
+
+func (mtx *memoryTx) bucket(name string) (map[string][]byte, error) {
+	b, ok := mtx.st.buckets[name]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+	return b, nil
+}
+
+func (mtx *memoryTx) CreateBucket(bucket string) error {
+	if mtx.isReadOnly {
+		return errReadOnlyTx
+	}
+	if _, ok := mtx.st.buckets[bucket]; !ok {
+		mtx.st.buckets[bucket] = map[string][]byte{}
+		mtx.undo = append(mtx.undo, func() { delete(mtx.st.buckets, bucket) })
+	}
+	return nil
+}
+
+func (mtx *memoryTx) DeleteBucket(bucket string) error {
+	if mtx.isReadOnly {
+		return errReadOnlyTx
+	}
+	b, err := mtx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(mtx.st.buckets, bucket)
+	mtx.undo = append(mtx.undo, func() { mtx.st.buckets[bucket] = b })
+	return nil
+}
+
+func (mtx *memoryTx) Buckets() ([]string, error) {
+	var result []string
+	for name := range mtx.st.buckets {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (mtx *memoryTx) Get(bucket string, key []byte) ([]byte, error) {
+	b, err := mtx.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := b[string(key)]; ok {
+		return append([]byte{}, v...), nil
+	}
+	return nil, nil
+}
+
+func (mtx *memoryTx) Put(bucket string, key []byte, value []byte) error {
+	if mtx.isReadOnly {
+		return errReadOnlyTx
+	}
+	b, err := mtx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	mtx.saveUndo(b, string(key))
+	b[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (mtx *memoryTx) Delete(bucket string, key []byte) error {
+	if mtx.isReadOnly {
+		return errReadOnlyTx
+	}
+	b, err := mtx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	mtx.saveUndo(b, string(key))
+	delete(b, string(key))
+	return nil
+}
+
+// saveUndo remembers old value of the key , so it can be restored by rollback
+func (mtx *memoryTx) saveUndo(b map[string][]byte, key string) {
+	if old, ok := b[key]; ok {
+		mtx.undo = append(mtx.undo, func() { b[key] = old })
+	} else {
+		mtx.undo = append(mtx.undo, func() { delete(b, key) })
+	}
+}
+
+func (mtx *memoryTx) Scan(bucket string, from []byte, to []byte, reverse bool, fn func(key []byte, value []byte) (bool, error)) error {
+	b, err := mtx.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for k := range b {
+		if (from == nil || bytes.Compare([]byte(k), from) >= 0) && (to == nil || bytes.Compare([]byte(k), to) < 0) {
+			keys = append(keys, k)
+		}
+	}
+	// Go strings are compared byte-wise , the same way as bolt keys
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	for _, k := range keys {
+		if next, err := fn([]byte(k), b[k]); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+type storageItem struct {
+	key   []byte
+	value []byte
+}
+
+// MigrateStorage copies all buckets from src to dst . Variables and history values are re-encoded with dstEncoding ,
+// runtime state and history policies are copied as is . Returns number of copied items.
+func MigrateStorage(src StorageBackend, dst StorageBackend, dstEncoding string) (int, error) {
+	codec, err := newRecordCodec(dstEncoding)
+	if err != nil {
+		return 0, err
+	}
+	var buckets []string
+	err = src.View(func(tx StorageTx) error {
+		buckets, err = tx.Buckets()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	var counter int
+	for _, bucket := range buckets {
+		var items []storageItem
+		err = src.View(func(tx StorageTx) error {
+			return tx.Scan(bucket, nil, nil, false, func(k, v []byte) (bool, error) {
+				value, err := reencodeItem(codec, bucket, v)
+				if err != nil {
+					return false, fmt.Errorf("can't convert %s in bucket %s : %s", k, bucket, err)
+				}
+				items = append(items, storageItem{key: append([]byte{}, k...), value: value})
+				return true, nil
+			})
+		})
+		if err != nil {
+			return counter, err
+		}
+		err = dst.Update(func(tx StorageTx) error {
+			if err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := tx.Put(bucket, item.key, item.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return counter, err
+		}
+		counter += len(items)
+	}
+	return counter, nil
+}
+
+// reencodeItem converts stored value into target encoding , bucket name defines type of the value
+func reencodeItem(codec recordCodec, bucket string, data []byte) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(bucket, historyBucketPrefix):
+		vrbl, err := codec.decodeVariable(data)
+		if err != nil {
+			return nil, err
+		}
+		return codec.encode(vrbl)
+	case strings.HasPrefix(bucket, "_"):
+		return append([]byte{}, data...), nil
+	}
+	rec, err := codec.decodeRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.encodeRecord(rec)
+}
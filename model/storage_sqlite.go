@@ -0,0 +1,189 @@
+//go:build sqlite
+// +build sqlite
+
+package model
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite storage requires cgo , therefore it's compiled only with sqlite build tag : go build -tags sqlite
+
+func init() {
+	RegisterStorageBackend(StorageSqlite, func(location string) (StorageBackend, error) {
+		st, err := NewSqliteStorage(location)
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	})
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (name TEXT PRIMARY KEY);
+CREATE TABLE IF NOT EXISTS records (
+	bucket TEXT NOT NULL REFERENCES buckets(name) ON DELETE CASCADE,
+	key BLOB NOT NULL,
+	value BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+) WITHOUT ROWID;
+`
+
+// SqliteStorage keeps all buckets in single table , keys are BLOBs , so they are ordered the same way as in bolt
+type SqliteStorage struct {
+	db *sql.DB
+}
+
+func NewSqliteStorage(location string) (*SqliteStorage, error) {
+	db, err := sql.Open("sqlite3", location+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer , single connection avoids "database is locked" errors
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SqliteStorage{db: db}, nil
+}
+
+func (st *SqliteStorage) View(fn func(tx StorageTx) error) error {
+	return st.Update(fn)
+}
+
+func (st *SqliteStorage) Update(fn func(tx StorageTx) error) error {
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(&sqliteTx{tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st *SqliteStorage) Close() error {
+	return st.db.Close()
+}
+
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+func (stx *sqliteTx) checkBucket(bucket string) error {
+	var name string
+	err := stx.tx.QueryRow("SELECT name FROM buckets WHERE name = ?", bucket).Scan(&name)
+	if err == sql.ErrNoRows {
+		return ErrBucketNotFound
+	}
+	return err
+}
+
+func (stx *sqliteTx) CreateBucket(bucket string) error {
+	_, err := stx.tx.Exec("INSERT OR IGNORE INTO buckets (name) VALUES (?)", bucket)
+	return err
+}
+
+func (stx *sqliteTx) DeleteBucket(bucket string) error {
+	if err := stx.checkBucket(bucket); err != nil {
+		return err
+	}
+	_, err := stx.tx.Exec("DELETE FROM buckets WHERE name = ?", bucket)
+	return err
+}
+
+func (stx *sqliteTx) Buckets() ([]string, error) {
+	rows, err := stx.tx.Query("SELECT name FROM buckets ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		result = append(result, name)
+	}
+	return result, rows.Err()
+}
+
+func (stx *sqliteTx) Get(bucket string, key []byte) ([]byte, error) {
+	if err := stx.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	var value []byte
+	err := stx.tx.QueryRow("SELECT value FROM records WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (stx *sqliteTx) Put(bucket string, key []byte, value []byte) error {
+	if err := stx.checkBucket(bucket); err != nil {
+		return err
+	}
+	_, err := stx.tx.Exec("INSERT OR REPLACE INTO records (bucket, key, value) VALUES (?, ?, ?)", bucket, key, value)
+	return err
+}
+
+func (stx *sqliteTx) Delete(bucket string, key []byte) error {
+	if err := stx.checkBucket(bucket); err != nil {
+		return err
+	}
+	_, err := stx.tx.Exec("DELETE FROM records WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+func (stx *sqliteTx) Scan(bucket string, from []byte, to []byte, reverse bool, fn func(key []byte, value []byte) (bool, error)) error {
+	if err := stx.checkBucket(bucket); err != nil {
+		return err
+	}
+	query := "SELECT key, value FROM records WHERE bucket = ?"
+	args := []interface{}{bucket}
+	if from != nil {
+		query += " AND key >= ?"
+		args = append(args, from)
+	}
+	if to != nil {
+		query += " AND key < ?"
+		args = append(args, to)
+	}
+	if reverse {
+		query += " ORDER BY key DESC"
+	} else {
+		query += " ORDER BY key"
+	}
+	rows, err := stx.tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	// All rows are read before calling fn , single connection can't run other queries while rows are open
+	type row struct {
+		key, value []byte
+	}
+	var result []row
+	for rows.Next() {
+		r := row{}
+		if err = rows.Scan(&r.key, &r.value); err != nil {
+			rows.Close()
+			return err
+		}
+		result = append(result, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range result {
+		if next, err := fn(r.key, r.value); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openTestStorages opens every registered backend , file based backends use temporary files
+func openTestStorages(t *testing.T) map[string]StorageBackend {
+	result := map[string]StorageBackend{}
+	for _, backendType := range StorageBackendTypes() {
+		location := "storage_test_" + backendType + ".db"
+		os.Remove(location)
+		st, err := OpenStorageBackend(backendType, location)
+		if err != nil {
+			t.Fatal("Can't open storage ", backendType, err)
+		}
+		result[backendType] = st
+	}
+	return result
+}
+
+func closeTestStorages(storages map[string]StorageBackend) {
+	for backendType, st := range storages {
+		st.Close()
+		os.Remove("storage_test_" + backendType + ".db")
+	}
+}
+
+func TestStorage_Backends(t *testing.T) {
+	storages := openTestStorages(t)
+	defer closeTestStorages(storages)
+	scan := func(tx StorageTx, from, to []byte, reverse bool) []string {
+		var keys []string
+		tx.Scan("b1", from, to, reverse, func(k, v []byte) (bool, error) {
+			keys = append(keys, string(k))
+			return true, nil
+		})
+		return keys
+	}
+	for backendType, st := range storages {
+		t.Run(backendType, func(t *testing.T) {
+			err := st.Update(func(tx StorageTx) error {
+				tx.CreateBucket("b1")
+				for _, k := range []string{"c", "a", "d", "b"} {
+					if err := tx.Put("b1", []byte(k), []byte("v"+k)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			st.View(func(tx StorageTx) error {
+				if v, _ := tx.Get("b1", []byte("b")); string(v) != "vb" {
+					t.Error("Wrong value ", string(v))
+				}
+				if v, err := tx.Get("b1", []byte("x")); v != nil || err != nil {
+					t.Error("Missing key must return nil")
+				}
+				if _, err := tx.Get("b2", []byte("a")); err != ErrBucketNotFound {
+					t.Error("Missing bucket must return ErrBucketNotFound ", err)
+				}
+				if keys := scan(tx, nil, nil, false); !reflect.DeepEqual(keys, []string{"a", "b", "c", "d"}) {
+					t.Error("Wrong scan ", keys)
+				}
+				if keys := scan(tx, []byte("b"), []byte("d"), false); !reflect.DeepEqual(keys, []string{"b", "c"}) {
+					t.Error("Wrong range scan ", keys)
+				}
+				if keys := scan(tx, []byte("b"), []byte("d"), true); !reflect.DeepEqual(keys, []string{"c", "b"}) {
+					t.Error("Wrong reverse scan ", keys)
+				}
+				if keys := scan(tx, nil, []byte("bb"), true); !reflect.DeepEqual(keys, []string{"b", "a"}) {
+					t.Error("Wrong reverse scan ", keys)
+				}
+				return nil
+			})
+			// Failed transaction must be rolled back
+			err = st.Update(func(tx StorageTx) error {
+				tx.Put("b1", []byte("a"), []byte("changed"))
+				tx.Delete("b1", []byte("b"))
+				tx.CreateBucket("b3")
+				return errors.New("failed")
+			})
+			if err == nil {
+				t.Error("Error must be returned")
+			}
+			st.View(func(tx StorageTx) error {
+				a, _ := tx.Get("b1", []byte("a"))
+				b, _ := tx.Get("b1", []byte("b"))
+				buckets, _ := tx.Buckets()
+				if string(a) != "va" || string(b) != "vb" || len(buckets) != 1 {
+					t.Error("Transaction wasn't rolled back ", string(a), string(b), buckets)
+				}
+				return nil
+			})
+			st.Update(func(tx StorageTx) error {
+				return tx.DeleteBucket("b1")
+			})
+			st.View(func(tx StorageTx) error {
+				if buckets, _ := tx.Buckets(); len(buckets) != 0 {
+					t.Error("Bucket wasn't deleted ", buckets)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestContext_JsonEncoding(t *testing.T) {
+	storage := NewMemoryStorage()
+	ctx, err := NewContext(storage, EncodingJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+	ctx.SetHistoryPolicy("global", "temp", HistoryPolicy{MaxCount: 10})
+	variables := []Variable{
+		{ValueType: "int", Value: int64(5)},
+		{ValueType: "float", Value: 21.5},
+		{ValueType: "string", Value: "home"},
+		{ValueType: "str_array", Value: []string{"a", "b"}},
+		{ValueType: "int_map", Value: map[string]int64{"a": 1}},
+		{ValueType: "object", Value: map[string]interface{}{"x": 1.5, "y": []interface{}{"z"}}},
+	}
+	for _, vrbl := range variables {
+		ctx.SetVariable("temp", vrbl.ValueType, vrbl.Value, "", "global", false)
+		result, err := ctx.GetVariable("temp", "global")
+		if err != nil || !reflect.DeepEqual(result, vrbl) {
+			t.Errorf("Wrong value of type %s : %#v", vrbl.ValueType, result.Value)
+		}
+	}
+	storage.View(func(tx StorageTx) error {
+		if data, _ := tx.Get("global", []byte("temp")); !isJsonData(data) {
+			t.Error("Variable isn't stored as JSON ", string(data))
+		}
+		return nil
+	})
+	points, _ := ctx.GetHistory("global", "temp", time.Time{}, time.Time{})
+	if len(points) != len(variables) || points[0].Variable.Value != int64(5) {
+		t.Error("Wrong history ", points)
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	ctx, err := NewContextDB("context_test_migration.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("context_test_migration.db")
+	ctx.RegisterFlow("flow1")
+	ctx.SetVariable("counter", "int", int64(7), "", "flow1", false)
+	ctx.SetVariable("modes", "str_array", []string{"home", "away"}, "", "global", false)
+	ctx.SetHistoryPolicy("global", "temp", HistoryPolicy{MaxCount: 10})
+	ctx.SetVariable("temp", "float", 20.5, "", "global", false)
+	ctx.PutRuntimeState("node/flow1/1/", []byte{1, 2, 3})
+	ctx.Close()
+
+	src, _ := OpenStorageBackend(StorageBolt, "context_test_migration.db")
+	defer src.Close()
+	dst := NewMemoryStorage()
+	counter, err := MigrateStorage(src, dst, EncodingJson)
+	if err != nil || counter != 6 {
+		t.Fatal("Migration failed ", counter, err)
+	}
+	ctx, err = NewContext(dst, EncodingJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vrbl, _ := ctx.GetVariable("counter", "flow1"); vrbl.Value != int64(7) {
+		t.Error("Wrong migrated variable ", vrbl)
+	}
+	if vrbl, _ := ctx.GetVariable("modes", "global"); !reflect.DeepEqual(vrbl.Value, []string{"home", "away"}) {
+		t.Error("Wrong migrated list ", vrbl)
+	}
+	if points, _ := ctx.GetHistory("global", "temp", time.Time{}, time.Time{}); len(points) != 1 || points[0].Variable.Value != 20.5 {
+		t.Error("Wrong migrated history ", points)
+	}
+	if _, ok := ctx.GetHistoryPolicy("global", "temp"); !ok {
+		t.Error("History policy wasn't migrated")
+	}
+	if state := ctx.GetRuntimeStates("node/flow1/"); !reflect.DeepEqual(state["node/flow1/1/"], []byte{1, 2, 3}) {
+		t.Error("Wrong migrated runtime state ", state)
+	}
+	dst.View(func(tx StorageTx) error {
+		if data, _ := tx.Get("flow1", []byte("counter")); !isJsonData(data) {
+			t.Error("Variable wasn't converted into JSON")
+		}
+		return nil
+	})
+}
+
+func TestContext_StorageBackends(t *testing.T) {
+	storages := openTestStorages(t)
+	defer closeTestStorages(storages)
+	for backendType, st := range storages {
+		t.Run(backendType, func(t *testing.T) {
+			ctx, err := NewContext(st, EncodingGob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx.SetHistoryPolicy("global", "counter", HistoryPolicy{MaxCount: 2})
+			for i := 0; i < 3; i++ {
+				if _, err = ctx.IncrementVariable("counter", "global", false, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if vrbl, err := ctx.GetVariable("counter", "global"); err != nil || vrbl.Value != int64(3) {
+				t.Error("Wrong counter ", vrbl, err)
+			}
+			if points, _ := ctx.GetHistory("global", "counter", time.Time{}, time.Time{}); len(points) != 2 || points[1].Variable.Value != int64(3) {
+				t.Error("Wrong history ", points)
+			}
+			if _, err = ctx.GetRecord("counter", "flow1"); err == nil {
+				t.Error("Variable of missing flow must not be found")
+			}
+			ctx.DeleteRecord("counter", "global", false)
+			if len(ctx.GetRecords("global")) != 0 {
+				t.Error("Variable wasn't deleted")
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// InstanceTrace contains all steps executed by one flow instance
+type InstanceTrace struct {
+	InstanceId  int32
+	FlowId      string
+	StartedAt   time.Time
+	CompletedAt time.Time
+	IsCompleted bool
+	Steps       []NodeTraceRecord
+}
+
+// NodeTraceRecord describes execution of one node
+type NodeTraceRecord struct {
+	NodeId           NodeID
+	NodeLabel        string
+	NodeType         string
+	StartedAt        time.Time
+	Duration         int64 // in microseconds
+	InputMsg         Message
+	ChangedVariables []VariableChange
+	Transition       NodeID
+	Error            string
+}
+
+// VariableChange describes context variable modification done by a node . Nil OldValue means the variable was created.
+type VariableChange struct {
+	FlowId   string
+	Name     string
+	OldValue *Variable
+	NewValue *Variable
+}
+
+type DebuggerState struct {
+	IsTraceEnabled  bool
+	Breakpoints     []NodeID
+	PausedInstances []PausedInstance
+}
+
+type PausedInstance struct {
+	InstanceId int32
+	NodeId     NodeID
+	PausedAt   time.Time
+}
@@ -0,0 +1,20 @@
+package model
+
+const (
+	ValidationSeverityError   = "error"
+	ValidationSeverityWarning = "warning"
+)
+
+// ValidationError describes one problem found in flow definition . NodeId is empty for flow level problems.
+type ValidationError struct {
+	NodeId   NodeID
+	Field    string
+	Message  string
+	Severity string
+}
+
+type FlowValidationReport struct {
+	FlowId  string
+	IsValid bool // false if report contains at least one error , warnings don't make flow invalid
+	Errors  []ValidationError
+}
@@ -182,3 +182,8 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	}
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
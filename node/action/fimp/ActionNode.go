@@ -149,3 +149,8 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	node.transport.PublishToTopic(address,fimpMsg)
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	return append(node.ValidateConfigDecoding(&conf), node.ValidateFimpAddress()...)
+}
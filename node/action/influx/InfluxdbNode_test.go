@@ -0,0 +1,139 @@
+package influx
+
+import (
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/connector"
+	"github.com/thingsplex/tpflow/connector/plugins/influxdb"
+	"github.com/thingsplex/tpflow/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// influxStub imitates influxdb HTTP API , records write requests and returns fixed result for select queries
+type influxStub struct {
+	mtx     sync.Mutex
+	queries []string
+	writes  []string
+	dbs     []string
+}
+
+func (stub *influxStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.mtx.Lock()
+	defer stub.mtx.Unlock()
+	w.Header().Set("X-Influxdb-Version", "1.6.2")
+	switch r.URL.Path {
+	case "/query":
+		q := r.URL.Query().Get("q")
+		stub.queries = append(stub.queries, q)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(q, "SELECT") {
+			fmt.Fprint(w, `{"results":[{"statement_id":0,"series":[{"name":"sensor_temp","tags":{"location":"kitchen"},"columns":["time","mean"],"values":[["2020-01-01T00:00:00Z",21.5],["2020-01-01T01:00:00Z",22]]}]}]}`)
+		} else {
+			fmt.Fprint(w, `{"results":[{"statement_id":0}]}`)
+		}
+	case "/write":
+		body, _ := ioutil.ReadAll(r.Body)
+		stub.writes = append(stub.writes, string(body))
+		stub.dbs = append(stub.dbs, r.URL.Query().Get("db")+"/"+r.URL.Query().Get("rp"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setupTest(t *testing.T) (*influxStub, *httptest.Server, *connector.Registry, *model.Context) {
+	stub := &influxStub{}
+	server := httptest.NewServer(stub)
+	registry := connector.NewRegistry("")
+	conn := influxdb.NewConnectorInstance("influx", influxdb.ConnectorConfig{Address: server.URL, Db: "historian", RetentionPolicyName: "default_20w", RetentionDuration: "20w"})
+	registry.AddConnection("influxdb", "influx", "influxdb", conn)
+	ctx, err := model.NewContextDB("InfluxTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.RegisterFlow("InfluxTest")
+	return stub, server, registry, ctx
+}
+
+func newTestNode(t *testing.T, constructor func(*model.FlowOperationalContext, model.MetaNode, *model.Context) model.Node, config interface{}, registry *connector.Registry, ctx *model.Context) model.Node {
+	meta := model.MetaNode{Id: "1", Type: "influx", Label: "Influx", SuccessTransition: "2", ErrorTransition: "3", Config: config}
+	node := constructor(&model.FlowOperationalContext{FlowId: "InfluxTest"}, meta, ctx)
+	node.SetConnectorRegistry(registry)
+	if err := node.LoadNodeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestInfluxdbReadNode(t *testing.T) {
+	stub, server, registry, ctx := setupTest(t)
+	defer server.Close()
+	defer os.Remove("InfluxTest.db")
+	defer ctx.Close()
+
+	config := InfluxdbReadConfig{ConnectorId: "influxdb", QueryExpression: `SELECT mean(value) FROM sensor_temp WHERE location = '{{ .Variable }}'`, ResultVariableName: "temp"}
+	node := newTestNode(t, NewInfluxdbReadNode, config, registry, ctx)
+	msg := model.Message{Payload: *fimpgo.NewStringMessage("cmd.report.get", "report", "kitchen", nil, nil, nil)}
+	transitions, err := node.OnInput(&msg)
+	if err != nil || transitions[0] != "2" {
+		t.Fatal("Wrong transition ", transitions, err)
+	}
+	if q := stub.queries[len(stub.queries)-1]; q != "SELECT mean(value) FROM sensor_temp WHERE location = 'kitchen'" {
+		t.Error("Wrong query ", q)
+	}
+	if v, err := ctx.GetVariable("temp", "InfluxTest"); err != nil || v.ValueType != "float" || v.Value.(float64) != 21.5 {
+		t.Error("Wrong value result ", v, err)
+	}
+
+	config.ResultFormat = ResultFormatRows
+	node = newTestNode(t, NewInfluxdbReadNode, config, registry, ctx)
+	if _, err = node.OnInput(&msg); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := ctx.GetVariable("temp", "InfluxTest")
+	rows, ok := v.Value.([]interface{})
+	if !ok || len(rows) != 2 || rows[1].(map[string]interface{})["mean"] != int64(22) || rows[1].(map[string]interface{})["location"] != "kitchen" {
+		t.Error("Wrong rows result ", v)
+	}
+}
+
+func TestInfluxdbWriteNode(t *testing.T) {
+	stub, server, registry, ctx := setupTest(t)
+	defer server.Close()
+	defer os.Remove("InfluxTest.db")
+	defer ctx.Close()
+
+	config := InfluxdbWriteConfig{ConnectorId: "influxdb", Tags: map[string]string{"site": "home"}}
+	node := newTestNode(t, NewInfluxdbWriteNode, config, registry, ctx)
+	msg := model.Message{AddressStr: "pt:j1/mt:evt/rt:dev/rn:zw/ad:1/sv:sensor_temp/ad:2_0",
+		Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", 21.5, fimpgo.Props{"unit": "C"}, nil, nil)}
+	transitions, err := node.OnInput(&msg)
+	if err != nil || transitions[0] != "2" {
+		t.Fatal("Wrong transition ", transitions, err)
+	}
+	if len(stub.writes) != 1 || stub.dbs[0] != "historian/default_20w" {
+		t.Fatal("Point wasn't written to connector database ", stub.dbs)
+	}
+	line := stub.writes[0]
+	for _, part := range []string{"sensor_temp,", "site=home", "unit=C", "msg_type=evt.sensor.report", " value=21.5 "} {
+		if !strings.Contains(line, part) {
+			t.Errorf("Line %s doesn't contain %s", line, part)
+		}
+	}
+
+	msg = model.Message{Payload: *fimpgo.NewMessage("evt.meter.report", "meter_elec", "float_map", map[string]float64{"p": 100, "e": 2.5}, nil, nil, nil)}
+	config.PropsAsFields = true
+	node = newTestNode(t, NewInfluxdbWriteNode, config, registry, ctx)
+	if _, err = node.OnInput(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if line = stub.writes[1]; !strings.Contains(line, "e=2.5,p=100") {
+		t.Error("Map value wasn't stored as fields ", line)
+	}
+}
@@ -1,86 +1,98 @@
 package influx
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
-	"github.com/thingsplex/tpflow/model"
+	"fmt"
 	influx "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
 	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"sync"
 	"text/template"
 )
 
+const (
+	ResultFormatValue  = "value"  // value of the first row from the first series
+	ResultFormatRows   = "rows"   // list of rows , every row is an object with columns and series tags
+	ResultFormatSeries = "series" // list of series as returned by influxdb
+)
+
 type InfluxdbReadNode struct {
-	BaseNode
-	ctx *model.Context
-	//transport *fimpgo.MqttTransport
+	base.BaseNode
+	ctx           *model.Context
 	config        InfluxdbReadConfig
 	queryTemplate *template.Template
 	connection    influx.Client
+	database      string
+	mtx           sync.Mutex
 }
 
 type InfluxdbReadConfig struct {
 	ConnectorId        string
-	QueryExpression    string
-	ResultVariableName string
-	IsLVariableGlobal  bool
+	Database           string // Database name , empty - database configured in connector
+	QueryExpression    string // InfluxQL query template . Template params : .Variable - message value , .Message - input message
+	ResultVariableName string // Context variable where result is stored
+	IsLVariableGlobal  bool   // true - if result variable is global
+	ResultFormat       string // value (default) , rows , series
+	ResultColumn       string // Column used by value format , empty - the first column after time
+}
+
+type QueryTemplateParams struct {
+	Variable interface{}
+	Message  *model.Message
 }
 
 func NewInfluxdbReadNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
 	node := InfluxdbReadNode{ctx: ctx}
-	node.meta = meta
-	node.flowOpCtx = flowOpCtx
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
 	node.config = InfluxdbReadConfig{}
 	node.SetupBaseNode()
 	return &node
 }
 
 func (node *InfluxdbReadNode) LoadNodeConfig() error {
-	err := mapstructure.Decode(node.meta.Config, &node.config)
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
 	if err != nil {
 		node.GetLog().Error("Can't decode config.Err:", err)
 		return err
-
+	}
+	if node.config.ResultFormat == "" {
+		node.config.ResultFormat = ResultFormatValue
 	}
 
-	connInstance := node.connectorRegistry.GetInstance(node.config.ConnectorId)
-	var ok bool
-	if connInstance != nil {
-		node.connection, ok = connInstance.Connection.(influx.Client)
-		if !ok {
-			node.connection = nil
-			node.GetLog().Error("Can't get things connection to things registry . Cast to influx client failed")
-		}
-	} else {
-		node.GetLog().Error("Connector registry doesn't have influxdb instance")
-	}
-
-	funcMap := template.FuncMap{
-		"variable": func(varName string, isGlobal bool) (interface{}, error) {
-			//node.GetLog().Debug("Getting variable by name ",varName)
-			var vari model.Variable
-			var err error
-			if isGlobal {
-				vari, err = node.ctx.GetVariable(varName, "global")
-			} else {
-				vari, err = node.ctx.GetVariable(varName, node.flowOpCtx.FlowId)
-			}
+	funcMap := node.AddVariableTemplateFuncs(template.FuncMap{}, node.ctx)
+	node.queryTemplate, err = template.New("query").Funcs(funcMap).Parse(node.config.QueryExpression)
+	if err != nil {
+		node.GetLog().Error(" Failed while parsing query template.Error:", err)
+		return err
+	}
+	// Connector may be added after the flow is started , connection is resolved again on first message
+	if err := node.initConnection(); err != nil {
+		node.GetLog().Warn("Influxdb connection is not available . Err:", err)
+	}
+	return nil
+}
 
-			if vari.IsNumber() {
-				return vari.ToNumber()
-			}
-			vstr, ok := vari.Value.(string)
-			if ok {
-				return vstr, err
-			} else {
-				node.GetLog().Debug("Only simple types are supported ")
-				return "", errors.New("Only simple types are supported ")
-			}
-		},
+func (node *InfluxdbReadNode) initConnection() error {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	if node.connection != nil {
+		return nil
 	}
-	node.queryTemplate, err = template.New("query").Funcs(funcMap).Parse(node.meta.Address)
+	client, conn, err := getConnection(node.ConnectorRegistry(), node.config.ConnectorId)
 	if err != nil {
-		node.GetLog().Error(" Failed while parsing url template.Error:", err)
+		return err
 	}
-	return err
+	node.connection = client
+	node.database = node.config.Database
+	if node.database == "" {
+		node.database = conn.GetDbName()
+	}
+	return nil
 }
 
 func (node *InfluxdbReadNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
@@ -88,20 +100,138 @@ func (node *InfluxdbReadNode) WaitForEvent(responseChannel chan model.ReactorEve
 }
 
 func (node *InfluxdbReadNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
-	node.GetLog().Info("Executing InfluxdbReadNode . Name = ", node.meta.Label)
-
-	//msgBa, err := fimpMsg.SerializeToJson()
-	//if err != nil {
-	//	return nil,err
-	//}
-	//var addrTemplateBuffer bytes.Buffer
-	//node.queryTemplate.Execute(&addrTemplateBuffer,nil)
-	//address:= addrTemplateBuffer.String()
-	//
-	//
-	//node.GetLog().Debug(" Address: ",address)
-	//node.GetLog().Debug(" Action message : ", fimpMsg)
-
-	//node.transport.PublishRaw(address, msgBa)
-	return []model.NodeID{node.meta.SuccessTransition}, nil
+	node.GetLog().Info("Executing InfluxdbReadNode . Name = ", node.Meta().Label)
+	if err := node.initConnection(); err != nil {
+		node.GetLog().Error("Influxdb connection is not available . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+
+	var queryBuffer bytes.Buffer
+	if err := node.queryTemplate.Execute(&queryBuffer, QueryTemplateParams{Variable: msg.Payload.Value, Message: msg}); err != nil {
+		node.GetLog().Error("Can't execute query template . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	node.GetLog().Debug(" Query: ", queryBuffer.String())
+
+	response, err := node.connection.Query(influx.NewQuery(queryBuffer.String(), node.database, ""))
+	if err == nil {
+		err = response.Error()
+	}
+	if err != nil {
+		node.GetLog().Error("Query failed . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	var series []models.Row
+	for _, result := range response.Results {
+		series = append(series, result.Series...)
+	}
+
+	if node.config.ResultVariableName != "" {
+		resultVar, err := node.mapResult(series)
+		if err != nil {
+			node.GetLog().Error("Can't map query result . Err:", err)
+			return []model.NodeID{node.Meta().ErrorTransition}, err
+		}
+		flowId := node.FlowOpCtx().FlowId
+		if node.config.IsLVariableGlobal {
+			flowId = "global"
+		}
+		if err = node.ctx.SetVariable(node.config.ResultVariableName, resultVar.ValueType, resultVar.Value, "", flowId, false); err != nil {
+			return []model.NodeID{node.Meta().ErrorTransition}, err
+		}
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// mapResult converts query series into context variable according to ResultFormat
+func (node *InfluxdbReadNode) mapResult(series []models.Row) (model.Variable, error) {
+	switch node.config.ResultFormat {
+	case ResultFormatValue:
+		if len(series) == 0 || len(series[0].Values) == 0 {
+			return model.Variable{}, errors.New("query returned no data")
+		}
+		column := -1
+		for i, name := range series[0].Columns {
+			if (node.config.ResultColumn == "" && name != "time") || name == node.config.ResultColumn {
+				column = i
+				break
+			}
+		}
+		if column == -1 || column >= len(series[0].Values[0]) {
+			return model.Variable{}, fmt.Errorf("column %s not found", node.config.ResultColumn)
+		}
+		return toVariable(series[0].Values[0][column]), nil
+	case ResultFormatRows:
+		rows := []interface{}{}
+		for _, s := range series {
+			for _, values := range s.Values {
+				row := map[string]interface{}{}
+				for k, v := range s.Tags {
+					row[k] = v
+				}
+				for i := range values {
+					if i < len(s.Columns) {
+						row[s.Columns[i]] = toVariable(values[i]).Value
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+		return model.Variable{ValueType: "object", Value: rows}, nil
+	case ResultFormatSeries:
+		result := []interface{}{}
+		for _, s := range series {
+			values := make([][]interface{}, len(s.Values))
+			for i := range s.Values {
+				values[i] = make([]interface{}, len(s.Values[i]))
+				for j := range s.Values[i] {
+					values[i][j] = toVariable(s.Values[i][j]).Value
+				}
+			}
+			result = append(result, map[string]interface{}{"name": s.Name, "tags": s.Tags, "columns": s.Columns, "values": values})
+		}
+		return model.Variable{ValueType: "object", Value: result}, nil
+	}
+	return model.Variable{}, fmt.Errorf("unknown result format %s", node.config.ResultFormat)
+}
+
+// toVariable converts value decoded by influxdb client , numbers are returned as json.Number
+func toVariable(value interface{}) model.Variable {
+	switch v := value.(type) {
+	case json.Number:
+		if intValue, err := v.Int64(); err == nil {
+			return model.Variable{ValueType: "int", Value: intValue}
+		}
+		floatValue, _ := v.Float64()
+		return model.Variable{ValueType: "float", Value: floatValue}
+	case float64:
+		return model.Variable{ValueType: "float", Value: v}
+	case string:
+		return model.Variable{ValueType: "string", Value: v}
+	case bool:
+		return model.Variable{ValueType: "bool", Value: v}
+	case nil:
+		return model.Variable{ValueType: "null", Value: nil}
+	}
+	return model.Variable{ValueType: "object", Value: value}
+}
+
+func (node *InfluxdbReadNode) ValidateConfig() []model.ValidationError {
+	conf := InfluxdbReadConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.ConnectorId == "" {
+		result = append(result, node.NewValidationError("Config.ConnectorId", "connector is not set"))
+	}
+	if conf.QueryExpression == "" {
+		result = append(result, node.NewValidationError("Config.QueryExpression", "query is not set"))
+	}
+	switch conf.ResultFormat {
+	case "", ResultFormatValue, ResultFormatRows, ResultFormatSeries:
+	default:
+		result = append(result, node.NewValidationError("Config.ResultFormat", "unknown result format %s", conf.ResultFormat))
+	}
+	return append(result, node.ValidateTemplate("Config.QueryExpression", conf.QueryExpression)...)
 }
@@ -0,0 +1,191 @@
+package influx
+
+import (
+	"fmt"
+	influx "github.com/influxdata/influxdb/client/v2"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"strings"
+	"sync"
+	"time"
+)
+
+type InfluxdbWriteNode struct {
+	base.BaseNode
+	ctx             *model.Context
+	config          InfluxdbWriteConfig
+	connection      influx.Client
+	database        string
+	retentionPolicy string
+	mtx             sync.Mutex
+}
+
+type InfluxdbWriteConfig struct {
+	ConnectorId     string
+	Database        string            // Database name , empty - database configured in connector
+	RetentionPolicy string            // Retention policy name , empty - retention policy configured in connector
+	Measurement     string            // Measurement name , empty - message service name
+	FieldName       string            // Field name of simple values , default - value . Keys of map values are used as field names
+	Tags            map[string]string // Static tags added to every point
+	PropsAsFields   bool              // true - message properties are stored as fields , otherwise as tags
+	Precision       string            // Write precision , default - ms
+}
+
+func NewInfluxdbWriteNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := InfluxdbWriteNode{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.config = InfluxdbWriteConfig{}
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *InfluxdbWriteNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Can't decode config.Err:", err)
+		return err
+	}
+	if node.config.FieldName == "" {
+		node.config.FieldName = "value"
+	}
+	if node.config.Precision == "" {
+		node.config.Precision = "ms"
+	}
+	// Connector may be added after the flow is started , connection is resolved again on first message
+	if err := node.initConnection(); err != nil {
+		node.GetLog().Warn("Influxdb connection is not available . Err:", err)
+	}
+	return nil
+}
+
+func (node *InfluxdbWriteNode) initConnection() error {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	if node.connection != nil {
+		return nil
+	}
+	client, conn, err := getConnection(node.ConnectorRegistry(), node.config.ConnectorId)
+	if err != nil {
+		return err
+	}
+	node.connection = client
+	node.database = node.config.Database
+	if node.database == "" {
+		node.database = conn.GetDbName()
+	}
+	node.retentionPolicy = node.config.RetentionPolicy
+	if node.retentionPolicy == "" {
+		node.retentionPolicy = conn.GetRetentionPolicyName()
+	}
+	return nil
+}
+
+func (node *InfluxdbWriteNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *InfluxdbWriteNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	node.GetLog().Info("Executing InfluxdbWriteNode . Name = ", node.Meta().Label)
+	if err := node.initConnection(); err != nil {
+		node.GetLog().Error("Influxdb connection is not available . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	point, err := node.buildPoint(msg)
+	if err != nil {
+		node.GetLog().Error("Can't build point . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	bp, err := influx.NewBatchPoints(influx.BatchPointsConfig{Database: node.database, RetentionPolicy: node.retentionPolicy, Precision: node.config.Precision})
+	if err != nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	bp.AddPoint(point)
+	if err = node.connection.Write(bp); err != nil {
+		node.GetLog().Error("Write failed . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// buildPoint creates point from message value , properties and tags
+func (node *InfluxdbWriteNode) buildPoint(msg *model.Message) (*influx.Point, error) {
+	measurement := node.config.Measurement
+	if measurement == "" {
+		measurement = msg.Payload.Service
+	}
+	if measurement == "" {
+		return nil, fmt.Errorf("measurement name is empty")
+	}
+	tags := map[string]string{}
+	if msg.AddressStr != "" {
+		tags["topic"] = msg.AddressStr
+	}
+	if msg.Payload.Type != "" {
+		tags["msg_type"] = msg.Payload.Type
+	}
+	if len(msg.Payload.Tags) > 0 {
+		tags["tags"] = strings.Join(msg.Payload.Tags, ",")
+	}
+	for k, v := range node.config.Tags {
+		tags[k] = v
+	}
+
+	fields := map[string]interface{}{}
+	switch v := msg.Payload.Value.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			fields[key] = value
+		}
+	case map[string]string:
+		for key, value := range v {
+			fields[key] = value
+		}
+	case map[string]int64:
+		for key, value := range v {
+			fields[key] = value
+		}
+	case map[string]float64:
+		for key, value := range v {
+			fields[key] = value
+		}
+	case map[string]bool:
+		for key, value := range v {
+			fields[key] = value
+		}
+	case int, int64, float32, float64, bool, string:
+		fields[node.config.FieldName] = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("value type %s can't be stored", msg.Payload.ValueType)
+	}
+	for k, v := range msg.Payload.Properties {
+		if node.config.PropsAsFields {
+			fields[k] = v
+		} else {
+			tags[k] = v
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("point has no fields")
+	}
+	return influx.NewPoint(measurement, tags, fields, time.Now())
+}
+
+func (node *InfluxdbWriteNode) ValidateConfig() []model.ValidationError {
+	conf := InfluxdbWriteConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.ConnectorId == "" {
+		result = append(result, node.NewValidationError("Config.ConnectorId", "connector is not set"))
+	}
+	if conf.Precision != "" {
+		if _, err := time.ParseDuration("1" + conf.Precision); err != nil {
+			result = append(result, node.NewValidationError("Config.Precision", "invalid precision %s", conf.Precision))
+		}
+	}
+	return result
+}
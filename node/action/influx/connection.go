@@ -0,0 +1,28 @@
+package influx
+
+import (
+	"errors"
+	influx "github.com/influxdata/influxdb/client/v2"
+	"github.com/thingsplex/tpflow/connector"
+	"github.com/thingsplex/tpflow/connector/plugins/influxdb"
+)
+
+// getConnection resolves influxdb client and connector instance from connector registry
+func getConnection(registry *connector.Registry, connectorId string) (influx.Client, *influxdb.Connector, error) {
+	if registry == nil {
+		return nil, nil, errors.New("connector registry is not set")
+	}
+	connInstance := registry.GetInstance(connectorId)
+	if connInstance == nil {
+		return nil, nil, errors.New("connector registry doesn't have influxdb instance " + connectorId)
+	}
+	conn, ok := connInstance.Connection.(*influxdb.Connector)
+	if !ok {
+		return nil, nil, errors.New("connector " + connectorId + " is not influxdb connector")
+	}
+	client, ok := conn.GetConnection().(influx.Client)
+	if !ok || client == nil {
+		return nil, nil, errors.New("influxdb client is not initialized")
+	}
+	return client, conn, nil
+}
@@ -68,3 +68,8 @@ func (node *LogNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *LogNode) ValidateConfig() []model.ValidationError {
+	conf := LogNodeConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
@@ -0,0 +1,154 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	mqttconn "github.com/thingsplex/tpflow/connector/plugins/mqtt"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"text/template"
+)
+
+// PublishNode publishes raw (non-FIMP) payload using generic MQTT connector
+type PublishNode struct {
+	base.BaseNode
+	ctx             *model.Context
+	conn            *mqttconn.Connector
+	config          PublishConfig
+	topicTemplate   *template.Template
+	payloadTemplate *template.Template
+}
+
+type PublishConfig struct {
+	ConnectorID      string // Instance of mqtt connector
+	Topic            string // Topic template
+	Qos              int
+	Retain           bool
+	PayloadTemplate  string // Payload template , empty - value is published as is (strings) or as JSON (other types)
+	VariableName     string // Value is taken from variable , empty - message value is used
+	IsVariableGlobal bool
+}
+
+type TemplateParams struct {
+	Variable interface{}
+	Message  *model.Message
+}
+
+func NewPublishNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := PublishNode{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.config = PublishConfig{}
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *PublishNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Can't decode config.Err:", err)
+		return err
+	}
+
+	funcMap := node.AddVariableTemplateFuncs(template.FuncMap{}, node.ctx)
+	node.topicTemplate, err = template.New("topic").Funcs(funcMap).Parse(node.config.Topic)
+	if err != nil {
+		node.GetLog().Error("Failed while parsing topic template.Error:", err)
+		return err
+	}
+	if node.config.PayloadTemplate != "" {
+		node.payloadTemplate, err = template.New("payload").Funcs(funcMap).Parse(node.config.PayloadTemplate)
+		if err != nil {
+			node.GetLog().Error("Failed while parsing payload template.Error:", err)
+			return err
+		}
+	}
+
+	connInstance := node.ConnectorRegistry().GetInstance(node.config.ConnectorID)
+	if connInstance == nil {
+		node.GetLog().Error("Connector registry doesn't have mqtt instance ", node.config.ConnectorID)
+		return errors.New("can't find mqtt connector")
+	}
+	var ok bool
+	node.conn, ok = connInstance.Connection.GetConnection().(*mqttconn.Connector)
+	if !ok {
+		node.GetLog().Error("can't cast connection to mqtt connector")
+		return errors.New("can't cast connection to mqtt connector")
+	}
+	return nil
+}
+
+func (node *PublishNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *PublishNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	topic, payload, err := node.BuildMessage(msg)
+	if err != nil {
+		node.GetLog().Error("Can't build message . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	node.GetLog().Debug(" Publishing to: ", topic)
+	if err = node.conn.Publish(topic, payload, byte(node.config.Qos), node.config.Retain); err != nil {
+		node.GetLog().Error("Publish failed . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// BuildMessage returns topic and payload generated from message or variable
+func (node *PublishNode) BuildMessage(msg *model.Message) (string, []byte, error) {
+	value := msg.Payload.Value
+	if node.config.VariableName != "" {
+		flowId := node.FlowOpCtx().FlowId
+		if node.config.IsVariableGlobal {
+			flowId = "global"
+		}
+		variable, err := node.ctx.GetVariable(node.config.VariableName, flowId)
+		if err != nil {
+			return "", nil, err
+		}
+		value = variable.Value
+	}
+	params := TemplateParams{Variable: value, Message: msg}
+	var topicBuffer bytes.Buffer
+	if err := node.topicTemplate.Execute(&topicBuffer, params); err != nil {
+		return "", nil, err
+	}
+	if node.payloadTemplate != nil {
+		var payloadBuffer bytes.Buffer
+		if err := node.payloadTemplate.Execute(&payloadBuffer, params); err != nil {
+			return "", nil, err
+		}
+		return topicBuffer.String(), payloadBuffer.Bytes(), nil
+	}
+	switch v := value.(type) {
+	case nil:
+		return topicBuffer.String(), []byte{}, nil
+	case string:
+		return topicBuffer.String(), []byte(v), nil
+	}
+	payload, err := json.Marshal(value)
+	return topicBuffer.String(), payload, err
+}
+
+func (node *PublishNode) ValidateConfig() []model.ValidationError {
+	conf := PublishConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.ConnectorID == "" {
+		result = append(result, node.NewValidationError("Config.ConnectorID", "connector is not set"))
+	}
+	if conf.Topic == "" {
+		result = append(result, node.NewValidationError("Config.Topic", "topic is not set"))
+	}
+	if conf.Qos < 0 || conf.Qos > 2 {
+		result = append(result, node.NewValidationError("Config.Qos", "qos must be 0 , 1 or 2"))
+	}
+	result = append(result, node.ValidateTemplate("Config.Topic", conf.Topic)...)
+	return append(result, node.ValidateTemplate("Config.PayloadTemplate", conf.PayloadTemplate)...)
+}
@@ -461,3 +461,16 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	node.GetLog().Infof(" Done . Name = %s,Status = %s", node.Meta().Label, resp.Status)
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.Url == "" {
+		result = append(result, node.NewValidationError("Config.Url", "url is not set"))
+	}
+	result = append(result, node.ValidateTemplate("Config.Url", conf.Url)...)
+	return append(result, node.ValidateTemplate("Config.RequestTemplate", conf.RequestTemplate)...)
+}
@@ -0,0 +1,258 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strings"
+	"time"
+)
+
+type NodeConfig struct {
+	Language        string                  // lua
+	Script          string                  // Script body . Script can return name of transition , nil means success
+	Timeout         int64                   // Max script execution time in milliseconds , default 1000
+	MaxMemory       int64                   // Approximate max size of data held by the script in MB , default 32 , -1 - no limit
+	MaxInstructions int64                   // Max number of executed VM instructions , default 10 000 000 , -1 - no limit
+	CallStackSize   int                     // Max depth of function calls , default 64
+	Transitions     map[string]model.NodeID // Named transitions script can return , in addition to success , error and timeout
+}
+
+// Script node executes embedded Lua script within flow goroutine . Script can access and modify message via global table
+// msg (type , service , value , value_type , props) , context variables via get_var/set_var functions and selects
+// next node by returning transition name.
+// Only base , table , string and math libraries are available , functions which access file system are removed.
+type Node struct {
+	base.BaseNode
+	ctx    *model.Context
+	config NodeConfig
+	proto  *lua.FunctionProto
+}
+
+const (
+	defaultTimeout         = 1000
+	defaultMaxMemory       = 32
+	defaultMaxInstructions = 10000000
+	defaultCallStackSize   = 64
+	registryMaxSize        = 1024 * 64
+)
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	conf := NodeConfig{}
+	err := mapstructure.Decode(node.Meta().Config, &conf)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	if conf.Language == "" {
+		conf.Language = "lua"
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.MaxMemory == 0 {
+		conf.MaxMemory = defaultMaxMemory
+	}
+	if conf.MaxInstructions == 0 {
+		conf.MaxInstructions = defaultMaxInstructions
+	}
+	if conf.CallStackSize == 0 {
+		conf.CallStackSize = defaultCallStackSize
+	}
+	node.config = conf
+	node.proto, err = compile(conf.Language, conf.Script, string(node.Meta().Id))
+	if err != nil {
+		node.GetLog().Error("Can't compile script . Err:", err)
+	}
+	return err
+}
+
+func compile(language string, script string, name string) (*lua.FunctionProto, error) {
+	if language != "lua" {
+		return nil, fmt.Errorf("unsupported script language %s", language)
+	}
+	chunk, err := parse.Parse(strings.NewReader(script), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	if node.proto == nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, errors.New("script is not compiled")
+	}
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: node.config.CallStackSize, RegistryMaxSize: registryMaxSize})
+	defer L.Close()
+
+	execCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(node.config.Timeout))
+	defer cancel()
+	var maxMemory int
+	if node.config.MaxMemory > 0 {
+		maxMemory = int(node.config.MaxMemory) * 1024 * 1024
+	}
+	var maxInstructions int64
+	if node.config.MaxInstructions > 0 {
+		maxInstructions = node.config.MaxInstructions
+	}
+	execBudget := newBudget(execCtx, L, maxInstructions, maxMemory)
+	defer execBudget.cancel()
+	L.SetContext(execBudget)
+	openSafeLibs(L, execBudget)
+
+	msgTable := messageToTable(L, msg)
+	L.SetGlobal("msg", msgTable)
+	L.SetGlobal("get_var", L.NewFunction(node.luaGetVariable))
+	L.SetGlobal("set_var", L.NewFunction(node.luaSetVariable))
+	L.SetGlobal("log", L.NewFunction(node.luaLog))
+
+	L.Push(L.NewFunctionFromProto(node.proto))
+	err := L.PCall(0, 1, nil)
+	if err != nil {
+		if limitErr := execBudget.Exceeded(); limitErr != nil {
+			err = limitErr
+		} else if execCtx.Err() == context.DeadlineExceeded {
+			err = errors.New("script execution timeout")
+		}
+		node.GetLog().Error("Script failed . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	if err := tableToMessage(msgTable, msg); err != nil {
+		node.GetLog().Error("Can't update message from script . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+
+	switch result.Type() {
+	case lua.LTNil:
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	case lua.LTString:
+		return node.getTransition(result.String())
+	}
+	return []model.NodeID{node.Meta().ErrorTransition}, fmt.Errorf("script returned %s , transition name expected", result.Type())
+}
+
+func (node *Node) getTransition(name string) ([]model.NodeID, error) {
+	switch name {
+	case "success":
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	case "error":
+		return []model.NodeID{node.Meta().ErrorTransition}, nil
+	case "timeout":
+		return []model.NodeID{node.Meta().TimeoutTransition}, nil
+	}
+	if nodeId, ok := node.config.Transitions[name]; ok {
+		return []model.NodeID{nodeId}, nil
+	}
+	return []model.NodeID{node.Meta().ErrorTransition}, fmt.Errorf("script returned unknown transition %s", name)
+}
+
+func openSafeLibs(L *lua.LState, execBudget *budget) {
+	libs := []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// string.rep can allocate whole memory budget in a single call , size is checked before the call
+	stringLib := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	rep := stringLib.RawGetString("rep").(*lua.LFunction)
+	stringLib.RawSetString("rep", L.NewFunction(func(L *lua.LState) int {
+		execBudget.checkAllocation(L, len(L.CheckString(1)), L.CheckInt(2))
+		return rep.GFunction(L)
+	}))
+}
+
+// get_var(name , is_global) returns variable value or nil if variable doesn't exist
+func (node *Node) luaGetVariable(L *lua.LState) int {
+	name := L.CheckString(1)
+	flowId := node.FlowOpCtx().FlowId
+	if L.OptBool(2, false) {
+		flowId = "global"
+	}
+	variable, err := node.ctx.GetVariable(name, flowId)
+	if err != nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(toLuaValue(L, variable.Value))
+	return 1
+}
+
+// set_var(name , value , value_type , is_global , in_memory)
+func (node *Node) luaSetVariable(L *lua.LState) int {
+	name := L.CheckString(1)
+	value := L.CheckAny(2)
+	valueType := L.CheckString(3)
+	flowId := node.FlowOpCtx().FlowId
+	if L.OptBool(4, false) {
+		flowId = "global"
+	}
+	goValue, err := fromLuaValue(value, valueType)
+	if err != nil {
+		L.RaiseError("can't convert variable %s : %s", name, err)
+		return 0
+	}
+	if err = node.ctx.SetVariable(name, valueType, goValue, "", flowId, L.OptBool(5, false)); err != nil {
+		L.RaiseError("can't set variable %s : %s", name, err)
+	}
+	return 0
+}
+
+func (node *Node) luaLog(L *lua.LState) int {
+	node.GetLog().Info("Script: ", L.CheckString(1))
+	return 0
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.Language == "" {
+		conf.Language = "lua"
+	}
+	if _, err := compile(conf.Language, conf.Script, string(node.Meta().Id)); err != nil {
+		result = append(result, node.NewValidationError("Config.Script", "invalid script : %s", err))
+	}
+	node.config = conf
+	return result
+}
+
+func (node *Node) GetConfigTransitions() map[string]model.NodeID {
+	result := map[string]model.NodeID{}
+	for name, nodeId := range node.config.Transitions {
+		result["Config.Transitions."+name] = nodeId
+	}
+	return result
+}
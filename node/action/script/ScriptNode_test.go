@@ -0,0 +1,96 @@
+package script
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	log "github.com/sirupsen/logrus"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"os"
+	"testing"
+)
+
+func newScriptNode(t *testing.T, ctx *model.Context, config NodeConfig) *Node {
+	meta := model.MetaNode{Id: "1", Type: "script", Label: "Script", SuccessTransition: "2", ErrorTransition: "3", TimeoutTransition: "4", Config: config}
+	node, err := base.NewConfiguredNode(NewNode, &model.FlowOperationalContext{FlowId: "ScriptTest"}, meta, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*Node)
+}
+
+func TestScriptNode_OnInput(t *testing.T) {
+	log.SetLevel(log.DebugLevel)
+	ctx, err := model.NewContextDB("ScriptTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("ScriptTest.db")
+	defer ctx.Close()
+	ctx.RegisterFlow("ScriptTest")
+	ctx.SetVariable("offset", "int", int64(5), "", "global", false)
+
+	script := `
+		local offset = get_var("offset", true)
+		msg.value = msg.value + offset
+		msg.props["unit"] = "C"
+		set_var("last_value", msg.value, "int")
+		if msg.value > 20 then
+			return "high"
+		end`
+	node := newScriptNode(t, ctx, NodeConfig{Script: script, Transitions: map[string]model.NodeID{"high": "5"}})
+
+	msg := model.Message{Payload: *fimpgo.NewIntMessage("evt.sensor.report", "sensor_temp", 10, nil, nil, nil)}
+	transitions, err := node.OnInput(&msg)
+	if err != nil || transitions[0] != "2" {
+		t.Fatal("Wrong transition ", transitions, err)
+	}
+	if v, _ := msg.Payload.GetIntValue(); v != 15 || msg.Payload.Properties["unit"] != "C" {
+		t.Error("Message wasn't updated ", msg.Payload)
+	}
+	if v, err := ctx.GetVariable("last_value", "ScriptTest"); err != nil || v.Value.(int64) != 15 {
+		t.Error("Variable wasn't set ", v, err)
+	}
+
+	msg = model.Message{Payload: *fimpgo.NewIntMessage("evt.sensor.report", "sensor_temp", 20, nil, nil, nil)}
+	transitions, err = node.OnInput(&msg)
+	if err != nil || transitions[0] != "5" {
+		t.Error("Named transition wasn't selected ", transitions, err)
+	}
+}
+
+func TestScriptNode_Limits(t *testing.T) {
+	ctx, err := model.NewContextDB("ScriptLimitsTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("ScriptLimitsTest.db")
+	defer ctx.Close()
+
+	tests := []struct {
+		name   string
+		config NodeConfig
+		errMsg string
+	}{
+		{"timeout", NodeConfig{Script: "while true do end", Timeout: 100, MaxMemory: -1, MaxInstructions: -1}, "script execution timeout"},
+		{"instructions", NodeConfig{Script: "while true do end", Timeout: 20000, MaxInstructions: 100000}, "script instruction limit exceeded"},
+		{"memory", NodeConfig{Script: `local t = {} for i=1,100000000 do t[i] = string.rep("x", 100) .. i end`, Timeout: 20000, MaxMemory: 16, MaxInstructions: -1}, "script memory limit exceeded"},
+		{"memory_global", NodeConfig{Script: `t = {} for i=1,100000000 do t[i] = {i} end`, Timeout: 20000, MaxMemory: 16, MaxInstructions: -1}, "script memory limit exceeded"},
+		{"memory_concat", NodeConfig{Script: `local s = "x" for i=1,64 do s = s .. s end`, Timeout: 20000, MaxMemory: 16}, "script memory limit exceeded"},
+		{"memory_rep", NodeConfig{Script: `local s = string.rep("xx", 1000000000)`, Timeout: 20000, MaxMemory: 16}, "script memory limit exceeded"},
+		{"sandbox", NodeConfig{Script: `dofile("/etc/passwd")`}, ""},
+		{"recursion", NodeConfig{Script: `local function f(n) return f(n + 1) + 1 end f(1)`}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newScriptNode(t, ctx, tt.config)
+			msg := model.Message{}
+			transitions, err := node.OnInput(&msg)
+			if err == nil || transitions[0] != "3" {
+				t.Fatal("Script wasn't stopped , transitions = ", transitions)
+			}
+			if tt.errMsg != "" && err.Error() != tt.errMsg {
+				t.Error("Wrong error ", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	minMemCheckInterval = 1000 // instructions between full memory checks
+	valueOverhead       = 16   // approximate size of lua value header
+	tableOverhead       = 64   // approximate size of empty table
+)
+
+var (
+	errInstructionLimit = errors.New("script instruction limit exceeded")
+	errMemoryLimit      = errors.New("script memory limit exceeded")
+)
+
+// budget is execution context of the script . Interpreter checks Done before every instruction , budget uses it as a hook
+// to count executed instructions and to estimate memory held by the script . Registers of the current function are checked
+// on every instruction , values reachable from registers and globals are measured periodically , the interval grows with
+// the amount of data , so the check costs constant time per instruction.
+// budget is used only by goroutine executing the script.
+type budget struct {
+	context.Context
+	cancel          context.CancelFunc
+	L               *lua.LState
+	maxInstructions int64 // 0 - no limit
+	maxMemory       int   // bytes , 0 - no limit
+	executed        int64
+	nextMemCheck    int64
+	err             error
+}
+
+func newBudget(parent context.Context, L *lua.LState, maxInstructions int64, maxMemory int) *budget {
+	ctx, cancel := context.WithCancel(parent)
+	return &budget{Context: ctx, cancel: cancel, L: L, maxInstructions: maxInstructions, maxMemory: maxMemory, nextMemCheck: minMemCheckInterval}
+}
+
+func (b *budget) Done() <-chan struct{} {
+	if b.err == nil {
+		b.check()
+	}
+	return b.Context.Done()
+}
+
+func (b *budget) Err() error {
+	if b.err != nil {
+		return b.err
+	}
+	return b.Context.Err()
+}
+
+// Exceeded returns limit error if script was stopped by the budget
+func (b *budget) Exceeded() error {
+	return b.err
+}
+
+func (b *budget) check() {
+	b.executed++
+	if b.maxInstructions > 0 && b.executed > b.maxInstructions {
+		b.stop(errInstructionLimit)
+		return
+	}
+	if b.maxMemory <= 0 {
+		return
+	}
+	if b.executed < b.nextMemCheck {
+		// cheap check , catches strings which grow by concatenation
+		size := 0
+		for i := 1; i <= b.L.GetTop(); i++ {
+			if str, ok := b.L.Get(i).(lua.LString); ok {
+				size += len(str)
+			}
+		}
+		if size > b.maxMemory {
+			b.stop(errMemoryLimit)
+		}
+		return
+	}
+	size, steps := b.measure()
+	if size > b.maxMemory {
+		b.stop(errMemoryLimit)
+		return
+	}
+	if steps < minMemCheckInterval {
+		steps = minMemCheckInterval
+	}
+	b.nextMemCheck = b.executed + int64(steps)
+}
+
+// measure returns approximate size of values reachable from registers of the current function and from globals and number
+// of visited values . Walk stops as soon as size exceeds the limit.
+func (b *budget) measure() (int, int) {
+	var stack []lua.LValue
+	for i := 1; i <= b.L.GetTop(); i++ {
+		stack = append(stack, b.L.Get(i))
+	}
+	stack = append(stack, b.L.G.Global)
+	visited := map[*lua.LTable]bool{}
+	size, steps := 0, 0
+	for len(stack) > 0 && size <= b.maxMemory {
+		value := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		steps++
+		switch v := value.(type) {
+		case lua.LString:
+			size += valueOverhead + len(v)
+		case *lua.LTable:
+			if visited[v] {
+				continue
+			}
+			visited[v] = true
+			size += tableOverhead
+			for key, val := v.Next(lua.LNil); key != lua.LNil; key, val = v.Next(key) {
+				stack = append(stack, key, val)
+			}
+		default:
+			size += valueOverhead
+		}
+	}
+	return size, steps
+}
+
+func (b *budget) stop(err error) {
+	b.err = err
+	b.cancel()
+}
+
+// checkAllocation is used by library functions which can allocate large values in a single call
+func (b *budget) checkAllocation(L *lua.LState, itemSize int, count int) {
+	if b.maxMemory > 0 && itemSize > 0 && count > b.maxMemory/itemSize {
+		b.stop(errMemoryLimit)
+		L.RaiseError(errMemoryLimit.Error())
+	}
+}
@@ -0,0 +1,217 @@
+package script
+
+import (
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/yuin/gopher-lua"
+)
+
+// messageToTable converts message into Lua table . Address is read only.
+func messageToTable(L *lua.LState, msg *model.Message) *lua.LTable {
+	tbl := L.NewTable()
+	tbl.RawSetString("address", lua.LString(msg.AddressStr))
+	tbl.RawSetString("type", lua.LString(msg.Payload.Type))
+	tbl.RawSetString("service", lua.LString(msg.Payload.Service))
+	tbl.RawSetString("value_type", lua.LString(msg.Payload.ValueType))
+	tbl.RawSetString("value", toLuaValue(L, msg.Payload.Value))
+	props := L.NewTable()
+	for k, v := range msg.Payload.Properties {
+		props.RawSetString(k, lua.LString(v))
+	}
+	tbl.RawSetString("props", props)
+	return tbl
+}
+
+// tableToMessage copies values modified by script back into the message
+func tableToMessage(tbl *lua.LTable, msg *model.Message) error {
+	msg.Payload.Type = lua.LVAsString(tbl.RawGetString("type"))
+	msg.Payload.Service = lua.LVAsString(tbl.RawGetString("service"))
+	valueType := lua.LVAsString(tbl.RawGetString("value_type"))
+	value, err := fromLuaValue(tbl.RawGetString("value"), valueType)
+	if err != nil {
+		return err
+	}
+	msg.Payload.ValueType = valueType
+	msg.Payload.Value = value
+	if props, ok := tbl.RawGetString("props").(*lua.LTable); ok {
+		msg.Payload.Properties = fimpgo.Props{}
+		props.ForEach(func(k lua.LValue, v lua.LValue) {
+			msg.Payload.Properties[k.String()] = v.String()
+		})
+	}
+	return nil
+}
+
+func toLuaValue(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case []interface{}:
+		tbl := L.NewTable()
+		for i := range v {
+			tbl.Append(toLuaValue(L, v[i]))
+		}
+		return tbl
+	case []string:
+		tbl := L.NewTable()
+		for i := range v {
+			tbl.Append(lua.LString(v[i]))
+		}
+		return tbl
+	case []int64:
+		tbl := L.NewTable()
+		for i := range v {
+			tbl.Append(lua.LNumber(v[i]))
+		}
+		return tbl
+	case []float64:
+		tbl := L.NewTable()
+		for i := range v {
+			tbl.Append(lua.LNumber(v[i]))
+		}
+		return tbl
+	case []bool:
+		tbl := L.NewTable()
+		for i := range v {
+			tbl.Append(lua.LBool(v[i]))
+		}
+		return tbl
+	case map[string]interface{}:
+		tbl := L.NewTable()
+		for k := range v {
+			tbl.RawSetString(k, toLuaValue(L, v[k]))
+		}
+		return tbl
+	case map[string]string:
+		tbl := L.NewTable()
+		for k := range v {
+			tbl.RawSetString(k, lua.LString(v[k]))
+		}
+		return tbl
+	case map[string]int64:
+		tbl := L.NewTable()
+		for k := range v {
+			tbl.RawSetString(k, lua.LNumber(v[k]))
+		}
+		return tbl
+	case map[string]float64:
+		tbl := L.NewTable()
+		for k := range v {
+			tbl.RawSetString(k, lua.LNumber(v[k]))
+		}
+		return tbl
+	case map[string]bool:
+		tbl := L.NewTable()
+		for k := range v {
+			tbl.RawSetString(k, lua.LBool(v[k]))
+		}
+		return tbl
+	}
+	return lua.LString(fmt.Sprint(value))
+}
+
+// fromLuaValue converts Lua value into Go type defined by fimp value type
+func fromLuaValue(value lua.LValue, valueType string) (interface{}, error) {
+	if value == lua.LNil {
+		return nil, nil
+	}
+	switch valueType {
+	case "string":
+		return lua.LVAsString(value), nil
+	case "int":
+		n, ok := value.(lua.LNumber)
+		if !ok {
+			return nil, fmt.Errorf("number expected , got %s", value.Type())
+		}
+		return int64(n), nil
+	case "float":
+		n, ok := value.(lua.LNumber)
+		if !ok {
+			return nil, fmt.Errorf("number expected , got %s", value.Type())
+		}
+		return float64(n), nil
+	case "bool":
+		return lua.LVAsBool(value), nil
+	case "null":
+		return nil, nil
+	}
+	tbl, ok := value.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("table expected for type %s , got %s", valueType, value.Type())
+	}
+	switch valueType {
+	case "str_array":
+		var result []string
+		tbl.ForEach(func(_ lua.LValue, v lua.LValue) { result = append(result, lua.LVAsString(v)) })
+		return result, nil
+	case "int_array":
+		var result []int64
+		tbl.ForEach(func(_ lua.LValue, v lua.LValue) { result = append(result, int64(lua.LVAsNumber(v))) })
+		return result, nil
+	case "float_array":
+		var result []float64
+		tbl.ForEach(func(_ lua.LValue, v lua.LValue) { result = append(result, float64(lua.LVAsNumber(v))) })
+		return result, nil
+	case "bool_array":
+		var result []bool
+		tbl.ForEach(func(_ lua.LValue, v lua.LValue) { result = append(result, lua.LVAsBool(v)) })
+		return result, nil
+	case "str_map":
+		result := map[string]string{}
+		tbl.ForEach(func(k lua.LValue, v lua.LValue) { result[k.String()] = lua.LVAsString(v) })
+		return result, nil
+	case "int_map":
+		result := map[string]int64{}
+		tbl.ForEach(func(k lua.LValue, v lua.LValue) { result[k.String()] = int64(lua.LVAsNumber(v)) })
+		return result, nil
+	case "float_map":
+		result := map[string]float64{}
+		tbl.ForEach(func(k lua.LValue, v lua.LValue) { result[k.String()] = float64(lua.LVAsNumber(v)) })
+		return result, nil
+	case "bool_map":
+		result := map[string]bool{}
+		tbl.ForEach(func(k lua.LValue, v lua.LValue) { result[k.String()] = lua.LVAsBool(v) })
+		return result, nil
+	}
+	return tableToGo(tbl), nil
+}
+
+// tableToGo converts table into generic object , tables with sequential keys are converted into arrays
+func tableToGo(tbl *lua.LTable) interface{} {
+	convert := func(v lua.LValue) interface{} {
+		switch lv := v.(type) {
+		case lua.LBool:
+			return bool(lv)
+		case lua.LNumber:
+			return float64(lv)
+		case lua.LString:
+			return string(lv)
+		case *lua.LTable:
+			return tableToGo(lv)
+		}
+		return nil
+	}
+	if length := tbl.Len(); length > 0 {
+		result := make([]interface{}, 0, length)
+		for i := 1; i <= length; i++ {
+			result = append(result, convert(tbl.RawGetInt(i)))
+		}
+		return result
+	}
+	result := map[string]interface{}{}
+	tbl.ForEach(func(k lua.LValue, v lua.LValue) { result[k.String()] = convert(v) })
+	return result
+}
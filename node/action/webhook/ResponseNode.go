@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	webhookconn "github.com/thingsplex/tpflow/connector/plugins/webhook"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	trigwebhook "github.com/thingsplex/tpflow/node/trigger/webhook"
+	"text/template"
+)
+
+// ResponseNode replies to HTTP request which started the flow . Webhook trigger must have WaitForResponse enabled.
+type ResponseNode struct {
+	base.BaseNode
+	ctx          *model.Context
+	conn         *webhookconn.Connector
+	config       ResponseConfig
+	bodyTemplate *template.Template
+}
+
+type ResponseConfig struct {
+	ConnectorID  string            // Instance of webhook connector , default - webhook
+	StatusCode   int               // HTTP status code , default - 200
+	Headers      map[string]string // Response headers
+	BodyTemplate string            // Body template , empty - message value is sent as is (strings) or as JSON (other types)
+	ContentType  string            // Content type , default - text/plain for strings and application/json for other values
+}
+
+type TemplateParams struct {
+	Variable interface{}
+	Message  *model.Message
+}
+
+func NewResponseNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := ResponseNode{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.config = ResponseConfig{}
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *ResponseNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Can't decode config.Err:", err)
+		return err
+	}
+	if node.config.ConnectorID == "" {
+		node.config.ConnectorID = trigwebhook.DefaultConnectorID
+	}
+	if node.config.StatusCode == 0 {
+		node.config.StatusCode = 200
+	}
+	if node.config.BodyTemplate != "" {
+		funcMap := node.AddVariableTemplateFuncs(template.FuncMap{}, node.ctx)
+		node.bodyTemplate, err = template.New("body").Funcs(funcMap).Parse(node.config.BodyTemplate)
+		if err != nil {
+			node.GetLog().Error("Failed while parsing body template.Error:", err)
+			return err
+		}
+	}
+
+	connInstance := node.ConnectorRegistry().GetInstance(node.config.ConnectorID)
+	if connInstance == nil {
+		node.GetLog().Error("Connector registry doesn't have webhook instance ", node.config.ConnectorID)
+		return errors.New("can't find webhook connector")
+	}
+	var ok bool
+	node.conn, ok = connInstance.Connection.GetConnection().(*webhookconn.Connector)
+	if !ok {
+		node.GetLog().Error("can't cast connection to webhook connector")
+		return errors.New("can't cast connection to webhook connector")
+	}
+	return nil
+}
+
+func (node *ResponseNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *ResponseNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	requestId := msg.Header[trigwebhook.RequestIdHeader]
+	if requestId == "" {
+		node.GetLog().Error("Message wasn't produced by webhook trigger waiting for response")
+		return []model.NodeID{node.Meta().ErrorTransition}, errors.New("no webhook request to respond to")
+	}
+	response, err := node.BuildResponse(msg)
+	if err != nil {
+		node.GetLog().Error("Can't build response . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	if err = node.conn.Respond(requestId, response); err != nil {
+		node.GetLog().Error("Can't respond . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// BuildResponse generates HTTP response from template or message value
+func (node *ResponseNode) BuildResponse(msg *model.Message) (webhookconn.Response, error) {
+	response := webhookconn.Response{StatusCode: node.config.StatusCode, Headers: map[string]string{}}
+	contentType := "application/json"
+	if node.bodyTemplate != nil {
+		var bodyBuffer bytes.Buffer
+		if err := node.bodyTemplate.Execute(&bodyBuffer, TemplateParams{Variable: msg.Payload.Value, Message: msg}); err != nil {
+			return response, err
+		}
+		response.Body = bodyBuffer.Bytes()
+		contentType = "text/plain"
+	} else if str, ok := msg.Payload.Value.(string); ok {
+		response.Body = []byte(str)
+		contentType = "text/plain"
+	} else if msg.Payload.Value != nil {
+		body, err := json.Marshal(msg.Payload.Value)
+		if err != nil {
+			return response, err
+		}
+		response.Body = body
+	}
+	if node.config.ContentType != "" {
+		contentType = node.config.ContentType
+	}
+	response.Headers["Content-Type"] = contentType
+	for k, v := range node.config.Headers {
+		response.Headers[k] = v
+	}
+	return response, nil
+}
+
+func (node *ResponseNode) ValidateConfig() []model.ValidationError {
+	conf := ResponseConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.StatusCode != 0 && (conf.StatusCode < 100 || conf.StatusCode > 599) {
+		result = append(result, node.NewValidationError("Config.StatusCode", "invalid status code %d", conf.StatusCode))
+	}
+	return append(result, node.ValidateTemplate("Config.BodyTemplate", conf.BodyTemplate)...)
+}
@@ -4,18 +4,20 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/thingsplex/tpflow/connector"
 	"github.com/thingsplex/tpflow/model"
+	"sync/atomic"
 )
 
 type BaseNode struct {
-	meta              model.MetaNode
-	ctx               *model.Context
-	flowOpCtx         *model.FlowOperationalContext
-	isStartNode       bool // true - if node is first in a flow
-	isMsgReactor      bool // true - node reacts on messages and requires input stream .
-	isReactorRunning  bool
-	logFields         log.Fields
-	connectorRegistry *connector.Registry
-	flowRunner        model.FlowRunner
+	meta               model.MetaNode
+	ctx                *model.Context
+	flowOpCtx          *model.FlowOperationalContext
+	isStartNode        bool // true - if node is first in a flow
+	isMsgReactor       bool // true - node reacts on messages and requires input stream .
+	isReactorRunning   bool
+	logFields          log.Fields
+	connectorRegistry  *connector.Registry
+	flowRunner         model.FlowRunner
+	receivedMsgCounter int64 // number of messages received by trigger node
 }
 
 func (node *BaseNode) FlowRunner() model.FlowRunner {
@@ -117,3 +119,12 @@ func (node *BaseNode) Cleanup() error {
 func (node *BaseNode) SetConnectorRegistry(connectorRegistry *connector.Registry) {
 	node.connectorRegistry = connectorRegistry
 }
+
+// IncReceivedMsgCounter is invoked by trigger nodes on every message received from message bus , before filtering.
+func (node *BaseNode) IncReceivedMsgCounter() {
+	atomic.AddInt64(&node.receivedMsgCounter, 1)
+}
+
+func (node *BaseNode) GetReceivedMsgCounter() int64 {
+	return atomic.LoadInt64(&node.receivedMsgCounter)
+}
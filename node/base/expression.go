@@ -0,0 +1,28 @@
+package base
+
+import (
+	"github.com/thingsplex/tpflow/model"
+)
+
+// ExpressionParameters builds parameters of calc expressions : input - value , prop_<name> - message properties ,
+// flow , global and instance variables by name . Instance variables override global variables and global variables
+// override flow variables with the same name.
+func (node *BaseNode) ExpressionParameters(input interface{}, msg *model.Message, ctx *model.Context) map[string]interface{} {
+	parameters := make(map[string]interface{}, 8)
+	parameters["input"] = input
+	for name, value := range msg.Payload.Properties {
+		parameters["prop_"+name] = value
+	}
+	records := ctx.GetRecords(node.flowOpCtx.FlowId)
+	for i := range records {
+		parameters[records[i].Name] = records[i].Variable.Value
+	}
+	records = ctx.GetRecords("global")
+	for i := range records {
+		parameters[records[i].Name] = records[i].Variable.Value
+	}
+	for name, vrbl := range msg.Vars {
+		parameters[name] = vrbl.Value
+	}
+	return parameters
+}
@@ -0,0 +1,25 @@
+package base
+
+import (
+	"github.com/Knetic/govaluate"
+	"github.com/thingsplex/tpflow/model"
+	"text/template"
+)
+
+// AddHistoryTemplateFuncs adds variable history functions (history , avg_over , value_at , etc.) to template function map.
+// ctx can be nil if functions are only parsed (config validation).
+func (node *BaseNode) AddHistoryTemplateFuncs(funcMap template.FuncMap, ctx *model.Context) template.FuncMap {
+	for name, fn := range ctx.HistoryFunctions(node.flowOpCtx.FlowId) {
+		funcMap[name] = fn
+	}
+	return funcMap
+}
+
+// HistoryExpressionFuncs returns variable history functions for calc expressions
+func (node *BaseNode) HistoryExpressionFuncs(ctx *model.Context) map[string]govaluate.ExpressionFunction {
+	result := map[string]govaluate.ExpressionFunction{}
+	for name, fn := range ctx.HistoryFunctions(node.flowOpCtx.FlowId) {
+		result[name] = govaluate.ExpressionFunction(fn)
+	}
+	return result
+}
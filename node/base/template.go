@@ -0,0 +1,36 @@
+package base
+
+import (
+	"errors"
+	"github.com/thingsplex/tpflow/model"
+	"text/template"
+)
+
+// AddVariableTemplateFuncs adds variable and setting functions to template function map.
+// variable returns value of flow or global variable , only simple types are supported.
+func (node *BaseNode) AddVariableTemplateFuncs(funcMap template.FuncMap, ctx *model.Context) template.FuncMap {
+	funcMap["variable"] = func(varName string, isGlobal bool) (interface{}, error) {
+		flowId := node.flowOpCtx.FlowId
+		if isGlobal {
+			flowId = "global"
+		}
+		vari, err := ctx.GetVariable(varName, flowId)
+		if vari.IsNumber() {
+			return vari.ToNumber()
+		}
+		vstr, ok := vari.Value.(string)
+		if !ok {
+			node.GetLog().Debug("Only simple types are supported ")
+			return "", errors.New("Only simple types are supported ")
+		}
+		return vstr, err
+	}
+	funcMap["setting"] = func(name string) (interface{}, error) {
+		if node.flowOpCtx.FlowMeta != nil && node.flowOpCtx.FlowMeta.Settings != nil {
+			s := node.flowOpCtx.FlowMeta.Settings[name]
+			return s.String(), nil
+		}
+		return "", nil
+	}
+	return funcMap
+}
@@ -0,0 +1,65 @@
+package base
+
+import (
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"text/template"
+)
+
+// templateFuncStubs mirrors functions available in node templates , is used only for parsing.
+var templateFuncStubs = template.FuncMap{
+	"variable": func(varName string, isGlobal bool) (interface{}, error) { return nil, nil },
+	"setting":  func(name string) (interface{}, error) { return nil, nil },
+}
+
+// NewValidationError creates validation error of the node
+func (node *BaseNode) NewValidationError(field string, format string, args ...interface{}) model.ValidationError {
+	return model.ValidationError{NodeId: node.meta.Id, Field: field, Message: fmt.Sprintf(format, args...), Severity: model.ValidationSeverityError}
+}
+
+// ValidateConfigDecoding decodes node configuration into target and reports decoding error.
+func (node *BaseNode) ValidateConfigDecoding(target interface{}) []model.ValidationError {
+	if err := mapstructure.Decode(node.meta.Config, target); err != nil {
+		return []model.ValidationError{node.NewValidationError("Config", "can't decode configuration : %s", err)}
+	}
+	return nil
+}
+
+// ValidateTemplate reports template which can't be parsed.
+func (node *BaseNode) ValidateTemplate(field string, text string) []model.ValidationError {
+	if _, err := template.New(field).Funcs(templateFuncStubs).Funcs(node.AddHistoryTemplateFuncs(template.FuncMap{}, nil)).Parse(text); err != nil {
+		return []model.ValidationError{node.NewValidationError(field, "invalid template : %s", err)}
+	}
+	return nil
+}
+
+// ValidateFimpAddress checks address fields required by nodes which send or receive fimp messages.
+func (node *BaseNode) ValidateFimpAddress() []model.ValidationError {
+	var result []model.ValidationError
+	if node.meta.Address == "" {
+		result = append(result, node.NewValidationError("Address", "address is not set"))
+	}
+	if node.meta.Service == "" {
+		result = append(result, node.NewValidationError("Service", "service is not set"))
+	}
+	if node.meta.ServiceInterface == "" {
+		result = append(result, node.NewValidationError("ServiceInterface", "service interface is not set"))
+	}
+	return append(result, node.ValidateTemplate("Address", node.meta.Address)...)
+}
+
+// NodeConstructor has the same signature as constructors in node registry
+type NodeConstructor func(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node
+
+// NewConfiguredNode creates node and loads its config the same way as flow does , config is validated first if the node
+// implements ConfigValidator . Is used to execute single node , for instance by node tests.
+func NewConfiguredNode(constructor NodeConstructor, flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) (model.Node, error) {
+	node := constructor(flowOpCtx, meta, ctx)
+	if validator, ok := node.(model.ConfigValidator); ok {
+		if errs := validator.ValidateConfig(); len(errs) != 0 {
+			return nil, fmt.Errorf("config is not valid : %+v", errs)
+		}
+	}
+	return node, node.LoadNodeConfig()
+}
@@ -0,0 +1,81 @@
+package fork
+
+import (
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+)
+
+type NodeConfig struct {
+	Transitions []model.NodeID // Parallel branches . Every branch is executed concurrently together with SuccessTransition
+}
+
+// Fork node starts all success transitions concurrently within the same flow instance
+type Node struct {
+	base.BaseNode
+	ctx    *model.Context
+	config NodeConfig
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	conf := NodeConfig{}
+	err := mapstructure.Decode(node.Meta().Config, &conf)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	node.config = conf
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+// GetNextSuccessNodes returns SuccessTransition and all parallel transitions , duplicates and empty transitions are skipped.
+func (node *Node) GetNextSuccessNodes() []model.NodeID {
+	var result []model.NodeID
+	add := func(nodeId model.NodeID) {
+		if nodeId == "" {
+			return
+		}
+		for i := range result {
+			if result[i] == nodeId {
+				return
+			}
+		}
+		result = append(result, nodeId)
+	}
+	add(node.Meta().SuccessTransition)
+	for i := range node.config.Transitions {
+		add(node.config.Transitions[i])
+	}
+	return result
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	transitions := node.GetNextSuccessNodes()
+	node.GetLog().Debugf("Forking flow into %d branches", len(transitions))
+	return transitions, nil
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	return node.ValidateConfigDecoding(&node.config)
+}
+
+func (node *Node) GetConfigTransitions() map[string]model.NodeID {
+	result := map[string]model.NodeID{}
+	for i := range node.config.Transitions {
+		result[fmt.Sprintf("Config.Transitions[%d]", i)] = node.config.Transitions[i]
+	}
+	return result
+}
@@ -2,15 +2,28 @@ package ifn
 
 import (
 	"errors"
+	"fmt"
+	"github.com/Knetic/govaluate"
 	"github.com/thingsplex/tpflow/model"
 	"github.com/thingsplex/tpflow/node/base"
-	"github.com/thingsplex/tpflow/utils"
+	"reflect"
+	"regexp"
+	"sync"
 	//"github.com/mitchellh/mapstructure"
 	"github.com/mitchellh/mapstructure"
 )
 
+const (
+	ModeList = "list" // default mode , list of expressions is evaluated
+	ModeCalc = "calc" // single govaluate expression is evaluated
+
+	OperandChanged = "changed"
+)
+
 type IFExpressions struct {
+	Mode            string // list or calc , empty means list
 	Expression      []IFExpression
+	CalcExpression  string // govaluate expression , must return bool . Parameters : input - message value , prop_<name> - message properties , context and instance variables by name
 	TrueTransition  model.NodeID
 	FalseTransition model.NodeID
 }
@@ -19,16 +32,20 @@ type IFExpression struct {
 	LeftVariableName     string         // Left variable of expression . If empty , Message value will be used .
 	LeftVariableIsGlobal bool           // true - if left variable is global
 	LeftVariable         model.Variable `json:"-"` // Right variable of expression . Have to be defined , empty value will generate error .
-	RightVariable        model.Variable // Right variable of expression . Have to be defined , empty value will generate error .
-	Operand              string         // eq , gr , lt
+	RightVariable        model.Variable // Right variable of expression . Have to be defined , empty value will generate error . Not used by changed operand
+	RightVariableMax     model.Variable // Upper bound of between operand , RightVariable is lower bound
+	Operand              string         // eq , ne , gt , gte , lt , lte , contains , in , regex , between , changed
 	BooleanOperator      string         // and , or , not
 }
 
 // IF node
 type Node struct {
 	base.BaseNode
-	config IFExpressions
-	ctx    *model.Context
+	config     IFExpressions
+	ctx        *model.Context
+	expression *govaluate.EvaluableExpression
+	lastValues map[int]interface{} // last left values of expressions with changed operand
+	mtx        sync.Mutex
 }
 
 func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
@@ -36,6 +53,7 @@ func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *
 	node.SetMeta(meta)
 	node.SetFlowOpCtx(flowOpCtx)
 	node.SetupBaseNode()
+	node.lastValues = map[int]interface{}{}
 	return &node
 }
 
@@ -47,6 +65,12 @@ func (node *Node) LoadNodeConfig() error {
 	} else {
 		node.config = exp
 	}
+	if node.config.Mode == ModeCalc {
+		node.expression, err = govaluate.NewEvaluableExpressionWithFunctions(node.config.CalcExpression, node.HistoryExpressionFuncs(node.ctx))
+		if err != nil {
+			node.GetLog().Error("Can't parse calc expression", err)
+		}
+	}
 	return nil
 }
 
@@ -55,15 +79,30 @@ func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
 }
 
 func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
-	var leftNumericValue, rightNumericValue float64
+	var finalResult bool
+	var err error
+	if node.config.Mode == ModeCalc {
+		finalResult, err = node.evaluateCalcExpression(msg)
+	} else {
+		finalResult, err = node.evaluateExpressionList(msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if finalResult {
+		return []model.NodeID{node.config.TrueTransition}, nil
+	}
+	return []model.NodeID{node.config.FalseTransition}, nil
+}
+
+func (node *Node) evaluateExpressionList(msg *model.Message) (bool, error) {
 	var err error
 	conf := node.config
 	booleanOperator := ""
 	var finalResult bool
 	for i := range conf.Expression {
-
-		if conf.Expression[i].RightVariable.ValueType == "" {
-			return nil, errors.New(node.FlowOpCtx().FlowId + "Right variable is not defined. Node is skipped.")
+		if conf.Expression[i].RightVariable.ValueType == "" && conf.Expression[i].Operand != OperandChanged {
+			return false, errors.New(node.FlowOpCtx().FlowId + "Right variable is not defined. Node is skipped.")
 		}
 		if conf.Expression[i].LeftVariableName == "" {
 			conf.Expression[i].LeftVariable = model.Variable{ValueType: msg.Payload.ValueType, Value: msg.Payload.Value}
@@ -75,49 +114,21 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 			conf.Expression[i].LeftVariable, err = node.ctx.GetVariable(conf.Expression[i].LeftVariableName, flowId)
 			if err != nil {
 				node.GetLog().Error("Can't get variable from context.Error : ", err)
-				return nil, err
-			}
-		}
-		if conf.Expression[i].LeftVariable.ValueType != conf.Expression[i].RightVariable.ValueType {
-			if !utils.IsNumber(conf.Expression[i].LeftVariable.ValueType)  &&  !utils.IsNumber(conf.Expression[i].LeftVariable.ValueType) {
-				return nil, errors.New(node.FlowOpCtx().FlowId + "<Node> Right and left of expression have different types ")
+				return false, err
 			}
 		}
 
 		var result bool
-		if conf.Expression[i].Operand == "gt" || conf.Expression[i].Operand == "lt" || (conf.Expression[i].Operand == "eq" && utils.IsNumber(conf.Expression[i].LeftVariable.ValueType) ){
-			if conf.Expression[i].LeftVariable.ValueType == "int" || conf.Expression[i].LeftVariable.ValueType == "float" {
-				leftNumericValue, err = utils.ConfigValueToNumber(conf.Expression[i].LeftVariable.ValueType, conf.Expression[i].LeftVariable.Value)
-				if err != nil {
-					node.GetLog().Error("Error while converting left variable to number.Error : ", err)
-					return nil, err
-				}
-				rightNumericValue, err = utils.ConfigValueToNumber(conf.Expression[i].RightVariable.ValueType, conf.Expression[i].RightVariable.Value)
-				if err != nil {
-					node.GetLog().Error("Error while converting right variable to number.Error : ", err)
-					return nil, err
-				}
-
-			} else {
-				return nil, errors.New("incompatible value types . gt and lt can be used only with numeric types")
-			}
-		}else {
-			//node.GetLog().Debug("Not a number ")
-		}
-		//node.GetLog().Debug(" Left numeric value = ", leftNumericValue)
-		//node.GetLog().Debug(" Right numeric value = ", rightNumericValue)
-		switch conf.Expression[i].Operand {
-		case "eq":
-			if utils.IsNumber(conf.Expression[i].LeftVariable.ValueType) {
-				result = leftNumericValue == rightNumericValue
-			}else {
-				result = conf.Expression[i].LeftVariable.Value == conf.Expression[i].RightVariable.Value
+		if conf.Expression[i].Operand == OperandChanged {
+			result = node.isValueChanged(i, conf.Expression[i].LeftVariable.Value)
+		} else {
+			result, err = model.CompareVariables(conf.Expression[i].Operand, conf.Expression[i].LeftVariable, conf.Expression[i].RightVariable, conf.Expression[i].RightVariableMax)
+			if err != nil {
+				node.GetLog().Error("Expression can't be evaluated.Error : ", err)
+				return false, err
 			}
-		case "gt":
-			result = leftNumericValue > rightNumericValue
-		case "lt":
-			result = leftNumericValue < rightNumericValue
 		}
+
 		if len(conf.Expression) > 1 {
 			if i > 0 {
 				// boolean operator between current and previous element
@@ -142,12 +153,75 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 			finalResult = result
 		}
 	}
-	if finalResult {
-		return []model.NodeID{conf.TrueTransition}, nil
-	} else {
-		return []model.NodeID{conf.FalseTransition}, nil
+	return finalResult, nil
+}
+
+// isValueChanged compares value with value from previous execution . The first value is always reported as changed.
+func (node *Node) isValueChanged(expressionIndex int, value interface{}) bool {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	lastValue, ok := node.lastValues[expressionIndex]
+	node.lastValues[expressionIndex] = value
+	return !ok || !reflect.DeepEqual(lastValue, value)
+}
+
+func (node *Node) evaluateCalcExpression(msg *model.Message) (bool, error) {
+	if node.expression == nil {
+		return false, errors.New("calc expression is not valid")
+	}
+	parameters := node.ExpressionParameters(msg.Payload.Value, msg, node.ctx)
+	r, err := node.expression.Evaluate(parameters)
+	if err != nil {
+		return false, err
 	}
-	return nil, nil
+	result, ok := r.(bool)
+	if !ok {
+		return false, fmt.Errorf("calc expression returned %v , bool expected", r)
+	}
+	return result, nil
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	result := node.ValidateConfigDecoding(&node.config)
+	if result != nil {
+		return result
+	}
+	switch node.config.Mode {
+	case ModeCalc:
+		if _, err := govaluate.NewEvaluableExpressionWithFunctions(node.config.CalcExpression, node.HistoryExpressionFuncs(nil)); err != nil {
+			result = append(result, node.NewValidationError("Config.CalcExpression", "invalid expression : %s", err))
+		}
+	case "", ModeList:
+		if len(node.config.Expression) == 0 {
+			result = append(result, node.NewValidationError("Config.Expression", "node has no expressions"))
+		}
+		for i, exp := range node.config.Expression {
+			field := fmt.Sprintf("Config.Expression[%d]", i)
+			if exp.Operand == OperandChanged {
+				continue
+			}
+			if !model.IsCompareOperandSupported(exp.Operand) {
+				result = append(result, node.NewValidationError(field+".Operand", "unsupported operand %s", exp.Operand))
+				continue
+			}
+			if exp.RightVariable.ValueType == "" {
+				result = append(result, node.NewValidationError(field+".RightVariable", "right variable is not defined"))
+			}
+			if exp.Operand == model.OperandBetween && exp.RightVariableMax.ValueType == "" {
+				result = append(result, node.NewValidationError(field+".RightVariableMax", "upper bound is not defined"))
+			}
+			if pattern, ok := exp.RightVariable.Value.(string); ok && exp.Operand == model.OperandRegex {
+				if _, err := regexp.Compile(pattern); err != nil {
+					result = append(result, node.NewValidationError(field+".RightVariable", "invalid regular expression : %s", err))
+				}
+			}
+		}
+	default:
+		result = append(result, node.NewValidationError("Config.Mode", "unknown mode %s", node.config.Mode))
+	}
+	return result
+}
 
-	return []model.NodeID{node.Meta().SuccessTransition}, nil
+func (node *Node) GetConfigTransitions() map[string]model.NodeID {
+	return map[string]model.NodeID{"Config.TrueTransition": node.config.TrueTransition, "Config.FalseTransition": node.config.FalseTransition}
 }
@@ -0,0 +1,115 @@
+package ifn
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"os"
+	"testing"
+)
+
+func newIfNode(t *testing.T, ctx *model.Context, config IFExpressions) *Node {
+	config.TrueTransition = "true"
+	config.FalseTransition = "false"
+	meta := model.MetaNode{Id: "1", Type: "if", Label: "If", Config: config}
+	node, err := base.NewConfiguredNode(NewNode, &model.FlowOperationalContext{FlowId: "IfTest"}, meta, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*Node)
+}
+
+func TestIfNode_Operands(t *testing.T) {
+	num := func(v float64) model.Variable { return model.Variable{ValueType: "float", Value: v} }
+	str := func(v string) model.Variable { return model.Variable{ValueType: "string", Value: v} }
+	tests := []struct {
+		name     string
+		msg      *fimpgo.FimpMessage
+		exp      IFExpression
+		expected model.NodeID
+	}{
+		{"ne", fimpgo.NewIntMessage("evt.sensor.report", "temp", 21, nil, nil, nil), IFExpression{Operand: "ne", RightVariable: num(21)}, "false"},
+		{"gte", fimpgo.NewIntMessage("evt.sensor.report", "temp", 21, nil, nil, nil), IFExpression{Operand: "gte", RightVariable: num(21)}, "true"},
+		{"lte", fimpgo.NewFloatMessage("evt.sensor.report", "temp", 21.5, nil, nil, nil), IFExpression{Operand: "lte", RightVariable: num(21)}, "false"},
+		{"between", fimpgo.NewIntMessage("evt.sensor.report", "temp", 22, nil, nil, nil), IFExpression{Operand: "between", RightVariable: num(20), RightVariableMax: num(25)}, "true"},
+		{"between_out", fimpgo.NewIntMessage("evt.sensor.report", "temp", 26, nil, nil, nil), IFExpression{Operand: "between", RightVariable: num(20), RightVariableMax: num(25)}, "false"},
+		{"contains", fimpgo.NewStringMessage("evt.mode.report", "mode", "vacation_home", nil, nil, nil), IFExpression{Operand: "contains", RightVariable: str("home")}, "true"},
+		{"in", fimpgo.NewStringMessage("evt.mode.report", "mode", "away", nil, nil, nil), IFExpression{Operand: "in", RightVariable: model.Variable{ValueType: "str_array", Value: []interface{}{"home", "away"}}}, "true"},
+		{"in_numbers", fimpgo.NewIntMessage("evt.scene.report", "scene", 3, nil, nil, nil), IFExpression{Operand: "in", RightVariable: model.Variable{ValueType: "int_array", Value: []interface{}{1.0, 2.0}}}, "false"},
+		{"regex", fimpgo.NewStringMessage("evt.mode.report", "mode", "sleep_1", nil, nil, nil), IFExpression{Operand: "regex", RightVariable: str("^sleep_[0-9]+$")}, "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newIfNode(t, nil, IFExpressions{Expression: []IFExpression{tt.exp}})
+			if errs := node.ValidateConfig(); len(errs) != 0 {
+				t.Fatal("Config is not valid ", errs)
+			}
+			transitions, err := node.OnInput(&model.Message{Payload: *tt.msg})
+			if err != nil || transitions[0] != tt.expected {
+				t.Error("Wrong transition ", transitions, err)
+			}
+		})
+	}
+}
+
+func TestIfNode_Changed(t *testing.T) {
+	node := newIfNode(t, nil, IFExpressions{Expression: []IFExpression{{Operand: "changed"}}})
+	for i, value := range []int64{1, 1, 2} {
+		transitions, _ := node.OnInput(&model.Message{Payload: *fimpgo.NewIntMessage("evt.sensor.report", "temp", value, nil, nil, nil)})
+		expected := model.NodeID("true")
+		if i == 1 {
+			expected = "false"
+		}
+		if transitions[0] != expected {
+			t.Errorf("Wrong transition %s for value %d", transitions[0], i)
+		}
+	}
+}
+
+func TestIfNode_CalcMode(t *testing.T) {
+	ctx, err := model.NewContextDB("IfTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("IfTest.db")
+	defer ctx.Close()
+	ctx.RegisterFlow("IfTest")
+	ctx.SetVariable("max_temp", "int", int64(25), "", "global", true)
+
+	node := newIfNode(t, ctx, IFExpressions{Mode: "calc", CalcExpression: "input >= 20 && input <= max_temp && prop_unit == 'C'"})
+	msg := model.Message{Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "temp", 22.5, fimpgo.Props{"unit": "C"}, nil, nil)}
+	if transitions, err := node.OnInput(&msg); err != nil || transitions[0] != "true" {
+		t.Error("Wrong transition ", transitions, err)
+	}
+	msg.Payload.Value = 26.0
+	if transitions, err := node.OnInput(&msg); err != nil || transitions[0] != "false" {
+		t.Error("Wrong transition ", transitions, err)
+	}
+
+	node = newIfNode(t, ctx, IFExpressions{Mode: "calc", CalcExpression: "input + 1"})
+	if _, err := node.OnInput(&msg); err == nil {
+		t.Error("Non bool result must be reported as error")
+	}
+}
+
+func TestIfNode_CalcHistoryFunctions(t *testing.T) {
+	ctx, err := model.NewContextDB("IfHistoryTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("IfHistoryTest.db")
+	defer ctx.Close()
+	ctx.SetHistoryPolicy("global", "temp", model.HistoryPolicy{MaxAge: 3600})
+	for _, v := range []float64{20, 22, 24} {
+		ctx.SetVariable("temp", "float", v, "", "global", false)
+	}
+
+	node := newIfNode(t, ctx, IFExpressions{Mode: "calc", CalcExpression: "input > avg_over('temp', '1h') && count_over('temp', '1h') == 3"})
+	if errs := node.ValidateConfig(); len(errs) != 0 {
+		t.Fatal("Config is not valid ", errs)
+	}
+	msg := model.Message{Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "temp", 23, nil, nil, nil)}
+	if transitions, err := node.OnInput(&msg); err != nil || transitions[0] != "true" {
+		t.Error("Wrong transition ", transitions, err)
+	}
+}
@@ -113,3 +113,8 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	}
 	return []model.NodeID{node.Meta().ErrorTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := TExpressions{}
+	return node.ValidateConfigDecoding(&conf)
+}
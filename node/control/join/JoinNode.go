@@ -0,0 +1,180 @@
+package join
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"sync"
+	"time"
+)
+
+type NodeConfig struct {
+	NumberOfBranches int   // Number of branches the node waits for before continuing , 0 - all branches of the fork
+	Timeout          int64 // in seconds , 0 - no timeout . On timeout the flow continues via TimeoutTransition
+}
+
+type groupKey struct {
+	instanceId int32
+	forkId     int64
+}
+
+// branchGroup holds join state of branches started by single fork execution
+type branchGroup struct {
+	arrived     int
+	ended       int // branches which ended without reaching the node
+	required    int
+	size        int
+	isCompleted bool
+	done        chan joinResult
+}
+
+type joinResult struct {
+	msg       model.Message
+	isPartial bool // remaining branches ended , required number of branches can't be reached
+}
+
+// Join node waits for all (or N of M) parallel branches started by the same fork execution and continues as single branch.
+// First arrived branch holds the instance , all other branches are terminated by the node . If remaining branches end
+// without reaching the node , holding branch continues via TimeoutTransition.
+type Node struct {
+	base.BaseNode
+	ctx    *model.Context
+	config NodeConfig
+	groups map[groupKey]*branchGroup
+	mtx    sync.Mutex
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	node.groups = map[groupKey]*branchGroup{}
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	conf := NodeConfig{}
+	err := mapstructure.Decode(node.Meta().Config, &conf)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	node.config = conf
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+// OnInput is used only if the node is executed outside of flow runner , in that case there is nothing to join.
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// getGroup returns join state of the group , must be called under lock
+func (node *Node) getGroup(group model.BranchGroup) *branchGroup {
+	key := groupKey{instanceId: group.InstanceId, forkId: group.ForkId}
+	state, ok := node.groups[key]
+	if !ok {
+		required := node.config.NumberOfBranches
+		if required <= 0 || required > group.Size {
+			required = group.Size
+		}
+		state = &branchGroup{required: required, size: group.Size, done: make(chan joinResult, 1)}
+		node.groups[key] = state
+	}
+	return state
+}
+
+func (node *Node) JoinBranch(group model.BranchGroup, msg *model.Message) ([]model.NodeID, error) {
+	node.mtx.Lock()
+	state := node.getGroup(group)
+	state.arrived++
+	if state.arrived > 1 {
+		// Branch is merged into the branch which holds the instance
+		if !state.isCompleted && state.arrived >= state.required {
+			state.isCompleted = true
+			state.done <- joinResult{msg: msg.Clone()}
+		}
+		node.mtx.Unlock()
+		node.GetLog().Debugf("Branch %d of %d joined", state.arrived, state.required)
+		return nil, nil
+	}
+	if state.required <= 1 {
+		state.isCompleted = true
+		node.mtx.Unlock()
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	}
+	if state.arrived+state.ended >= state.size {
+		state.isCompleted = true
+		node.mtx.Unlock()
+		node.GetLog().Debug("Other branches ended without reaching the node")
+		return []model.NodeID{node.Meta().TimeoutTransition}, nil
+	}
+	node.mtx.Unlock()
+
+	node.GetLog().Debugf("Waiting for %d branches", state.required)
+	timer := time.NewTimer(time.Hour * 24)
+	if node.config.Timeout > 0 {
+		timer.Reset(time.Second * time.Duration(node.config.Timeout))
+	} else {
+		timer.Stop()
+	}
+	defer timer.Stop()
+	select {
+	case result := <-state.done:
+		if result.isPartial {
+			node.GetLog().Debug("Other branches ended without reaching the node")
+			return []model.NodeID{node.Meta().TimeoutTransition}, nil
+		}
+		*msg = result.msg
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	case <-timer.C:
+		node.mtx.Lock()
+		state.isCompleted = true
+		node.mtx.Unlock()
+		node.GetLog().Debug("Timeout while waiting for branches")
+		return []model.NodeID{node.Meta().TimeoutTransition}, nil
+	case signal := <-node.FlowOpCtx().NodeControlSignalChannel:
+		node.mtx.Lock()
+		state.isCompleted = true
+		node.mtx.Unlock()
+		node.GetLog().Debug("Control signal ", signal)
+		return nil, nil
+	case <-msg.Done:
+		node.mtx.Lock()
+		state.isCompleted = true
+		node.mtx.Unlock()
+		node.GetLog().Debug("Instance is canceled")
+		return nil, nil
+	}
+}
+
+// BranchEnded releases holding branch if required number of branches can't be reached anymore
+func (node *Node) BranchEnded(group model.BranchGroup) {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	state := node.getGroup(group)
+	state.ended++
+	if !state.isCompleted && state.arrived > 0 && state.arrived < state.required && state.arrived+state.ended >= state.size {
+		state.isCompleted = true
+		state.done <- joinResult{isPartial: true}
+	}
+}
+
+func (node *Node) ReleaseInstance(instanceId int32) {
+	node.mtx.Lock()
+	for key := range node.groups {
+		if key.instanceId == instanceId {
+			delete(node.groups, key)
+		}
+	}
+	node.mtx.Unlock()
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
@@ -73,3 +73,8 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	}
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
@@ -0,0 +1,329 @@
+package msgfilter
+
+import (
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	ModeDebounce = "debounce" // message is passed only after no other message arrived within interval , the last message wins
+	ModeThrottle = "throttle" // at most one message per interval is passed , message passed at the end of interval is the newest one
+	ModeDedup    = "dedup"    // repeated value or message uuid within interval is dropped
+	ModeDeadband = "deadband" // numeric value is passed only if it differs from the last passed value by more than threshold
+
+	DedupByValue = "value"
+	DedupByUuid  = "uuid"
+)
+
+// Idle source state is removed after the period , deadband keeps last value longer since it doesn't depend on interval
+const (
+	evictionInterval      = time.Minute
+	deadbandSourceIdleTTL = 24 * time.Hour
+)
+
+// Node filters chattering messages . State is kept per source address , so one node can be used with wildcard trigger.
+// Passed messages take success transition , dropped messages take error transition without error.
+// Debounce and throttle modes don't hold the instance . Delayed message ends current instance , per source timer starts
+// new flow instance from success transition when the message is released.
+type Node struct {
+	base.BaseNode
+	ctx         *model.Context
+	config      NodeConfig
+	sources     map[string]*sourceState
+	lastEvicted time.Time
+	mtx         sync.Mutex
+}
+
+type NodeConfig struct {
+	Mode      string  // debounce , throttle , dedup , deadband
+	Interval  int     // Debounce quiet period , throttle period or dedup window in milliseconds
+	DedupBy   string  // value (default) , uuid
+	Threshold float64 // Deadband threshold , absolute change of numeric value
+}
+
+// sourceState - filter state of single source address
+type sourceState struct {
+	lastSeenAt   time.Time
+	lastPassedAt time.Time
+	lastValue    interface{}
+	hasValue     bool
+	latestMsg    *model.Message // debounce and throttle - the newest message waiting for release
+	timer        *time.Timer    // debounce and throttle - releases the newest message
+	timerSeq     int64          // sequence number of the latest started timer
+	expiresAt    time.Time
+	uuids        map[string]time.Time
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.sources = map[string]*sourceState{}
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	if node.config.DedupBy == "" {
+		node.config.DedupBy = DedupByValue
+	}
+	return nil
+}
+
+// Cleanup stops timers , delayed messages are dropped
+func (node *Node) Cleanup() error {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	for addr, source := range node.sources {
+		if source.timer != nil {
+			source.timer.Stop()
+		}
+		delete(node.sources, addr)
+	}
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	var isPassed bool
+	var err error
+	switch node.config.Mode {
+	case ModeDebounce:
+		node.debounce(msg)
+		return nil, nil
+	case ModeThrottle:
+		if isPassed = node.throttle(msg); !isPassed {
+			return nil, nil
+		}
+	case ModeDedup:
+		isPassed = node.dedup(msg)
+	case ModeDeadband:
+		isPassed, err = node.deadband(msg)
+	default:
+		err = fmt.Errorf("unknown mode %s", node.config.Mode)
+	}
+	if err != nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	if isPassed {
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	}
+	node.GetLog().Debug("Message is dropped by filter , source = ", msg.AddressStr)
+	return []model.NodeID{node.Meta().ErrorTransition}, nil
+}
+
+func (node *Node) interval() time.Duration {
+	return time.Duration(node.config.Interval) * time.Millisecond
+}
+
+// getSource returns state of message source , must be called under lock
+func (node *Node) getSource(msg *model.Message) *sourceState {
+	now := time.Now()
+	if now.Sub(node.lastEvicted) >= evictionInterval {
+		node.evictIdleSources(now)
+	}
+	source, ok := node.sources[msg.AddressStr]
+	if !ok {
+		source = &sourceState{}
+		node.sources[msg.AddressStr] = source
+	}
+	source.lastSeenAt = now
+	return source
+}
+
+// evictIdleSources removes state of sources which don't affect filtering anymore , must be called under lock
+func (node *Node) evictIdleSources(now time.Time) {
+	node.lastEvicted = now
+	ttl := node.interval()
+	if node.config.Mode == ModeDeadband {
+		ttl = deadbandSourceIdleTTL
+	}
+	for addr, source := range node.sources {
+		if source.timer == nil && now.Sub(source.lastSeenAt) > ttl {
+			delete(node.sources, addr)
+		}
+	}
+}
+
+// debounce restarts source timer , the latest message is released when no other message arrived within interval
+func (node *Node) debounce(msg *model.Message) {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	source := node.getSource(msg)
+	node.startTimer(msg.AddressStr, source, msg, node.interval())
+}
+
+// throttle passes message if interval since the last passed message elapsed , otherwise message replaces waiting one ,
+// which is released at the end of interval
+func (node *Node) throttle(msg *model.Message) bool {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	source := node.getSource(msg)
+	now := time.Now()
+	if source.timer == nil && now.Sub(source.lastPassedAt) >= node.interval() {
+		source.lastPassedAt = now
+		return true
+	}
+	if source.timer != nil {
+		// Running timer will release this message
+		latest := msg.Clone()
+		source.latestMsg = &latest
+		return false
+	}
+	node.startTimer(msg.AddressStr, source, msg, source.lastPassedAt.Add(node.interval()).Sub(now))
+	return false
+}
+
+// startTimer (re)starts release timer of the source , must be called under lock
+func (node *Node) startTimer(addr string, source *sourceState, msg *model.Message, delay time.Duration) {
+	if source.timer != nil {
+		source.timer.Stop()
+	}
+	latest := msg.Clone()
+	source.latestMsg = &latest
+	source.expiresAt = time.Now().Add(delay)
+	source.timerSeq++
+	seq := source.timerSeq
+	source.timer = time.AfterFunc(delay, func() {
+		node.onTimer(addr, source, seq)
+	})
+}
+
+// onTimer releases the latest message of the source by starting new flow instance
+func (node *Node) onTimer(addr string, source *sourceState, seq int64) {
+	node.mtx.Lock()
+	if source.timer == nil || source.timerSeq != seq || node.sources[addr] != source {
+		// Timer was restarted or node was stopped while release was in progress
+		node.mtx.Unlock()
+		return
+	}
+	source.timer = nil
+	source.expiresAt = time.Time{}
+	msg := source.latestMsg
+	source.latestMsg = nil
+	source.lastPassedAt = time.Now()
+	node.mtx.Unlock()
+	if msg == nil || node.FlowRunner() == nil {
+		return
+	}
+	node.GetLog().Debug("Message is released by filter , source = ", addr)
+	node.FlowRunner()(model.ReactorEvent{Msg: *msg, TransitionNodeId: node.Meta().SuccessTransition, SrcNodeId: node.Meta().Id})
+}
+
+// GetPendingTimers returns release timers of debounce and throttle modes
+func (node *Node) GetPendingTimers() []model.PendingTimer {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	var result []model.PendingTimer
+	for _, source := range node.sources {
+		if source.timer != nil {
+			result = append(result, model.PendingTimer{NodeId: node.Meta().Id, NodeLabel: node.Meta().Label, ExpiresAt: source.expiresAt})
+		}
+	}
+	return result
+}
+
+func (node *Node) dedup(msg *model.Message) bool {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	source := node.getSource(msg)
+	now := time.Now()
+	if node.config.DedupBy == DedupByUuid {
+		if msg.Payload.UID == "" {
+			return true
+		}
+		if source.uuids == nil {
+			source.uuids = map[string]time.Time{}
+		}
+		for uid, seenAt := range source.uuids {
+			if now.Sub(seenAt) >= node.interval() {
+				delete(source.uuids, uid)
+			}
+		}
+		if _, ok := source.uuids[msg.Payload.UID]; ok {
+			return false
+		}
+		source.uuids[msg.Payload.UID] = now
+		return true
+	}
+	if source.hasValue && now.Sub(source.lastPassedAt) < node.interval() && reflect.DeepEqual(source.lastValue, msg.Payload.Value) {
+		return false
+	}
+	source.lastValue = msg.Payload.Value
+	source.hasValue = true
+	source.lastPassedAt = now
+	return true
+}
+
+func (node *Node) deadband(msg *model.Message) (bool, error) {
+	value, ok := toFloat(msg.Payload.Value)
+	if !ok {
+		return false, fmt.Errorf("deadband mode supports only numeric values , value type = %s", msg.Payload.ValueType)
+	}
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	source := node.getSource(msg)
+	if source.hasValue && math.Abs(value-source.lastValue.(float64)) <= node.config.Threshold {
+		return false, nil
+	}
+	source.lastValue = value
+	source.hasValue = true
+	source.lastPassedAt = time.Now()
+	return true, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	switch conf.Mode {
+	case ModeDebounce, ModeThrottle, ModeDedup:
+		if conf.Interval <= 0 {
+			result = append(result, node.NewValidationError("Config.Interval", "interval must be greater than 0"))
+		}
+	case ModeDeadband:
+		if conf.Threshold < 0 {
+			result = append(result, node.NewValidationError("Config.Threshold", "threshold can't be negative"))
+		}
+	default:
+		result = append(result, node.NewValidationError("Config.Mode", "unknown mode %s", conf.Mode))
+	}
+	switch conf.DedupBy {
+	case "", DedupByValue, DedupByUuid:
+	default:
+		result = append(result, node.NewValidationError("Config.DedupBy", "unknown dedup key %s", conf.DedupBy))
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package msgfilter
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newFilterNode(t *testing.T, config NodeConfig) *Node {
+	meta := model.MetaNode{Id: "1", Type: "msg_filter", Label: "Filter", Config: config, SuccessTransition: "pass", ErrorTransition: "drop"}
+	flowOpCtx := &model.FlowOperationalContext{FlowId: "MsgFilterTest", NodeControlSignalChannel: make(chan int)}
+	node, err := base.NewConfiguredNode(NewNode, flowOpCtx, meta, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*Node)
+}
+
+func newMsg(addr string, value float64) *model.Message {
+	return &model.Message{AddressStr: addr, Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", value, nil, nil, nil)}
+}
+
+func isPassed(t *testing.T, node *Node, msg *model.Message) bool {
+	transitions, err := node.OnInput(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transitions[0] == "pass"
+}
+
+// sendAndCollect sends messages with small delay between them and returns values of messages which passed immediately
+// or were released by timer
+func sendAndCollect(t *testing.T, node *Node, values []float64, wait time.Duration) []float64 {
+	var passed []float64
+	var mtx sync.Mutex
+	node.SetFlowRunner(func(event model.ReactorEvent) {
+		if event.TransitionNodeId != "pass" {
+			t.Error("Released message must take success transition")
+		}
+		mtx.Lock()
+		passed = append(passed, event.Msg.Payload.Value.(float64))
+		mtx.Unlock()
+	})
+	for _, v := range values {
+		msg := newMsg("pt:j1/mt:evt/rt:dev/rn:zw/ad:1/sv:sensor_temp/ad:2_0", v)
+		transitions, err := node.OnInput(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transitions) > 0 && transitions[0] == "pass" {
+			mtx.Lock()
+			passed = append(passed, v)
+			mtx.Unlock()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(wait)
+	mtx.Lock()
+	defer mtx.Unlock()
+	return passed
+}
+
+func TestNode_Debounce(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeDebounce, Interval: 100})
+	passed := sendAndCollect(t, node, []float64{1, 2, 3}, 150*time.Millisecond)
+	if len(passed) != 1 || passed[0] != 3 {
+		t.Error("Only the last message must pass , passed = ", passed)
+	}
+	if len(node.GetPendingTimers()) != 0 {
+		t.Error("Timer must be released")
+	}
+}
+
+func TestNode_Throttle(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeThrottle, Interval: 100})
+	passed := sendAndCollect(t, node, []float64{1, 2, 3}, 150*time.Millisecond)
+	if len(passed) != 2 || passed[0] != 1 || passed[1] != 3 {
+		t.Error("The first and the latest messages must pass , passed = ", passed)
+	}
+}
+
+func TestNode_CleanupAndEviction(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeDebounce, Interval: 50})
+	released := false
+	node.SetFlowRunner(func(event model.ReactorEvent) { released = true })
+	node.OnInput(newMsg("a", 1))
+	if len(node.GetPendingTimers()) != 1 {
+		t.Fatal("Timer must be started")
+	}
+	node.Cleanup()
+	time.Sleep(100 * time.Millisecond)
+	if released || len(node.sources) != 0 {
+		t.Error("Timers must be stopped on cleanup")
+	}
+
+	node = newFilterNode(t, NodeConfig{Mode: ModeDedup, Interval: 10})
+	isPassed(t, node, newMsg("a", 1))
+	time.Sleep(20 * time.Millisecond)
+	node.lastEvicted = time.Time{}
+	isPassed(t, node, newMsg("b", 1))
+	if _, ok := node.sources["a"]; ok || len(node.sources) != 1 {
+		t.Error("Idle source wasn't evicted")
+	}
+}
+
+func TestNode_DedupByValue(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeDedup, Interval: 1000})
+	expected := []bool{true, false, true, true}
+	for i, v := range []float64{1, 1, 2, 1} {
+		if isPassed(t, node, newMsg("a", v)) != expected[i] {
+			t.Error("Wrong result at position ", i)
+		}
+	}
+	if !isPassed(t, node, newMsg("b", 1)) {
+		t.Error("Sources must be filtered independently")
+	}
+}
+
+func TestNode_DedupByUuid(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeDedup, DedupBy: DedupByUuid, Interval: 50})
+	msg := newMsg("a", 1)
+	if !isPassed(t, node, msg) || isPassed(t, node, msg) {
+		t.Error("Repeated uuid must be dropped")
+	}
+	if !isPassed(t, node, newMsg("a", 1)) {
+		t.Error("New uuid must pass")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !isPassed(t, node, msg) {
+		t.Error("Uuid must pass after window expired")
+	}
+}
+
+func TestNode_Deadband(t *testing.T) {
+	node := newFilterNode(t, NodeConfig{Mode: ModeDeadband, Threshold: 0.5})
+	expected := []bool{true, false, false, true, false}
+	for i, v := range []float64{20, 20.3, 19.6, 20.6, 20.2} {
+		if isPassed(t, node, newMsg("a", v)) != expected[i] {
+			t.Error("Wrong result at position ", i)
+		}
+	}
+	_, err := node.OnInput(&model.Message{Payload: *fimpgo.NewStringMessage("evt.mode.report", "mode", "home", nil, nil, nil)})
+	if err == nil {
+		t.Error("Non numeric value must fail")
+	}
+}
+
+func TestNode_ValidateConfig(t *testing.T) {
+	meta := model.MetaNode{Id: "1", Type: "msg_filter", Config: NodeConfig{Mode: ModeThrottle}}
+	node := NewNode(&model.FlowOperationalContext{}, meta, nil).(*Node)
+	if len(node.ValidateConfig()) != 1 {
+		t.Error("Missing interval must be reported")
+	}
+}
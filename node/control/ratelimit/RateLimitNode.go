@@ -62,3 +62,8 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	node.GetLog().Debug("Request skipped by rate limiter.")
 	return []model.NodeID{node.Meta().ErrorTransition}, nil
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
@@ -0,0 +1,148 @@
+package subflow
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"time"
+)
+
+type NodeConfig struct {
+	FlowId          string           // Id of the flow which is invoked . The flow must start with subflow_trigger node
+	Timeout         int64            // in seconds , default is 30 seconds
+	InputVariables  []InputVariable  // Variables passed to the sub-flow
+	OutputVariables []OutputVariable // Instance variables of the sub-flow copied back into current flow
+	UpdateInputMsg  bool             // true - message returned by the sub-flow replaces input message
+}
+
+type InputVariable struct {
+	Name               string // Variable name within the sub-flow
+	SourceVariableName string // Variable from current flow , if empty Value is used
+	IsSourceGlobal     bool
+	IsSourceInstance   bool           // true - source is instance variable of current flow instance
+	Value              model.Variable // Constant value
+}
+
+type OutputVariable struct {
+	Name               string // Instance variable name within the sub-flow
+	TargetVariableName string // Variable name in current flow , if empty Name is used
+	IsTargetGlobal     bool
+	IsTargetInMemory   bool
+	IsTargetInstance   bool // true - value is stored as instance variable of current flow instance
+}
+
+// Subflow node invokes another flow synchronously and continues via SuccessTransition or ErrorTransition
+type Node struct {
+	base.BaseNode
+	ctx    *model.Context
+	config NodeConfig
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	conf := NodeConfig{}
+	err := mapstructure.Decode(node.Meta().Config, &conf)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 30
+	}
+	node.config = conf
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	node.GetLog().Debug("Invoking sub-flow ", node.config.FlowId)
+	invoker := node.FlowOpCtx().SubflowInvoker
+	if invoker == nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, errors.New("sub-flow invoker is not configured")
+	}
+	inVars := map[string]model.Variable{}
+	for _, v := range node.config.InputVariables {
+		if v.SourceVariableName == "" {
+			inVars[v.Name] = v.Value
+			continue
+		}
+		if v.IsSourceInstance {
+			variable, ok := msg.Vars[v.SourceVariableName]
+			if !ok {
+				node.GetLog().Errorf("Instance variable %s doesn't exist", v.SourceVariableName)
+				return []model.NodeID{node.Meta().ErrorTransition}, fmt.Errorf("instance variable %s doesn't exist", v.SourceVariableName)
+			}
+			inVars[v.Name] = variable
+			continue
+		}
+		flowId := node.FlowOpCtx().FlowId
+		if v.IsSourceGlobal {
+			flowId = "global"
+		}
+		variable, err := node.ctx.GetVariable(v.SourceVariableName, flowId)
+		if err != nil {
+			node.GetLog().Errorf("Can't get input variable %s . Err: %s", v.SourceVariableName, err)
+			return []model.NodeID{node.Meta().ErrorTransition}, err
+		}
+		inVars[v.Name] = variable
+	}
+
+	// Call chain is used by the invoked flow to reject recursive calls , including indirect ones (A -> B -> A)
+	callMsg := msg.Clone()
+	callMsg.Vars = nil
+	callMsg.CallChain = append(callMsg.CallChain, node.FlowOpCtx().FlowId)
+	outMsg, outVars, err := invoker(node.config.FlowId, callMsg, inVars, time.Second*time.Duration(node.config.Timeout))
+	if err != nil {
+		node.GetLog().Error("Sub-flow failed . Err:", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+
+	for _, v := range node.config.OutputVariables {
+		variable, ok := outVars[v.Name]
+		if !ok {
+			node.GetLog().Warnf("Sub-flow didn't return variable %s", v.Name)
+			continue
+		}
+		targetName := v.TargetVariableName
+		if targetName == "" {
+			targetName = v.Name
+		}
+		if v.IsTargetInstance {
+			msg.SetVar(targetName, variable)
+			continue
+		}
+		flowId := node.FlowOpCtx().FlowId
+		if v.IsTargetGlobal {
+			flowId = "global"
+		}
+		if err := node.ctx.SetVariable(targetName, variable.ValueType, variable.Value, "", flowId, v.IsTargetInMemory); err != nil {
+			node.GetLog().Errorf("Can't save output variable %s . Err: %s", targetName, err)
+		}
+	}
+	if node.config.UpdateInputMsg {
+		outMsg.KeepInstanceScope(msg)
+		*msg = outMsg
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result == nil && conf.FlowId == "" {
+		result = append(result, node.NewValidationError("Config.FlowId", "sub-flow id is not set"))
+	}
+	return result
+}
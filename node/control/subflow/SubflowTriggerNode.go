@@ -0,0 +1,34 @@
+package subflow
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+)
+
+// TriggerNode is entry point of a flow which is invoked by subflow node from other flows.
+// The node doesn't listen for any events , instances are started by the flow itself.
+type TriggerNode struct {
+	base.BaseNode
+	ctx *model.Context
+}
+
+func NewTriggerNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := TriggerNode{ctx: ctx}
+	node.SetStartNode(true)
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *TriggerNode) LoadNodeConfig() error {
+	return nil
+}
+
+func (node *TriggerNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
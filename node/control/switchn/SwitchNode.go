@@ -0,0 +1,171 @@
+package switchn
+
+import (
+	"fmt"
+	"github.com/Knetic/govaluate"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+)
+
+// OperandExpression - case is matched if govaluate expression returns true
+const OperandExpression = "expression"
+
+type NodeConfig struct {
+	VariableName      string // Variable which value is routed . If empty , message value is used
+	VariableIsGlobal  bool
+	Cases             []Case       // Cases are checked in order , the first matching case wins
+	DefaultTransition model.NodeID // Is used if no case matches
+}
+
+type Case struct {
+	Operand    string         // eq (default) , ne , gt , gte , lt , lte , contains , in , regex , between , expression
+	Value      model.Variable // Case value , lower bound of between
+	ValueMax   model.Variable // Upper bound of between
+	Expression string         // govaluate expression . Parameters : input - switch value , prop_<name> - message properties , context and instance variables by name
+	Transition model.NodeID
+}
+
+// Switch node routes message to transition of the first matching case
+type Node struct {
+	base.BaseNode
+	ctx         *model.Context
+	config      NodeConfig
+	expressions map[int]*govaluate.EvaluableExpression
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	conf := NodeConfig{}
+	err := mapstructure.Decode(node.Meta().Config, &conf)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	node.config = conf
+	node.expressions = map[int]*govaluate.EvaluableExpression{}
+	for i := range conf.Cases {
+		if conf.Cases[i].Operand != OperandExpression {
+			continue
+		}
+		expression, err := govaluate.NewEvaluableExpressionWithFunctions(conf.Cases[i].Expression, node.HistoryExpressionFuncs(node.ctx))
+		if err != nil {
+			node.GetLog().Errorf("Can't parse expression of case %d . Err: %s", i, err)
+			return err
+		}
+		node.expressions[i] = expression
+	}
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	value := model.Variable{ValueType: msg.Payload.ValueType, Value: msg.Payload.Value}
+	if node.config.VariableName != "" {
+		flowId := node.FlowOpCtx().FlowId
+		if node.config.VariableIsGlobal {
+			flowId = "global"
+		}
+		var err error
+		value, err = node.ctx.GetVariable(node.config.VariableName, flowId)
+		if err != nil {
+			node.GetLog().Error("Can't get variable from context.Error : ", err)
+			return []model.NodeID{node.Meta().ErrorTransition}, err
+		}
+	}
+	for i := range node.config.Cases {
+		isMatched, err := node.matchCase(i, value, msg)
+		if err != nil {
+			// value of different type is not an error , the case just doesn't match
+			node.GetLog().Debugf("Case %d skipped . Err: %s", i, err)
+			continue
+		}
+		if isMatched {
+			node.GetLog().Debugf("Case %d matched , transition to %s", i, node.config.Cases[i].Transition)
+			return []model.NodeID{node.config.Cases[i].Transition}, nil
+		}
+	}
+	return []model.NodeID{node.config.DefaultTransition}, nil
+}
+
+func (node *Node) matchCase(index int, value model.Variable, msg *model.Message) (bool, error) {
+	swCase := node.config.Cases[index]
+	switch swCase.Operand {
+	case "":
+		return model.CompareVariables(model.OperandEq, value, swCase.Value, swCase.ValueMax)
+	case OperandExpression:
+		return node.evaluateExpression(index, value, msg)
+	}
+	return model.CompareVariables(swCase.Operand, value, swCase.Value, swCase.ValueMax)
+}
+
+func (node *Node) evaluateExpression(index int, value model.Variable, msg *model.Message) (bool, error) {
+	expression, ok := node.expressions[index]
+	if !ok {
+		return false, fmt.Errorf("expression is not valid")
+	}
+	parameters := node.ExpressionParameters(value.Value, msg, node.ctx)
+	r, err := expression.Evaluate(parameters)
+	if err != nil {
+		return false, err
+	}
+	result, ok := r.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %v , bool expected", r)
+	}
+	return result, nil
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	result := node.ValidateConfigDecoding(&node.config)
+	if result != nil {
+		return result
+	}
+	if len(node.config.Cases) == 0 {
+		result = append(result, node.NewValidationError("Config.Cases", "node has no cases"))
+	}
+	for i, swCase := range node.config.Cases {
+		field := fmt.Sprintf("Config.Cases[%d]", i)
+		if swCase.Transition == "" {
+			result = append(result, node.NewValidationError(field+".Transition", "case has no transition"))
+		}
+		switch swCase.Operand {
+		case OperandExpression:
+			if _, err := govaluate.NewEvaluableExpressionWithFunctions(swCase.Expression, node.HistoryExpressionFuncs(nil)); err != nil {
+				result = append(result, node.NewValidationError(field+".Expression", "invalid expression : %s", err))
+			}
+			continue
+		case "":
+		default:
+			if !model.IsCompareOperandSupported(swCase.Operand) {
+				result = append(result, node.NewValidationError(field+".Operand", "unsupported operand %s", swCase.Operand))
+				continue
+			}
+		}
+		if swCase.Value.ValueType == "" {
+			result = append(result, node.NewValidationError(field+".Value", "case value is not defined"))
+		}
+		if swCase.Operand == model.OperandBetween && swCase.ValueMax.ValueType == "" {
+			result = append(result, node.NewValidationError(field+".ValueMax", "upper bound is not defined"))
+		}
+	}
+	return result
+}
+
+func (node *Node) GetConfigTransitions() map[string]model.NodeID {
+	result := map[string]model.NodeID{"Config.DefaultTransition": node.config.DefaultTransition}
+	for i := range node.config.Cases {
+		result[fmt.Sprintf("Config.Cases[%d].Transition", i)] = node.config.Cases[i].Transition
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package switchn
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"os"
+	"testing"
+)
+
+func TestSwitchNode_OnInput(t *testing.T) {
+	ctx, err := model.NewContextDB("SwitchTest.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("SwitchTest.db")
+	defer ctx.Close()
+	ctx.RegisterFlow("SwitchTest")
+
+	str := func(v string) model.Variable { return model.Variable{ValueType: "string", Value: v} }
+	num := func(v float64) model.Variable { return model.Variable{ValueType: "float", Value: v} }
+	config := NodeConfig{Cases: []Case{
+		{Value: str("home"), Transition: "home"},
+		{Operand: "in", Value: model.Variable{ValueType: "str_array", Value: []interface{}{"away", "vacation"}}, Transition: "away"},
+		{Operand: "between", Value: num(20), ValueMax: num(25), Transition: "comfort"},
+		{Operand: "expression", Expression: "input == 'sleep' && prop_src == 'app'", Transition: "sleep"},
+	}, DefaultTransition: "default"}
+	meta := model.MetaNode{Id: "1", Type: "switch", Label: "Switch", Config: config}
+	node := NewNode(&model.FlowOperationalContext{FlowId: "SwitchTest"}, meta, ctx).(*Node)
+	if err := node.LoadNodeConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if errs := node.ValidateConfig(); len(errs) != 0 {
+		t.Fatal("Config is not valid ", errs)
+	}
+
+	tests := []struct {
+		msg      *fimpgo.FimpMessage
+		expected model.NodeID
+	}{
+		{fimpgo.NewStringMessage("evt.mode.report", "house", "home", nil, nil, nil), "home"},
+		{fimpgo.NewStringMessage("evt.mode.report", "house", "vacation", nil, nil, nil), "away"},
+		{fimpgo.NewFloatMessage("evt.sensor.report", "temp", 21.5, nil, nil, nil), "comfort"},
+		{fimpgo.NewStringMessage("evt.mode.report", "house", "sleep", fimpgo.Props{"src": "app"}, nil, nil), "sleep"},
+		{fimpgo.NewStringMessage("evt.mode.report", "house", "sleep", nil, nil, nil), "default"},
+		{fimpgo.NewIntMessage("evt.sensor.report", "temp", 30, nil, nil, nil), "default"},
+	}
+	for _, tt := range tests {
+		transitions, err := node.OnInput(&model.Message{Payload: *tt.msg})
+		if err != nil || transitions[0] != tt.expected {
+			t.Errorf("Value %v : wrong transition %v , expected %s", tt.msg.Value, transitions, tt.expected)
+		}
+	}
+
+	transitions := node.GetConfigTransitions()
+	if len(transitions) != 5 || transitions["Config.Cases[2].Transition"] != "comfort" {
+		t.Error("Wrong config transitions ", transitions)
+	}
+}
@@ -0,0 +1,254 @@
+package timer
+
+import (
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"sync"
+	"time"
+)
+
+const (
+	OpStart   = "start"   // starts timer , does nothing if timer is already running
+	OpRestart = "restart" // starts timer or extends running timer by full duration
+	OpCancel  = "cancel"  // stops timer without expiry
+	OpQuery   = "query"   // replaces message value with timer state
+	OpFromMsg = "msg"     // operation is taken from message value , values which aren't strings restart the timer
+)
+
+// Restored timers which expired while the flow wasn't running are fired with the delay , so the flow is fully started
+const restoredTimerMinDelay = time.Second
+
+// Node is retriggerable timer owned by the flow rather than by instance . Instance which executes the node
+// continues immediately , on expiry the node starts new flow instance from ExpiryTransition using the message
+// which started or restarted the timer . Every node has own timer , branches which control the same timer should
+// lead to the same node configured with msg operation.
+// Running timer is stored in context and is restored when flow is started again.
+type Node struct {
+	base.BaseNode
+	ctx       *model.Context
+	config    NodeConfig
+	timer     *time.Timer
+	timerSeq  int64 // sequence number of the latest started timer
+	expiresAt time.Time
+	msg       model.Message
+	mtx       sync.Mutex
+}
+
+type NodeConfig struct {
+	Operation        string // start , restart , cancel , query , msg - operation is taken from message value
+	Duration         int    // Timer duration in seconds
+	ExpiryTransition model.NodeID
+}
+
+// TimerState is running timer stored in context
+type TimerState struct {
+	ExpiresAt  time.Time
+	AddressStr string
+	Payload    []byte // fimp message serialized by fimpgo
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	if node.config.Operation == "" {
+		node.config.Operation = OpRestart
+	}
+	return nil
+}
+
+// Init restores timer which was running when the flow was stopped
+func (node *Node) Init() error {
+	if node.ctx == nil {
+		return nil
+	}
+	state := TimerState{}
+	ok, err := node.ctx.LoadNodeState(node.FlowOpCtx().FlowId, node.Meta().Id, &state)
+	if err != nil {
+		node.GetLog().Error("Can't restore timer . Err:", err)
+		return err
+	}
+	if !ok || state.ExpiresAt.IsZero() {
+		return nil
+	}
+	msg := model.Message{AddressStr: state.AddressStr}
+	if len(state.Payload) > 0 {
+		payload, err := fimpgo.NewMessageFromBytes(state.Payload)
+		if err == nil {
+			msg.Payload = *payload
+		}
+	}
+	delay := time.Until(state.ExpiresAt)
+	if delay < restoredTimerMinDelay {
+		delay = restoredTimerMinDelay
+	}
+	node.GetLog().Infof("Timer restored , expires at %s", state.ExpiresAt.Format(time.RFC3339))
+	node.mtx.Lock()
+	node.startTimer(msg, delay)
+	node.expiresAt = state.ExpiresAt
+	node.mtx.Unlock()
+	return nil
+}
+
+// Cleanup stops timer goroutine , stored timer is kept and restored by Init
+func (node *Node) Cleanup() error {
+	node.mtx.Lock()
+	if node.timer != nil {
+		node.timer.Stop()
+		node.timer = nil
+	}
+	node.expiresAt = time.Time{}
+	node.mtx.Unlock()
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	op := node.config.Operation
+	if op == OpFromMsg {
+		var ok bool
+		if op, ok = msg.Payload.Value.(string); !ok {
+			op = OpRestart
+		}
+	}
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	switch op {
+	case OpStart:
+		if node.timer == nil {
+			node.startTimer(*msg, node.duration())
+			node.saveState()
+		}
+	case OpRestart:
+		node.startTimer(*msg, node.duration())
+		node.saveState()
+	case OpCancel:
+		if node.timer != nil {
+			node.timer.Stop()
+			node.timer = nil
+			node.expiresAt = time.Time{}
+			node.saveState()
+		}
+	case OpQuery:
+		value := map[string]interface{}{"running": node.timer != nil, "remaining": 0}
+		if node.timer != nil {
+			value["remaining"] = int(time.Until(node.expiresAt).Seconds())
+			value["expires_at"] = node.expiresAt.Format(time.RFC3339)
+		}
+		msg.Payload.ValueType = "object"
+		msg.Payload.Value = value
+	default:
+		node.GetLog().Errorf("Unknown timer operation %s", op)
+		return []model.NodeID{node.Meta().ErrorTransition}, fmt.Errorf("unknown timer operation %s", op)
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// startTimer (re)starts timer , must be invoked under lock
+func (node *Node) startTimer(msg model.Message, delay time.Duration) {
+	if node.timer != nil {
+		node.timer.Stop()
+	}
+	node.msg = msg.Clone()
+	node.expiresAt = time.Now().Add(delay)
+	node.timerSeq++
+	seq := node.timerSeq
+	node.timer = time.AfterFunc(delay, func() {
+		node.onExpiry(seq)
+	})
+}
+
+func (node *Node) onExpiry(seq int64) {
+	node.mtx.Lock()
+	if node.timer == nil || node.timerSeq != seq {
+		// Timer was restarted or cancelled while expiry was in progress
+		node.mtx.Unlock()
+		return
+	}
+	node.timer = nil
+	node.expiresAt = time.Time{}
+	msg := node.msg
+	node.saveState()
+	node.mtx.Unlock()
+	node.GetLog().Debug("Timer expired")
+	if node.FlowRunner() == nil {
+		return
+	}
+	node.FlowRunner()(model.ReactorEvent{Msg: msg, TransitionNodeId: node.config.ExpiryTransition, SrcNodeId: node.Meta().Id})
+}
+
+// saveState stores running timer or removes stored one , must be invoked under lock
+func (node *Node) saveState() {
+	if node.ctx == nil {
+		return
+	}
+	var err error
+	if node.timer == nil {
+		err = node.ctx.DeleteNodeState(node.FlowOpCtx().FlowId, node.Meta().Id)
+	} else {
+		state := TimerState{ExpiresAt: node.expiresAt, AddressStr: node.msg.AddressStr}
+		if node.msg.Payload.Type != "" {
+			state.Payload, _ = node.msg.Payload.SerializeToJson()
+		}
+		err = node.ctx.SaveNodeState(node.FlowOpCtx().FlowId, node.Meta().Id, state)
+	}
+	if err != nil {
+		node.GetLog().Error("Can't save timer state . Err:", err)
+	}
+}
+
+func (node *Node) duration() time.Duration {
+	return time.Duration(node.config.Duration) * time.Second
+}
+
+func (node *Node) GetPendingTimers() []model.PendingTimer {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	if node.timer == nil {
+		return nil
+	}
+	return []model.PendingTimer{{NodeId: node.Meta().Id, NodeLabel: node.Meta().Label, ExpiresAt: node.expiresAt}}
+}
+
+// GetConfigTransitions decodes transition from node definition , config of running node isn't touched
+func (node *Node) GetConfigTransitions() map[string]model.NodeID {
+	conf := NodeConfig{}
+	mapstructure.Decode(node.Meta().Config, &conf)
+	return map[string]model.NodeID{"Config.ExpiryTransition": conf.ExpiryTransition}
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	switch conf.Operation {
+	case "", OpStart, OpRestart, OpCancel, OpQuery, OpFromMsg:
+	default:
+		result = append(result, node.NewValidationError("Config.Operation", "unknown operation %s", conf.Operation))
+	}
+	if conf.Duration <= 0 {
+		result = append(result, node.NewValidationError("Config.Duration", "duration must be greater than 0"))
+	}
+	if conf.ExpiryTransition == "" {
+		result = append(result, node.NewValidationError("Config.ExpiryTransition", "expiry transition is not set"))
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package timer
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTimerNode(t *testing.T, ctx *model.Context, config NodeConfig) (*Node, chan model.ReactorEvent) {
+	meta := model.MetaNode{Id: "1", Type: "timer", Label: "Timer", Config: config, SuccessTransition: "next"}
+	node, err := base.NewConfiguredNode(NewNode, &model.FlowOperationalContext{FlowId: "TimerTest"}, meta, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan model.ReactorEvent, 10)
+	node.SetFlowRunner(func(event model.ReactorEvent) { events <- event })
+	return node.(*Node), events
+}
+
+func newMsg(value interface{}) *model.Message {
+	return &model.Message{AddressStr: "pt:j1/mt:evt/rt:dev/rn:zw/ad:1/sv:sensor_presence/ad:5_0",
+		Payload: *fimpgo.NewMessage("evt.presence.report", "sensor_presence", "bool", value, nil, nil, nil)}
+}
+
+func TestNode_RestartAndExpiry(t *testing.T) {
+	node, events := newTimerNode(t, nil, NodeConfig{Operation: OpFromMsg, Duration: 1, ExpiryTransition: "lights_off"})
+	node.OnInput(newMsg(true))
+	time.Sleep(600 * time.Millisecond)
+	// Restart extends the timer by full duration
+	transitions, err := node.OnInput(newMsg(true))
+	if err != nil || transitions[0] != "next" {
+		t.Fatal("Instance must continue ", transitions, err)
+	}
+	if len(node.GetPendingTimers()) != 1 {
+		t.Error("Timer must be pending")
+	}
+	select {
+	case <-events:
+		t.Fatal("Timer expired too early")
+	case <-time.After(700 * time.Millisecond):
+	}
+	select {
+	case event := <-events:
+		if event.TransitionNodeId != "lights_off" || event.SrcNodeId != "1" || event.Msg.Payload.Service != "sensor_presence" {
+			t.Error("Wrong expiry event ", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timer didn't expire")
+	}
+	if len(node.GetPendingTimers()) != 0 {
+		t.Error("Expired timer must not be pending")
+	}
+}
+
+func TestNode_CancelAndQuery(t *testing.T) {
+	node, events := newTimerNode(t, nil, NodeConfig{Operation: OpFromMsg, Duration: 10, ExpiryTransition: "lights_off"})
+	node.OnInput(newMsg(true))
+	msg := &model.Message{Payload: *fimpgo.NewStringMessage("cmd.timer.query", "timer", OpQuery, nil, nil, nil)}
+	node.OnInput(msg)
+	value := msg.Payload.Value.(map[string]interface{})
+	if value["running"] != true || value["remaining"].(int) < 9 {
+		t.Error("Wrong query result ", value)
+	}
+	node.OnInput(&model.Message{Payload: *fimpgo.NewStringMessage("cmd.timer.cancel", "timer", OpCancel, nil, nil, nil)})
+	if len(node.GetPendingTimers()) != 0 {
+		t.Error("Cancelled timer must not be pending")
+	}
+	_, err := node.OnInput(&model.Message{Payload: *fimpgo.NewStringMessage("cmd.timer.set", "timer", "pause", nil, nil, nil)})
+	if err == nil {
+		t.Error("Unknown operation must fail")
+	}
+	select {
+	case <-events:
+		t.Error("Cancelled timer must not expire")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNode_RestoreAfterReload(t *testing.T) {
+	ctx, err := model.NewContextDB("timer_test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("timer_test.db")
+	defer ctx.Close()
+	config := NodeConfig{Operation: OpFromMsg, Duration: 60, ExpiryTransition: "lights_off"}
+	node, _ := newTimerNode(t, ctx, config)
+	node.OnInput(newMsg(true))
+	expiresAt := node.GetPendingTimers()[0].ExpiresAt
+	node.Cleanup()
+
+	node, _ = newTimerNode(t, ctx, config)
+	node.Init()
+	timers := node.GetPendingTimers()
+	if len(timers) != 1 || !timers[0].ExpiresAt.Equal(expiresAt) {
+		t.Fatal("Timer wasn't restored ", timers)
+	}
+	if node.msg.Payload.Service != "sensor_presence" {
+		t.Error("Message wasn't restored")
+	}
+	node.OnInput(&model.Message{Payload: *fimpgo.NewStringMessage("cmd.timer.cancel", "timer", OpCancel, nil, nil, nil)})
+	node.Cleanup()
+
+	node, _ = newTimerNode(t, ctx, config)
+	node.Init()
+	if len(node.GetPendingTimers()) != 0 {
+		t.Error("Cancelled timer must not be restored")
+	}
+}
@@ -39,10 +39,33 @@ func (node *WaitNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 
 func (node *WaitNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	node.GetLog().Info(" Waiting  for = ", node.delay)
-	timer := time.NewTimer(time.Millisecond * time.Duration(node.delay))
+	return node.waitFor(time.Millisecond*time.Duration(node.delay), msg.Done)
+}
+
+func (node *WaitNode) GetWaitTime() time.Duration {
+	return time.Millisecond * time.Duration(node.delay)
+}
+
+// ResumeWait waits only remaining time of the delay , wait continues immediately if the delay has already expired.
+func (node *WaitNode) ResumeWait(msg *model.Message, waitUntil time.Time) ([]model.NodeID, error) {
+	remaining := time.Until(waitUntil)
+	node.GetLog().Info(" Resuming wait , remaining = ", remaining)
+	if remaining <= 0 {
+		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	}
+	return node.waitFor(remaining, msg.Done)
+}
+
+// waitFor is interrupted by control signal or by cancellation of the instance
+func (node *WaitNode) waitFor(delay time.Duration, done <-chan struct{}) ([]model.NodeID, error) {
+	timer := time.NewTimer(delay)
 	select {
 	case <-timer.C:
 		return []model.NodeID{node.Meta().SuccessTransition}, nil
+	case <-done:
+		timer.Stop()
+		node.GetLog().Debug("Instance is canceled")
+		return nil, nil
 	case signal := <-node.FlowOpCtx().NodeControlSignalChannel:
 		timer.Stop()
 		node.GetLog().Debug("Control signal SIGNAL_TERMINATE_WAITING")
@@ -52,3 +75,10 @@ func (node *WaitNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	}
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
+
+func (node *WaitNode) ValidateConfig() []model.ValidationError {
+	if _, ok := node.Meta().Config.(float64); !ok {
+		return []model.ValidationError{node.NewValidationError("Config", "delay must be a number")}
+	}
+	return nil
+}
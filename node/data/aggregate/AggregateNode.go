@@ -0,0 +1,417 @@
+package aggregate
+
+import (
+	"errors"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	WindowSliding  = "sliding"  // window moves with every new value
+	WindowTumbling = "tumbling" // window is closed when full , next value starts new window
+
+	WindowByTime  = "time"
+	WindowByCount = "count"
+
+	EmitOnInput       = "input"
+	EmitOnWindowClose = "window_close"
+
+	TargetMessage  = "message"
+	TargetVariable = "variable"
+)
+
+var supportedFunctions = []string{"avg", "min", "max", "sum", "count", "stddev", "rate"}
+
+// Node aggregates numeric values of incoming messages within time or count window.
+// Results are either stored into message (float for single function , float_map for multiple) or into context variables.
+// Messages which don't produce results (window isn't closed yet) take error transition without error.
+// Tumbling time window which emits on close is closed by timer at WindowStart+Size , results are emitted by new flow
+// instance started from success transition with copy of the last input message.
+type Node struct {
+	base.BaseNode
+	ctx      *model.Context
+	config   NodeConfig
+	state    WindowState
+	lastMsg  *model.Message // the last input message , template of message emitted by close timer
+	timer    *time.Timer
+	timerSeq int64
+	mtx      sync.Mutex
+	now      func() time.Time
+}
+
+type NodeConfig struct {
+	Window             string   // sliding (default) , tumbling
+	WindowBy           string   // time (default) , count
+	Size               int      // Window length in seconds (time) or number of values (count)
+	Functions          []string // avg , min , max , sum , count , stddev , rate (change per second) ; default - avg
+	EmitOn             string   // input (default) - results on every input , window_close - results only when tumbling window is closed
+	Target             string   // message (default) , variable
+	VariableName       string   // Variable name prefix , results are stored as <VariableName>_<function>
+	IsVariableGlobal   bool
+	IsVariableInMemory bool
+	PersistState       bool // true - window is stored on disk when it's closed and when flow is stopped , it's restored after restart
+}
+
+type Sample struct {
+	Value float64
+	Time  time.Time
+}
+
+// WindowState is content of current window , it's stored in context if PersistState is enabled
+type WindowState struct {
+	Samples     []Sample
+	WindowStart time.Time
+}
+
+func NewNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := Node{ctx: ctx, now: time.Now}
+	node.SetMeta(meta)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *Node) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Failed to load node config", err)
+		return err
+	}
+	if node.config.Window == "" {
+		node.config.Window = WindowSliding
+	}
+	if node.config.WindowBy == "" {
+		node.config.WindowBy = WindowByTime
+	}
+	if node.config.EmitOn == "" {
+		node.config.EmitOn = EmitOnInput
+	}
+	if node.config.Target == "" {
+		node.config.Target = TargetMessage
+	}
+	if len(node.config.Functions) == 0 {
+		node.config.Functions = []string{"avg"}
+	}
+	if node.config.PersistState && node.ctx != nil {
+		if _, err := node.ctx.LoadNodeState(node.FlowOpCtx().FlowId, node.Meta().Id, &node.state); err != nil {
+			node.GetLog().Error("Can't restore window state . Err:", err)
+		}
+	}
+	return nil
+}
+
+// Init starts close timer of restored window
+func (node *Node) Init() error {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	if node.isClosedByTimer() && len(node.state.Samples) > 0 {
+		node.startTimer()
+	}
+	return nil
+}
+
+// Cleanup stops close timer and stores current window
+func (node *Node) Cleanup() error {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	node.stopTimer()
+	node.saveState()
+	return nil
+}
+
+func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
+
+}
+
+func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	vari := model.Variable{ValueType: msg.Payload.ValueType, Value: msg.Payload.Value}
+	value, err := vari.ToNumber()
+	if err != nil {
+		node.GetLog().Error("Only numeric values can be aggregated , value type = ", msg.Payload.ValueType)
+		return []model.NodeID{node.Meta().ErrorTransition}, errors.New("value is not numeric")
+	}
+	if node.isClosedByTimer() {
+		lastMsg := msg.Clone()
+		node.mtx.Lock()
+		node.lastMsg = &lastMsg
+		node.mtx.Unlock()
+	}
+	results := node.AddValue(value)
+	if results == nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, nil
+	}
+	if err = node.applyResults(msg, results); err != nil {
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
+// applyResults stores results into context variables or into message
+func (node *Node) applyResults(msg *model.Message, results map[string]float64) error {
+	if node.config.Target == TargetVariable {
+		flowId := node.FlowOpCtx().FlowId
+		if node.config.IsVariableGlobal {
+			flowId = "global"
+		}
+		for name, result := range results {
+			err := node.ctx.SetVariable(node.config.VariableName+"_"+name, "float", result, "", flowId, node.config.IsVariableInMemory)
+			if err != nil {
+				node.GetLog().Error("Can't set variable . Err:", err)
+				return err
+			}
+		}
+	} else if len(node.config.Functions) == 1 {
+		msg.Payload.ValueType = "float"
+		msg.Payload.Value = results[node.config.Functions[0]]
+	} else {
+		msg.Payload.ValueType = "float_map"
+		msg.Payload.Value = results
+	}
+	return nil
+}
+
+// AddValue adds value to the window and returns aggregation results , nil if results shouldn't be emitted
+func (node *Node) AddValue(value float64) map[string]float64 {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	now := node.now()
+	sample := Sample{Value: value, Time: now}
+	var closed []Sample
+	if node.config.Window == WindowTumbling {
+		if node.config.WindowBy == WindowByTime {
+			if node.state.WindowStart.IsZero() {
+				node.state.WindowStart = now
+			}
+			if !now.Before(node.state.WindowStart.Add(node.size())) {
+				// Window wasn't closed by timer yet or the previous window was empty
+				closed = node.state.Samples
+				node.state.Samples = nil
+				node.state.WindowStart = node.alignWindowStart(now)
+				node.stopTimer()
+				node.saveState()
+			}
+			node.state.Samples = append(node.state.Samples, sample)
+			if node.isClosedByTimer() && node.timer == nil {
+				node.startTimer()
+			}
+		} else {
+			node.state.Samples = append(node.state.Samples, sample)
+			if len(node.state.Samples) >= node.config.Size {
+				closed = node.state.Samples
+				node.state.Samples = nil
+				node.saveState()
+			}
+		}
+	} else {
+		node.state.Samples = append(node.state.Samples, sample)
+		node.evict(now)
+	}
+
+	if node.config.EmitOn == EmitOnWindowClose {
+		if len(closed) == 0 {
+			return nil
+		}
+		return node.calculate(closed)
+	}
+	if len(node.state.Samples) == 0 {
+		// Count window was closed by this value
+		return node.calculate(closed)
+	}
+	return node.calculate(node.state.Samples)
+}
+
+// alignWindowStart returns start of window which contains now , windows follow each other without gaps
+func (node *Node) alignWindowStart(now time.Time) time.Time {
+	elapsed := now.Sub(node.state.WindowStart)
+	return node.state.WindowStart.Add(elapsed - elapsed%node.size())
+}
+
+func (node *Node) isClosedByTimer() bool {
+	return node.config.Window == WindowTumbling && node.config.WindowBy == WindowByTime && node.config.EmitOn == EmitOnWindowClose
+}
+
+// startTimer starts timer which closes current window , must be called under lock
+func (node *Node) startTimer() {
+	node.timerSeq++
+	seq := node.timerSeq
+	node.timer = time.AfterFunc(node.state.WindowStart.Add(node.size()).Sub(node.now()), func() {
+		node.onWindowEnd(seq)
+	})
+}
+
+// stopTimer must be called under lock
+func (node *Node) stopTimer() {
+	if node.timer != nil {
+		node.timer.Stop()
+		node.timer = nil
+	}
+}
+
+// onWindowEnd closes current window and starts new flow instance with results
+func (node *Node) onWindowEnd(seq int64) {
+	node.mtx.Lock()
+	if node.timer == nil || node.timerSeq != seq {
+		// Window was closed by input or node was stopped
+		node.mtx.Unlock()
+		return
+	}
+	node.timer = nil
+	closed := node.state.Samples
+	node.state.Samples = nil
+	node.state.WindowStart = node.state.WindowStart.Add(node.size())
+	node.saveState()
+	msg := model.Message{}
+	if node.lastMsg != nil {
+		msg = node.lastMsg.Clone()
+	}
+	node.mtx.Unlock()
+	if len(closed) == 0 {
+		return
+	}
+	if err := node.applyResults(&msg, node.calculate(closed)); err != nil {
+		return
+	}
+	node.GetLog().Debug("Window is closed")
+	if node.FlowRunner() == nil {
+		return
+	}
+	node.FlowRunner()(model.ReactorEvent{Msg: msg, TransitionNodeId: node.Meta().SuccessTransition, SrcNodeId: node.Meta().Id})
+}
+
+// GetPendingTimers returns close timer of current window
+func (node *Node) GetPendingTimers() []model.PendingTimer {
+	node.mtx.Lock()
+	defer node.mtx.Unlock()
+	if node.timer == nil {
+		return nil
+	}
+	return []model.PendingTimer{{NodeId: node.Meta().Id, NodeLabel: node.Meta().Label, ExpiresAt: node.state.WindowStart.Add(node.size())}}
+}
+
+// evict removes samples which are outside of sliding window
+func (node *Node) evict(now time.Time) {
+	if node.config.WindowBy == WindowByCount {
+		if extra := len(node.state.Samples) - node.config.Size; extra > 0 {
+			node.state.Samples = node.state.Samples[extra:]
+		}
+		return
+	}
+	windowStart := now.Add(-node.size())
+	i := 0
+	for i < len(node.state.Samples) && !node.state.Samples[i].Time.After(windowStart) {
+		i++
+	}
+	node.state.Samples = node.state.Samples[i:]
+}
+
+func (node *Node) size() time.Duration {
+	return time.Duration(node.config.Size) * time.Second
+}
+
+// saveState must be called under lock
+func (node *Node) saveState() {
+	if !node.config.PersistState || node.ctx == nil {
+		return
+	}
+	if err := node.ctx.SaveNodeState(node.FlowOpCtx().FlowId, node.Meta().Id, node.state); err != nil {
+		node.GetLog().Error("Can't save window state . Err:", err)
+	}
+}
+
+func (node *Node) calculate(samples []Sample) map[string]float64 {
+	var sum float64
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		sum += s.Value
+		min = math.Min(min, s.Value)
+		max = math.Max(max, s.Value)
+	}
+	count := float64(len(samples))
+	avg := sum / count
+	results := map[string]float64{}
+	for _, fn := range node.config.Functions {
+		switch fn {
+		case "avg":
+			results[fn] = avg
+		case "min":
+			results[fn] = min
+		case "max":
+			results[fn] = max
+		case "sum":
+			results[fn] = sum
+		case "count":
+			results[fn] = count
+		case "stddev":
+			var variance float64
+			for _, s := range samples {
+				variance += (s.Value - avg) * (s.Value - avg)
+			}
+			results[fn] = math.Sqrt(variance / count)
+		case "rate":
+			first, last := samples[0], samples[len(samples)-1]
+			results[fn] = 0
+			if duration := last.Time.Sub(first.Time).Seconds(); duration > 0 {
+				results[fn] = (last.Value - first.Value) / duration
+			}
+		}
+	}
+	return results
+}
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	switch conf.Window {
+	case "", WindowSliding:
+		if conf.EmitOn == EmitOnWindowClose {
+			result = append(result, node.NewValidationError("Config.EmitOn", "sliding window is never closed , use tumbling window"))
+		}
+	case WindowTumbling:
+	default:
+		result = append(result, node.NewValidationError("Config.Window", "unknown window %s", conf.Window))
+	}
+	switch conf.WindowBy {
+	case "", WindowByTime, WindowByCount:
+	default:
+		result = append(result, node.NewValidationError("Config.WindowBy", "unknown window type %s", conf.WindowBy))
+	}
+	if conf.Size <= 0 {
+		result = append(result, node.NewValidationError("Config.Size", "window size must be greater than 0"))
+	}
+	switch conf.EmitOn {
+	case "", EmitOnInput, EmitOnWindowClose:
+	default:
+		result = append(result, node.NewValidationError("Config.EmitOn", "unknown value %s", conf.EmitOn))
+	}
+	for _, fn := range conf.Functions {
+		if !isFunctionSupported(fn) {
+			result = append(result, node.NewValidationError("Config.Functions", "unknown function %s", fn))
+		}
+	}
+	switch conf.Target {
+	case "", TargetMessage:
+	case TargetVariable:
+		if conf.VariableName == "" {
+			result = append(result, node.NewValidationError("Config.VariableName", "variable name is not set"))
+		}
+	default:
+		result = append(result, node.NewValidationError("Config.Target", "unknown target %s", conf.Target))
+	}
+	return result
+}
+
+func isFunctionSupported(fn string) bool {
+	for _, f := range supportedFunctions {
+		if f == fn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package aggregate
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"os"
+	"testing"
+	"time"
+)
+
+func newAggregateNode(t *testing.T, ctx *model.Context, config NodeConfig) *Node {
+	meta := model.MetaNode{Id: "1", Type: "aggregate", Label: "Aggregate", Config: config, SuccessTransition: "result", ErrorTransition: "skip"}
+	node, err := base.NewConfiguredNode(NewNode, &model.FlowOperationalContext{FlowId: "AggregateTest"}, meta, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*Node)
+}
+
+// fakeClock moves by one second on every call
+func fakeClock() func() time.Time {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func TestNode_SlidingCountWindow(t *testing.T) {
+	node := newAggregateNode(t, nil, NodeConfig{WindowBy: WindowByCount, Size: 3, Functions: []string{"avg", "min", "max", "sum", "count", "rate"}})
+	node.now = fakeClock()
+	var results map[string]float64
+	for _, v := range []float64{10, 20, 30, 40} {
+		results = node.AddValue(v)
+	}
+	if results["avg"] != 30 || results["min"] != 20 || results["max"] != 40 || results["sum"] != 90 || results["count"] != 3 || results["rate"] != 10 {
+		t.Error("Wrong results ", results)
+	}
+}
+
+func TestNode_SlidingTimeWindow(t *testing.T) {
+	node := newAggregateNode(t, nil, NodeConfig{Window: WindowSliding, Size: 2, Functions: []string{"count", "stddev"}})
+	node.now = fakeClock()
+	var results map[string]float64
+	for _, v := range []float64{100, 2, 4} {
+		results = node.AddValue(v)
+	}
+	if results["count"] != 2 || results["stddev"] != 1 {
+		t.Error("Value older than window must be evicted ", results)
+	}
+}
+
+func TestNode_TumblingWindowClose(t *testing.T) {
+	node := newAggregateNode(t, nil, NodeConfig{Window: WindowTumbling, WindowBy: WindowByCount, Size: 2, EmitOn: EmitOnWindowClose, Functions: []string{"sum"}})
+	expected := []model.NodeID{"skip", "result", "skip", "result"}
+	for i, v := range []int64{1, 2, 3, 4} {
+		msg := &model.Message{Payload: *fimpgo.NewIntMessage("evt.meter.report", "meter_elec", v, nil, nil, nil)}
+		transitions, err := node.OnInput(msg)
+		if err != nil || transitions[0] != expected[i] {
+			t.Fatal("Wrong transition at position ", i, transitions, err)
+		}
+		if i == 3 && (msg.Payload.ValueType != "float" || msg.Payload.Value.(float64) != 7) {
+			t.Error("Wrong result ", msg.Payload.Value)
+		}
+	}
+}
+
+func TestNode_TumblingTimeWindowTimer(t *testing.T) {
+	node := newAggregateNode(t, nil, NodeConfig{Window: WindowTumbling, Size: 1, EmitOn: EmitOnWindowClose, Functions: []string{"max"}})
+	events := make(chan model.ReactorEvent, 1)
+	node.SetFlowRunner(func(event model.ReactorEvent) { events <- event })
+	for _, v := range []float64{5, 7} {
+		msg := &model.Message{AddressStr: "sensor/1", Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", v, nil, nil, nil)}
+		if transitions, _ := node.OnInput(msg); transitions[0] != "skip" {
+			t.Fatal("Open window must not emit results")
+		}
+	}
+	if len(node.GetPendingTimers()) != 1 {
+		t.Fatal("Close timer isn't running")
+	}
+	select {
+	case event := <-events:
+		if event.TransitionNodeId != "result" || event.Msg.AddressStr != "sensor/1" || event.Msg.Payload.Value != 7.0 {
+			t.Error("Wrong event ", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Window wasn't closed by timer")
+	}
+	if len(node.GetPendingTimers()) != 0 || len(node.state.Samples) != 0 {
+		t.Error("Window must be empty after close")
+	}
+	node.Cleanup()
+}
+
+func TestNode_VariableTargetAndPersistence(t *testing.T) {
+	ctx, err := model.NewContextDB("aggregate_test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("aggregate_test.db")
+	defer ctx.Close()
+	ctx.RegisterFlow("AggregateTest")
+	config := NodeConfig{Window: WindowTumbling, WindowBy: WindowByCount, Size: 3, Functions: []string{"avg", "max"},
+		Target: TargetVariable, VariableName: "temp", IsVariableInMemory: true, PersistState: true}
+	node := newAggregateNode(t, ctx, config)
+	node.OnInput(&model.Message{Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", 20, nil, nil, nil)})
+	node.OnInput(&model.Message{Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", 22, nil, nil, nil)})
+	if ok, _ := ctx.LoadNodeState("AggregateTest", "1", &WindowState{}); ok {
+		t.Error("Open window must be stored only when flow is stopped")
+	}
+	node.Cleanup()
+
+	// Window must be restored by new node instance
+	node = newAggregateNode(t, ctx, config)
+	node.OnInput(&model.Message{Payload: *fimpgo.NewFloatMessage("evt.sensor.report", "sensor_temp", 24, nil, nil, nil)})
+	avg, err := ctx.GetVariable("temp_avg", "AggregateTest")
+	if err != nil || avg.Value != 22.0 {
+		t.Error("Wrong avg variable ", avg, err)
+	}
+	max, err := ctx.GetVariable("temp_max", "AggregateTest")
+	if err != nil || max.Value != 24.0 {
+		t.Error("Wrong max variable ", max, err)
+	}
+}
+
+func TestNode_NotNumericValue(t *testing.T) {
+	node := newAggregateNode(t, nil, NodeConfig{Size: 10})
+	transitions, err := node.OnInput(&model.Message{Payload: *fimpgo.NewStringMessage("evt.mode.report", "mode", "home", nil, nil, nil)})
+	if err == nil || transitions[0] != "skip" {
+		t.Error("Not numeric value must fail")
+	}
+}
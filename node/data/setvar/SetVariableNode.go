@@ -4,6 +4,7 @@ import (
 	"github.com/thingsplex/tpflow/model"
 	"github.com/thingsplex/tpflow/node/base"
 	"github.com/mitchellh/mapstructure"
+	"time"
 )
 
 type SetVariableNode struct {
@@ -17,8 +18,16 @@ type SetVariableNodeConfig struct {
 	Description        string
 	UpdateGlobal       bool // true - update global variable ; false - update local variable
 	UpdateInputMsg     bool // true - update input message  ; false - update context variable
+	UpdateInstance     bool // true - update instance variable , it's visible only within flow instance and is returned to sub-flow caller
 	IsVariableInMemory bool // true - is saved on disk ; false - in memory only
 	DefaultValue       model.Variable
+	Ttl                int            // variable time to live in seconds , 0 - never expires
+	ExpiresAt          string         // absolute expiry time in RFC3339 format , is used if Ttl is 0
+	Operation          string         // set (default) , increment , decrement , cas , append , pop , map_set , map_delete
+	ExpectedValue      model.Variable // cas - expected current value , empty type - variable must not exist
+	MapKey             string         // map_set , map_delete - key of map variable
+	MaxListSize        int            // append - max number of items in list , 0 - unlimited
+	PopLast            bool           // pop - remove last item instead of first one
 }
 
 func NewSetVariableNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
@@ -43,26 +52,39 @@ func (node *SetVariableNode) LoadNodeConfig() error {
 func (node *SetVariableNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	node.GetLog().Debugf(" Executing SetVariableNode . Name = ", node.Meta().Label)
 
+	if node.nodeConfig.Operation != "" && node.nodeConfig.Operation != "set" {
+		return node.executeAtomicOperation(msg)
+	}
 	if node.nodeConfig.UpdateInputMsg {
 		// Update input value with value from node config .
 		msg.Payload.Value = node.nodeConfig.DefaultValue.Value
 		msg.Payload.ValueType = node.nodeConfig.DefaultValue.ValueType
+	} else if node.nodeConfig.UpdateInstance {
+		if node.nodeConfig.DefaultValue.ValueType == "" {
+			msg.SetVar(node.nodeConfig.Name, model.Variable{ValueType: msg.Payload.ValueType, Value: msg.Payload.Value})
+		} else {
+			msg.SetVar(node.nodeConfig.Name, node.nodeConfig.DefaultValue)
+		}
 	} else {
 		node.GetLog().Debugf("Var name = %s , type = %s, value = %+v",node.nodeConfig.Name,msg.Payload.ValueType,msg.Payload.Value)
 		// Save input value to variable
-		var err error
+		expiresAt, err := model.GetExpiryTime(node.nodeConfig.Ttl, node.nodeConfig.ExpiresAt)
+		if err != nil {
+			node.GetLog().Error("Invalid expiry time :", err)
+			expiresAt = time.Time{}
+		}
 		if node.nodeConfig.DefaultValue.ValueType == "" {
 			if node.nodeConfig.UpdateGlobal {
-				err = node.ctx.SetVariable(node.nodeConfig.Name, msg.Payload.ValueType, msg.Payload.Value, node.nodeConfig.Description, "global", node.nodeConfig.IsVariableInMemory)
+				err = node.ctx.SetVariableWithExpiry(node.nodeConfig.Name, msg.Payload.ValueType, msg.Payload.Value, node.nodeConfig.Description, "global", node.nodeConfig.IsVariableInMemory, expiresAt)
 			} else {
-				err = node.ctx.SetVariable(node.nodeConfig.Name, msg.Payload.ValueType, msg.Payload.Value, node.nodeConfig.Description, node.FlowOpCtx().FlowId, node.nodeConfig.IsVariableInMemory)
+				err = node.ctx.SetVariableWithExpiry(node.nodeConfig.Name, msg.Payload.ValueType, msg.Payload.Value, node.nodeConfig.Description, node.FlowOpCtx().FlowId, node.nodeConfig.IsVariableInMemory, expiresAt)
 			}
 		} else {
 			// Save default value from node config to variable
 			if node.nodeConfig.UpdateGlobal {
-				err = node.ctx.SetVariable(node.nodeConfig.Name, node.nodeConfig.DefaultValue.ValueType, node.nodeConfig.DefaultValue.Value, node.nodeConfig.Description, "global", node.nodeConfig.IsVariableInMemory)
+				err = node.ctx.SetVariableWithExpiry(node.nodeConfig.Name, node.nodeConfig.DefaultValue.ValueType, node.nodeConfig.DefaultValue.Value, node.nodeConfig.Description, "global", node.nodeConfig.IsVariableInMemory, expiresAt)
 			} else {
-				err = node.ctx.SetVariable(node.nodeConfig.Name, node.nodeConfig.DefaultValue.ValueType, node.nodeConfig.DefaultValue.Value, node.nodeConfig.Description, node.FlowOpCtx().FlowId, node.nodeConfig.IsVariableInMemory)
+				err = node.ctx.SetVariableWithExpiry(node.nodeConfig.Name, node.nodeConfig.DefaultValue.ValueType, node.nodeConfig.DefaultValue.Value, node.nodeConfig.Description, node.FlowOpCtx().FlowId, node.nodeConfig.IsVariableInMemory, expiresAt)
 			}
 
 		}
@@ -73,6 +95,79 @@ func (node *SetVariableNode) OnInput(msg *model.Message) ([]model.NodeID, error)
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
 
+// executeAtomicOperation updates variable without read-modify-write race with other flow instances.
+// Value from node config or input message is used as operand , popped item is written into input message.
+func (node *SetVariableNode) executeAtomicOperation(msg *model.Message) ([]model.NodeID, error) {
+	flowId := node.FlowOpCtx().FlowId
+	if node.nodeConfig.UpdateGlobal {
+		flowId = "global"
+	}
+	op := model.AtomicOperation{
+		Type:     node.nodeConfig.Operation,
+		Value:    node.nodeConfig.DefaultValue,
+		Expected: node.nodeConfig.ExpectedValue,
+		Key:      node.nodeConfig.MapKey,
+		MaxSize:  node.nodeConfig.MaxListSize,
+		PopLast:  node.nodeConfig.PopLast,
+	}
+	switch op.Type {
+	case model.AtomicCas, model.AtomicAppend, model.AtomicMapSet:
+		if op.Value.ValueType == "" {
+			op.Value = model.Variable{ValueType: msg.Payload.ValueType, Value: msg.Payload.Value}
+		}
+	}
+	result, err := node.ctx.ExecuteAtomicOperation(node.nodeConfig.Name, flowId, node.nodeConfig.IsVariableInMemory, op)
+	if err == model.ErrCompareFailed || err == model.ErrListEmpty {
+		node.GetLog().Debugf("Operation %s on variable %s wasn't executed : %s", op.Type, node.nodeConfig.Name, err)
+		return []model.NodeID{node.Meta().ErrorTransition}, nil
+	}
+	if err != nil {
+		node.GetLog().Error("Atomic operation error :", err)
+		return []model.NodeID{node.Meta().ErrorTransition}, err
+	}
+	if op.Type == model.AtomicPop {
+		msg.Payload.Value = result.Value
+		msg.Payload.ValueType = result.ValueType
+	}
+	return []model.NodeID{node.Meta().SuccessTransition}, nil
+}
+
 func (node *SetVariableNode) WaitForEvent(responseChannel chan model.ReactorEvent) {
 
 }
+
+func (node *SetVariableNode) ValidateConfig() []model.ValidationError {
+	conf := SetVariableNodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result == nil && conf.Name == "" {
+		result = append(result, node.NewValidationError("Config.Name", "variable name is not set"))
+	}
+	if conf.Ttl < 0 {
+		result = append(result, node.NewValidationError("Config.Ttl", "ttl can't be negative"))
+	}
+	if conf.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, conf.ExpiresAt); err != nil {
+			result = append(result, node.NewValidationError("Config.ExpiresAt", "expiry time must be in RFC3339 format : %s", err))
+		}
+	}
+	switch conf.Operation {
+	case "", "set", model.AtomicCas, model.AtomicAppend, model.AtomicPop:
+	case model.AtomicIncrement, model.AtomicDecrement:
+		if conf.DefaultValue.ValueType != "" && !conf.DefaultValue.IsNumber() {
+			result = append(result, node.NewValidationError("Config.DefaultValue", "step of %s must be a number", conf.Operation))
+		}
+	case model.AtomicMapSet, model.AtomicMapDelete:
+		if conf.MapKey == "" {
+			result = append(result, node.NewValidationError("Config.MapKey", "map key is required by %s operation", conf.Operation))
+		}
+	default:
+		result = append(result, node.NewValidationError("Config.Operation", "unknown operation %s", conf.Operation))
+	}
+	if conf.UpdateInstance && conf.Operation != "" && conf.Operation != "set" {
+		result = append(result, node.NewValidationError("Config.Operation", "operation %s isn't supported by instance variables", conf.Operation))
+	}
+	if conf.MaxListSize < 0 {
+		result = append(result, node.NewValidationError("Config.MaxListSize", "max list size can't be negative"))
+	}
+	return result
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/thingsplex/tpflow/node/base"
 	"github.com/mitchellh/mapstructure"
 	"text/template"
+	"time"
 )
 
 type Node struct {
@@ -25,6 +26,7 @@ type NodeConfig struct {
 	TargetVariableType     string
 	IsTargetVariableGlobal bool
 	IsTargetVariableInMemory bool
+	TargetVariableTtl      int                  // target variable time to live in seconds , 0 - never expires
 	TransformType          string               // map , calc , str-to-json ,json-to-str , jpath , xpath , template
 	IsRVariableGlobal      bool                 // true - update global variable ; false - update local variable
 	IsLVariableGlobal      bool                 // true - update global variable ; false - update local variable
@@ -103,13 +105,13 @@ func (node *Node) LoadNodeConfig() error {
 				}
 			},
 		}
-		node.template, err = template.New("transform").Funcs(funcMap).Parse(node.nodeConfig.Template)
+		node.template, err = template.New("transform").Funcs(node.AddHistoryTemplateFuncs(funcMap, node.ctx)).Parse(node.nodeConfig.Template)
 		if err != nil {
 			node.GetLog().Error(" Failed while parsing request template.Error:", err)
 			return err
 		}
 	}else if node.nodeConfig.TransformType == "calc" {
-		node.expression, err = govaluate.NewEvaluableExpression(node.nodeConfig.Expression)
+		node.expression, err = govaluate.NewEvaluableExpressionWithFunctions(node.nodeConfig.Expression, node.HistoryExpressionFuncs(node.ctx))
 		if err != nil {
 			node.GetLog().Error("Can't parse calc expression",err)
 		}
@@ -256,9 +258,9 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 					// Save default value from node config to variable
 					node.GetLog().Info(" Setting transformed variable : ")
 					if node.nodeConfig.XPathMapping[i].IsTargetVariableGlobal {
-						node.ctx.SetVariable(node.nodeConfig.XPathMapping[i].TargetVariableName, result.ValueType, result.Value, "", "global", node.nodeConfig.IsTargetVariableInMemory)
+						node.ctx.SetVariableWithExpiry(node.nodeConfig.XPathMapping[i].TargetVariableName, result.ValueType, result.Value, "", "global", node.nodeConfig.IsTargetVariableInMemory, node.targetExpiryTime())
 					} else {
-						node.ctx.SetVariable(node.nodeConfig.XPathMapping[i].TargetVariableName, result.ValueType, result.Value, "", node.FlowOpCtx().FlowId, node.nodeConfig.IsTargetVariableInMemory)
+						node.ctx.SetVariableWithExpiry(node.nodeConfig.XPathMapping[i].TargetVariableName, result.ValueType, result.Value, "", node.FlowOpCtx().FlowId, node.nodeConfig.IsTargetVariableInMemory, node.targetExpiryTime())
 					}
 
 				}
@@ -292,10 +294,10 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 		// Save value into variable
 		// Save default value from node config to variable
 		if node.nodeConfig.IsTargetVariableGlobal {
-			err = node.ctx.SetVariable(node.nodeConfig.TargetVariableName, result.ValueType, result.Value, "", "global", node.nodeConfig.IsTargetVariableInMemory)
+			err = node.ctx.SetVariableWithExpiry(node.nodeConfig.TargetVariableName, result.ValueType, result.Value, "", "global", node.nodeConfig.IsTargetVariableInMemory, node.targetExpiryTime())
 		} else {
 			//node.GetLog().Debug("Setting local variable.",result.Value)
-			err = node.ctx.SetVariable(node.nodeConfig.TargetVariableName, result.ValueType, result.Value, "", node.FlowOpCtx().FlowId, node.nodeConfig.IsTargetVariableInMemory)
+			err = node.ctx.SetVariableWithExpiry(node.nodeConfig.TargetVariableName, result.ValueType, result.Value, "", node.FlowOpCtx().FlowId, node.nodeConfig.IsTargetVariableInMemory, node.targetExpiryTime())
 		}
 		if err != nil {
 			node.GetLog().Error("Can't save variable . Err:",err.Error())
@@ -305,6 +307,34 @@ func (node *Node) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	return []model.NodeID{node.Meta().SuccessTransition}, nil
 }
 
+// targetExpiryTime returns expiry time of target variable , zero time if variable never expires
+func (node *Node) targetExpiryTime() time.Time {
+	if node.nodeConfig.TargetVariableTtl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(node.nodeConfig.TargetVariableTtl) * time.Second)
+}
+
 func (node *Node) WaitForEvent(responseChannel chan model.ReactorEvent) {
 
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	switch conf.TransformType {
+	case "template":
+		result = node.ValidateTemplate("Config.Template", conf.Template)
+	case "calc":
+		if _, err := govaluate.NewEvaluableExpressionWithFunctions(conf.Expression, node.HistoryExpressionFuncs(nil)); err != nil {
+			result = append(result, node.NewValidationError("Config.Expression", "invalid expression : %s", err))
+		}
+	}
+	if conf.TargetVariableTtl < 0 {
+		result = append(result, node.NewValidationError("Config.TargetVariableTtl", "ttl can't be negative"))
+	}
+	return result
+}
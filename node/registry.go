@@ -4,35 +4,67 @@ import (
 	"github.com/thingsplex/tpflow/model"
 	"github.com/thingsplex/tpflow/node/action/exec"
 	actfimp "github.com/thingsplex/tpflow/node/action/fimp"
+	"github.com/thingsplex/tpflow/node/action/influx"
 	log "github.com/thingsplex/tpflow/node/action/log"
+	actmqtt "github.com/thingsplex/tpflow/node/action/mqtt"
 	"github.com/thingsplex/tpflow/node/action/rest"
+	"github.com/thingsplex/tpflow/node/action/script"
+	actwebhook "github.com/thingsplex/tpflow/node/action/webhook"
+	"github.com/thingsplex/tpflow/node/control/fork"
 	"github.com/thingsplex/tpflow/node/control/ifn"
 	"github.com/thingsplex/tpflow/node/control/iftime"
+	"github.com/thingsplex/tpflow/node/control/join"
 	"github.com/thingsplex/tpflow/node/control/loop"
+	"github.com/thingsplex/tpflow/node/control/msgfilter"
 	"github.com/thingsplex/tpflow/node/control/ratelimit"
+	"github.com/thingsplex/tpflow/node/control/subflow"
+	"github.com/thingsplex/tpflow/node/control/switchn"
+	"github.com/thingsplex/tpflow/node/control/timer"
 	"github.com/thingsplex/tpflow/node/control/wait"
+	"github.com/thingsplex/tpflow/node/data/aggregate"
 	"github.com/thingsplex/tpflow/node/data/setvar"
 	"github.com/thingsplex/tpflow/node/data/transform"
+	"github.com/thingsplex/tpflow/node/trigger/connstate"
 	trigfimp "github.com/thingsplex/tpflow/node/trigger/fimp"
+	trigmqtt "github.com/thingsplex/tpflow/node/trigger/mqtt"
 	"github.com/thingsplex/tpflow/node/trigger/time"
+	trigvar "github.com/thingsplex/tpflow/node/trigger/variable"
+	trigwebhook "github.com/thingsplex/tpflow/node/trigger/webhook"
 )
 
 type Constructor func(context *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node
 
 var Registry = map[string]Constructor{
-	"trigger":      trigfimp.NewTriggerNode,
-	"vinc_trigger": trigfimp.NewVincTriggerNode,
-	"receive":      trigfimp.NewReceiveNode,
-	"if":           ifn.NewNode,
-	"iftime":		iftime.NewNode,
-	"rate_limit":	ratelimit.NewNode,
-	"action":       actfimp.NewNode,
-	"log_action":   log.NewNode,
-	"rest_action":  rest.NewNode,
-	"wait":         wait.NewWaitNode,
-	"set_variable": setvar.NewSetVariableNode,
-	"loop":         loop.NewNode,
-	"time_trigger": time.NewNode,
-	"transform":    transform.NewNode,
-	"exec":         exec.NewNode,
+	"trigger":          trigfimp.NewTriggerNode,
+	"vinc_trigger":     trigfimp.NewVincTriggerNode,
+	"receive":          trigfimp.NewReceiveNode,
+	"if":               ifn.NewNode,
+	"switch":           switchn.NewNode,
+	"iftime":           iftime.NewNode,
+	"rate_limit":       ratelimit.NewNode,
+	"msg_filter":       msgfilter.NewNode,
+	"action":           actfimp.NewNode,
+	"log_action":       log.NewNode,
+	"rest_action":      rest.NewNode,
+	"wait":             wait.NewWaitNode,
+	"timer":            timer.NewNode,
+	"set_variable":     setvar.NewSetVariableNode,
+	"loop":             loop.NewNode,
+	"fork":             fork.NewNode,
+	"join":             join.NewNode,
+	"subflow":          subflow.NewNode,
+	"subflow_trigger":  subflow.NewTriggerNode,
+	"script":           script.NewNode,
+	"time_trigger":     time.NewNode,
+	"transform":        transform.NewNode,
+	"aggregate":        aggregate.NewNode,
+	"exec":             exec.NewNode,
+	"influx_read":      influx.NewInfluxdbReadNode,
+	"influx_write":     influx.NewInfluxdbWriteNode,
+	"mqtt_trigger":     trigmqtt.NewTriggerNode,
+	"mqtt_publish":     actmqtt.NewPublishNode,
+	"connector_state":  connstate.NewTriggerNode,
+	"var_trigger":      trigvar.NewTriggerNode,
+	"webhook_trigger":  trigwebhook.NewTriggerNode,
+	"webhook_response": actwebhook.NewResponseNode,
 }
@@ -0,0 +1,131 @@
+package connstate
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/connector"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"strconv"
+)
+
+// TriggerNode starts flow when connector instance changes state (goes up or down).
+// Message value is new state , previous state and connector details are stored in message properties.
+type TriggerNode struct {
+	base.BaseNode
+	ctx          *model.Context
+	config       TriggerConfig
+	eventStream  chan connector.StateChangeEvent
+	subscriberId string
+}
+
+type TriggerConfig struct {
+	ConnectorID string   // Connector instance , empty - all instances
+	States      []string // Triggering states (RUNNING , CONNECTION_LOST , INIT_FAILED , STOPPED) , empty - any state change
+}
+
+func NewTriggerNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := TriggerNode{ctx: ctx}
+	node.SetStartNode(true)
+	node.SetMsgReactorNode(true)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetMeta(meta)
+	node.config = TriggerConfig{}
+	node.subscriberId = node.FlowOpCtx().FlowId + "_" + string(node.GetMetaNode().Id)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *TriggerNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Error while decoding node configs.Err:", err)
+	}
+	return err
+}
+
+func (node *TriggerNode) Init() error {
+	node.eventStream = make(chan connector.StateChangeEvent, 10)
+	node.ConnectorRegistry().SubscribeToStateChanges(node.subscriberId, node.eventStream)
+	return nil
+}
+
+func (node *TriggerNode) Cleanup() error {
+	if node.ConnectorRegistry() != nil {
+		node.ConnectorRegistry().UnsubscribeFromStateChanges(node.subscriberId)
+	}
+	return nil
+}
+
+func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
+	node.SetReactorRunning(true)
+	defer func() {
+		node.SetReactorRunning(false)
+		node.GetLog().Debug("WaitForEvent has quit. ")
+	}()
+	for {
+		select {
+		case event := <-node.eventStream:
+			if !node.IsEventMatching(event) {
+				continue
+			}
+			node.IncReceivedMsgCounter()
+			node.FlowRunner()(model.ReactorEvent{Msg: ConvertEvent(event), TransitionNodeId: node.Meta().SuccessTransition})
+		case signal := <-node.FlowOpCtx().TriggerControlSignalChannel:
+			node.GetLog().Debug("Control signal ")
+			if signal == model.SIGNAL_STOP {
+				node.GetLog().Info("Trigger stopped by SIGNAL_STOP ")
+				return
+			}
+		}
+	}
+}
+
+// IsEventMatching returns true if event matches connector and states configured in the node
+func (node *TriggerNode) IsEventMatching(event connector.StateChangeEvent) bool {
+	if node.config.ConnectorID != "" && node.config.ConnectorID != event.ID {
+		return false
+	}
+	if len(node.config.States) == 0 {
+		return true
+	}
+	for _, state := range node.config.States {
+		if state == event.State {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertEvent converts connector state change event into flow message
+func ConvertEvent(event connector.StateChangeEvent) model.Message {
+	props := fimpgo.Props{
+		"connector_id":       event.ID,
+		"connector_name":     event.Name,
+		"plugin":             event.Plugin,
+		"prev_state":         event.PreviousState,
+		"reconnect_attempts": strconv.Itoa(event.ReconnectAttempts),
+	}
+	payload := fimpgo.NewStringMessage("evt.connector.state_report", "tpflow", event.State, props, nil, nil)
+	return model.Message{AddressStr: "connector/" + event.ID, Payload: *payload}
+}
+
+func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return nil, nil
+}
+
+func (node *TriggerNode) ValidateConfig() []model.ValidationError {
+	conf := TriggerConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	for i, state := range conf.States {
+		switch state {
+		case "RUNNING", "CONNECTION_LOST", "INIT_FAILED", "STOPPED":
+		default:
+			result = append(result, node.NewValidationError("Config.States", "unknown state %s at position %d", state, i))
+		}
+	}
+	return result
+}
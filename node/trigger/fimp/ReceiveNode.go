@@ -182,25 +182,14 @@ func (node *ReceiveNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 		select {
 		case newMsg := <-node.msgInStream:
 			node.GetLog().Debug("New message :")
-			if !node.config.IsValueFilterEnabled {
-					rMsg := model.Message{AddressStr: newMsg.Topic, Address: *newMsg.Addr, Payload: *newMsg.Payload}
-					newEvent := model.ReactorEvent{Msg: rMsg, TransitionNodeId: node.Meta().SuccessTransition}
-					select {
-					case nodeEventStream <- newEvent:
-						return
-					default:
-						node.GetLog().Debug("Message is dropped (no listeners) ")
-					}
-
-			} else if newMsg.Payload.Value == node.config.ValueFilter.Value {
-					rMsg := model.Message{AddressStr: newMsg.Topic, Address: *newMsg.Addr, Payload: *newMsg.Payload}
-					newEvent := model.ReactorEvent{Msg: rMsg, TransitionNodeId: node.Meta().SuccessTransition}
-					select {
-					case nodeEventStream <- newEvent:
-						return
-					default:
-						node.GetLog().Debug("Message is dropped (no listeners) ")
-					}
+			if rMsg, ok := node.acceptMessage(newMsg); ok {
+				newEvent := model.ReactorEvent{Msg: rMsg, TransitionNodeId: node.Meta().SuccessTransition}
+				select {
+				case nodeEventStream <- newEvent:
+					return
+				default:
+					node.GetLog().Debug("Message is dropped (no listeners) ")
+				}
 			}
 			//if node.config.Timeout > 0 {
 			//	elapsed := time.Since(start)
@@ -228,6 +217,64 @@ func (node *ReceiveNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 	}
 }
 
+// acceptMessage applies value filter and converts fimp message into flow message . Returns false if message is filtered out.
+func (node *ReceiveNode) acceptMessage(newMsg *fimpgo.Message) (model.Message, bool) {
+	if node.config.IsValueFilterEnabled && newMsg.Payload.Value != node.config.ValueFilter.Value {
+		return model.Message{}, false
+	}
+	return model.Message{AddressStr: newMsg.Topic, Address: *newMsg.Addr, Payload: *newMsg.Payload}, true
+}
+
 func (node *ReceiveNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	return nil, nil
 }
+
+func (node *ReceiveNode) ValidateConfig() []model.ValidationError {
+	conf := ReceiveConfig{}
+	return append(node.ValidateConfigDecoding(&conf), node.ValidateFimpAddress()...)
+}
+
+func (node *ReceiveNode) GetWaitTime() time.Duration {
+	return time.Second * time.Duration(node.config.Timeout)
+}
+
+// ResumeWait continues via TimeoutTransition if timeout expired while the instance wasn't running , otherwise the node
+// waits for a message only for the remaining time , so restarts don't extend the deadline.
+func (node *ReceiveNode) ResumeWait(msg *model.Message, waitUntil time.Time) ([]model.NodeID, error) {
+	var timeoutCh <-chan time.Time
+	if !waitUntil.IsZero() {
+		remaining := time.Until(waitUntil)
+		node.GetLog().Info(" Resuming receive , remaining = ", remaining)
+		if remaining <= 0 {
+			return []model.NodeID{node.Meta().TimeoutTransition}, nil
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	for {
+		select {
+		case newMsg := <-node.msgInStream:
+			rMsg, ok := node.acceptMessage(newMsg)
+			if !ok {
+				continue
+			}
+			rMsg.KeepInstanceScope(msg)
+			*msg = rMsg
+			return []model.NodeID{node.Meta().SuccessTransition}, nil
+		case <-timeoutCh:
+			node.GetLog().Debug(" Timeout ")
+			return []model.NodeID{node.Meta().TimeoutTransition}, nil
+		case signal := <-node.FlowOpCtx().TriggerControlSignalChannel:
+			if signal == model.SIGNAL_STOP {
+				return nil, nil
+			}
+		case signal := <-node.FlowOpCtx().NodeControlSignalChannel:
+			if signal == model.SIGNAL_STOP || signal == model.SIGNAL_TERMINATE_WAITING {
+				return nil, nil
+			}
+		case <-msg.Done:
+			return nil, nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package fimp
+
+import (
+	"github.com/futurehomeno/fimpgo"
+	"github.com/thingsplex/tpflow/model"
+	"testing"
+	"time"
+)
+
+func newTestReceiveNode() *ReceiveNode {
+	opCtx := &model.FlowOperationalContext{FlowId: "test", TriggerControlSignalChannel: make(chan int), NodeControlSignalChannel: make(chan int)}
+	meta := model.MetaNode{Id: "2", Type: "receive", SuccessTransition: "3", TimeoutTransition: "4"}
+	node := NewReceiveNode(opCtx, meta, nil).(*ReceiveNode)
+	node.config = ReceiveConfig{Timeout: 60}
+	node.msgInStream = make(fimpgo.MessageCh, 1)
+	return node
+}
+
+func TestReceiveNode_ResumeWait(t *testing.T) {
+	node := newTestReceiveNode()
+	msg := model.Message{Vars: map[string]model.Variable{"a": {ValueType: "int", Value: int64(1)}}}
+	if next, _ := node.ResumeWait(&msg, time.Now().Add(-time.Second)); next[0] != "4" {
+		t.Error("Expired wait must continue via timeout transition")
+	}
+	startedAt := time.Now()
+	if next, _ := node.ResumeWait(&msg, time.Now().Add(100*time.Millisecond)); next[0] != "4" || time.Since(startedAt) > time.Second {
+		t.Error("Node must wait only remaining time , not full timeout")
+	}
+	node.msgInStream <- &fimpgo.Message{Topic: "pt:j1/mt:evt/rt:dev/rn:test/ad:1/sv:out_bin_switch/ad:1", Addr: &fimpgo.Address{},
+		Payload: fimpgo.NewBoolMessage("evt.binary.report", "out_bin_switch", true, nil, nil, nil)}
+	next, _ := node.ResumeWait(&msg, time.Now().Add(time.Second))
+	if next[0] != "3" || msg.Payload.Value != true || msg.Vars["a"].Value != int64(1) {
+		t.Error("Received message must be passed to success transition ", msg)
+	}
+
+	// Value filter is applied as in WaitForEvent
+	node.config.IsValueFilterEnabled = true
+	node.config.ValueFilter = model.Variable{ValueType: "bool", Value: false}
+	node.msgInStream <- &fimpgo.Message{Topic: "pt:j1/mt:evt/rt:dev/rn:test/ad:1/sv:out_bin_switch/ad:1", Addr: &fimpgo.Address{},
+		Payload: fimpgo.NewBoolMessage("evt.binary.report", "out_bin_switch", true, nil, nil, nil)}
+	if next, _ := node.ResumeWait(&msg, time.Now().Add(100*time.Millisecond)); next[0] != "4" {
+		t.Error("Filtered message must be skipped")
+	}
+}
@@ -211,6 +211,7 @@ func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 		select {
 		case newMsg := <-node.msgInStream:
 			node.GetLog().Debug("--New message--")
+			node.IncReceivedMsgCounter()
 			if node.config.ValueJPath != "" {
 				rMsg := model.Message{RawPayload:newMsg.Payload.ValueObj }
 				newVal , err := model.GetValueByPath(&rMsg,"jpath", node.config.ValueJPath, node.config.ValueJPathResultType)
@@ -265,3 +266,8 @@ func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
 	return nil, nil
 }
+
+func (node *TriggerNode) ValidateConfig() []model.ValidationError {
+	conf := TriggerConfig{}
+	return append(node.ValidateConfigDecoding(&conf), node.ValidateFimpAddress()...)
+}
@@ -109,6 +109,7 @@ func (node *VincTriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEven
 		}
 		select {
 		case newMsg := <-node.msgInStream:
+			node.IncReceivedMsgCounter()
 			var eventValue string
 			if newMsg.Payload.Type == "cmd.pd7.request" {
 				request := primefimp.Request{}
@@ -250,3 +251,8 @@ pt:j1/mt:evt/rt:app/rn:vinculum/ad:1
   "ver": "1"
 }
  */
+
+func (node *VincTriggerNode) ValidateConfig() []model.ValidationError {
+	conf := VincTriggerConfig{}
+	return node.ValidateConfigDecoding(&conf)
+}
@@ -0,0 +1,239 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/mitchellh/mapstructure"
+	mqttconn "github.com/thingsplex/tpflow/connector/plugins/mqtt"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"strings"
+)
+
+const (
+	PayloadFormatAuto   = "auto"   // JSON if payload can be parsed , otherwise string
+	PayloadFormatJson   = "json"   // messages which are not valid JSON are dropped
+	PayloadFormatString = "string" // payload is used as string value
+)
+
+// TriggerNode starts flow on messages from generic MQTT connector . Message value is extracted from raw payload ,
+// topic segments defined as {name} in topic pattern are stored in flow variables and message properties.
+type TriggerNode struct {
+	base.BaseNode
+	ctx          *model.Context
+	conn         *mqttconn.Connector
+	config       TriggerConfig
+	topicFilter  string
+	segmentNames map[int]string
+	msgInStream  chan mqttconn.Message
+	subscriberId string
+}
+
+type TriggerConfig struct {
+	ConnectorID          string // Instance of mqtt connector
+	Topic                string // Topic pattern , supports + and # wildcards . Segment {name} matches single level and is captured into variable
+	Qos                  int
+	PayloadFormat        string // auto (default) , json , string
+	ValueJPath           string // JPath path which is used to extract value from JSON payload , empty - whole payload is used
+	ValueJPathResultType string // Type of extracted variable , default - string
+	IsVariableGlobal     bool   // true - captured topic segments are stored as global variables
+}
+
+func NewTriggerNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := TriggerNode{ctx: ctx}
+	node.SetStartNode(true)
+	node.SetMsgReactorNode(true)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetMeta(meta)
+	node.config = TriggerConfig{}
+	node.subscriberId = node.FlowOpCtx().FlowId + "_" + string(node.GetMetaNode().Id)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *TriggerNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Error while decoding node configs.Err:", err)
+		return err
+	}
+	if node.config.PayloadFormat == "" {
+		node.config.PayloadFormat = PayloadFormatAuto
+	}
+	if node.config.ValueJPathResultType == "" {
+		node.config.ValueJPathResultType = "string"
+	}
+	node.topicFilter, node.segmentNames = ParseTopicPattern(node.config.Topic)
+
+	connInstance := node.ConnectorRegistry().GetInstance(node.config.ConnectorID)
+	if connInstance == nil {
+		node.GetLog().Error("Connector registry doesn't have mqtt instance ", node.config.ConnectorID)
+		return errors.New("can't find mqtt connector")
+	}
+	var ok bool
+	node.conn, ok = connInstance.Connection.GetConnection().(*mqttconn.Connector)
+	if !ok {
+		node.GetLog().Error("can't cast connection to mqtt connector")
+		return errors.New("can't cast connection to mqtt connector")
+	}
+	return nil
+}
+
+func (node *TriggerNode) Init() error {
+	node.msgInStream = make(chan mqttconn.Message, 10)
+	node.GetLog().Info("Subscribing for topic :", node.topicFilter)
+	if err := node.conn.Subscribe(node.subscriberId, node.topicFilter, byte(node.config.Qos), node.msgInStream); err != nil {
+		node.GetLog().Error("Can't subscribe . Err:", err)
+		return err
+	}
+	return nil
+}
+
+func (node *TriggerNode) Cleanup() error {
+	if node.conn != nil {
+		node.conn.Unsubscribe(node.subscriberId)
+	}
+	return nil
+}
+
+func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
+	node.SetReactorRunning(true)
+	defer func() {
+		node.SetReactorRunning(false)
+		node.GetLog().Debug("WaitForEvent has quit. ")
+	}()
+	for {
+		select {
+		case mqttMsg := <-node.msgInStream:
+			node.IncReceivedMsgCounter()
+			rMsg, err := node.ConvertMessage(mqttMsg)
+			if err != nil {
+				node.GetLog().Debug("Message is skipped . Err:", err)
+				continue
+			}
+			node.storeSegmentVariables(rMsg.Payload.Properties)
+			// Flow is executed within flow runner goroutine
+			node.FlowRunner()(model.ReactorEvent{Msg: rMsg, TransitionNodeId: node.Meta().SuccessTransition})
+		case signal := <-node.FlowOpCtx().TriggerControlSignalChannel:
+			node.GetLog().Debug("Control signal ")
+			if signal == model.SIGNAL_STOP {
+				node.GetLog().Info("Trigger stopped by SIGNAL_STOP ")
+				return
+			}
+		}
+	}
+}
+
+// ConvertMessage converts raw MQTT message into flow message . Topic is stored in AddressStr and raw payload in RawPayload.
+func (node *TriggerNode) ConvertMessage(mqttMsg mqttconn.Message) (model.Message, error) {
+	rMsg := model.Message{AddressStr: mqttMsg.Topic, RawPayload: mqttMsg.Payload}
+	var value interface{}
+	valueType := "string"
+	switch node.config.PayloadFormat {
+	case PayloadFormatString:
+		value = string(mqttMsg.Payload)
+	default:
+		if err := json.Unmarshal(mqttMsg.Payload, &value); err != nil {
+			if node.config.PayloadFormat == PayloadFormatJson {
+				return rMsg, fmt.Errorf("payload is not valid JSON : %s", err)
+			}
+			value = string(mqttMsg.Payload)
+			break
+		}
+		if node.config.ValueJPath != "" {
+			var err error
+			value, err = model.GetValueByPath(&rMsg, "jpath", node.config.ValueJPath, node.config.ValueJPathResultType)
+			if err != nil {
+				return rMsg, fmt.Errorf("can't extract value using JPath : %s", err)
+			}
+			valueType = node.config.ValueJPathResultType
+			break
+		}
+		valueType = jsonValueType(value)
+	}
+	props := fimpgo.Props{}
+	for name, segment := range node.CaptureTopicSegments(mqttMsg.Topic) {
+		props[name] = segment
+	}
+	rMsg.Payload = *fimpgo.NewMessage("evt.mqtt.message", "mqtt", valueType, value, props, nil, nil)
+	return rMsg, nil
+}
+
+func (node *TriggerNode) storeSegmentVariables(segments fimpgo.Props) {
+	flowId := node.FlowOpCtx().FlowId
+	if node.config.IsVariableGlobal {
+		flowId = "global"
+	}
+	for _, varName := range node.segmentNames {
+		node.ctx.SetVariable(varName, "string", segments[varName], "", flowId, true)
+	}
+}
+
+// CaptureTopicSegments returns values of named topic segments
+func (node *TriggerNode) CaptureTopicSegments(topic string) map[string]string {
+	result := map[string]string{}
+	segments := strings.Split(topic, "/")
+	for i, name := range node.segmentNames {
+		if i < len(segments) {
+			result[name] = segments[i]
+		}
+	}
+	return result
+}
+
+// ParseTopicPattern converts topic pattern with named segments ({name}) into MQTT topic filter and returns segment names
+// by segment position.
+func ParseTopicPattern(pattern string) (string, map[int]string) {
+	segments := strings.Split(pattern, "/")
+	names := map[int]string{}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && len(segment) > 2 {
+			names[i] = segment[1 : len(segment)-1]
+			segments[i] = "+"
+		}
+	}
+	return strings.Join(segments, "/"), names
+}
+
+func jsonValueType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	}
+	return "object"
+}
+
+func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return nil, nil
+}
+
+func (node *TriggerNode) ValidateConfig() []model.ValidationError {
+	conf := TriggerConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.ConnectorID == "" {
+		result = append(result, node.NewValidationError("Config.ConnectorID", "connector is not set"))
+	}
+	if conf.Topic == "" {
+		result = append(result, node.NewValidationError("Config.Topic", "topic is not set"))
+	}
+	if conf.Qos < 0 || conf.Qos > 2 {
+		result = append(result, node.NewValidationError("Config.Qos", "qos must be 0 , 1 or 2"))
+	}
+	switch conf.PayloadFormat {
+	case "", PayloadFormatAuto, PayloadFormatJson, PayloadFormatString:
+	default:
+		result = append(result, node.NewValidationError("Config.PayloadFormat", "unknown payload format %s", conf.PayloadFormat))
+	}
+	return result
+}
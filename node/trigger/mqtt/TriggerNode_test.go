@@ -0,0 +1,58 @@
+package mqtt
+
+import (
+	"github.com/thingsplex/tpflow/connector"
+	mqttconn "github.com/thingsplex/tpflow/connector/plugins/mqtt"
+	"github.com/thingsplex/tpflow/model"
+	"testing"
+)
+
+func TestParseTopicPattern(t *testing.T) {
+	filter, names := ParseTopicPattern("zigbee2mqtt/{device}/{attr}/#")
+	if filter != "zigbee2mqtt/+/+/#" || names[1] != "device" || names[2] != "attr" || len(names) != 2 {
+		t.Error("Wrong filter ", filter, names)
+	}
+}
+
+func TestTriggerNode_ConvertMessage(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        TriggerConfig
+		payload       string
+		expectedType  string
+		expectedValue interface{}
+		isSkipped     bool
+	}{
+		{"json_object", TriggerConfig{}, `{"temperature":21.5,"state":"ON"}`, "object", nil, false},
+		{"json_number", TriggerConfig{}, `21.5`, "float", 21.5, false},
+		{"plain_string", TriggerConfig{}, `ON`, "string", "ON", false},
+		{"string_format", TriggerConfig{PayloadFormat: "string"}, `{"state":"ON"}`, "string", `{"state":"ON"}`, false},
+		{"jpath", TriggerConfig{ValueJPath: "$.temperature", ValueJPathResultType: "float"}, `{"temperature":21.5}`, "float", 21.5, false},
+		{"json_only", TriggerConfig{PayloadFormat: "json"}, `ON`, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Topic = "zigbee2mqtt/{device}"
+			node := NewTriggerNode(&model.FlowOperationalContext{FlowId: "MqttTest"}, model.MetaNode{Id: "1", Type: "mqtt_trigger", Config: tt.config}, nil).(*TriggerNode)
+			// connector isn't available in tests , only configuration part is loaded
+			node.SetConnectorRegistry(connector.NewRegistry(""))
+			node.LoadNodeConfig()
+			msg, err := node.ConvertMessage(mqttconn.Message{Topic: "zigbee2mqtt/kitchen_sensor", Payload: []byte(tt.payload)})
+			if tt.isSkipped {
+				if err == nil {
+					t.Error("Message must be skipped")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Payload.ValueType != tt.expectedType || (tt.expectedValue != nil && msg.Payload.Value != tt.expectedValue) {
+				t.Errorf("Wrong value %s %v", msg.Payload.ValueType, msg.Payload.Value)
+			}
+			if msg.Payload.Properties["device"] != "kitchen_sensor" || msg.AddressStr != "zigbee2mqtt/kitchen_sensor" {
+				t.Error("Topic segment wasn't captured ", msg.Payload.Properties)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package time
 
 import (
+	"fmt"
 	"github.com/futurehomeno/fimpgo"
 	"github.com/thingsplex/tpflow/model"
 	"github.com/thingsplex/tpflow/node/base"
@@ -228,3 +229,14 @@ func (node *Node) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
 	}
 
 }
+
+func (node *Node) ValidateConfig() []model.ValidationError {
+	conf := NodeConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	for i := range conf.Expressions {
+		if _, err := cron.ParseStandard(conf.Expressions[i].Expression); err != nil {
+			result = append(result, node.NewValidationError(fmt.Sprintf("Config.Expressions[%d]", i), "invalid cron expression : %s", err))
+		}
+	}
+	return result
+}
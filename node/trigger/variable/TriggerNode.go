@@ -0,0 +1,175 @@
+package variable
+
+import (
+	"fmt"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/mitchellh/mapstructure"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"path"
+)
+
+const (
+	ChangeAny         = "any"          // any change of value
+	ChangeTo          = "changed_to"   // new value is equal to Value and old value isn't
+	ChangeFrom        = "changed_from" // old value is equal to Value and new value isn't
+	ChangeExpired     = "expired"      // variable was deleted because its TTL expired
+	eventStreamBuffer = 20
+)
+
+// TriggerNode starts flow when context variable is changed by other flow , API or node of the same flow.
+// Message value is new value of the variable , old value and variable details are stored in message properties.
+type TriggerNode struct {
+	base.BaseNode
+	ctx          *model.Context
+	config       TriggerConfig
+	eventStream  chan model.ContextChangeEvent
+	subscriberId string
+}
+
+type TriggerConfig struct {
+	VariableName    string         // Variable name or pattern , for instance house_mode or temp_* (path.Match syntax)
+	FlowId          string         // Flow which owns the variable , global - global variables , empty - flow of the node
+	ChangeType      string         // any (default) , changed_to , changed_from , expired
+	Value           model.Variable // Value used by changed_to and changed_from filters
+	TriggerOnUpdate bool           // true - flow is triggered on every write , even if value wasn't changed
+}
+
+func NewTriggerNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := TriggerNode{ctx: ctx}
+	node.SetStartNode(true)
+	node.SetMsgReactorNode(true)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetMeta(meta)
+	node.config = TriggerConfig{}
+	node.subscriberId = node.FlowOpCtx().FlowId + "_" + string(node.GetMetaNode().Id)
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *TriggerNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Error while decoding node configs.Err:", err)
+		return err
+	}
+	if node.config.FlowId == "" {
+		node.config.FlowId = node.FlowOpCtx().FlowId
+	}
+	if node.config.ChangeType == "" {
+		node.config.ChangeType = ChangeAny
+	}
+	return nil
+}
+
+func (node *TriggerNode) Init() error {
+	node.eventStream = make(chan model.ContextChangeEvent, eventStreamBuffer)
+	node.ctx.SubscribeToChanges(node.subscriberId, node.eventStream)
+	return nil
+}
+
+func (node *TriggerNode) Cleanup() error {
+	if node.ctx != nil {
+		node.ctx.UnsubscribeFromChanges(node.subscriberId)
+	}
+	return nil
+}
+
+func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
+	node.SetReactorRunning(true)
+	defer func() {
+		node.SetReactorRunning(false)
+		node.GetLog().Debug("WaitForEvent has quit. ")
+	}()
+	for {
+		select {
+		case event := <-node.eventStream:
+			if !node.IsEventMatching(event) {
+				continue
+			}
+			node.IncReceivedMsgCounter()
+			node.FlowRunner()(model.ReactorEvent{Msg: ConvertEvent(event), TransitionNodeId: node.Meta().SuccessTransition})
+		case signal := <-node.FlowOpCtx().TriggerControlSignalChannel:
+			node.GetLog().Debug("Control signal ")
+			if signal == model.SIGNAL_STOP {
+				node.GetLog().Info("Trigger stopped by SIGNAL_STOP ")
+				return
+			}
+		}
+	}
+}
+
+// IsEventMatching returns true if event matches variable name , flow and change filter configured in the node
+func (node *TriggerNode) IsEventMatching(event model.ContextChangeEvent) bool {
+	if event.FlowId != node.config.FlowId {
+		return false
+	}
+	if isMatching, _ := path.Match(node.config.VariableName, event.Name); !isMatching {
+		return false
+	}
+	if !node.config.TriggerOnUpdate && !event.IsValueChanged() {
+		return false
+	}
+	switch node.config.ChangeType {
+	case ChangeExpired:
+		return event.IsExpired
+	case ChangeTo:
+		return node.isEqualToConfigValue(event.NewValue) && !node.isEqualToConfigValue(event.OldValue)
+	case ChangeFrom:
+		return node.isEqualToConfigValue(event.OldValue) && !node.isEqualToConfigValue(event.NewValue)
+	}
+	return true
+}
+
+func (node *TriggerNode) isEqualToConfigValue(value *model.Variable) bool {
+	if value == nil {
+		return false
+	}
+	isEqual, err := model.CompareVariables(model.OperandEq, *value, node.config.Value, model.Variable{})
+	return err == nil && isEqual
+}
+
+// ConvertEvent converts variable change event into flow message
+func ConvertEvent(event model.ContextChangeEvent) model.Message {
+	props := fimpgo.Props{"var_name": event.Name, "flow_id": event.FlowId}
+	if event.OldValue != nil {
+		props["old_value"] = fmt.Sprintf("%v", event.OldValue.Value)
+		props["old_value_type"] = event.OldValue.ValueType
+	}
+	if event.IsExpired {
+		props["expired"] = "true"
+	}
+	valueType, value := "null", interface{}(nil)
+	if event.NewValue != nil {
+		valueType, value = event.NewValue.ValueType, event.NewValue.Value
+	}
+	payload := fimpgo.NewMessage("evt.variable.change_report", "tpflow", valueType, value, props, nil, nil)
+	return model.Message{AddressStr: "variable/" + event.FlowId + "/" + event.Name, Payload: *payload}
+}
+
+func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return nil, nil
+}
+
+func (node *TriggerNode) ValidateConfig() []model.ValidationError {
+	conf := TriggerConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if conf.VariableName == "" {
+		result = append(result, node.NewValidationError("Config.VariableName", "variable name is not set"))
+	} else if _, err := path.Match(conf.VariableName, ""); err != nil {
+		result = append(result, node.NewValidationError("Config.VariableName", "invalid pattern : %s", err))
+	}
+	switch conf.ChangeType {
+	case "", ChangeAny, ChangeExpired:
+	case ChangeTo, ChangeFrom:
+		if conf.Value.ValueType == "" {
+			result = append(result, node.NewValidationError("Config.Value", "value is required by %s filter", conf.ChangeType))
+		}
+	default:
+		result = append(result, node.NewValidationError("Config.ChangeType", "unknown change type %s", conf.ChangeType))
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package variable
+
+import (
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"testing"
+	"time"
+)
+
+func newVarTrigger(t *testing.T, ctx *model.Context, config TriggerConfig) *TriggerNode {
+	meta := model.MetaNode{Id: "1", Type: "var_trigger", Label: "Mode changed", Config: config, SuccessTransition: "2"}
+	flowOpCtx := &model.FlowOperationalContext{FlowId: "VarTriggerTest", TriggerControlSignalChannel: make(chan int)}
+	node, err := base.NewConfiguredNode(NewTriggerNode, flowOpCtx, meta, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.(*TriggerNode)
+}
+
+func str(value string) *model.Variable {
+	return &model.Variable{ValueType: "string", Value: value}
+}
+
+func TestTriggerNode_IsEventMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   TriggerConfig
+		event    model.ContextChangeEvent
+		expected bool
+	}{
+		{"any", TriggerConfig{VariableName: "house_mode", FlowId: "global"}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("home"), NewValue: str("away")}, true},
+		{"unchanged", TriggerConfig{VariableName: "house_mode", FlowId: "global"}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("home"), NewValue: str("home")}, false},
+		{"on_update", TriggerConfig{VariableName: "house_mode", FlowId: "global", TriggerOnUpdate: true}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("home"), NewValue: str("home")}, true},
+		{"other_flow", TriggerConfig{VariableName: "house_mode"}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", NewValue: str("away")}, false},
+		{"own_flow", TriggerConfig{VariableName: "house_mode"}, model.ContextChangeEvent{FlowId: "VarTriggerTest", Name: "house_mode", NewValue: str("away")}, true},
+		{"pattern", TriggerConfig{VariableName: "temp_*", FlowId: "global"}, model.ContextChangeEvent{FlowId: "global", Name: "temp_kitchen", NewValue: &model.Variable{ValueType: "float", Value: 21.5}}, true},
+		{"pattern_mismatch", TriggerConfig{VariableName: "temp_*", FlowId: "global"}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", NewValue: str("away")}, false},
+		{"changed_to", TriggerConfig{VariableName: "house_mode", FlowId: "global", ChangeType: ChangeTo, Value: *str("away")}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("home"), NewValue: str("away")}, true},
+		{"changed_to_other", TriggerConfig{VariableName: "house_mode", FlowId: "global", ChangeType: ChangeTo, Value: *str("away")}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("away"), NewValue: str("sleep")}, false},
+		{"changed_from", TriggerConfig{VariableName: "house_mode", FlowId: "global", ChangeType: ChangeFrom, Value: *str("away")}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("away"), NewValue: str("home")}, true},
+		{"deleted", TriggerConfig{VariableName: "house_mode", FlowId: "global", ChangeType: ChangeFrom, Value: *str("away")}, model.ContextChangeEvent{FlowId: "global", Name: "house_mode", OldValue: str("away")}, true},
+		{"expired", TriggerConfig{VariableName: "presence", FlowId: "global", ChangeType: ChangeExpired}, model.ContextChangeEvent{FlowId: "global", Name: "presence", OldValue: str("home"), IsExpired: true}, true},
+		{"deleted_not_expired", TriggerConfig{VariableName: "presence", FlowId: "global", ChangeType: ChangeExpired}, model.ContextChangeEvent{FlowId: "global", Name: "presence", OldValue: str("home")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newVarTrigger(t, nil, tt.config)
+			if node.IsEventMatching(tt.event) != tt.expected {
+				t.Error("Wrong result")
+			}
+		})
+	}
+}
+
+func TestTriggerNode_StartsFlow(t *testing.T) {
+	ctx := model.NewInMemoryContext()
+	defer ctx.Close()
+	node := newVarTrigger(t, ctx, TriggerConfig{VariableName: "house_mode", FlowId: "global", ChangeType: ChangeTo, Value: *str("away")})
+	reactorEvents := make(chan model.ReactorEvent, 10)
+	node.SetFlowRunner(func(event model.ReactorEvent) { reactorEvents <- event })
+	node.Init()
+	go node.WaitForEvent(nil)
+	defer func() {
+		node.FlowOpCtx().TriggerControlSignalChannel <- model.SIGNAL_STOP
+		node.Cleanup()
+	}()
+
+	ctx.SetVariable("house_mode", "string", "home", "", "global", false)
+	ctx.SetVariable("house_mode", "string", "away", "", "global", false)
+	select {
+	case event := <-reactorEvents:
+		msg := event.Msg
+		if msg.Payload.Value != "away" || msg.Payload.Properties["old_value"] != "home" || msg.Payload.Properties["var_name"] != "house_mode" {
+			t.Error("Wrong message ", msg.Payload)
+		}
+		if event.TransitionNodeId != "2" {
+			t.Error("Wrong transition ", event.TransitionNodeId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flow wasn't triggered")
+	}
+	select {
+	case <-reactorEvents:
+		t.Error("Flow must be triggered only once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,168 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/futurehomeno/fimpgo"
+	"github.com/mitchellh/mapstructure"
+	webhookconn "github.com/thingsplex/tpflow/connector/plugins/webhook"
+	"github.com/thingsplex/tpflow/model"
+	"github.com/thingsplex/tpflow/node/base"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultConnectorID = "webhook"
+	// RequestIdHeader - message header with id of HTTP request waiting for webhook_response node
+	RequestIdHeader = "webhook_request_id"
+)
+
+// TriggerNode starts flow on HTTP request to registered path . Method , headers , query and body are stored in message value.
+type TriggerNode struct {
+	base.BaseNode
+	ctx         *model.Context
+	conn        *webhookconn.Connector
+	config      TriggerConfig
+	path        string
+	msgInStream chan *webhookconn.Request
+}
+
+type TriggerConfig struct {
+	ConnectorID     string   // Instance of webhook connector , default - webhook
+	Path            string   // URL path , for instance /doorbell
+	Methods         []string // Allowed HTTP methods , empty - any method
+	Token           string   // Secret token , empty - token is not checked
+	WaitForResponse bool     // true - HTTP request is held open until webhook_response node responds
+	ResponseTimeout int      // Time in milliseconds the request is held open , default - 10000
+}
+
+func NewTriggerNode(flowOpCtx *model.FlowOperationalContext, meta model.MetaNode, ctx *model.Context) model.Node {
+	node := TriggerNode{ctx: ctx}
+	node.SetStartNode(true)
+	node.SetMsgReactorNode(true)
+	node.SetFlowOpCtx(flowOpCtx)
+	node.SetMeta(meta)
+	node.config = TriggerConfig{}
+	node.SetupBaseNode()
+	return &node
+}
+
+func (node *TriggerNode) LoadNodeConfig() error {
+	err := mapstructure.Decode(node.Meta().Config, &node.config)
+	if err != nil {
+		node.GetLog().Error("Error while decoding node configs.Err:", err)
+		return err
+	}
+	if node.config.ConnectorID == "" {
+		node.config.ConnectorID = DefaultConnectorID
+	}
+	if node.config.ResponseTimeout == 0 {
+		node.config.ResponseTimeout = 10000
+	}
+	node.path = node.config.Path
+	if !strings.HasPrefix(node.path, "/") {
+		node.path = "/" + node.path
+	}
+	connInstance := node.ConnectorRegistry().GetInstance(node.config.ConnectorID)
+	if connInstance == nil {
+		node.GetLog().Error("Connector registry doesn't have webhook instance ", node.config.ConnectorID)
+		return errors.New("can't find webhook connector")
+	}
+	var ok bool
+	node.conn, ok = connInstance.Connection.GetConnection().(*webhookconn.Connector)
+	if !ok {
+		node.GetLog().Error("can't cast connection to webhook connector")
+		return errors.New("can't cast connection to webhook connector")
+	}
+	return nil
+}
+
+func (node *TriggerNode) Init() error {
+	node.msgInStream = make(chan *webhookconn.Request, 10)
+	node.GetLog().Info("Registering webhook path :", node.path)
+	err := node.conn.RegisterHandler(webhookconn.Handler{
+		Path:            node.path,
+		Methods:         node.config.Methods,
+		Token:           node.config.Token,
+		WaitForResponse: node.config.WaitForResponse,
+		ResponseTimeout: time.Duration(node.config.ResponseTimeout) * time.Millisecond,
+		Ch:              node.msgInStream,
+	})
+	if err != nil {
+		node.GetLog().Error("Can't register webhook . Err:", err)
+	}
+	return err
+}
+
+func (node *TriggerNode) Cleanup() error {
+	if node.conn != nil {
+		node.conn.UnregisterHandler(node.path)
+	}
+	return nil
+}
+
+func (node *TriggerNode) WaitForEvent(nodeEventStream chan model.ReactorEvent) {
+	node.SetReactorRunning(true)
+	defer func() {
+		node.SetReactorRunning(false)
+		node.GetLog().Debug("WaitForEvent has quit. ")
+	}()
+	for {
+		select {
+		case req := <-node.msgInStream:
+			node.IncReceivedMsgCounter()
+			// Flow is executed within flow runner goroutine
+			node.FlowRunner()(model.ReactorEvent{Msg: ConvertRequest(req), TransitionNodeId: node.Meta().SuccessTransition})
+		case signal := <-node.FlowOpCtx().TriggerControlSignalChannel:
+			node.GetLog().Debug("Control signal ")
+			if signal == model.SIGNAL_STOP {
+				node.GetLog().Info("Trigger stopped by SIGNAL_STOP ")
+				return
+			}
+		}
+	}
+}
+
+// ConvertRequest converts HTTP request into flow message . JSON body is decoded , other bodies are stored as string.
+// Id of request waiting for response is stored in message header.
+func ConvertRequest(req *webhookconn.Request) model.Message {
+	var body interface{}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		body = string(req.Body)
+	}
+	value := map[string]interface{}{
+		"method":      req.Method,
+		"path":        req.Path,
+		"headers":     req.Headers,
+		"query":       req.Query,
+		"body":        body,
+		"remote_addr": req.RemoteAddr,
+	}
+	props := fimpgo.Props{"method": req.Method, "path": req.Path}
+	msg := model.Message{AddressStr: req.Path, RawPayload: req.Body}
+	msg.Payload = *fimpgo.NewMessage("evt.webhook.request", "webhook", "object", value, props, nil, nil)
+	if req.WaitForResponse {
+		msg.Header = map[string]string{RequestIdHeader: req.ID}
+	}
+	return msg
+}
+
+func (node *TriggerNode) OnInput(msg *model.Message) ([]model.NodeID, error) {
+	return nil, nil
+}
+
+func (node *TriggerNode) ValidateConfig() []model.ValidationError {
+	conf := TriggerConfig{}
+	result := node.ValidateConfigDecoding(&conf)
+	if result != nil {
+		return result
+	}
+	if strings.Trim(conf.Path, "/") == "" {
+		result = append(result, node.NewValidationError("Config.Path", "path is not set"))
+	}
+	if conf.ResponseTimeout < 0 {
+		result = append(result, node.NewValidationError("Config.ResponseTimeout", "timeout can't be negative"))
+	}
+	return result
+}